@@ -71,16 +71,33 @@ func loadEnums(sb *strings.Builder) *strings.Builder {
 
 func loadModels(sb *strings.Builder) *strings.Builder {
 	models := []interface{}{
+		&model.AWSAccount{},
+		&model.Broadcast{},
+		&model.BroadcastEvent{},
+		&model.BroadcastStat{},
+		&model.BroadcastVariant{},
 		&model.Client{},
+		&model.Contact{},
+		&model.DKIMKey{},
+		&model.DMARCReport{},
+		&model.DMARCReportRecord{},
+		&model.DNSProvider{},
 		&model.Domain{},
 		&model.Email{},
 		&model.Event{},
+		&model.IPPool{},
+		&model.IPPoolAssignment{},
 		&model.Organization{},
+		&model.Segment{},
+		&model.SegmentContact{},
+		&model.Sender{},
 		&model.SNSTopic{},
 		&model.Team{},
 		&model.TeamUser{},
 		&model.Template{},
 		&model.User{},
+		&model.Webhook{},
+		&model.WebhookEvent{},
 		&model.Workspace{},
 	}
 	stmts, err := gormschema.New(constant.DialectPostgres).Load(models...)
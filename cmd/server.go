@@ -82,6 +82,12 @@ func startServer(ctx context.Context) error {
 		logger.Error().Err(err).Msg("Failed to setup SNS topics")
 		return err
 	}
+	app.Service.SNS.StartConsumers(ctx)
+	app.Service.Broadcast.StartListeners(ctx)
+	app.Service.Broadcast.StartScheduler(ctx)
+	app.Service.Webhook.StartListeners(ctx)
+	app.Service.Reputation.StartListeners(ctx)
+	app.Service.Domain.StartReconciler(ctx)
 
 	go func() {
 		// start serving requests
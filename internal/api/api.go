@@ -20,10 +20,11 @@ const (
 const MaxTake = 100
 
 const (
-	QueryParamPage  = "page"
-	QueryParamTake  = "take"
-	QueryParamOrder = "order"
-	QueryParamQ     = "q"
+	QueryParamPage   = "page"
+	QueryParamTake   = "take"
+	QueryParamOrder  = "order"
+	QueryParamQ      = "q"
+	QueryParamCursor = "cursor"
 )
 
 const (
@@ -72,6 +73,16 @@ type Paginated[T interface{}] struct {
 	Meta PaginatedMeta `json:"meta"`
 }
 
+type CursorPaginatedMeta struct {
+	NextCursor  *string `json:"nextCursor"`
+	HasNextPage bool    `json:"hasNextPage"`
+}
+
+type CursorPaginated[T interface{}] struct {
+	Data []*T                `json:"data"`
+	Meta CursorPaginatedMeta `json:"meta"`
+}
+
 func NewAPI(app *core.App) (API, error) {
 	router := chi.NewRouter()
 	authInterceptor := middleware.NewIdentityInterceptor(app.JWT)
@@ -79,9 +90,24 @@ func NewAPI(app *core.App) (API, error) {
 	router.Route("/healthz", NewHealthAPI(app).Route())
 	router.Route("/auth", NewAuthnAPI(app).Route())
 	router.Post(constant.SNSEventPath, snsTopicHandler(app))
+	router.Get(constant.OptInConfirmPath, NewContactAPI(app).ConfirmContact())
+
+	router.Group(func(r chi.Router) {
+		r.Use(authInterceptor.QueryTokenHandler(constant.TokenScopeEventStream))
+		r.Get("/events/stream", NewEventAPI(app).StreamEvents())
+	})
 
 	router.Group(func(r chi.Router) {
 		r.Use(authInterceptor.Handler)
+		r.Group(NewCampaignAPI(app).Route())
+		r.Group(NewContactAPI(app).Route())
+		r.Group(NewEventAPI(app).Route())
+		r.Group(NewWebhookAPI(app).Route())
+		r.Group(NewDNSProviderAPI(app).Route())
+		r.Group(NewDMARCAPI(app).Route())
+		r.Group(NewSenderAPI(app).Route())
+		r.Group(NewSESAPI(app).Route())
+		r.Group(NewIPPoolAPI(app).Route())
 		r.Route("/domains", NewDomainAPI(app).Route())
 		r.Route("/users", NewUserAPI(app).Route())
 		r.Route("/workspaces", NewWorkspaceAPI(app).Route())
@@ -114,6 +140,24 @@ func ToPaginated[T interface{}](data []*T, options *PaginatedOptions, itemCount
 	}
 }
 
+// ToCursorPaginated returns a page of the data, the data has one item more
+// than the page when there is a next page
+func ToCursorPaginated[T interface{}](data []*T, take int, cursor func(*T) string) *CursorPaginated[T] {
+	paginated := &CursorPaginated[T]{
+		Data: data,
+	}
+	if len(data) > take {
+		nextCursor := cursor(data[take-1])
+		paginated.Data = data[:take]
+		paginated.Meta = CursorPaginatedMeta{
+			NextCursor:  &nextCursor,
+			HasNextPage: true,
+		}
+	}
+
+	return paginated
+}
+
 func NewPageOptions(r *http.Request) *PaginatedOptions {
 	options := &PaginatedOptions{
 		Page:  1,
@@ -136,7 +180,7 @@ func NewPageOptions(r *http.Request) *PaginatedOptions {
 	if take != "" {
 		take, err := strconv.Atoi(take)
 		if err == nil {
-			if take <= MaxTake {
+			if take > 0 && take <= MaxTake {
 				options.Take = take
 			}
 		}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog"
+	"github.com/usesend0/send0/internal/config"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/core"
+	"github.com/usesend0/send0/internal/service"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+const testWorkspaceId = "1234"
+
+// newTestApp returns an app over the given services, the services a test
+// doesn't set panic when they're called
+func newTestApp(service *service.Service) *core.App {
+	cnf := &config.Config{Env: constant.EnvDevelopment}
+	logger := zerolog.Nop()
+
+	return &core.App{
+		Config:       cnf,
+		Validate:     validator.New(),
+		Logger:       &logger,
+		Service:      service,
+		UIDGenerator: uid.NewUIDGenerator(cnf, &logger),
+	}
+}
+
+// serve calls the handler with a request of the identity of a user of the
+// test workspace
+func serve(t *testing.T, handler http.HandlerFunc, method string, target string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return serveRequest(t, handler, httptest.NewRequest(method, target, strings.NewReader(body)))
+}
+
+// serveRequest calls the handler with the request as a user of the test
+// workspace
+func serveRequest(t *testing.T, handler http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	workspaceId := testWorkspaceId
+	identity, err := core.NewIdentity(core.IdentityOptions{Sub: "1", WorkspaceId: &workspaceId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = r.WithContext(core.IdentityToContext(context.Background(), identity))
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	return w
+}
+
+func TestNewPageOptionsTake(t *testing.T) {
+	for take, want := range map[string]int{
+		"":    10,
+		"1":   1,
+		"100": MaxTake,
+		"101": 10,
+		"0":   10,
+		"-1":  10,
+		"one": 10,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/events?take="+take, nil)
+		if got := NewPageOptions(r).Take; got != want {
+			t.Fatalf("expected take %q to take %d, got %d", take, want, got)
+		}
+	}
+}
+
+func TestToCursorPaginated(t *testing.T) {
+	items := []*int{new(int), new(int), new(int)}
+	for i, item := range items {
+		*item = i + 1
+	}
+	cursor := func(item *int) string {
+		return strconv.Itoa(*item)
+	}
+
+	// the data has one item more than the page when there is a next page
+	page := ToCursorPaginated(items, 2, cursor)
+	if len(page.Data) != 2 || !page.Meta.HasNextPage || page.Meta.NextCursor == nil || *page.Meta.NextCursor != "2" {
+		t.Fatalf("expected 2 items and the cursor of the last one, got %d items and %+v", len(page.Data), page.Meta)
+	}
+	// a full last page has no next page
+	page = ToCursorPaginated(items, 3, cursor)
+	if len(page.Data) != 3 || page.Meta.HasNextPage || page.Meta.NextCursor != nil {
+		t.Fatalf("expected the last page, got %d items and %+v", len(page.Data), page.Meta)
+	}
+	page = ToCursorPaginated([]*int{}, 3, cursor)
+	if len(page.Data) != 0 || page.Meta.HasNextPage {
+		t.Fatalf("expected an empty last page, got %d items and %+v", len(page.Data), page.Meta)
+	}
+}
@@ -1,12 +1,69 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
 	"github.com/usesend0/send0/internal/core"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/service"
+	"github.com/usesend0/send0/internal/uid"
 )
 
+type broadcastVariantRequestPayload struct {
+	Name       string   `json:"name" validate:"required"`
+	Subject    *string  `json:"subject"`
+	TemplateId *uid.UID `json:"templateId"`
+	FromName   *string  `json:"fromName"`
+}
+
+type createBroadcastRequestPayload struct {
+	Name          string     `json:"name" validate:"required"`
+	From          string     `json:"from" validate:"required"`
+	ReplyTo       *string    `json:"replyTo" validate:"omitempty,email"`
+	TemplateId    uid.UID    `json:"templateId" validate:"required"`
+	SegmentIds    []uid.UID  `json:"segmentIds" validate:"required,min=1"`
+	ScheduledAt   *time.Time `json:"scheduledAt"`
+	SendRate      int        `json:"sendRate" validate:"min=0"`
+	LocalSendTime string     `json:"localSendTime" validate:"omitempty,datetime=15:04"`
+	DelayTimeZone string     `json:"delayTimeZone" validate:"omitempty,timezone"`
+	OpenTracking  bool       `json:"openTracking"`
+	ClickTracking bool       `json:"clickTracking"`
+	CCAddresses   []string   `json:"ccAddresses" validate:"dive,email"`
+	BCCAddresses  []string   `json:"bccAddresses" validate:"dive,email"`
+
+	Variants            []broadcastVariantRequestPayload `json:"variants" validate:"omitempty,min=2,max=5,dive"`
+	TestPercentage      int                              `json:"testPercentage" validate:"min=0,max=99"`
+	TestWindowInMinutes int                              `json:"testWindowInMinutes" validate:"min=0"`
+	WinnerMetric        model.BroadcastWinnerMetric      `json:"winnerMetric" validate:"omitempty,oneof=OPEN_RATE CLICK_RATE"`
+}
+
+type updateBroadcastRequestPayload struct {
+	Name          *string    `json:"name" validate:"omitempty,min=1"`
+	From          *string    `json:"from" validate:"omitempty,min=1"`
+	ReplyTo       *string    `json:"replyTo" validate:"omitempty,email"`
+	TemplateId    *uid.UID   `json:"templateId"`
+	SegmentIds    []uid.UID  `json:"segmentIds" validate:"omitempty,min=1"`
+	ScheduledAt   *time.Time `json:"scheduledAt"`
+	SendRate      *int       `json:"sendRate" validate:"omitempty,min=0"`
+	LocalSendTime *string    `json:"localSendTime" validate:"omitempty,datetime=15:04"`
+	DelayTimeZone *string    `json:"delayTimeZone" validate:"omitempty,timezone"`
+	OpenTracking  *bool      `json:"openTracking"`
+	ClickTracking *bool      `json:"clickTracking"`
+	CCAddresses   []string   `json:"ccAddresses" validate:"omitempty,dive,email"`
+	BCCAddresses  []string   `json:"bccAddresses" validate:"omitempty,dive,email"`
+
+	Variants            []broadcastVariantRequestPayload `json:"variants" validate:"omitempty,max=5,dive"`
+	TestPercentage      *int                             `json:"testPercentage" validate:"omitempty,min=0,max=99"`
+	TestWindowInMinutes *int                             `json:"testWindowInMinutes" validate:"omitempty,min=0"`
+	WinnerMetric        *model.BroadcastWinnerMetric     `json:"winnerMetric" validate:"omitempty,oneof=OPEN_RATE CLICK_RATE"`
+}
+
 type broadcastAPI struct {
 	app *core.App
 }
@@ -23,41 +80,363 @@ func (c *broadcastAPI) Route() func(r chi.Router) {
 		r.Patch("/broadcasts/{broadcastId}", c.UpdateBroadcast())
 		r.Delete("/broadcasts/{broadcastId}", c.DeleteBroadcast())
 		r.Post("/broadcasts/{broadcastId}/start", c.StartBroadcast())
+		r.Post("/broadcasts/{broadcastId}/pause", c.PauseBroadcast())
+		r.Post("/broadcasts/{broadcastId}/resume", c.ResumeBroadcast())
+		r.Post("/broadcasts/{broadcastId}/cancel", c.CancelBroadcast())
 	}
 }
 
 func (c *broadcastAPI) GetBroadcasts() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Get broadcasts
+		identity := core.IdentityFromContext(r.Context())
+		pageOptions := NewPageOptions(r)
+		broadcasts, count, err := c.app.Repository.Broadcast.FindAll(r.Context(), model.BroadcastFindOptions{
+			Status:      model.BroadcastStatus(r.URL.Query().Get("status")),
+			WorkspaceId: identity.WorkspaceId(),
+			Offset:      pageOptions.Skip(),
+			Limit:       pageOptions.Take,
+		})
+		if err != nil {
+			renderError(w, r, &ApiError{
+				Error:      err,
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		render.JSON(w, r, ToPaginated(broadcasts, pageOptions, count))
 	}
 }
 
 func (c *broadcastAPI) CreateBroadcast() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Create campaign
+		identity := core.IdentityFromContext(r.Context())
+		broadcast, err := func() (*model.Broadcast, *ApiError) {
+			payload := new(createBroadcastRequestPayload)
+			err := json.NewDecoder(r.Body).Decode(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			err = c.app.Validate.Struct(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			organizationId, apiErr := identityOrganizationId(c.app, r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			broadcast := &model.Broadcast{
+				Name:           payload.Name,
+				From:           payload.From,
+				ReplyTo:        payload.ReplyTo,
+				TemplateId:     payload.TemplateId,
+				ScheduledAt:    payload.ScheduledAt,
+				SendRate:       payload.SendRate,
+				LocalSendTime:  payload.LocalSendTime,
+				DelayTimeZone:  payload.DelayTimeZone,
+				Segments:       segmentIdsToStrings(payload.SegmentIds),
+				OpenTracking:   payload.OpenTracking,
+				ClickTracking:  payload.ClickTracking,
+				CCAddresses:    payload.CCAddresses,
+				BCCAddresses:   payload.BCCAddresses,
+				OrganizationId: organizationId,
+				WorkspaceId:    identity.WorkspaceId(),
+
+				Variants:            toBroadcastVariants(payload.Variants),
+				TestPercentage:      payload.TestPercentage,
+				TestWindowInMinutes: payload.TestWindowInMinutes,
+				WinnerMetric:        payload.WinnerMetric,
+			}
+			err = c.app.Service.Broadcast.Create(r.Context(), broadcast)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+
+			return broadcast, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success":   true,
+			"broadcast": broadcast,
+		})
 	}
 }
 
 func (c *broadcastAPI) GetBroadcast() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Get campaign
+		var stat *model.BroadcastStat
+		var variantStats []*model.BroadcastStat
+		broadcast, err := func() (*model.Broadcast, *ApiError) {
+			broadcast, apiErr := c.findBroadcast(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			var err error
+			broadcast.Variants, err = c.app.Repository.Broadcast.FindVariants(r.Context(), broadcast.Id)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+			stat, err = c.app.Repository.Broadcast.FindStat(r.Context(), broadcast.Id)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+			variantStats, err = c.app.Repository.Broadcast.FindVariantStats(r.Context(), broadcast.Id)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return broadcast, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success":      true,
+			"broadcast":    broadcast,
+			"stat":         stat,
+			"variantStats": variantStats,
+		})
 	}
 }
 
 func (c *broadcastAPI) UpdateBroadcast() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Update campaign
+		broadcast, err := func() (*model.Broadcast, *ApiError) {
+			broadcast, apiErr := c.findBroadcast(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			payload := new(updateBroadcastRequestPayload)
+			err := json.NewDecoder(r.Body).Decode(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			err = c.app.Validate.Struct(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			if payload.Name != nil {
+				broadcast.Name = *payload.Name
+			}
+			if payload.From != nil {
+				broadcast.From = *payload.From
+			}
+			if payload.ReplyTo != nil {
+				broadcast.ReplyTo = payload.ReplyTo
+			}
+			if payload.TemplateId != nil {
+				broadcast.TemplateId = *payload.TemplateId
+			}
+			if payload.SegmentIds != nil {
+				broadcast.Segments = segmentIdsToStrings(payload.SegmentIds)
+			}
+			if payload.ScheduledAt != nil {
+				broadcast.ScheduledAt = payload.ScheduledAt
+			}
+			if payload.SendRate != nil {
+				broadcast.SendRate = *payload.SendRate
+			}
+			if payload.LocalSendTime != nil {
+				broadcast.LocalSendTime = *payload.LocalSendTime
+			}
+			if payload.DelayTimeZone != nil {
+				broadcast.DelayTimeZone = *payload.DelayTimeZone
+			}
+			if payload.OpenTracking != nil {
+				broadcast.OpenTracking = *payload.OpenTracking
+			}
+			if payload.ClickTracking != nil {
+				broadcast.ClickTracking = *payload.ClickTracking
+			}
+			if payload.CCAddresses != nil {
+				broadcast.CCAddresses = payload.CCAddresses
+			}
+			if payload.BCCAddresses != nil {
+				broadcast.BCCAddresses = payload.BCCAddresses
+			}
+			if payload.Variants != nil {
+				broadcast.Variants = toBroadcastVariants(payload.Variants)
+			}
+			if payload.TestPercentage != nil {
+				broadcast.TestPercentage = *payload.TestPercentage
+			}
+			if payload.TestWindowInMinutes != nil {
+				broadcast.TestWindowInMinutes = *payload.TestWindowInMinutes
+			}
+			if payload.WinnerMetric != nil {
+				broadcast.WinnerMetric = *payload.WinnerMetric
+			}
+			err = c.app.Service.Broadcast.Update(r.Context(), broadcast)
+			if err != nil {
+				return nil, broadcastError(err)
+			}
+
+			return broadcast, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success":   true,
+			"broadcast": broadcast,
+		})
 	}
 }
 
 func (c *broadcastAPI) DeleteBroadcast() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Delete campaign
+		err := func() *ApiError {
+			broadcast, apiErr := c.findBroadcast(r)
+			if apiErr != nil {
+				return apiErr
+			}
+			err := c.app.Service.Broadcast.Delete(r.Context(), broadcast)
+			if err != nil {
+				return broadcastError(err)
+			}
+
+			return nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+		})
 	}
 }
 
 func (c *broadcastAPI) StartBroadcast() http.HandlerFunc {
+	return c.changeBroadcastStatus(c.app.Service.Broadcast.Start)
+}
+
+func (c *broadcastAPI) PauseBroadcast() http.HandlerFunc {
+	return c.changeBroadcastStatus(c.app.Service.Broadcast.Pause)
+}
+
+func (c *broadcastAPI) ResumeBroadcast() http.HandlerFunc {
+	return c.changeBroadcastStatus(c.app.Service.Broadcast.Resume)
+}
+
+func (c *broadcastAPI) CancelBroadcast() http.HandlerFunc {
+	return c.changeBroadcastStatus(c.app.Service.Broadcast.Cancel)
+}
+
+func (c *broadcastAPI) changeBroadcastStatus(
+	fn func(ctx context.Context, broadcast *model.Broadcast) error,
+) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Send campaign
+		broadcast, err := func() (*model.Broadcast, *ApiError) {
+			broadcast, apiErr := c.findBroadcast(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			err := fn(r.Context(), broadcast)
+			if err != nil {
+				return nil, broadcastError(err)
+			}
+
+			return broadcast, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success":   true,
+			"broadcast": broadcast,
+		})
+	}
+}
+
+func (c *broadcastAPI) findBroadcast(r *http.Request) (*model.Broadcast, *ApiError) {
+	identity := core.IdentityFromContext(r.Context())
+	broadcastId, err := uid.NewUIDFromString(chi.URLParam(r, "broadcastId"))
+	if err != nil {
+		return nil, &ApiError{
+			Error:      err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	broadcast, err := c.app.Repository.Broadcast.FindById(r.Context(), *broadcastId)
+	if err != nil {
+		return nil, &ApiError{
+			Error:      err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	if broadcast == nil || broadcast.WorkspaceId != identity.WorkspaceId() {
+		return nil, &ApiError{
+			Error:      errors.New("broadcast not found"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+
+	return broadcast, nil
+}
+
+func broadcastError(err error) *ApiError {
+	if errors.Is(err, service.ErrBroadcastNotEditable) || errors.Is(err, service.ErrBroadcastStatus) {
+		return &ApiError{
+			Error:      err,
+			StatusCode: http.StatusConflict,
+		}
 	}
+
+	return &ApiError{
+		Error:      err,
+		StatusCode: http.StatusBadRequest,
+	}
+}
+
+func segmentIdsToStrings(segmentIds []uid.UID) model.JSONBArray {
+	segments := make(model.JSONBArray, 0, len(segmentIds))
+	for _, segmentId := range segmentIds {
+		segments = append(segments, segmentId.String())
+	}
+
+	return segments
+}
+
+func toBroadcastVariants(payloads []broadcastVariantRequestPayload) []*model.BroadcastVariant {
+	variants := make([]*model.BroadcastVariant, 0, len(payloads))
+	for _, payload := range payloads {
+		variants = append(variants, &model.BroadcastVariant{
+			Name:       payload.Name,
+			Subject:    payload.Subject,
+			TemplateId: payload.TemplateId,
+			FromName:   payload.FromName,
+		})
+	}
+
+	return variants
 }
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/service"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type fakeBroadcastService struct {
+	service.BroadcastService
+	broadcasts []*model.Broadcast
+}
+
+func (s *fakeBroadcastService) Create(_ context.Context, broadcast *model.Broadcast) error {
+	s.broadcasts = append(s.broadcasts, broadcast)
+
+	return nil
+}
+
+func TestCreateBroadcastUsesIdentityOrganization(t *testing.T) {
+	workspaceId, _ := uid.NewUIDFromString(testWorkspaceId)
+	organization := &model.Organization{Base: model.Base{Id: *uid.NewUID(7)}, WorkspaceId: *workspaceId}
+	broadcastService := &fakeBroadcastService{}
+	api := NewCampaignAPI(newTestApp(&service.Service{
+		Broadcast:    broadcastService,
+		Organization: &fakeOrganizationService{organizations: map[uid.UID]*model.Organization{*workspaceId: organization}},
+	}))
+
+	w := serve(t, api.CreateBroadcast(), http.MethodPost, "/broadcasts", `{
+		"name": "Launch",
+		"from": "news@example.com",
+		"templateId": "5",
+		"segmentIds": ["6"],
+		"organizationId": "99"
+	}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(broadcastService.broadcasts) != 1 {
+		t.Fatalf("expected 1 broadcast to be created, got %d", len(broadcastService.broadcasts))
+	}
+	if got := broadcastService.broadcasts[0].OrganizationId; got != organization.Id {
+		t.Fatalf("expected organization %s, got %s", organization.Id, got)
+	}
+}
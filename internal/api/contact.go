@@ -1,12 +1,41 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
 	"github.com/usesend0/send0/internal/core"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
 )
 
+type createContactRequestPayload struct {
+	Email      string                 `json:"email" validate:"required,email"`
+	FirstName  string                 `json:"firstName"`
+	LastName   string                 `json:"lastName"`
+	Attributes map[string]interface{} `json:"attributes"`
+	Tags       []string               `json:"tags"`
+	SegmentIds []uid.UID              `json:"segmentIds"`
+}
+
+type createSegmentRequestPayload struct {
+	Name             string   `json:"name" validate:"required"`
+	Description      *string  `json:"description"`
+	IsPrivate        bool     `json:"isPrivate"`
+	IsOptIn          bool     `json:"isOptIn"`
+	OptInFrom        *string  `json:"optInFrom" validate:"required_if=IsOptIn true"`
+	OptInRedirectURL *string  `json:"optInRedirectUrl" validate:"omitempty,url"`
+	Tags             []string `json:"tags"`
+}
+
+type addContactToSegmentRequestPayload struct {
+	ContactId uid.UID `json:"contactId" validate:"required"`
+}
+
 type contactAPI struct {
 	app *core.App
 }
@@ -30,25 +59,211 @@ func (c *contactAPI) Route() func(r chi.Router) {
 
 func (c *contactAPI) CreateContact() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Create contact
+		identity := core.IdentityFromContext(r.Context())
+		contact, err := func() (*model.Contact, *ApiError) {
+			payload := new(createContactRequestPayload)
+			err := json.NewDecoder(r.Body).Decode(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			err = c.app.Validate.Struct(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			contact := &model.Contact{
+				FirstName:   payload.FirstName,
+				LastName:    payload.LastName,
+				Email:       strings.ToLower(payload.Email),
+				Attributes:  payload.Attributes,
+				Tags:        payload.Tags,
+				WorkspaceId: identity.WorkspaceId(),
+			}
+			err = c.app.Service.Contact.Create(r.Context(), contact, payload.SegmentIds)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return contact, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"contact": contact,
+		})
 	}
 }
 
 func (c *contactAPI) ConfirmContact() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Confirm contact
+		segment, err := func() (*model.Segment, *ApiError) {
+			token := r.URL.Query().Get("token")
+			if token == "" {
+				return nil, &ApiError{
+					Error:      errors.New("token is required"),
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			segment, err := c.app.Service.Contact.Confirm(r.Context(), token)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+
+			return segment, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		if segment.OptInRedirectURL != nil && *segment.OptInRedirectURL != "" {
+			http.Redirect(w, r, *segment.OptInRedirectURL, http.StatusFound)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+		})
 	}
 }
 
 func (c *contactAPI) CreateSegment() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Create segment
+		identity := core.IdentityFromContext(r.Context())
+		segment, err := func() (*model.Segment, *ApiError) {
+			payload := new(createSegmentRequestPayload)
+			err := json.NewDecoder(r.Body).Decode(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			err = c.app.Validate.Struct(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			organizationId, apiErr := identityOrganizationId(c.app, r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			segment := &model.Segment{
+				Name:             payload.Name,
+				Description:      payload.Description,
+				IsPrivate:        payload.IsPrivate,
+				IsOptIn:          payload.IsOptIn,
+				OptInFrom:        payload.OptInFrom,
+				OptInRedirectURL: payload.OptInRedirectURL,
+				Tags:             payload.Tags,
+				OrganizationId:   organizationId,
+				WorkspaceId:      identity.WorkspaceId(),
+			}
+			err = c.app.Service.Contact.CreateSegment(r.Context(), segment)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return segment, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"segment": segment,
+		})
 	}
 }
 
 func (c *contactAPI) AddContactToSegment() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Add contact to segment
+		identity := core.IdentityFromContext(r.Context())
+		segmentContact, err := func() (*model.SegmentContact, *ApiError) {
+			segmentId, err := uid.NewUIDFromString(chi.URLParam(r, "segmentId"))
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			payload := new(addContactToSegmentRequestPayload)
+			err = json.NewDecoder(r.Body).Decode(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			err = c.app.Validate.Struct(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			segment, err := c.app.Repository.Segment.FindByID(r.Context(), *segmentId)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+			if segment == nil || segment.WorkspaceId != identity.WorkspaceId() {
+				return nil, &ApiError{
+					Error:      errors.New("segment not found"),
+					StatusCode: http.StatusNotFound,
+				}
+			}
+			contact, err := c.app.Repository.Contact.FindById(r.Context(), payload.ContactId)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+			if contact == nil || contact.WorkspaceId != identity.WorkspaceId() {
+				return nil, &ApiError{
+					Error:      errors.New("contact not found"),
+					StatusCode: http.StatusNotFound,
+				}
+			}
+			segmentContact, err := c.app.Service.Contact.AddToSegment(r.Context(), contact, segment)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return segmentContact, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success":        true,
+			"segmentContact": segmentContact,
+		})
 	}
 }
 
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/service"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type fakeOrganizationService struct {
+	service.OrganizationService
+	organizations map[uid.UID]*model.Organization
+}
+
+func (s *fakeOrganizationService) Default(_ context.Context, workspaceId uid.UID) (*model.Organization, error) {
+	organization := s.organizations[workspaceId]
+	if organization == nil {
+		return nil, service.ErrNoDefaultOrganization
+	}
+
+	return organization, nil
+}
+
+type fakeContactService struct {
+	service.ContactService
+	segments []*model.Segment
+}
+
+func (s *fakeContactService) CreateSegment(_ context.Context, segment *model.Segment) error {
+	s.segments = append(s.segments, segment)
+
+	return nil
+}
+
+func TestCreateSegmentUsesIdentityOrganization(t *testing.T) {
+	workspaceId, _ := uid.NewUIDFromString(testWorkspaceId)
+	organization := &model.Organization{Base: model.Base{Id: *uid.NewUID(7)}, WorkspaceId: *workspaceId}
+	contactService := &fakeContactService{}
+	api := NewContactAPI(newTestApp(&service.Service{
+		Contact:      contactService,
+		Organization: &fakeOrganizationService{organizations: map[uid.UID]*model.Organization{*workspaceId: organization}},
+	}))
+
+	w := serve(t, api.CreateSegment(), http.MethodPost, "/segments", `{
+		"name": "Newsletter",
+		"organizationId": "99"
+	}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(contactService.segments) != 1 {
+		t.Fatalf("expected 1 segment to be created, got %d", len(contactService.segments))
+	}
+	segment := contactService.segments[0]
+	if segment.OrganizationId != organization.Id {
+		t.Fatalf("expected organization %s, got %s", organization.Id, segment.OrganizationId)
+	}
+	if segment.WorkspaceId != *workspaceId {
+		t.Fatalf("expected workspace %s, got %s", workspaceId, segment.WorkspaceId)
+	}
+}
+
+func TestCreateSegmentWithoutOrganization(t *testing.T) {
+	contactService := &fakeContactService{}
+	api := NewContactAPI(newTestApp(&service.Service{
+		Contact:      contactService,
+		Organization: &fakeOrganizationService{},
+	}))
+
+	w := serve(t, api.CreateSegment(), http.MethodPost, "/segments", `{"name": "Newsletter"}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(contactService.segments) != 0 {
+		t.Fatalf("expected no segment to be created, got %d", len(contactService.segments))
+	}
+}
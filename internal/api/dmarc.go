@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/usesend0/send0/internal/core"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/service"
+)
+
+// maxDMARCReportUploadSize limits the size of an uploaded report, reports are
+// usually compressed
+const maxDMARCReportUploadSize = 10 << 20
+
+// FormFieldDMARCReport is the multipart field of an uploaded report
+const FormFieldDMARCReport = "file"
+
+type dmarcAPI struct {
+	app *core.App
+}
+
+func NewDMARCAPI(app *core.App) *dmarcAPI {
+	return &dmarcAPI{app: app}
+}
+
+func (d *dmarcAPI) Route() func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Post("/dmarc/reports", d.ImportDMARCReport())
+	}
+}
+
+// ImportDMARCReport stores a DMARC aggregate report for the domain of the
+// workspace it is about. The report is the request body or the file field of
+// a multipart form, as XML, gzip or zip
+func (d *dmarcAPI) ImportDMARCReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := core.IdentityFromContext(r.Context())
+		report, err := func() (*model.DMARCReport, *ApiError) {
+			r.Body = http.MaxBytesReader(w, r.Body, maxDMARCReportUploadSize)
+			var reader io.Reader = r.Body
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+				file, _, err := r.FormFile(FormFieldDMARCReport)
+				if err != nil {
+					return nil, &ApiError{
+						Error:      err,
+						StatusCode: http.StatusBadRequest,
+					}
+				}
+				defer file.Close()
+				reader = file
+			}
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			report, err := d.app.Service.Domain.ImportDMARCReport(r.Context(), identity.WorkspaceId(), data)
+			if errors.Is(err, model.ErrDMARCReportExists) {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusConflict,
+				}
+			}
+			if errors.Is(err, service.ErrInvalidDMARCReport) {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			if errors.Is(err, service.ErrDMARCReportDomainNotFound) {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusUnprocessableEntity,
+				}
+			}
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return report, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"report":  report,
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/usesend0/send0/internal/core"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type createDNSProviderRequestPayload struct {
+	Name        string          `json:"name" validate:"required"`
+	Type        string          `json:"type" validate:"required,oneof=ROUTE53 CLOUDFLARE RFC2136"`
+	Credentials json.RawMessage `json:"credentials" validate:"required"`
+}
+
+type dnsProviderAPI struct {
+	app *core.App
+}
+
+func NewDNSProviderAPI(app *core.App) *dnsProviderAPI {
+	return &dnsProviderAPI{app: app}
+}
+
+func (d *dnsProviderAPI) Route() func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Post("/dns-providers", d.CreateDNSProvider())
+		r.Get("/dns-providers", d.GetDNSProviders())
+		r.Get("/dns-providers/{dnsProviderId}", d.GetDNSProvider())
+		r.Delete("/dns-providers/{dnsProviderId}", d.DeleteDNSProvider())
+	}
+}
+
+// CreateDNSProvider saves the credentials of a DNS provider, they are never
+// returned by the API
+func (d *dnsProviderAPI) CreateDNSProvider() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := core.IdentityFromContext(r.Context())
+		provider, err := func() (*model.DNSProvider, *ApiError) {
+			payload := new(createDNSProviderRequestPayload)
+			err := json.NewDecoder(r.Body).Decode(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			err = d.app.Validate.Struct(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			provider := &model.DNSProvider{
+				Name:        payload.Name,
+				Type:        payload.Type,
+				WorkspaceId: identity.WorkspaceId(),
+			}
+			err = d.app.Service.DNSProvider.Create(r.Context(), provider, payload.Credentials)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+
+			return provider, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success":     true,
+			"dnsProvider": provider,
+		})
+	}
+}
+
+func (d *dnsProviderAPI) GetDNSProviders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := core.IdentityFromContext(r.Context())
+		providers, err := d.app.Service.DNSProvider.List(r.Context(), identity.WorkspaceId())
+		if err != nil {
+			renderError(w, r, &ApiError{
+				Error:      err,
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success":      true,
+			"dnsProviders": providers,
+		})
+	}
+}
+
+func (d *dnsProviderAPI) GetDNSProvider() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider, err := d.findDNSProvider(r)
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success":     true,
+			"dnsProvider": provider,
+		})
+	}
+}
+
+func (d *dnsProviderAPI) DeleteDNSProvider() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := func() *ApiError {
+			provider, apiErr := d.findDNSProvider(r)
+			if apiErr != nil {
+				return apiErr
+			}
+			err := d.app.Service.DNSProvider.Delete(r.Context(), provider)
+			if err != nil {
+				return &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+		})
+	}
+}
+
+func (d *dnsProviderAPI) findDNSProvider(r *http.Request) (*model.DNSProvider, *ApiError) {
+	identity := core.IdentityFromContext(r.Context())
+	providerId, err := uid.NewUIDFromString(chi.URLParam(r, "dnsProviderId"))
+	if err != nil {
+		return nil, &ApiError{
+			Error:      err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	provider, err := d.app.Service.DNSProvider.Get(r.Context(), *providerId)
+	if err != nil {
+		return nil, &ApiError{
+			Error:      err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	if provider == nil || provider.WorkspaceId != identity.WorkspaceId() {
+		return nil, &ApiError{
+			Error:      errors.New("dns provider not found"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+
+	return provider, nil
+}
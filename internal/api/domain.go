@@ -1,20 +1,60 @@
 package api
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"github.com/usesend0/send0/internal/constant"
 	"github.com/usesend0/send0/internal/core"
+	"github.com/usesend0/send0/internal/dnsprovider"
 	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/service"
 	"github.com/usesend0/send0/internal/uid"
 )
 
 type createDomainRequestPayload struct {
-	Name   string             `json:"name" validate:"required"`
-	Region constant.AwsRegion `json:"region" validate:"required"`
+	Name                        string                    `json:"name" validate:"required"`
+	Region                      constant.AwsRegion        `json:"region" validate:"required"`
+	SendRate                    int                       `json:"sendRate" validate:"min=0"`
+	DNSProviderId               *string                   `json:"dnsProviderId"` // Publishes the records of the domain with the DNS provider
+	MailFromBehaviorOnMXFailure constant.MailFromBehavior `json:"mailFromBehaviorOnMxFailure" validate:"omitempty,oneof=USE_DEFAULT_VALUE REJECT_MESSAGE"`
+}
+
+type updateMailFromRequestPayload struct {
+	BehaviorOnMXFailure constant.MailFromBehavior `json:"behaviorOnMxFailure" validate:"required,oneof=USE_DEFAULT_VALUE REJECT_MESSAGE"`
+}
+
+type updateFailoverRequestPayload struct {
+	Region *constant.AwsRegion     `json:"region"` // Removes the failover region when null
+	Policy constant.FailoverPolicy `json:"policy" validate:"omitempty,oneof=NONE ON_THROTTLE"`
+}
+
+type publishDomainRecordsRequestPayload struct {
+	DNSProviderId *string `json:"dnsProviderId"` // Replaces the DNS provider of the domain
+}
+
+const (
+	DomainRecordsFormatBIND = "bind"
+	DomainRecordsFormatCSV  = "csv"
+	DomainRecordsFormatJSON = "json"
+)
+
+type domainRecordResponse struct {
+	Name     string             `json:"name"`
+	Type     string             `json:"type"`
+	Value    string             `json:"value"`
+	TTL      int                `json:"ttl"`
+	Priority int                `json:"priority,omitempty"`
+	Status   constant.DNSStatus `json:"status"`
 }
 
 type domainApi struct {
@@ -30,13 +70,25 @@ func NewDomainAPI(app *core.App) *domainApi {
 func (api *domainApi) Route() func(r chi.Router) {
 	return func(r chi.Router) {
 		r.Post("/", api.CreateDomainHandler())
+		r.Get("/", api.GetDomainsHandler())
+		r.Get("/{domainId}", api.GetDomainHandler())
+		r.Get("/{domainId}/records", api.GetDomainRecordsHandler())
 		r.Delete("/{domainId}", api.DeleteDomainHandler())
+		r.Post("/{domainId}/verify", api.VerifyDomainHandler())
+		r.Post("/{domainId}/dns/publish", api.PublishDomainRecordsHandler())
+		r.Get("/{domainId}/dkim/keys", api.GetDKIMKeysHandler())
+		r.Put("/{domainId}/mail-from", api.UpdateMailFromHandler())
+		r.Put("/{domainId}/failover", api.UpdateFailoverHandler())
+		r.Get("/{domainId}/health", api.GetDomainHealthHandler())
+		r.Get("/{domainId}/dmarc/reports", api.GetDMARCReportsHandler())
+		r.Get("/{domainId}/dmarc/sources", api.GetDMARCSourcesHandler())
+		r.Post("/{domainId}/dkim/rotate", api.RotateDKIMHandler())
 	}
 }
 
 func (api *domainApi) CreateDomainHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// identity := core.IdentityFromContext(r.Context())
+		identity := core.IdentityFromContext(r.Context())
 		payload := new(createDomainRequestPayload)
 		domain, err := func() (*model.Domain, *ApiError) {
 			err := json.NewDecoder(r.Body).Decode(payload)
@@ -53,11 +105,34 @@ func (api *domainApi) CreateDomainHandler() http.HandlerFunc {
 					StatusCode: http.StatusBadRequest,
 				}
 			}
+			organizationId, apiErr := identityOrganizationId(api.app, r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
 			domain := &model.Domain{
-				Name:   payload.Name,
-				Region: payload.Region,
+				Name:                        payload.Name,
+				Region:                      payload.Region,
+				SendRate:                    payload.SendRate,
+				MailFromBehaviorOnMXFailure: payload.MailFromBehaviorOnMXFailure,
+				OrganizationId:              organizationId,
+				WorkspaceId:                 identity.WorkspaceId(),
+			}
+			if payload.DNSProviderId != nil {
+				domain.DNSProviderId, err = uid.NewUIDFromString(*payload.DNSProviderId)
+				if err != nil {
+					return nil, &ApiError{
+						Error:      err,
+						StatusCode: http.StatusBadRequest,
+					}
+				}
 			}
 			err = api.app.Service.Domain.Create(r.Context(), domain)
+			if errors.Is(err, service.ErrRegionNotEnabled) {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
 			if err != nil {
 				return nil, &ApiError{
 					Error:      err,
@@ -76,24 +151,383 @@ func (api *domainApi) CreateDomainHandler() http.HandlerFunc {
 
 func (api *domainApi) DeleteDomainHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// identity := core.IdentityFromContext(r.Context())
 		err := func() *ApiError {
-			domainId, err := uid.NewUIDFromString(chi.URLParam(r, "domainId"))
+			domain, apiErr := api.findDomain(r)
+			if apiErr != nil {
+				return apiErr
+			}
+			err := api.app.Service.Domain.Delete(r.Context(), domain.Id)
 			if err != nil {
 				return &ApiError{
 					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+		})
+	}
+}
+
+func (api *domainApi) VerifyDomainHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		domain, err := func() (*model.Domain, *ApiError) {
+			domain, apiErr := api.findDomain(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			err := api.app.Service.Domain.Verify(r.Context(), domain)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadGateway,
+				}
+			}
+
+			return domain, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"domain":  domain,
+		})
+	}
+}
+
+// PublishDomainRecordsHandler creates or updates the records of the domain
+// with its DNS provider, with dryRun=true the changes are only returned
+func (api *domainApi) PublishDomainRecordsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dryRun := r.URL.Query().Get("dryRun") == "true"
+		changes, err := func() ([]*dnsprovider.Change, *ApiError) {
+			domain, apiErr := api.findDomain(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			payload := new(publishDomainRecordsRequestPayload)
+			err := json.NewDecoder(r.Body).Decode(payload)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			if payload.DNSProviderId != nil {
+				domain.DNSProviderId, err = uid.NewUIDFromString(*payload.DNSProviderId)
+				if err != nil {
+					return nil, &ApiError{
+						Error:      err,
+						StatusCode: http.StatusBadRequest,
+					}
+				}
+			}
+			if domain.DNSProviderId == nil {
+				return nil, &ApiError{
+					Error:      errors.New("domain has no dns provider"),
 					StatusCode: http.StatusBadRequest,
 				}
 			}
-			err = api.app.Service.Domain.Delete(r.Context(), *domainId)
+			changes, err := api.app.Service.Domain.PublishRecords(r.Context(), domain, dryRun)
+			if errors.Is(err, service.ErrDNSProviderNotFound) {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusNotFound,
+				}
+			}
 			if err != nil {
-				return &ApiError{
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadGateway,
+				}
+			}
+			if payload.DNSProviderId != nil && !dryRun {
+				err = api.app.Repository.Domain.UpdateDNSProvider(r.Context(), domain.Id, domain.DNSProviderId)
+				if err != nil {
+					return nil, &ApiError{
+						Error:      err,
+						StatusCode: http.StatusInternalServerError,
+					}
+				}
+			}
+
+			return changes, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"dryRun":  dryRun,
+			"changes": changes,
+		})
+	}
+}
+
+// UpdateMailFromHandler sets what SES does when the MX record of the custom
+// MAIL FROM domain is missing, REJECT_MESSAGE keeps SPF aligned for DMARC
+func (api *domainApi) UpdateMailFromHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		domain, err := func() (*model.Domain, *ApiError) {
+			domain, apiErr := api.findDomain(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			payload := new(updateMailFromRequestPayload)
+			err := json.NewDecoder(r.Body).Decode(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			err = api.app.Validate.Struct(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			err = api.app.Service.Domain.UpdateMailFrom(r.Context(), domain, payload.BehaviorOnMXFailure)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadGateway,
+				}
+			}
+
+			return domain, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"domain":  domain,
+		})
+	}
+}
+
+// UpdateFailoverHandler sets the region the domain sends from when its region
+// is throttled, the domain is verified in the failover region first
+func (api *domainApi) UpdateFailoverHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		domain, err := func() (*model.Domain, *ApiError) {
+			domain, apiErr := api.findDomain(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			payload := new(updateFailoverRequestPayload)
+			err := json.NewDecoder(r.Body).Decode(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			err = api.app.Validate.Struct(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			if payload.Policy == "" {
+				payload.Policy = constant.FailoverPolicyOnThrottle
+			}
+			err = api.app.Service.Domain.UpdateFailover(r.Context(), domain, payload.Region, payload.Policy)
+			if errors.Is(err, service.ErrRegionNotEnabled) {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadGateway,
+				}
+			}
+
+			return domain, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"domain":  domain,
+		})
+	}
+}
+
+// GetDomainHealthHandler checks the live DNS records of the domain and
+// returns a scored report with fixes
+func (api *domainApi) GetDomainHealthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report, err := func() (*service.DomainHealthReport, *ApiError) {
+			domain, apiErr := api.findDomain(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			report, err := api.app.Service.Domain.Health(r.Context(), domain)
+			if err != nil {
+				return nil, &ApiError{
 					Error:      err,
 					StatusCode: http.StatusInternalServerError,
 				}
 			}
 
-			return nil
+			return report, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"health":  report,
+		})
+	}
+}
+
+func (api *domainApi) GetDMARCReportsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pageOptions := NewPageOptions(r)
+		domain, apiErr := api.findDomain(r)
+		if apiErr != nil {
+			renderError(w, r, apiErr)
+			return
+		}
+		options, err := dmarcReportFindOptions(r)
+		if err != nil {
+			renderError(w, r, &ApiError{
+				Error:      err,
+				StatusCode: http.StatusBadRequest,
+			})
+			return
+		}
+		options.DomainId = domain.Id
+		options.Offset = pageOptions.Skip()
+		options.Limit = pageOptions.Take
+		reports, count, err := api.app.Repository.DMARCReport.FindAll(r.Context(), *options)
+		if err != nil {
+			renderError(w, r, &ApiError{
+				Error:      err,
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		render.JSON(w, r, ToPaginated(reports, pageOptions, count))
+	}
+}
+
+// GetDMARCSourcesHandler sums the DMARC results of the domain by source IP
+// over the reports in the time range
+func (api *domainApi) GetDMARCSourcesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sources, err := func() ([]*model.DMARCSourceStat, *ApiError) {
+			domain, apiErr := api.findDomain(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			options, err := dmarcReportFindOptions(r)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			options.DomainId = domain.Id
+			sources, err := api.app.Repository.DMARCReport.FindSourceStats(r.Context(), *options)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return sources, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"sources": sources,
+		})
+	}
+}
+
+// GetDKIMKeysHandler returns the DKIM key history of the domain, the newest
+// key first
+func (api *domainApi) GetDKIMKeysHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys, err := func() ([]*model.DKIMKey, *ApiError) {
+			domain, apiErr := api.findDomain(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			keys, err := api.app.Service.Domain.DKIMKeys(r.Context(), domain)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return keys, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success":  true,
+			"dkimKeys": keys,
+		})
+	}
+}
+
+// RotateDKIMHandler starts a DKIM rotation, the new record has to be
+// published before SES signs with the new key
+func (api *domainApi) RotateDKIMHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var domain *model.Domain
+		key, err := func() (*model.DKIMKey, *ApiError) {
+			var apiErr *ApiError
+			domain, apiErr = api.findDomain(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			key, err := api.app.Service.Domain.RotateDKIM(r.Context(), domain)
+			if errors.Is(err, service.ErrDKIMRotationInProgress) {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusConflict,
+				}
+			}
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return key, nil
 		}()
 		if err != nil {
 			renderError(w, r, err)
@@ -101,6 +535,175 @@ func (api *domainApi) DeleteDomainHandler() http.HandlerFunc {
 		}
 		render.JSON(w, r, map[string]interface{}{
 			"success": true,
+			"dkimKey": key,
+			"domain":  domain,
+		})
+	}
+}
+
+func (api *domainApi) GetDomainsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := core.IdentityFromContext(r.Context())
+		pageOptions := NewPageOptions(r)
+		query := r.URL.Query()
+		domains, count, err := api.app.Repository.Domain.FindAll(r.Context(), model.DomainFindOptions{
+			Region:      constant.AwsRegion(query.Get("region")),
+			Status:      constant.DomainStatus(strings.ToUpper(query.Get("status"))),
+			WorkspaceId: identity.WorkspaceId(),
+			Ascending:   pageOptions.Order == PageOrderAsc,
+			Offset:      pageOptions.Skip(),
+			Limit:       pageOptions.Take,
+		})
+		if err != nil {
+			renderError(w, r, &ApiError{
+				Error:      err,
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		render.JSON(w, r, ToPaginated(domains, pageOptions, count))
+	}
+}
+
+func (api *domainApi) GetDomainHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		domain, err := api.findDomain(r)
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"domain":  domain,
+		})
+	}
+}
+
+// GetDomainRecordsHandler exports the DNS records of the domain with fully
+// qualified names, as a BIND zone snippet, a CSV file or JSON
+func (api *domainApi) GetDomainRecordsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		domain, apiErr := api.findDomain(r)
+		if apiErr != nil {
+			renderError(w, r, apiErr)
+			return
+		}
+		records := make([]*domainRecordResponse, 0)
+		for _, record := range domain.Records() {
+			records = append(records, &domainRecordResponse{
+				Name:     domain.RecordName(record),
+				Type:     record.Type,
+				Value:    record.Value,
+				TTL:      record.TTL,
+				Priority: record.Priority,
+				Status:   record.Status,
+			})
+		}
+		format := r.URL.Query().Get("format")
+		switch format {
+		case "", DomainRecordsFormatJSON:
+			render.JSON(w, r, map[string]interface{}{
+				"success": true,
+				"records": records,
+			})
+		case DomainRecordsFormatBIND:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", domain.Name+".zone"))
+			writeBINDRecords(w, records)
+		case DomainRecordsFormatCSV:
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", domain.Name+".csv"))
+			writeCSVRecords(w, records)
+		default:
+			renderError(w, r, &ApiError{
+				Error:      fmt.Errorf("unsupported format %s", format),
+				StatusCode: http.StatusBadRequest,
+			})
+		}
+	}
+}
+
+// dmarcReportFindOptions reads the RFC 3339 from and to times of the query
+func dmarcReportFindOptions(r *http.Request) (*model.DMARCReportFindOptions, error) {
+	options := &model.DMARCReportFindOptions{}
+	for _, param := range []struct {
+		name string
+		time **time.Time
+	}{
+		{"from", &options.From},
+		{"to", &options.To},
+	} {
+		value := r.URL.Query().Get(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, errors.New("invalid " + param.name + " time")
+		}
+		*param.time = &t
+	}
+
+	return options, nil
+}
+
+func (api *domainApi) findDomain(r *http.Request) (*model.Domain, *ApiError) {
+	identity := core.IdentityFromContext(r.Context())
+	domainId, err := uid.NewUIDFromString(chi.URLParam(r, "domainId"))
+	if err != nil {
+		return nil, &ApiError{
+			Error:      err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	domain, err := api.app.Service.Domain.Get(r.Context(), *domainId)
+	if err != nil {
+		return nil, &ApiError{
+			Error:      err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	if domain == nil || domain.WorkspaceId != identity.WorkspaceId() {
+		return nil, &ApiError{
+			Error:      errors.New("domain not found"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+
+	return domain, nil
+}
+
+// writeBINDRecords writes the records in zone file syntax, TXT values are
+// quoted and split into strings of at most 255 characters
+func writeBINDRecords(w io.Writer, records []*domainRecordResponse) {
+	for _, record := range records {
+		value := record.Value
+		switch record.Type {
+		case "TXT":
+			if len(value) > dnsprovider.MaxTXTStringLength {
+				value = "( " + dnsprovider.QuoteTXT(value) + " )"
+			} else {
+				value = dnsprovider.QuoteTXT(value)
+			}
+		case "MX":
+			value = fmt.Sprintf("%d %s.", record.Priority, strings.TrimSuffix(value, "."))
+		}
+		fmt.Fprintf(w, "%s.\t%d\tIN\t%s\t%s\n", record.Name, record.TTL, record.Type, value)
+	}
+}
+
+func writeCSVRecords(w io.Writer, records []*domainRecordResponse) {
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"name", "type", "value", "ttl", "priority", "status"})
+	for _, record := range records {
+		_ = writer.Write([]string{
+			record.Name,
+			record.Type,
+			record.Value,
+			strconv.Itoa(record.TTL),
+			strconv.Itoa(record.Priority),
+			string(record.Status),
 		})
 	}
+	writer.Flush()
 }
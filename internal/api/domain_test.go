@@ -0,0 +1,270 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/service"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type fakeDomainService struct {
+	service.DomainService
+	domains  []*model.Domain
+	deleted  []uid.UID
+	created  []*model.Domain
+	verified []uid.UID
+	err      error
+}
+
+func (s *fakeDomainService) Create(_ context.Context, domain *model.Domain) error {
+	s.created = append(s.created, domain)
+
+	return nil
+}
+
+func (s *fakeDomainService) Get(_ context.Context, domainId uid.UID) (*model.Domain, error) {
+	for _, domain := range s.domains {
+		if domain.Id == domainId {
+			return domain, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *fakeDomainService) Delete(_ context.Context, domainId uid.UID) error {
+	s.deleted = append(s.deleted, domainId)
+
+	return nil
+}
+
+func (s *fakeDomainService) Verify(_ context.Context, domain *model.Domain) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.verified = append(s.verified, domain.Id)
+	domain.Status = constant.DomainStatusActive
+
+	return nil
+}
+
+type fakeDomainRepository struct {
+	model.DomainRepository
+	domains []*model.Domain
+	count   int
+	options *model.DomainFindOptions // The options of the last find
+}
+
+func (r *fakeDomainRepository) FindAll(_ context.Context, options model.DomainFindOptions) ([]*model.Domain, int, error) {
+	r.options = &options
+
+	return r.domains, r.count, nil
+}
+
+func TestDeleteDomain(t *testing.T) {
+	workspaceId, _ := uid.NewUIDFromString(testWorkspaceId)
+	domainService := &fakeDomainService{domains: []*model.Domain{
+		{Base: model.Base{Id: *uid.NewUID(1)}, WorkspaceId: *workspaceId},
+		{Base: model.Base{Id: *uid.NewUID(2)}, WorkspaceId: *uid.NewUID(99)},
+	}}
+	api := NewDomainAPI(newTestApp(&service.Service{Domain: domainService}))
+	router := chi.NewRouter()
+	router.Delete("/domains/{domainId}", api.DeleteDomainHandler())
+
+	tests := []struct {
+		name     string
+		domainId string
+		want     int
+	}{
+		{"own domain", "1", http.StatusOK},
+		{"domain of another workspace", "2", http.StatusNotFound},
+		{"unknown domain", "3", http.StatusNotFound},
+		{"invalid id", "abc", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(t, router.ServeHTTP, http.MethodDelete, "/domains/"+tt.domainId, "")
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+	if len(domainService.deleted) != 1 || domainService.deleted[0] != *uid.NewUID(1) {
+		t.Fatalf("expected only the own domain to be deleted, got %v", domainService.deleted)
+	}
+}
+
+func TestCreateDomainUsesIdentityOrganization(t *testing.T) {
+	workspaceId, _ := uid.NewUIDFromString(testWorkspaceId)
+	organization := &model.Organization{Base: model.Base{Id: *uid.NewUID(7)}, WorkspaceId: *workspaceId}
+	domainService := &fakeDomainService{}
+	api := NewDomainAPI(newTestApp(&service.Service{
+		Domain:       domainService,
+		Organization: &fakeOrganizationService{organizations: map[uid.UID]*model.Organization{*workspaceId: organization}},
+	}))
+
+	w := serve(t, api.CreateDomainHandler(), http.MethodPost, "/domains", `{"name": "example.com", "region": "us-east-1"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(domainService.created) != 1 || domainService.created[0].OrganizationId != organization.Id {
+		t.Fatalf("expected a domain of organization %s, got %+v", organization.Id, domainService.created)
+	}
+
+	// a workspace without a default organization can't create domains
+	api = NewDomainAPI(newTestApp(&service.Service{
+		Domain:       domainService,
+		Organization: &fakeOrganizationService{},
+	}))
+	w = serve(t, api.CreateDomainHandler(), http.MethodPost, "/domains", `{"name": "example.org", "region": "us-east-1"}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGetDomains(t *testing.T) {
+	workspaceId, _ := uid.NewUIDFromString(testWorkspaceId)
+	repository := &fakeDomainRepository{
+		domains: []*model.Domain{{Base: model.Base{Id: *uid.NewUID(2)}, Name: "example.org", WorkspaceId: *workspaceId}},
+		count:   3,
+	}
+	app := newTestApp(&service.Service{})
+	app.Repository = &model.Repository{Domain: repository}
+
+	w := serve(t, NewDomainAPI(app).GetDomainsHandler(), http.MethodGet, "/domains?region=us-east-1&status=active&page=2&take=1&order=asc", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	want := model.DomainFindOptions{
+		Region:      constant.AwsRegionNorthVirginia,
+		Status:      constant.DomainStatusActive,
+		WorkspaceId: *workspaceId,
+		Ascending:   true,
+		Offset:      1,
+		Limit:       1,
+	}
+	if *repository.options != want {
+		t.Fatalf("expected the options %+v, got %+v", want, *repository.options)
+	}
+	var page Paginated[struct {
+		Name string `json:"name"`
+	}]
+	err := json.NewDecoder(w.Body).Decode(&page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Data) != 1 || page.Meta != (PaginatedMeta{ItemCount: 3, PageCount: 3, HasPreviousPage: true, HasNextPage: true}) {
+		t.Fatalf("expected the second of 3 pages, got %d domains and %+v", len(page.Data), page.Meta)
+	}
+}
+
+func TestGetDomainRecords(t *testing.T) {
+	workspaceId, _ := uid.NewUIDFromString(testWorkspaceId)
+	dkim := strings.Repeat("a", 300)
+	domain := &model.Domain{
+		Base:        model.Base{Id: *uid.NewUID(1)},
+		Name:        "example.co.uk",
+		DKIMRecords: constant.JSONDomainRecords{{Name: "s1._domainkey", Type: "TXT", Value: dkim, TTL: 1800, Status: constant.DNSStatusActive}},
+		SPFRecords: constant.JSONDomainRecords{
+			{Name: "bounce", Type: "MX", Value: "feedback-smtp.us-east-1.amazonses.com", TTL: 1800, Priority: 10, Status: constant.DNSStatusPending},
+		},
+		DMARCRecords: constant.JSONDomainRecords{{Name: "", Type: "TXT", Value: "v=DMARC1; p=none", TTL: 1800, Status: constant.DNSStatusPending}},
+		WorkspaceId:  *workspaceId,
+	}
+	api := NewDomainAPI(newTestApp(&service.Service{Domain: &fakeDomainService{domains: []*model.Domain{domain}}}))
+	router := chi.NewRouter()
+	router.Get("/domains/{domainId}/records", api.GetDomainRecordsHandler())
+
+	w := serve(t, router.ServeHTTP, http.MethodGet, "/domains/1/records", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Records []domainRecordResponse `json:"records"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(response.Records))
+	for _, record := range response.Records {
+		names = append(names, record.Name)
+	}
+	// the names are relative to the registered domain
+	if got := strings.Join(names, " "); got != "s1._domainkey.example.co.uk bounce.example.co.uk example.co.uk" {
+		t.Fatalf("expected fully qualified names, got %s", got)
+	}
+
+	w = serve(t, router.ServeHTTP, http.MethodGet, "/domains/1/records?format=bind", "")
+	want := "s1._domainkey.example.co.uk.\t1800\tIN\tTXT\t( \"" + dkim[:255] + "\" \"" + dkim[255:] + "\" )\n" +
+		"bounce.example.co.uk.\t1800\tIN\tMX\t10 feedback-smtp.us-east-1.amazonses.com.\n" +
+		"example.co.uk.\t1800\tIN\tTXT\t\"v=DMARC1; p=none\"\n"
+	if w.Body.String() != want {
+		t.Fatalf("expected the zone\n%s\ngot\n%s", want, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="example.co.uk.zone"` {
+		t.Fatalf("expected the zone file name, got %s", got)
+	}
+
+	w = serve(t, router.ServeHTTP, http.MethodGet, "/domains/1/records?format=csv", "")
+	lines := strings.Split(w.Body.String(), "\n")
+	if lines[0] != "name,type,value,ttl,priority,status" || lines[2] != "bounce.example.co.uk,MX,feedback-smtp.us-east-1.amazonses.com,1800,10,PENDING" {
+		t.Fatalf("expected the records as CSV, got %s", w.Body.String())
+	}
+
+	w = serve(t, router.ServeHTTP, http.MethodGet, "/domains/1/records?format=xml", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unsupported format, got %d", w.Code)
+	}
+}
+
+func TestVerifyDomain(t *testing.T) {
+	workspaceId, _ := uid.NewUIDFromString(testWorkspaceId)
+	domainService := &fakeDomainService{domains: []*model.Domain{
+		{Base: model.Base{Id: *uid.NewUID(1)}, Status: constant.DomainStatusPending, WorkspaceId: *workspaceId},
+		{Base: model.Base{Id: *uid.NewUID(2)}, Status: constant.DomainStatusPending, WorkspaceId: *uid.NewUID(99)},
+	}}
+	api := NewDomainAPI(newTestApp(&service.Service{Domain: domainService}))
+	router := chi.NewRouter()
+	router.Post("/domains/{domainId}/verify", api.VerifyDomainHandler())
+
+	w := serve(t, router.ServeHTTP, http.MethodPost, "/domains/1/verify", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Domain struct {
+			Status constant.DomainStatus `json:"status"`
+		} `json:"domain"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Domain.Status != constant.DomainStatusActive {
+		t.Fatalf("expected the verified domain, got %s", response.Domain.Status)
+	}
+
+	w = serve(t, router.ServeHTTP, http.MethodPost, "/domains/2/verify", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for the domain of another workspace, got %d", w.Code)
+	}
+	if len(domainService.verified) != 1 {
+		t.Fatalf("expected only the own domain to be verified, got %v", domainService.verified)
+	}
+
+	// SES failing to verify the domain is a bad gateway
+	domainService.err = errors.New("throttled")
+	w = serve(t, router.ServeHTTP, http.MethodPost, "/domains/1/verify", "")
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", w.Code)
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -12,7 +13,7 @@ import (
 )
 
 type sendEmailRequestPayload struct {
-	From           string                  `json:"from" validate:"required"`
+	From           string                  `json:"from,omitempty"` // The default sender when empty
 	Recipients     []string                `json:"recipients" validate:"required"`
 	CC             []string                `json:"cc"`
 	BCC            []string                `json:"bcc"`
@@ -29,10 +30,6 @@ type sendEmailRequestPayload struct {
 	MetaData       *map[string]interface{} `json:"metaData"`
 }
 
-type sendEmailRequestHeaders struct {
-	IdempotencyKey *string `json:"Idempotency-Key"`
-}
-
 type EmailAPI struct {
 	app *core.App
 }
@@ -51,9 +48,8 @@ func (api *EmailAPI) Route() func(r chi.Router) {
 
 func (api *EmailAPI) SendEmailHandler() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// identity := core.IdentityFromContext(r.Context())
+		identity := core.IdentityFromContext(r.Context())
 		payload := new(sendEmailRequestPayload)
-		headers := new(sendEmailRequestHeaders)
 		email, err := func() (*model.Email, *ApiError) {
 			err := json.NewDecoder(r.Body).Decode(payload)
 			if err != nil {
@@ -62,18 +58,19 @@ func (api *EmailAPI) SendEmailHandler() func(w http.ResponseWriter, r *http.Requ
 					StatusCode: http.StatusBadRequest,
 				}
 			}
-			err = json.NewDecoder(r.Body).Decode(headers)
-			if err != nil {
-				return nil, &ApiError{
-					Error:      err,
-					StatusCode: http.StatusBadRequest,
-				}
-			}
+			// the default sender of the workspace is used without a from
 			email := &model.Email{
-				From: payload.From,
+				From:        payload.From,
+				ReplyTo:     payload.ReplyTo,
+				WorkspaceId: identity.WorkspaceId(),
+				EmailContent: model.EmailContent{
+					Subject: payload.Subject,
+					Html:    payload.Html,
+					Text:    payload.Text,
+				},
 			}
-			if headers.IdempotencyKey != nil {
-				email.RequestId = *headers.IdempotencyKey
+			if idempotencyKey := r.Header.Get("Idempotency-Key"); idempotencyKey != "" {
+				email.RequestId = idempotencyKey
 			} else {
 				email.RequestId = api.app.UIDGenerator.Next().String()
 			}
@@ -103,6 +100,18 @@ func (api *EmailAPI) SendEmailHandler() func(w http.ResponseWriter, r *http.Requ
 			_, err = api.app.Service.Email.Send(r.Context(), email.RequestId, []*model.Email{
 				email,
 			})
+			if errors.Is(err, service.ErrNoDefaultSender) || errors.Is(err, service.ErrSenderNotAllowed) {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			if errors.Is(err, service.ErrEmailNotSent) {
+				return nil, &ApiError{
+					Error:      service.ErrEmailNotSent,
+					StatusCode: http.StatusServiceUnavailable,
+				}
+			}
 			if err != nil {
 				return nil, &ApiError{
 					Error:      err,
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/service"
+)
+
+type fakeEmailService struct {
+	emails []*model.Email
+	err    error
+}
+
+func (s *fakeEmailService) Send(_ context.Context, _ string, emails []*model.Email) ([]string, error) {
+	s.emails = append(s.emails, emails...)
+
+	return nil, s.err
+}
+
+func (s *fakeEmailService) Deliver(_ context.Context, _ []*model.Email) error {
+	return s.err
+}
+
+func TestSendEmailWithoutFrom(t *testing.T) {
+	emailService := &fakeEmailService{}
+	api := NewEmailAPI(newTestApp(&service.Service{Email: emailService}))
+
+	w := serve(t, api.SendEmailHandler(), http.MethodPost, "/emails", `{
+		"recipients": ["jane@example.com"],
+		"subject": "Hello",
+		"html": "<p>Hello</p>"
+	}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(emailService.emails) != 1 {
+		t.Fatalf("expected 1 email to be sent, got %d", len(emailService.emails))
+	}
+	if emailService.emails[0].From != "" {
+		t.Fatalf("expected the from to be left to the default sender, got %q", emailService.emails[0].From)
+	}
+}
+
+func TestSendEmailWithoutFromOrDefaultSender(t *testing.T) {
+	emailService := &fakeEmailService{err: service.ErrNoDefaultSender}
+	api := NewEmailAPI(newTestApp(&service.Service{Email: emailService}))
+
+	w := serve(t, api.SendEmailHandler(), http.MethodPost, "/emails", `{
+		"recipients": ["jane@example.com"],
+		"subject": "Hello",
+		"html": "<p>Hello</p>"
+	}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSendEmailNotSent(t *testing.T) {
+	emailService := &fakeEmailService{err: fmt.Errorf("%w: throttled", service.ErrEmailNotSent)}
+	api := NewEmailAPI(newTestApp(&service.Service{Email: emailService}))
+
+	w := serve(t, api.SendEmailHandler(), http.MethodPost, "/emails", `{
+		"from": "hello@example.com",
+		"recipients": ["jane@example.com"],
+		"subject": "Hello",
+		"html": "<p>Hello</p>"
+	}`)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -1,12 +1,43 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/usesend0/send0/internal/constant"
 	"github.com/usesend0/send0/internal/core"
+	"github.com/usesend0/send0/internal/crypto"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+	"golang.org/x/net/websocket"
 )
 
+// QueryParamMetaDataPrefix filters events by a meta data key, meta.key=value
+// matches the value and meta.key= only requires the key
+const QueryParamMetaDataPrefix = "meta."
+
+// QueryParamLastEventId resumes a stream for clients which can't set the
+// Last-Event-ID header
+const QueryParamLastEventId = "lastEventId"
+
+const HeaderLastEventId = "Last-Event-ID"
+
+// eventStreamTokenExpiry is how long a stream token opens a stream, the stream
+// stays open once it's authenticated
+const eventStreamTokenExpiry = 5 * time.Minute
+
+// eventStreamKeepAlive is how often a comment is sent on an idle stream so
+// proxies keep the connection open
+const eventStreamKeepAlive = 15 * time.Second
+
 type eventAPI struct {
 	app *core.App
 }
@@ -18,18 +49,254 @@ func NewEventAPI(app *core.App) *eventAPI {
 func (e *eventAPI) Route() func(r chi.Router) {
 	return func(r chi.Router) {
 		r.Get("/events", e.GetEvents())
+		r.Post("/events/stream/token", e.CreateStreamToken())
 		r.Get("/events/{eventId}", e.GetEvent())
 	}
 }
 
-func (e *eventAPI) GetEvents() func(w http.ResponseWriter, r *http.Request) {
+func (e *eventAPI) GetEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := core.IdentityFromContext(r.Context())
+		pageOptions := NewPageOptions(r)
+		events, err := func() ([]*model.Event, *ApiError) {
+			options, err := eventFindOptions(r)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			options.WorkspaceId = identity.WorkspaceId()
+			options.Ascending = pageOptions.Order == PageOrderAsc
+			// one more event tells if there is a next page
+			options.Limit = pageOptions.Take + 1
+			events, err := e.app.Repository.Event.FindAll(r.Context(), *options)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return events, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, ToCursorPaginated(events, pageOptions.Take, func(event *model.Event) string {
+			return event.Id.String()
+		}))
+	}
+}
+
+func (e *eventAPI) GetEvent() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := core.IdentityFromContext(r.Context())
+		event, err := func() (*model.Event, *ApiError) {
+			eventId, err := uid.NewUIDFromString(chi.URLParam(r, "eventId"))
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			event, err := e.app.Repository.Event.FindById(r.Context(), *eventId)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+			if event == nil || event.WorkspaceId != identity.WorkspaceId() {
+				return nil, &ApiError{
+					Error:      errors.New("event not found"),
+					StatusCode: http.StatusNotFound,
+				}
+			}
+
+			return event, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"event":   event,
+		})
+	}
+}
+
+// CreateStreamToken issues a short lived token which opens a stream of the
+// workspace events in the token query parameter
+func (e *eventAPI) CreateStreamToken() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Get events
+		identity := core.IdentityFromContext(r.Context())
+		_, token, err := e.app.JWT.NewAccessToken(
+			identity.UserId().String(),
+			crypto.WithScope(constant.TokenScopeEventStream),
+			crypto.WithWorkspaceId(identity.WorkspaceId().String()),
+			crypto.WithExpiresIn(eventStreamTokenExpiry),
+		)
+		if err != nil {
+			renderError(w, r, &ApiError{
+				Error:      err,
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success":   true,
+			"token":     token,
+			"expiresIn": int(eventStreamTokenExpiry.Seconds()),
+		})
 	}
 }
 
-func (e *eventAPI) GetEvent() func(w http.ResponseWriter, r *http.Request) {
+// StreamEvents pushes the events of the workspace as Server-Sent Events, or as
+// JSON messages when the request is a WebSocket upgrade. The filters are the
+// same as GetEvents, the stream resumes after the Last-Event-ID header. It
+// accepts a token of CreateStreamToken in the query instead of the
+// authorization header
+func (e *eventAPI) StreamEvents() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Get event
+		identity := core.IdentityFromContext(r.Context())
+		options, err := eventFindOptions(r)
+		if err != nil {
+			renderError(w, r, &ApiError{
+				Error:      err,
+				StatusCode: http.StatusBadRequest,
+			})
+			return
+		}
+		options.WorkspaceId = identity.WorkspaceId()
+		lastEventId := r.Header.Get(HeaderLastEventId)
+		if lastEventId == "" {
+			lastEventId = r.URL.Query().Get(QueryParamLastEventId)
+		}
+		if lastEventId != "" {
+			id, err := uid.NewUIDFromString(lastEventId)
+			if err != nil {
+				renderError(w, r, &ApiError{
+					Error:      errors.New("invalid last event id"),
+					StatusCode: http.StatusBadRequest,
+				})
+				return
+			}
+			options.Cursor = *id
+		}
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			websocket.Server{Handler: e.streamWebSocket(*options)}.ServeHTTP(w, r)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			renderError(w, r, &ApiError{
+				Error:      errors.New("streaming is not supported"),
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		events := e.app.Service.Event.Stream(r.Context(), *options)
+		ticker := time.NewTicker(eventStreamKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_, err = io.WriteString(w, ": keep-alive\n\n")
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				err = writeServerSentEvent(w, event)
+			}
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
 	}
 }
+
+func (e *eventAPI) streamWebSocket(options model.EventFindOptions) websocket.Handler {
+	return func(conn *websocket.Conn) {
+		ctx, cancel := context.WithCancel(conn.Request().Context())
+		defer cancel()
+		// the client doesn't send messages, reading detects the close
+		go func() {
+			defer cancel()
+			_, _ = io.Copy(io.Discard, conn)
+		}()
+		for event := range e.app.Service.Event.Stream(ctx, options) {
+			err := websocket.JSON.Send(conn, event)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeServerSentEvent(w io.Writer, event *model.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.Id.String(), event.EventType, data)
+
+	return err
+}
+
+// eventFindOptions reads the event filters from the query, event types are
+// comma separated and times are RFC 3339
+func eventFindOptions(r *http.Request) (*model.EventFindOptions, error) {
+	query := r.URL.Query()
+	options := &model.EventFindOptions{
+		EmailId:     query.Get("emailId"),
+		Recipient:   query.Get("recipient"),
+		BroadcastId: query.Get("broadcastId"),
+		MetaData:    make(map[string]string),
+	}
+	if eventTypes := query.Get("type"); eventTypes != "" {
+		for _, eventType := range strings.Split(eventTypes, ",") {
+			options.EventTypes = append(options.EventTypes, constant.EventType(strings.TrimSpace(eventType)))
+		}
+	}
+	for _, param := range []struct {
+		name string
+		time **time.Time
+	}{
+		{"from", &options.From},
+		{"to", &options.To},
+	} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, errors.New("invalid " + param.name + " time")
+		}
+		*param.time = &t
+	}
+	if cursor := query.Get(QueryParamCursor); cursor != "" {
+		id, err := uid.NewUIDFromString(cursor)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		options.Cursor = *id
+	}
+	for key, values := range query {
+		if !strings.HasPrefix(key, QueryParamMetaDataPrefix) {
+			continue
+		}
+		options.MetaData[strings.TrimPrefix(key, QueryParamMetaDataPrefix)] = values[0]
+	}
+
+	return options, nil
+}
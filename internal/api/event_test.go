@@ -0,0 +1,223 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/usesend0/send0/internal/config"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/crypto"
+	"github.com/usesend0/send0/internal/middleware"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/service"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type fakeEventService struct {
+	service.EventSevice
+	events  []*model.Event
+	options *model.EventFindOptions // The options of the last stream
+}
+
+func (s *fakeEventService) Stream(_ context.Context, options model.EventFindOptions) <-chan *model.Event {
+	s.options = &options
+	events := make(chan *model.Event, len(s.events))
+	for _, event := range s.events {
+		events <- event
+	}
+	close(events)
+
+	return events
+}
+
+// fakeEventRepository finds the events like the events table, the events are
+// in the order of their ids
+type fakeEventRepository struct {
+	model.EventRepository
+	events []*model.Event
+}
+
+func (r *fakeEventRepository) FindAll(_ context.Context, options model.EventFindOptions) ([]*model.Event, error) {
+	events := make([]*model.Event, 0)
+	for i := range r.events {
+		event := r.events[i]
+		if !options.Ascending {
+			event = r.events[len(r.events)-1-i]
+		}
+		if options.Cursor != (uid.UID{}) &&
+			(options.Ascending && event.Id.ID() <= options.Cursor.ID() ||
+				!options.Ascending && event.Id.ID() >= options.Cursor.ID()) {
+			continue
+		}
+		if len(events) == options.Limit {
+			break
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+func newTestJWT(t *testing.T) *crypto.JWT {
+	t.Helper()
+	key, _, err := crypto.GenerateKeyPair(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes, err := crypto.PrivateKeyToBytes(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwt, err := crypto.NewJWT(&config.Config{JWT: config.JWT{PrivateKey: base64.StdEncoding.EncodeToString(bytes)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return jwt
+}
+
+func TestStreamEventsAcceptsStreamToken(t *testing.T) {
+	events := &fakeEventService{}
+	app := newTestApp(&service.Service{Event: events})
+	app.JWT = newTestJWT(t)
+	interceptor := middleware.NewIdentityInterceptor(app.JWT)
+	router := chi.NewRouter()
+	router.With(interceptor.QueryTokenHandler(constant.TokenScopeEventStream)).Get("/events/stream", NewEventAPI(app).StreamEvents())
+	router.With(interceptor.Handler).Get("/events", NewEventAPI(app).GetEvents())
+
+	w := serve(t, NewEventAPI(app).CreateStreamToken(), http.MethodPost, "/events/stream/token", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var response struct {
+		Token string `json:"token"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events/stream?token="+token, nil))
+		return w
+	}
+
+	w = stream(response.Token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if events.options == nil || events.options.WorkspaceId.String() != testWorkspaceId {
+		t.Fatalf("expected a stream of the workspace of the token, got %+v", events.options)
+	}
+
+	// an access token doesn't open a stream from the query, where it would
+	// be logged
+	_, accessToken, err := app.JWT.NewAccessToken("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w = stream(accessToken); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an access token, got %d", w.Code)
+	}
+	// and the stream token doesn't grant api access
+	r := httptest.NewRequest(http.MethodGet, "/events", nil)
+	r.Header.Set(constant.HeaderAuthorization, "Bearer "+response.Token)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for the stream token, got %d", w.Code)
+	}
+}
+
+func TestGetEventsPagesThroughTheEvents(t *testing.T) {
+	repository := &fakeEventRepository{}
+	for i := 1; i <= 5; i++ {
+		repository.events = append(repository.events, &model.Event{Base: model.Base{Id: *uid.NewUID(int64(i))}})
+	}
+	app := newTestApp(&service.Service{})
+	app.Repository = &model.Repository{Event: repository}
+	pages := func(query string) [][]string {
+		t.Helper()
+		pages := make([][]string, 0)
+		cursor := ""
+		for {
+			w := serve(t, NewEventAPI(app).GetEvents(), http.MethodGet, "/events?take=2"+query+cursor, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+			}
+			var page CursorPaginated[struct {
+				Id string `json:"id"`
+			}]
+			err := json.NewDecoder(w.Body).Decode(&page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := make([]string, 0, len(page.Data))
+			for _, event := range page.Data {
+				ids = append(ids, event.Id)
+			}
+			pages = append(pages, ids)
+			if !page.Meta.HasNextPage {
+				return pages
+			}
+			cursor = "&cursor=" + *page.Meta.NextCursor
+		}
+	}
+
+	for query, want := range map[string]string{
+		"":           "[[5 4] [3 2] [1]]",
+		"&order=asc": "[[1 2] [3 4] [5]]",
+	} {
+		if got := fmt.Sprint(pages(query)); got != want {
+			t.Fatalf("expected the pages %s, got %s", want, got)
+		}
+	}
+	// the last page is full, without a next page
+	repository.events = repository.events[:4]
+	if got := fmt.Sprint(pages("")); got != "[[4 3] [2 1]]" {
+		t.Fatalf("expected the pages [[4 3] [2 1]], got %s", got)
+	}
+}
+
+func TestStreamEventsResumesAfterTheLastEventId(t *testing.T) {
+	events := &fakeEventService{events: []*model.Event{{
+		Base:      model.Base{Id: *uid.NewUID(11)},
+		EventType: constant.EventTypeEmailDelivered,
+	}}}
+	app := newTestApp(&service.Service{Event: events})
+
+	w := serve(t, NewEventAPI(app).StreamEvents(), http.MethodGet, "/events/stream?lastEventId=10", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if events.options.Cursor.String() != "10" {
+		t.Fatalf("expected the stream to resume after 10, got %s", events.options.Cursor)
+	}
+	if want := "id: 11\nevent: EMAIL_DELIVERED\n"; !strings.HasPrefix(w.Body.String(), want) {
+		t.Fatalf("expected the event 11, got %q", w.Body)
+	}
+
+	// the header of a reconnecting EventSource wins over the query
+	r := httptest.NewRequest(http.MethodGet, "/events/stream?lastEventId=10", nil)
+	r.Header.Set(HeaderLastEventId, "11")
+	w = serveRequest(t, NewEventAPI(app).StreamEvents(), r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if events.options.Cursor.String() != "11" {
+		t.Fatalf("expected the stream to resume after 11, got %s", events.options.Cursor)
+	}
+
+	w = serve(t, NewEventAPI(app).StreamEvents(), http.MethodGet, "/events/stream?lastEventId=last", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid last event id, got %d", w.Code)
+	}
+}
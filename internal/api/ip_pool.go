@@ -0,0 +1,339 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/core"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/service"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type createIPPoolRequestPayload struct {
+	Name        string                     `json:"name" validate:"required"`
+	Region      constant.AwsRegion         `json:"region" validate:"required"`
+	ScalingMode constant.IPPoolScalingMode `json:"scalingMode"` // STANDARD or MANAGED, defaults to STANDARD
+}
+
+type assignIPPoolRequestPayload struct {
+	IPPoolId string                 `json:"ipPoolId" validate:"required"`
+	DomainId *string                `json:"domainId"` // Every domain of the workspace in the region of the pool when not set
+	Stream   constant.MessageStream `json:"stream" validate:"required"`
+}
+
+type ipPoolAPI struct {
+	app *core.App
+}
+
+func NewIPPoolAPI(app *core.App) *ipPoolAPI {
+	return &ipPoolAPI{app: app}
+}
+
+func (p *ipPoolAPI) Route() func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Post("/ip-pools", p.CreateIPPool())
+		r.Get("/ip-pools", p.GetIPPools())
+		r.Get("/ip-pools/assignments", p.GetAssignments())
+		r.Put("/ip-pools/assignments", p.AssignIPPool())
+		r.Delete("/ip-pools/assignments/{assignmentId}", p.DeleteAssignment())
+		r.Get("/ip-pools/{ipPoolId}", p.GetIPPool())
+		r.Delete("/ip-pools/{ipPoolId}", p.DeleteIPPool())
+	}
+}
+
+// CreateIPPool creates a dedicated IP pool in the SES account of the
+// workspace
+func (p *ipPoolAPI) CreateIPPool() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := core.IdentityFromContext(r.Context())
+		pool, err := func() (*model.IPPool, *ApiError) {
+			payload := new(createIPPoolRequestPayload)
+			err := json.NewDecoder(r.Body).Decode(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			err = p.app.Validate.Struct(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			pool := &model.IPPool{
+				Name:        payload.Name,
+				Region:      payload.Region,
+				ScalingMode: payload.ScalingMode,
+				WorkspaceId: identity.WorkspaceId(),
+			}
+			err = p.app.Service.IPPool.Create(r.Context(), pool)
+			if errors.Is(err, service.ErrIPPoolExists) {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusConflict,
+				}
+			}
+			if errors.Is(err, service.ErrRegionNotEnabled) || errors.Is(err, service.ErrInvalidScalingMode) {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return pool, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"ipPool":  pool,
+		})
+	}
+}
+
+func (p *ipPoolAPI) GetIPPools() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := core.IdentityFromContext(r.Context())
+		pools, err := p.app.Service.IPPool.List(r.Context(), identity.WorkspaceId())
+		if err != nil {
+			renderError(w, r, &ApiError{
+				Error:      err,
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"ipPools": pools,
+		})
+	}
+}
+
+// GetIPPool returns the pool with the warm-up status of its dedicated IPs
+func (p *ipPoolAPI) GetIPPool() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pool, apiErr := p.findIPPool(r)
+		if apiErr != nil {
+			renderError(w, r, apiErr)
+			return
+		}
+		ips, err := p.app.Service.IPPool.DedicatedIPs(r.Context(), pool)
+		if err != nil {
+			renderError(w, r, &ApiError{
+				Error:      err,
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success":      true,
+			"ipPool":       pool,
+			"dedicatedIps": ips,
+		})
+	}
+}
+
+func (p *ipPoolAPI) DeleteIPPool() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := func() *ApiError {
+			pool, apiErr := p.findIPPool(r)
+			if apiErr != nil {
+				return apiErr
+			}
+			err := p.app.Service.IPPool.Delete(r.Context(), pool)
+			if errors.Is(err, service.ErrIPPoolInUse) {
+				return &ApiError{
+					Error:      err,
+					StatusCode: http.StatusConflict,
+				}
+			}
+			if err != nil {
+				return &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+		})
+	}
+}
+
+func (p *ipPoolAPI) GetAssignments() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := core.IdentityFromContext(r.Context())
+		assignments, err := p.app.Service.IPPool.Assignments(r.Context(), identity.WorkspaceId())
+		if err != nil {
+			renderError(w, r, &ApiError{
+				Error:      err,
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success":     true,
+			"assignments": assignments,
+		})
+	}
+}
+
+// AssignIPPool picks the pool the emails of the stream are sent from, for a
+// domain or for every domain of the workspace
+func (p *ipPoolAPI) AssignIPPool() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := core.IdentityFromContext(r.Context())
+		assignment, err := func() (*model.IPPoolAssignment, *ApiError) {
+			payload := new(assignIPPoolRequestPayload)
+			err := json.NewDecoder(r.Body).Decode(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			err = p.app.Validate.Struct(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			poolId, err := uid.NewUIDFromString(payload.IPPoolId)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			assignment := &model.IPPoolAssignment{
+				Stream:      payload.Stream,
+				IPPoolId:    *poolId,
+				WorkspaceId: identity.WorkspaceId(),
+			}
+			if payload.DomainId != nil {
+				assignment.DomainId, err = uid.NewUIDFromString(*payload.DomainId)
+				if err != nil {
+					return nil, &ApiError{
+						Error:      err,
+						StatusCode: http.StatusBadRequest,
+					}
+				}
+			}
+			err = p.app.Service.IPPool.Assign(r.Context(), assignment)
+			if errors.Is(err, service.ErrIPPoolNotApplied) {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+
+			return assignment, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success":    true,
+			"assignment": assignment,
+		})
+	}
+}
+
+func (p *ipPoolAPI) DeleteAssignment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := core.IdentityFromContext(r.Context())
+		err := func() *ApiError {
+			assignmentId, err := uid.NewUIDFromString(chi.URLParam(r, "assignmentId"))
+			if err != nil {
+				return &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			assignment, err := p.app.Service.IPPool.GetAssignment(r.Context(), *assignmentId)
+			if err != nil {
+				return &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+			if assignment == nil || assignment.WorkspaceId != identity.WorkspaceId() {
+				return &ApiError{
+					Error:      errors.New("assignment not found"),
+					StatusCode: http.StatusNotFound,
+				}
+			}
+			err = p.app.Service.IPPool.Unassign(r.Context(), assignment)
+			if err != nil {
+				return &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+		})
+	}
+}
+
+func (p *ipPoolAPI) findIPPool(r *http.Request) (*model.IPPool, *ApiError) {
+	identity := core.IdentityFromContext(r.Context())
+	poolId, err := uid.NewUIDFromString(chi.URLParam(r, "ipPoolId"))
+	if err != nil {
+		return nil, &ApiError{
+			Error:      err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	pool, err := p.app.Service.IPPool.Get(r.Context(), *poolId)
+	if err != nil {
+		return nil, &ApiError{
+			Error:      err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	if pool == nil || pool.WorkspaceId != identity.WorkspaceId() {
+		return nil, &ApiError{
+			Error:      errors.New("IP pool not found"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+
+	return pool, nil
+}
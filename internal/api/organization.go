@@ -2,12 +2,15 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"github.com/usesend0/send0/internal/core"
 	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/service"
+	"github.com/usesend0/send0/internal/uid"
 )
 
 type createOrganizationRequestPayload struct {
@@ -91,3 +94,24 @@ func (api *organizationApi) ListOrganizationsHandler() http.HandlerFunc {
 		render.JSON(w, r, ToPaginated(organizations, pageOptions, count))
 	}
 }
+
+// identityOrganizationId returns the organization of the workspace of the
+// request identity, resources created by the request belong to it
+func identityOrganizationId(app *core.App, r *http.Request) (uid.UID, *ApiError) {
+	identity := core.IdentityFromContext(r.Context())
+	organization, err := app.Service.Organization.Default(r.Context(), identity.WorkspaceId())
+	if errors.Is(err, service.ErrNoDefaultOrganization) {
+		return uid.UID{}, &ApiError{
+			Error:      err,
+			StatusCode: http.StatusConflict,
+		}
+	}
+	if err != nil {
+		return uid.UID{}, &ApiError{
+			Error:      err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+
+	return organization.Id, nil
+}
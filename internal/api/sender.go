@@ -0,0 +1,281 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/core"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/service"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type createSenderRequestPayload struct {
+	Address   string             `json:"address" validate:"required,email"`
+	Name      string             `json:"name"`
+	ReplyTo   *string            `json:"replyTo" validate:"omitempty,email"`
+	Region    constant.AwsRegion `json:"region"` // Required for a mailbox sender
+	IsDefault bool               `json:"isDefault"`
+}
+
+type updateSenderRequestPayload struct {
+	Name      *string `json:"name"`
+	ReplyTo   *string `json:"replyTo" validate:"omitempty,email"`
+	IsDefault *bool   `json:"isDefault"`
+}
+
+type senderAPI struct {
+	app *core.App
+}
+
+func NewSenderAPI(app *core.App) *senderAPI {
+	return &senderAPI{app: app}
+}
+
+func (s *senderAPI) Route() func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Post("/senders", s.CreateSender())
+		r.Get("/senders", s.GetSenders())
+		r.Get("/senders/{senderId}", s.GetSender())
+		r.Patch("/senders/{senderId}", s.UpdateSender())
+		r.Delete("/senders/{senderId}", s.DeleteSender())
+		r.Post("/senders/{senderId}/verify", s.VerifySender())
+	}
+}
+
+// CreateSender adds a sender address, an address outside of the domains of
+// the workspace is verified by SES with an email to the mailbox
+func (s *senderAPI) CreateSender() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := core.IdentityFromContext(r.Context())
+		sender, err := func() (*model.Sender, *ApiError) {
+			payload := new(createSenderRequestPayload)
+			err := json.NewDecoder(r.Body).Decode(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			err = s.app.Validate.Struct(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			sender := &model.Sender{
+				Address:     payload.Address,
+				Name:        payload.Name,
+				ReplyTo:     payload.ReplyTo,
+				Region:      payload.Region,
+				IsDefault:   payload.IsDefault,
+				WorkspaceId: identity.WorkspaceId(),
+			}
+			err = s.app.Service.Sender.Create(r.Context(), sender)
+			if errors.Is(err, service.ErrSenderExists) {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusConflict,
+				}
+			}
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+
+			return sender, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"sender":  sender,
+		})
+	}
+}
+
+func (s *senderAPI) GetSenders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := core.IdentityFromContext(r.Context())
+		senders, err := s.app.Service.Sender.List(r.Context(), identity.WorkspaceId())
+		if err != nil {
+			renderError(w, r, &ApiError{
+				Error:      err,
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"senders": senders,
+		})
+	}
+}
+
+func (s *senderAPI) GetSender() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sender, err := s.findSender(r)
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"sender":  sender,
+		})
+	}
+}
+
+func (s *senderAPI) UpdateSender() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sender, err := func() (*model.Sender, *ApiError) {
+			sender, apiErr := s.findSender(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			payload := new(updateSenderRequestPayload)
+			err := json.NewDecoder(r.Body).Decode(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			err = s.app.Validate.Struct(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			if payload.Name != nil {
+				sender.Name = *payload.Name
+			}
+			if payload.ReplyTo != nil {
+				sender.ReplyTo = payload.ReplyTo
+				// an empty reply-to removes the default
+				if *payload.ReplyTo == "" {
+					sender.ReplyTo = nil
+				}
+			}
+			err = s.app.Service.Sender.Update(r.Context(), sender)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			if payload.IsDefault != nil && *payload.IsDefault && !sender.IsDefault {
+				err = s.app.Service.Sender.SetDefault(r.Context(), sender)
+				if err != nil {
+					return nil, &ApiError{
+						Error:      err,
+						StatusCode: http.StatusInternalServerError,
+					}
+				}
+			}
+
+			return sender, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"sender":  sender,
+		})
+	}
+}
+
+func (s *senderAPI) DeleteSender() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := func() *ApiError {
+			sender, apiErr := s.findSender(r)
+			if apiErr != nil {
+				return apiErr
+			}
+			err := s.app.Service.Sender.Delete(r.Context(), sender)
+			if err != nil {
+				return &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+		})
+	}
+}
+
+// VerifySender refreshes the status of the sender from its domain or its SES
+// identity
+func (s *senderAPI) VerifySender() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sender, err := func() (*model.Sender, *ApiError) {
+			sender, apiErr := s.findSender(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			err := s.app.Service.Sender.Verify(r.Context(), sender)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return sender, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+			"sender":  sender,
+		})
+	}
+}
+
+func (s *senderAPI) findSender(r *http.Request) (*model.Sender, *ApiError) {
+	identity := core.IdentityFromContext(r.Context())
+	senderId, err := uid.NewUIDFromString(chi.URLParam(r, "senderId"))
+	if err != nil {
+		return nil, &ApiError{
+			Error:      err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	sender, err := s.app.Service.Sender.Get(r.Context(), *senderId)
+	if err != nil {
+		return nil, &ApiError{
+			Error:      err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	if sender == nil || sender.WorkspaceId != identity.WorkspaceId() {
+		return nil, &ApiError{
+			Error:      errors.New("sender not found"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+
+	return sender, nil
+}
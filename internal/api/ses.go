@@ -0,0 +1,61 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/usesend0/send0/internal/core"
+	"github.com/usesend0/send0/internal/service"
+)
+
+type sesAPI struct {
+	app *core.App
+}
+
+func NewSESAPI(app *core.App) *sesAPI {
+	return &sesAPI{app: app}
+}
+
+func (s *sesAPI) Route() func(r chi.Router) {
+	return func(r chi.Router) {
+		r.Get("/ses/accounts", s.GetAccounts())
+	}
+}
+
+// GetAccounts returns the SES sending quota and status of every region with
+// the bounce and complaint rates of the workspace
+func (s *sesAPI) GetAccounts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := core.IdentityFromContext(r.Context())
+		accounts, err := s.app.Service.Reputation.Accounts(r.Context(), identity.WorkspaceId())
+		if errors.Is(err, service.ErrAWSAccountNotActive) {
+			renderError(w, r, &ApiError{
+				Error:      err,
+				StatusCode: http.StatusConflict,
+			})
+			return
+		}
+		if err != nil {
+			renderError(w, r, &ApiError{
+				Error:      err,
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		reputation, err := s.app.Service.Reputation.Metrics(r.Context(), identity.WorkspaceId())
+		if err != nil {
+			renderError(w, r, &ApiError{
+				Error:      err,
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success":    true,
+			"accounts":   accounts,
+			"reputation": reputation,
+		})
+	}
+}
@@ -1,12 +1,30 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
 	"github.com/usesend0/send0/internal/core"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
 )
 
+type createWebhookRequestPayload struct {
+	URL         string                   `json:"url" validate:"required,url"`
+	Events      []string                 `json:"events" validate:"required,min=1"`
+	Enabled     *bool                    `json:"enabled"`
+	SigningMode model.WebhookSigningMode `json:"signingMode" validate:"omitempty,oneof=RSA HMAC_SHA256 ED25519"`
+}
+
+type updateWebhookRequestPayload struct {
+	URL     *string  `json:"url" validate:"omitempty,url"`
+	Events  []string `json:"events" validate:"omitempty,min=1"`
+	Enabled *bool    `json:"enabled"`
+}
+
 type webhookAPI struct {
 	app *core.App
 }
@@ -22,35 +40,327 @@ func (w *webhookAPI) Route() func(r chi.Router) {
 		r.Get("/webhooks/{webhookId}", w.GetWebhook())
 		r.Patch("/webhooks/{webhookId}", w.UpdateWebhook())
 		r.Delete("/webhooks/{webhookId}", w.DeleteWebhook())
+		r.Post("/webhooks/{webhookId}/rotate-key", w.RotateWebhookKey())
+		r.Post("/webhooks/{webhookId}/test", w.TestWebhook())
+		r.Get("/webhooks/{webhookId}/events", w.GetWebhookEvents())
+		r.Post("/webhooks/{webhookId}/events/{eventId}/redeliver", w.RedeliverWebhookEvent())
+	}
+}
+
+func (w *webhookAPI) CreateWebhook() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		identity := core.IdentityFromContext(r.Context())
+		webhook, err := func() (*model.Webhook, *ApiError) {
+			payload := new(createWebhookRequestPayload)
+			err := json.NewDecoder(r.Body).Decode(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			err = w.app.Validate.Struct(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			webhook := &model.Webhook{
+				Status:      model.WebhookStatusActive,
+				URL:         payload.URL,
+				Events:      payload.Events,
+				SigningMode: payload.SigningMode,
+				WorkspaceId: identity.WorkspaceId(),
+			}
+			if payload.Enabled != nil && !*payload.Enabled {
+				webhook.Status = model.WebhookStatusInactive
+			}
+			webhook, err = w.app.Service.Webhook.Create(r.Context(), webhook)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+
+			return webhook, nil
+		}()
+		if err != nil {
+			renderError(rw, r, err)
+			return
+		}
+		render.JSON(rw, r, map[string]interface{}{
+			"success": true,
+			"webhook": webhook,
+		})
+	}
+}
+
+func (w *webhookAPI) GetWebhooks() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		identity := core.IdentityFromContext(r.Context())
+		webhooks, err := w.app.Service.Webhook.List(r.Context(), identity.WorkspaceId())
+		if err != nil {
+			renderError(rw, r, &ApiError{
+				Error:      err,
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		render.JSON(rw, r, map[string]interface{}{
+			"success":  true,
+			"webhooks": webhooks,
+		})
+	}
+}
+
+func (w *webhookAPI) GetWebhook() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		webhook, err := w.findWebhook(r)
+		if err != nil {
+			renderError(rw, r, err)
+			return
+		}
+		render.JSON(rw, r, map[string]interface{}{
+			"success": true,
+			"webhook": webhook,
+		})
 	}
 }
 
-func (w *webhookAPI) CreateWebhook() func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Create webhook
+func (w *webhookAPI) UpdateWebhook() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		webhook, err := func() (*model.Webhook, *ApiError) {
+			webhook, apiErr := w.findWebhook(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			payload := new(updateWebhookRequestPayload)
+			err := json.NewDecoder(r.Body).Decode(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			err = w.app.Validate.Struct(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			if payload.URL != nil {
+				webhook.URL = *payload.URL
+			}
+			if payload.Events != nil {
+				webhook.Events = payload.Events
+			}
+			if payload.Enabled != nil {
+				webhook.Status = model.WebhookStatusInactive
+				if *payload.Enabled {
+					webhook.Status = model.WebhookStatusActive
+				}
+			}
+			err = w.app.Service.Webhook.Update(r.Context(), webhook)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+
+			return webhook, nil
+		}()
+		if err != nil {
+			renderError(rw, r, err)
+			return
+		}
+		render.JSON(rw, r, map[string]interface{}{
+			"success": true,
+			"webhook": webhook,
+		})
+	}
+}
+
+func (w *webhookAPI) DeleteWebhook() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		err := func() *ApiError {
+			webhook, apiErr := w.findWebhook(r)
+			if apiErr != nil {
+				return apiErr
+			}
+			err := w.app.Service.Webhook.Delete(r.Context(), webhook)
+			if err != nil {
+				return &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return nil
+		}()
+		if err != nil {
+			renderError(rw, r, err)
+			return
+		}
+		render.JSON(rw, r, map[string]interface{}{
+			"success": true,
+		})
+	}
+}
+
+func (w *webhookAPI) RotateWebhookKey() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		webhook, err := func() (*model.Webhook, *ApiError) {
+			webhook, apiErr := w.findWebhook(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			err := w.app.Service.Webhook.RotateSigningKey(r.Context(), webhook)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return webhook, nil
+		}()
+		if err != nil {
+			renderError(rw, r, err)
+			return
+		}
+		render.JSON(rw, r, map[string]interface{}{
+			"success": true,
+			"webhook": webhook,
+		})
 	}
 }
 
-func (w *webhookAPI) GetWebhooks() func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Get webhooks
+func (w *webhookAPI) TestWebhook() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		request, err := func() (*model.WehbookRequest, *ApiError) {
+			webhook, apiErr := w.findWebhook(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			request, err := w.app.Service.Webhook.Test(r.Context(), webhook)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadGateway,
+				}
+			}
+
+			return request, nil
+		}()
+		if err != nil {
+			renderError(rw, r, err)
+			return
+		}
+		render.JSON(rw, r, map[string]interface{}{
+			"success": true,
+			"request": request,
+		})
 	}
 }
 
-func (w *webhookAPI) GetWebhook() func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Get webhook
+func (w *webhookAPI) GetWebhookEvents() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		pageOptions := NewPageOptions(r)
+		webhook, apiErr := w.findWebhook(r)
+		if apiErr != nil {
+			renderError(rw, r, apiErr)
+			return
+		}
+		logs, count, err := w.app.Repository.Webhook.FindLogs(r.Context(), model.WebhookLogFindOptions{
+			WebhookId: webhook.Id,
+			Offset:    pageOptions.Skip(),
+			Limit:     pageOptions.Take,
+		})
+		if err != nil {
+			renderError(rw, r, &ApiError{
+				Error:      err,
+				StatusCode: http.StatusInternalServerError,
+			})
+			return
+		}
+		render.JSON(rw, r, ToPaginated(logs, pageOptions, count))
 	}
 }
 
-func (w *webhookAPI) UpdateWebhook() func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Update webhook
+func (w *webhookAPI) RedeliverWebhookEvent() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		log, err := func() (*model.WebhookEvent, *ApiError) {
+			webhook, apiErr := w.findWebhook(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			eventId, err := uid.NewUIDFromString(chi.URLParam(r, "eventId"))
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			log, err := w.app.Repository.Webhook.FindLogById(r.Context(), *eventId)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+			if log == nil || log.WebhookId != webhook.Id {
+				return nil, &ApiError{
+					Error:      errors.New("webhook event not found"),
+					StatusCode: http.StatusNotFound,
+				}
+			}
+			err = w.app.Service.Webhook.Redeliver(r.Context(), webhook, log)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return log, nil
+		}()
+		if err != nil {
+			renderError(rw, r, err)
+			return
+		}
+		render.JSON(rw, r, map[string]interface{}{
+			"success": true,
+			"event":   log,
+		})
 	}
 }
 
-func (w *webhookAPI) DeleteWebhook() func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Delete webhook
+func (w *webhookAPI) findWebhook(r *http.Request) (*model.Webhook, *ApiError) {
+	identity := core.IdentityFromContext(r.Context())
+	webhookId, err := uid.NewUIDFromString(chi.URLParam(r, "webhookId"))
+	if err != nil {
+		return nil, &ApiError{
+			Error:      err,
+			StatusCode: http.StatusBadRequest,
+		}
 	}
+	webhook, err := w.app.Service.Webhook.Get(r.Context(), *webhookId)
+	if err != nil {
+		return nil, &ApiError{
+			Error:      err,
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	if webhook == nil || webhook.WorkspaceId != identity.WorkspaceId() {
+		return nil, &ApiError{
+			Error:      errors.New("webhook not found"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+
+	return webhook, nil
 }
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -29,6 +30,10 @@ type inviteUserRequestPayload struct {
 	OrganizationId uid.UID  `json:"organizationId" validate:"required"`
 }
 
+type updateAWSAccountRequestPayload struct {
+	RoleArn string `json:"roleArn" validate:"required"`
+}
+
 type workspaceAPI struct {
 	app *core.App
 }
@@ -47,6 +52,9 @@ func (api *workspaceAPI) Route() func(r chi.Router) {
 		r.Post("/{id}/invite", api.InviteUserHandler())
 		r.Post("/{id}/team", api.CreateTeamHandler())
 		r.Post("/{id}/team/{teamId}/users", api.InviteUserHandler())
+		r.Get("/{id}/aws-account", api.GetAWSAccountHandler())
+		r.Put("/{id}/aws-account", api.UpdateAWSAccountHandler())
+		r.Delete("/{id}/aws-account", api.DeleteAWSAccountHandler())
 	}
 }
 
@@ -360,3 +368,164 @@ func (api *workspaceAPI) createWorkspace(ctx context.Context, workspace *model.W
 
 	return err
 }
+
+func (api *workspaceAPI) GetAWSAccountHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		account, err := func() (*model.AWSAccount, *ApiError) {
+			workspaceId, apiErr := api.identityWorkspaceId(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			account, err := api.app.Service.AWSAccount.Get(r.Context(), workspaceId)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+			if account == nil {
+				return nil, &ApiError{
+					Error:      errors.New("aws account not found"),
+					StatusCode: http.StatusNotFound,
+				}
+			}
+
+			return account, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success":    true,
+			"awsAccount": account,
+		})
+	}
+}
+
+// UpdateAWSAccountHandler makes the workspace send through the AWS account of
+// the role, the role must trust the operator account with the external id
+func (api *workspaceAPI) UpdateAWSAccountHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		account, err := func() (*model.AWSAccount, *ApiError) {
+			workspaceId, apiErr := api.identityWorkspaceId(r)
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			payload := new(updateAWSAccountRequestPayload)
+			err := json.NewDecoder(r.Body).Decode(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			err = api.app.Validate.Struct(payload)
+			if err != nil {
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			}
+			account := &model.AWSAccount{
+				RoleArn:     payload.RoleArn,
+				WorkspaceId: workspaceId,
+			}
+			err = api.app.Service.AWSAccount.Connect(r.Context(), account)
+			switch {
+			case errors.Is(err, service.ErrAWSAccountInUse), errors.Is(err, service.ErrRoleArnConnected):
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusConflict,
+				}
+			case errors.Is(err, service.ErrInvalidRoleArn), errors.Is(err, service.ErrAWSAccountFailed):
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusBadRequest,
+				}
+			case err != nil:
+				return nil, &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return account, nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success":    true,
+			"awsAccount": account,
+		})
+	}
+}
+
+func (api *workspaceAPI) DeleteAWSAccountHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := func() *ApiError {
+			workspaceId, apiErr := api.identityWorkspaceId(r)
+			if apiErr != nil {
+				return apiErr
+			}
+			account, err := api.app.Service.AWSAccount.Get(r.Context(), workspaceId)
+			if err != nil {
+				return &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+			if account == nil {
+				return &ApiError{
+					Error:      errors.New("aws account not found"),
+					StatusCode: http.StatusNotFound,
+				}
+			}
+			err = api.app.Service.AWSAccount.Disconnect(r.Context(), account)
+			if errors.Is(err, service.ErrAWSAccountInUse) {
+				return &ApiError{
+					Error:      err,
+					StatusCode: http.StatusConflict,
+				}
+			}
+			if err != nil {
+				return &ApiError{
+					Error:      err,
+					StatusCode: http.StatusInternalServerError,
+				}
+			}
+
+			return nil
+		}()
+		if err != nil {
+			renderError(w, r, err)
+			return
+		}
+		render.JSON(w, r, map[string]interface{}{
+			"success": true,
+		})
+	}
+}
+
+// identityWorkspaceId returns the workspace of the path, only the workspace
+// of the identity can be managed
+func (api *workspaceAPI) identityWorkspaceId(r *http.Request) (uid.UID, *ApiError) {
+	identity := core.IdentityFromContext(r.Context())
+	workspaceId, err := uid.NewUIDFromString(chi.URLParam(r, "id"))
+	if err != nil {
+		return uid.UID{}, &ApiError{
+			Error:      err,
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+	if *workspaceId != identity.WorkspaceId() {
+		return uid.UID{}, &ApiError{
+			Error:      errors.New("workspace not found"),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+
+	return *workspaceId, nil
+}
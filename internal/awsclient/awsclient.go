@@ -0,0 +1,78 @@
+package awsclient
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Credentials are the keys the requests are signed with, the role is assumed
+// with the keys when set, e.g. a role of another AWS account
+type Credentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	RoleArn         string
+	ExternalId      string // Required by roles which trust a third party
+}
+
+// NewClient creates the client of a service in the region
+type NewClient[T any] func(region string, credentials aws.CredentialsProvider) T
+
+type cacheKey struct {
+	region      string
+	credentials Credentials
+}
+
+// Cache creates a client on the first use of a region and credentials and
+// reuses it after, assumed role credentials are refreshed before they expire
+type Cache[T any] struct {
+	mu        sync.Mutex
+	clients   map[cacheKey]T
+	newClient NewClient[T]
+}
+
+func NewCache[T any](newClient NewClient[T]) *Cache[T] {
+	return &Cache[T]{
+		clients:   make(map[cacheKey]T),
+		newClient: newClient,
+	}
+}
+
+func (c *Cache[T]) Get(region string, credentials Credentials) T {
+	key := cacheKey{region: region, credentials: credentials}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	client, ok := c.clients[key]
+	if !ok {
+		client = c.newClient(region, CredentialsProvider(region, credentials))
+		c.clients[key] = client
+	}
+
+	return client
+}
+
+// CredentialsProvider returns the cached provider of the credentials, the STS
+// endpoint of the region assumes the role
+func CredentialsProvider(region string, c Credentials) aws.CredentialsProvider {
+	var provider aws.CredentialsProvider = credentials.NewStaticCredentialsProvider(
+		c.AccessKeyId,
+		c.SecretAccessKey,
+		"",
+	)
+	if c.RoleArn != "" {
+		stsClient := sts.New(sts.Options{
+			Region:      region,
+			Credentials: provider,
+		})
+		provider = stscreds.NewAssumeRoleProvider(stsClient, c.RoleArn, func(o *stscreds.AssumeRoleOptions) {
+			if c.ExternalId != "" {
+				o.ExternalID = aws.String(c.ExternalId)
+			}
+		})
+	}
+
+	return aws.NewCredentialsCache(provider)
+}
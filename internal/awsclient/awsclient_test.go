@@ -0,0 +1,45 @@
+package awsclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestCacheReusesTheClientOfTheRegionAndCredentials(t *testing.T) {
+	created := 0
+	cache := NewCache(func(_ string, credentials aws.CredentialsProvider) aws.CredentialsProvider {
+		created++
+		return credentials
+	})
+	operator := Credentials{AccessKeyId: "AKIAOPERATOR", SecretAccessKey: "secret"}
+	role := operator
+	role.RoleArn = "arn:aws:iam::123456789012:role/send0"
+	role.ExternalId = "external"
+
+	provider := cache.Get("us-east-1", operator)
+	if cache.Get("us-east-1", operator) != provider {
+		t.Fatal("expected the client of the region and credentials to be reused")
+	}
+	cache.Get("eu-west-1", operator)
+	assumed := cache.Get("us-east-1", role)
+	if cache.Get("us-east-1", role) != assumed {
+		t.Fatal("expected the client of the role to be reused")
+	}
+	if created != 3 {
+		t.Fatalf("expected a client for every region and credentials, got %d", created)
+	}
+	// the reused client keeps the assumed role credentials until they expire
+	if _, ok := assumed.(*aws.CredentialsCache); !ok {
+		t.Fatalf("expected cached credentials of the role, got %T", assumed)
+	}
+
+	credentials, err := provider.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials.AccessKeyID != "AKIAOPERATOR" || credentials.SecretAccessKey != "secret" {
+		t.Fatalf("expected the operator keys, got %s", credentials.AccessKeyID)
+	}
+}
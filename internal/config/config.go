@@ -12,14 +12,21 @@ type Config struct {
 	Postgres       Postgres     `required:"true"`
 	Redis          Redis        `required:"true"`
 	Authn          Authn        `required:"true"`
+	OptIn          OptIn        `required:"true"`
+	Broadcast      Broadcast    `required:"true"`
+	Webhook        Webhook      `required:"true"`
+	EventBus       EventBus     `required:"true"`
+	Domain         Domain       `required:"true"`
 	SES            SES          `required:"true"`
 	S3             S3           `required:"true"`
 	SNS            SNS          `required:"true"`
+	Reputation     Reputation   `required:"true"`
 	Env            constant.Env `default:"DEVELOPMENT"`
 	JWT            JWT          `required:"true"`
 	AdminEmail     string       `required:"true" default:"admin@send0.com"`
 	WorkspaceId    int          `default:"123456789"`
 	OrganizationId int          `default:"123456789"`
+	EncryptionKey  string       `required:"false"` // Base64 encoded 32 byte key, encrypts the secrets stored in the database
 }
 
 type Postgres struct {
@@ -40,15 +47,72 @@ type Authn struct {
 	OtpVerifyRateLimitWindow   int `default:"86400"`
 }
 
+type OptIn struct {
+	LinkExpiryInHours int `default:"72"`
+}
+
+type Broadcast struct {
+	BatchSize                  int `default:"100"`
+	SchedulerIntervalInSeconds int `default:"60"`
+	LeaseInSeconds             int `default:"60"` // A replica which stops renewing its running broadcast for this long loses it to another
+	TypicalOpenHour            int `default:"10"` // Local hour most contacts open emails, used to infer timezones
+	MinOpensForTimeZone        int `default:"3"`  // Opens needed before a timezone is inferred
+}
+
+type Webhook struct {
+	TimeoutInSeconds     int `default:"10"`
+	DisableAfterFailures int `default:"100"` // Consecutive failed requests before a webhook is disabled
+}
+
+type Domain struct {
+	VerificationIntervalInSeconds int    `default:"600"` // How often the records of a domain are checked
+	VerificationBatchSize         int    `default:"50"`
+	DKIMKeySize                   int    `default:"2048"`
+	DKIMSelectorFormat            string `default:"dated"`             // dated or counter
+	DKIMRotationIntervalInDays    int    `default:"180"`               // 0 disables the scheduled rotation
+	DKIMOverlapInHours            int    `default:"72"`                // How long the previous key stays published after a rotation
+	MailFromBehaviorOnMXFailure   string `default:"USE_DEFAULT_VALUE"` // USE_DEFAULT_VALUE or REJECT_MESSAGE
+}
+
+type EventBus struct {
+	Driver               string `default:"redis"` // redis or memory
+	Stream               string `default:"events"`
+	MaxLen               int64  `default:"100000"`
+	BatchSize            int64  `default:"10"`
+	PendingIdleInSeconds int    `default:"60"` // Pending events are handled again after this
+	MaxDeliveries        int64  `default:"10"`
+}
+
 type SES struct {
-	AccessKeyId     string `required:"true"`
-	SecretAccessKey string `required:"true"`
+	AccessKeyId            string               `required:"true"`
+	SecretAccessKey        string               `required:"true"`
+	RoleArn                string               `required:"false"` // Assumed with the keys, e.g. a role of another AWS account
+	ExternalId             string               `required:"false"`
+	Regions                []constant.AwsRegion `default:"us-east-1,eu-west-1,sa-east-1,ap-northeast-1"` // Regions domains can be created in
+	RegionAccessKeyIds     map[string]string    `required:"false"`                                       // Keys of a region, region:key
+	RegionSecretAccessKeys map[string]string    `required:"false"`
+	RegionRoleArns         map[string]string    `required:"false"`
+	DefaultMaxSendRate     float64              `default:"1"` // Used when the account send rate can not be fetched
 }
 
 type SNS struct {
-	AccessKeyId     string `required:"true"`
-	SecretAccessKey string `required:"true"`
-	EndPoint        string `required:"false"`
+	AccessKeyId                   string `required:"true"`
+	SecretAccessKey               string `required:"true"`
+	EndPoint                      string `required:"false"`
+	MaxMessageAgeInSeconds        int    `default:"3600"`   // Older notifications are rejected as replays
+	Delivery                      string `default:"http"`   // http or sqs, sqs doesn't require a public endpoint
+	SNSEndPoint                   string `required:"false"` // Overrides the SNS endpoint, e.g. LocalStack, its certificates are trusted in development
+	SQSEndPoint                   string `required:"false"` // Overrides the SQS endpoint, e.g. a local SQS compatible server
+	SQSWaitTimeInSeconds          int32  `default:"20"`
+	SQSVisibilityTimeoutInSeconds int32  `default:"60"`
+	SQSMaxReceiveCount            int    `default:"10"` // Messages which fail more often are dropped
+}
+
+type Reputation struct {
+	WindowInHours          int     `default:"24"`    // Period the bounce and complaint rates are computed over
+	MinSent                int     `default:"100"`   // Emails sent in the window before the rates are checked
+	BounceRateThreshold    float64 `default:"0.05"`  // SES reviews accounts above 5%
+	ComplaintRateThreshold float64 `default:"0.001"` // SES reviews accounts above 0.1%
 }
 
 type S3 struct {
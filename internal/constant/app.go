@@ -12,6 +12,7 @@ const DialectPostgres = "postgres"
 
 const AppName = "send0"
 const SNSEventPath = "/sns/events"
+const OptInConfirmPath = "/contacts/confirm"
 const (
 	HeaderAuthorization = "authorization"
 	HeaderWorkspaceId   = "x-workspace-id"
@@ -18,13 +18,41 @@ const (
 	AwsSNSTopicStatusPending  AwsSNSTopicStatus = "PENDING"
 )
 
+const (
+	AwsSNSDeliveryHTTP = "http"
+	AwsSNSDeliverySQS  = "sqs"
+)
+
 const AwsSESEventTopicSuccessMessage string = "Successfully validated SNS topic for Amazon SES event publishing."
 
+const AwsSESBounceTypePermanent string = "Permanent"
+
+// SupportedSESRegions are the regions SES is available in, the regions domains
+// can be created in are configured from these
 var SupportedSESRegions = []AwsRegion{
 	AwsRegionNorthVirginia,
+	"us-east-2",
+	"us-west-1",
+	"us-west-2",
+	"af-south-1",
+	"ap-south-1",
+	AwsRegionTokyo,
+	"ap-northeast-2",
+	"ap-northeast-3",
+	"ap-southeast-1",
+	"ap-southeast-2",
+	"ap-southeast-3",
+	"ca-central-1",
+	"eu-central-1",
 	AwsRegionIreland,
+	"eu-west-2",
+	"eu-west-3",
+	"eu-north-1",
+	"eu-south-1",
+	"il-central-1",
+	"me-south-1",
 	AwsRegionSaopaulo,
-	AwsRegionTokyo,
+	"us-gov-west-1",
 }
 
 var _ sql.Scanner = (*AwsRegion)(nil)
@@ -5,6 +5,11 @@ const (
 	SecretKeyLength = 32
 )
 
+const (
+	TokenScopeOptIn       = "OPT_IN"
+	TokenScopeEventStream = "EVENT_STREAM"
+)
+
 var (
 	LowerLetters = []rune("abcdefghijklmnopqrstuvwxyz")
 	UpperLetters = []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZ")
@@ -10,15 +10,44 @@ import (
 const CustomDomainPrefix = "ses"
 
 const (
-	DomainStatusActive   DomainStatus = "ACTIVE"
-	DomainStatusInactive DomainStatus = "INACTIVE"
-	DomainStatusPending  DomainStatus = "PENDING"
+	DKIMSelectorFormatDated   = "dated"   // send0-20240701
+	DKIMSelectorFormatCounter = "counter" // send0-1, send0-2, ...
+)
+
+const (
+	DomainStatusActive     DomainStatus = "ACTIVE"
+	DomainStatusInactive   DomainStatus = "INACTIVE"
+	DomainStatusPending    DomainStatus = "PENDING"
+	DomainStatusIncomplete DomainStatus = "INCOMPLETE" // Some of the records are set up
 )
 
 const (
 	DNSStatusActive     DNSStatus = "ACTIVE"
 	DNSStatusPending    DNSStatus = "PENDING"
-	DNSStatusIncomplete DNSStatus = "INCOMPLETE"
+	DNSStatusIncomplete DNSStatus = "INCOMPLETE" // A record exists with a different value
+	DNSStatusInactive   DNSStatus = "INACTIVE"
+)
+
+// MailFromStatus is the SES status of the custom MAIL FROM domain
+const (
+	MailFromStatusPending          MailFromStatus = "PENDING"
+	MailFromStatusSuccess          MailFromStatus = "SUCCESS"
+	MailFromStatusFailed           MailFromStatus = "FAILED"
+	MailFromStatusTemporaryFailure MailFromStatus = "TEMPORARY_FAILURE"
+)
+
+// MailFromBehavior is what SES does when the MX record of the custom MAIL FROM
+// domain is not found
+const (
+	MailFromBehaviorUseDefaultValue MailFromBehavior = "USE_DEFAULT_VALUE" // Sends from amazonses.com, SPF is not aligned
+	MailFromBehaviorRejectMessage   MailFromBehavior = "REJECT_MESSAGE"
+)
+
+// FailoverPolicy is when the emails of a domain are sent from its failover
+// region
+const (
+	FailoverPolicyNone       FailoverPolicy = "NONE"
+	FailoverPolicyOnThrottle FailoverPolicy = "ON_THROTTLE" // The primary region rejected the email for its send rate or quota
 )
 
 var _ sql.Scanner = (*JSONDomainRecords)(nil)
@@ -26,7 +55,10 @@ var _ driver.Valuer = (*JSONDomainRecords)(nil)
 
 type DomainStatus string
 type DNSStatus string
-type domainRecord struct {
+type MailFromStatus string
+type MailFromBehavior string
+type FailoverPolicy string
+type DomainRecord struct {
 	Name     string    `json:"name"`
 	Value    string    `json:"value"`
 	Type     string    `json:"type"`
@@ -35,11 +67,11 @@ type domainRecord struct {
 	Status   DNSStatus `json:"status"`
 }
 
-type JSONDomainRecords []domainRecord
+type JSONDomainRecords []DomainRecord
 
 func (r *JSONDomainRecords) Scan(value interface{}) error {
 	if value == nil {
-		*r = []domainRecord{}
+		*r = []DomainRecord{}
 		return nil
 	}
 	switch v := value.(type) {
@@ -54,7 +86,7 @@ func (r *JSONDomainRecords) Scan(value interface{}) error {
 
 func (r JSONDomainRecords) Value() (driver.Value, error) {
 	if r == nil {
-		return json.Marshal([]domainRecord{})
+		return json.Marshal([]DomainRecord{})
 	}
 
 	return json.Marshal(r)
@@ -15,10 +15,35 @@ const (
 	EventTypeEmailDeliveryDelayed EventType = "EMAIL_DELIVERY_DELAYED"
 	EventTypeLinkClicked          EventType = "LINK_CLICKED"
 	EventTypeOptIn                EventType = "OPT_IN"
+	EventTypeWebhookFailed        EventType = "WEBHOOK_FAILED"
+	EventTypeDomainVerified       EventType = "DOMAIN_VERIFIED"
+	EventTypeDomainFailed         EventType = "DOMAIN_FAILED"
+	EventTypeBounceRateHigh       EventType = "BOUNCE_RATE_HIGH"
+	EventTypeComplaintRateHigh    EventType = "COMPLAINT_RATE_HIGH"
 )
 
 type EventType string
 
+// EventTypes are the event types webhooks can subscribe to
+var EventTypes = []EventType{
+	EventTypeEmailSend,
+	EventTypeEmailSendFailed,
+	EventTypeEmailOpened,
+	EventTypeEmailClicked,
+	EventTypeEmailBounced,
+	EventTypeEmailReported,
+	EventTypeEmailRejected,
+	EventTypeEmailDelivered,
+	EventTypeEmailUnsubsribed,
+	EventTypeEmailDeliveryDelayed,
+	EventTypeLinkClicked,
+	EventTypeOptIn,
+	EventTypeDomainVerified,
+	EventTypeDomainFailed,
+	EventTypeBounceRateHigh,
+	EventTypeComplaintRateHigh,
+}
+
 var AwsSESEventTypeToEventType = map[types.EventType]EventType{
 	types.EventTypeSend:          EventTypeEmailSend,
 	types.EventTypeOpen:          EventTypeEmailOpened,
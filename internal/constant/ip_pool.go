@@ -0,0 +1,17 @@
+package constant
+
+// MessageStream is the kind of emails an IP pool is picked for
+const (
+	MessageStreamTransactional MessageStream = "TRANSACTIONAL" // Emails sent through the API
+	MessageStreamMarketing     MessageStream = "MARKETING"     // Broadcast emails
+)
+
+// IPPoolScalingMode is how the dedicated IPs of a pool are managed, SES
+// leases and warms up the IPs of a MANAGED pool itself
+const (
+	IPPoolScalingModeStandard IPPoolScalingMode = "STANDARD"
+	IPPoolScalingModeManaged  IPPoolScalingMode = "MANAGED"
+)
+
+type MessageStream string
+type IPPoolScalingMode string
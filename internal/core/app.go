@@ -10,6 +10,7 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/usesend0/send0/internal/config"
 	"github.com/usesend0/send0/internal/crypto"
+	"github.com/usesend0/send0/internal/eventbus"
 	"github.com/usesend0/send0/internal/health"
 	"github.com/usesend0/send0/internal/model"
 	"github.com/usesend0/send0/internal/service"
@@ -58,7 +59,12 @@ func NewApp(ctx context.Context, cfg *config.Config) (*App, error) {
 	}
 	baseRepository := model.NewBaseRepository(cache, db, uidGenerator, logger)
 	repository := model.NewRepository(baseRepository)
-	service, err := service.NewService(service.NewBaseService(cfg, uidGenerator, logger, repository))
+	eventBus, err := eventbus.NewEventBus(cfg, cache, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to setup event bus")
+		return nil, err
+	}
+	service, err := service.NewService(service.NewBaseService(cfg, uidGenerator, logger, repository, eventBus))
 	if err != nil {
 		logger.Error().Err(err).Msg("failed to setup service")
 		return nil, err
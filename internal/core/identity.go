@@ -36,7 +36,7 @@ func NewIdentity(options IdentityOptions) (Identity, error) {
 	}
 	identity.userId = *uid.NewUID(int64(userId))
 	// Parse workspace ID if provided
-	if options.WorkspaceId == nil {
+	if options.WorkspaceId != nil {
 		workspaceId, err := strconv.Atoi(*options.WorkspaceId)
 		if err != nil {
 			return nil, err
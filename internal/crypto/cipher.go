@@ -0,0 +1,61 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+)
+
+const encryptionKeySize = 32
+
+var ErrInvalidEncryptionKey = errors.New("encryption key must be 32 base64 encoded bytes")
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// Encrypt seals the plaintext with AES-256-GCM, the key is base64 encoded and
+// the nonce is prepended to the ciphertext
+func Encrypt(encodedKey string, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(encodedKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt opens a ciphertext sealed by Encrypt
+func Decrypt(encodedKey string, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(encodedKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(encodedKey string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) != encryptionKeySize {
+		return nil, ErrInvalidEncryptionKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -25,6 +25,9 @@ type claims struct {
 	FirstName string `json:"firstName,omitempty"`
 	LastName  string `json:"lastName,omitempty"`
 	Email     string `json:"email,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	// WorkspaceId is the workspace a scoped token is limited to
+	WorkspaceId string `json:"workspaceId,omitempty"`
 }
 
 type JWTClaimOptions = func(*claims)
@@ -83,6 +86,31 @@ func (j *JWT) NewAccessToken(
 }
 
 func (j *JWT) VerifyAccessToken(accessToken string) (*claims, error) {
+	claims, err := j.verify(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	// scoped tokens are single purpose and must never grant api access
+	if claims.Scope != "" {
+		return nil, errors.New("invalid access token")
+	}
+
+	return claims, nil
+}
+
+func (j *JWT) VerifyScopedToken(token string, scope string) (*claims, error) {
+	claims, err := j.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	if scope == "" || claims.Scope != scope {
+		return nil, errors.New("invalid token scope")
+	}
+
+	return claims, nil
+}
+
+func (j *JWT) verify(accessToken string) (*claims, error) {
 	claims := &claims{}
 	token, err := jwt.ParseWithClaims(accessToken, claims, func(t *jwt.Token) (any, error) {
 		if t.Method.Alg() != jwt.SigningMethodRS256.Name {
@@ -131,6 +159,18 @@ func WithLastName(lastName string) JWTClaimOptions {
 	}
 }
 
+func WithScope(scope string) JWTClaimOptions {
+	return func(c *claims) {
+		c.Scope = scope
+	}
+}
+
+func WithWorkspaceId(workspaceId string) JWTClaimOptions {
+	return func(c *claims) {
+		c.WorkspaceId = workspaceId
+	}
+}
+
 func WithExpiresIn(expiresIn time.Duration) JWTClaimOptions {
 	return func(c *claims) {
 		c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(expiresIn))
@@ -0,0 +1,202 @@
+package dnsprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var _ DNSProvider = (*CloudflareProvider)(nil)
+
+const cloudflareBaseURL = "https://api.cloudflare.com/client/v4"
+
+type CloudflareCredentials struct {
+	APIToken string `json:"apiToken"`
+	ZoneId   string `json:"zoneId"` // Looked up by the zone name when empty
+}
+
+type CloudflareProvider struct {
+	client   *http.Client
+	baseURL  string
+	apiToken string
+	zoneId   string
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+type cloudflareRecord struct {
+	Id       string `json:"id,omitempty"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Content  string `json:"content"`
+	TTL      int    `json:"ttl"`
+	Priority *int   `json:"priority,omitempty"`
+}
+
+func NewCloudflareProvider(c CloudflareCredentials) (*CloudflareProvider, error) {
+	if c.APIToken == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &CloudflareProvider{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		baseURL:  cloudflareBaseURL,
+		apiToken: c.APIToken,
+		zoneId:   c.ZoneId,
+	}, nil
+}
+
+func (p *CloudflareProvider) Upsert(ctx context.Context, zone string, record Record) error {
+	zoneId, err := p.findZoneId(ctx, zone)
+	if err != nil {
+		return err
+	}
+	existing, err := p.findRecords(ctx, zoneId, record)
+	if err != nil {
+		return err
+	}
+	body := cloudflareRecord{
+		Type:    record.Type,
+		Name:    record.Name,
+		Content: record.Value,
+		TTL:     record.TTL,
+	}
+	if record.Type == "MX" {
+		body.Priority = &record.Priority
+	}
+	if len(existing) == 0 {
+		return p.do(ctx, http.MethodPost, fmt.Sprintf("/zones/%s/dns_records", zoneId), body, nil)
+	}
+
+	return p.do(ctx, http.MethodPut, fmt.Sprintf("/zones/%s/dns_records/%s", zoneId, existing[0].Id), body, nil)
+}
+
+func (p *CloudflareProvider) Delete(ctx context.Context, zone string, record Record) error {
+	zoneId, err := p.findZoneId(ctx, zone)
+	if err != nil {
+		return err
+	}
+	existing, err := p.findRecords(ctx, zoneId, record)
+	if err != nil {
+		return err
+	}
+	for _, r := range existing {
+		if !strings.EqualFold(strings.Trim(r.Content, `"`), record.Value) {
+			continue
+		}
+		err = p.do(ctx, http.MethodDelete, fmt.Sprintf("/zones/%s/dns_records/%s", zoneId, r.Id), nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *CloudflareProvider) List(ctx context.Context, zone string, name string, recordType string) ([]Record, error) {
+	zoneId, err := p.findZoneId(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := p.findRecords(ctx, zoneId, Record{Name: name, Type: recordType})
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(existing))
+	for _, r := range existing {
+		record := Record{
+			Name:  r.Name,
+			Type:  r.Type,
+			Value: strings.Trim(r.Content, `"`),
+			TTL:   r.TTL,
+		}
+		if r.Priority != nil {
+			record.Priority = *r.Priority
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func (p *CloudflareProvider) findZoneId(ctx context.Context, zone string) (string, error) {
+	if p.zoneId != "" {
+		return p.zoneId, nil
+	}
+	var zones []struct {
+		Id string `json:"id"`
+	}
+	err := p.do(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(zone), nil, &zones)
+	if err != nil {
+		return "", err
+	}
+	if len(zones) == 0 {
+		return "", errors.New("zone not found")
+	}
+
+	return zones[0].Id, nil
+}
+
+func (p *CloudflareProvider) findRecords(ctx context.Context, zoneId string, record Record) ([]cloudflareRecord, error) {
+	query := url.Values{}
+	query.Set("type", record.Type)
+	query.Set("name", record.Name)
+	var records []cloudflareRecord
+	err := p.do(ctx, http.MethodGet, fmt.Sprintf("/zones/%s/dns_records?%s", zoneId, query.Encode()), nil, &records)
+
+	return records, err
+}
+
+func (p *CloudflareProvider) do(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.apiToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var response cloudflareResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return fmt.Errorf("cloudflare responded with status %d", resp.StatusCode)
+	}
+	if !response.Success {
+		messages := make([]string, 0, len(response.Errors))
+		for _, e := range response.Errors {
+			messages = append(messages, fmt.Sprintf("%d %s", e.Code, e.Message))
+		}
+		return fmt.Errorf("cloudflare: %s", strings.Join(messages, ", "))
+	}
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(response.Result, result)
+}
@@ -0,0 +1,175 @@
+package dnsprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	TypeRoute53    = "ROUTE53"
+	TypeCloudflare = "CLOUDFLARE"
+	TypeRFC2136    = "RFC2136"
+)
+
+const (
+	ChangeActionUpsert = "UPSERT"
+	ChangeActionDelete = "DELETE"
+)
+
+// MaxTXTStringLength is the length limit of a TXT character string, longer
+// values are split into several strings
+const MaxTXTStringLength = 255
+
+var Types = []string{
+	TypeRoute53,
+	TypeCloudflare,
+	TypeRFC2136,
+}
+
+var ErrInvalidCredentials = errors.New("invalid DNS provider credentials")
+
+// Record is a DNS record, the name is fully qualified without a trailing dot
+type Record struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	TTL      int    `json:"ttl"`
+	Priority int    `json:"priority,omitempty"`
+}
+
+// Equal reports whether the records have the same name, type and value, the
+// TTL is ignored
+func (r Record) Equal(other Record) bool {
+	if !strings.EqualFold(dns.Fqdn(r.Name), dns.Fqdn(other.Name)) || !strings.EqualFold(r.Type, other.Type) {
+		return false
+	}
+	switch strings.ToUpper(r.Type) {
+	case "TXT":
+		return r.Value == other.Value
+	case "MX":
+		return r.Priority == other.Priority && strings.EqualFold(dns.Fqdn(r.Value), dns.Fqdn(other.Value))
+	default:
+		return strings.EqualFold(dns.Fqdn(r.Value), dns.Fqdn(other.Value))
+	}
+}
+
+type Change struct {
+	Action string `json:"action"`
+	Record Record `json:"record"`
+}
+
+// DNSProvider publishes records in a zone hosted by a DNS provider
+type DNSProvider interface {
+	// Upsert creates the record or replaces the records of the same name and
+	// type
+	Upsert(ctx context.Context, zone string, record Record) error
+	// Delete removes the record, a missing record is not an error
+	Delete(ctx context.Context, zone string, record Record) error
+	// List returns the live records of the name and type
+	List(ctx context.Context, zone string, name string, recordType string) ([]Record, error)
+}
+
+// NewDNSProvider returns the provider of the type, the credentials are the
+// JSON encoded credentials of the type
+func NewDNSProvider(providerType string, credentials []byte) (DNSProvider, error) {
+	switch providerType {
+	case TypeRoute53:
+		var c Route53Credentials
+		err := json.Unmarshal(credentials, &c)
+		if err != nil {
+			return nil, err
+		}
+		return NewRoute53Provider(c)
+	case TypeCloudflare:
+		var c CloudflareCredentials
+		err := json.Unmarshal(credentials, &c)
+		if err != nil {
+			return nil, err
+		}
+		return NewCloudflareProvider(c)
+	case TypeRFC2136:
+		var c RFC2136Credentials
+		err := json.Unmarshal(credentials, &c)
+		if err != nil {
+			return nil, err
+		}
+		return NewRFC2136Provider(c)
+	default:
+		return nil, fmt.Errorf("unsupported DNS provider type %s", providerType)
+	}
+}
+
+// Apply makes the changes in the zone, it stops at the first failed change
+func Apply(ctx context.Context, provider DNSProvider, zone string, changes []*Change) error {
+	for _, change := range changes {
+		var err error
+		switch change.Action {
+		case ChangeActionUpsert:
+			err = provider.Upsert(ctx, zone, change.Record)
+		case ChangeActionDelete:
+			err = provider.Delete(ctx, zone, change.Record)
+		default:
+			err = fmt.Errorf("unsupported change action %s", change.Action)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s %s: %w", change.Action, change.Record.Type, change.Record.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// QuoteTXT returns the TXT value in zone file syntax, the value is quoted and
+// split into strings of at most 255 characters
+func QuoteTXT(value string) string {
+	parts := make([]string, 0, len(value)/MaxTXTStringLength+1)
+	for len(value) > MaxTXTStringLength {
+		parts = append(parts, strconv.Quote(value[:MaxTXTStringLength]))
+		value = value[MaxTXTStringLength:]
+	}
+	parts = append(parts, strconv.Quote(value))
+
+	return strings.Join(parts, " ")
+}
+
+// recordFromRR returns the record of the resource record, the character
+// strings of a TXT record are joined
+func recordFromRR(rr dns.RR) Record {
+	header := rr.Header()
+	record := Record{
+		Name: strings.TrimSuffix(header.Name, "."),
+		Type: dns.TypeToString[header.Rrtype],
+		TTL:  int(header.Ttl),
+	}
+	switch rr := rr.(type) {
+	case *dns.TXT:
+		record.Value = strings.Join(rr.Txt, "")
+	case *dns.MX:
+		record.Value = strings.TrimSuffix(rr.Mx, ".")
+		record.Priority = int(rr.Preference)
+	case *dns.CNAME:
+		record.Value = strings.TrimSuffix(rr.Target, ".")
+	default:
+		record.Value = strings.TrimPrefix(rr.String(), header.String())
+	}
+
+	return record
+}
+
+// presentationValue returns the value of the record in zone file syntax
+func presentationValue(record Record) string {
+	switch record.Type {
+	case "TXT":
+		return QuoteTXT(record.Value)
+	case "MX":
+		return fmt.Sprintf("%d %s.", record.Priority, strings.TrimSuffix(record.Value, "."))
+	default:
+		return record.Value
+	}
+}
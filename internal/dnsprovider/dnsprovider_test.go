@@ -0,0 +1,86 @@
+package dnsprovider
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestRecordEqual(t *testing.T) {
+	tests := []struct {
+		name string
+		a    Record
+		b    Record
+		want bool
+	}{
+		{
+			name: "same TXT record with another TTL",
+			a:    Record{Name: "example.com", Type: "TXT", Value: "v=spf1 -all", TTL: 300},
+			b:    Record{Name: "example.com.", Type: "TXT", Value: "v=spf1 -all", TTL: 3600},
+			want: true,
+		},
+		{
+			name: "TXT values are case sensitive",
+			a:    Record{Name: "s1._domainkey.example.com", Type: "TXT", Value: "p=AbC"},
+			b:    Record{Name: "s1._domainkey.example.com", Type: "TXT", Value: "p=abc"},
+		},
+		{
+			name: "names are case insensitive",
+			a:    Record{Name: "Example.com", Type: "txt", Value: "v=spf1 -all"},
+			b:    Record{Name: "example.com", Type: "TXT", Value: "v=spf1 -all"},
+			want: true,
+		},
+		{
+			name: "MX with another priority",
+			a:    Record{Name: "mail.example.com", Type: "MX", Value: "feedback-smtp.us-east-1.amazonses.com", Priority: 10},
+			b:    Record{Name: "mail.example.com", Type: "MX", Value: "feedback-smtp.us-east-1.amazonses.com.", Priority: 20},
+		},
+		{
+			name: "same MX",
+			a:    Record{Name: "mail.example.com", Type: "MX", Value: "feedback-smtp.us-east-1.amazonses.com", Priority: 10},
+			b:    Record{Name: "mail.example.com", Type: "MX", Value: "Feedback-SMTP.us-east-1.amazonses.com.", Priority: 10},
+			want: true,
+		},
+		{
+			name: "another type",
+			a:    Record{Name: "example.com", Type: "TXT", Value: "example.com"},
+			b:    Record{Name: "example.com", Type: "CNAME", Value: "example.com"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.a.Equal(test.b); got != test.want {
+				t.Fatalf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestRecordFromRRJoinsTXTStrings(t *testing.T) {
+	value := strings.Repeat("a", 300)
+	rr, err := newRR(Record{Name: "s1._domainkey.example.com", Type: "TXT", Value: value, TTL: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(rr.(*dns.TXT).Txt); got != 2 {
+		t.Fatalf("expected the value to be split into 2 strings, got %d", got)
+	}
+	record := recordFromRR(rr)
+	want := Record{Name: "s1._domainkey.example.com", Type: "TXT", Value: value, TTL: 300}
+	if record != want {
+		t.Fatalf("expected %+v, got %+v", want, record)
+	}
+}
+
+func TestRecordFromRRMX(t *testing.T) {
+	rr, err := dns.NewRR("mail.example.com. 300 IN MX 10 feedback-smtp.us-east-1.amazonses.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := recordFromRR(rr)
+	want := Record{Name: "mail.example.com", Type: "MX", Value: "feedback-smtp.us-east-1.amazonses.com", TTL: 300, Priority: 10}
+	if record != want {
+		t.Fatalf("expected %+v, got %+v", want, record)
+	}
+}
@@ -0,0 +1,122 @@
+package dnsprovider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var _ DNSProvider = (*RFC2136Provider)(nil)
+
+const rfc2136TSIGFudge = 300
+
+type RFC2136Credentials struct {
+	Server        string `json:"server"` // host:port of the primary name server
+	TSIGKeyName   string `json:"tsigKeyName"`
+	TSIGSecret    string `json:"tsigSecret"`    // Base64 encoded
+	TSIGAlgorithm string `json:"tsigAlgorithm"` // Defaults to hmac-sha256
+}
+
+// RFC2136Provider sends dynamic updates to a name server, the updates are
+// signed with TSIG when a key is given
+type RFC2136Provider struct {
+	client      *dns.Client
+	server      string
+	tsigKeyName string
+	tsigAlgo    string
+}
+
+func NewRFC2136Provider(c RFC2136Credentials) (*RFC2136Provider, error) {
+	if c.Server == "" || (c.TSIGKeyName == "") != (c.TSIGSecret == "") {
+		return nil, ErrInvalidCredentials
+	}
+	client := &dns.Client{
+		Net:     "tcp",
+		Timeout: 30 * time.Second,
+	}
+	provider := &RFC2136Provider{
+		client: client,
+		server: c.Server,
+	}
+	if c.TSIGKeyName != "" {
+		provider.tsigKeyName = dns.Fqdn(c.TSIGKeyName)
+		provider.tsigAlgo = dns.HmacSHA256
+		if c.TSIGAlgorithm != "" {
+			provider.tsigAlgo = dns.Fqdn(c.TSIGAlgorithm)
+		}
+		client.TsigSecret = map[string]string{provider.tsigKeyName: c.TSIGSecret}
+	}
+
+	return provider, nil
+}
+
+func (p *RFC2136Provider) Upsert(ctx context.Context, zone string, record Record) error {
+	rr, err := newRR(record)
+	if err != nil {
+		return err
+	}
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zone))
+	m.RemoveRRset([]dns.RR{rr})
+	m.Insert([]dns.RR{rr})
+
+	return p.exchange(ctx, m)
+}
+
+func (p *RFC2136Provider) Delete(ctx context.Context, zone string, record Record) error {
+	rr, err := newRR(record)
+	if err != nil {
+		return err
+	}
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zone))
+	m.Remove([]dns.RR{rr})
+
+	return p.exchange(ctx, m)
+}
+
+// List queries the name server, the answer of a primary is authoritative
+func (p *RFC2136Provider) List(ctx context.Context, zone string, name string, recordType string) ([]Record, error) {
+	rrType, ok := dns.StringToType[recordType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported record type %s", recordType)
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), rrType)
+	resp, _, err := p.client.ExchangeContext(ctx, m, p.server)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("query failed with %s", dns.RcodeToString[resp.Rcode])
+	}
+	records := []Record{}
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype == rrType {
+			records = append(records, recordFromRR(rr))
+		}
+	}
+
+	return records, nil
+}
+
+func (p *RFC2136Provider) exchange(ctx context.Context, m *dns.Msg) error {
+	if p.tsigKeyName != "" {
+		m.SetTsig(p.tsigKeyName, p.tsigAlgo, rfc2136TSIGFudge, time.Now().Unix())
+	}
+	resp, _, err := p.client.ExchangeContext(ctx, m, p.server)
+	if err != nil {
+		return err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("dynamic update failed with %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	return nil
+}
+
+func newRR(record Record) (dns.RR, error) {
+	return dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(record.Name), record.TTL, record.Type, presentationValue(record)))
+}
@@ -0,0 +1,77 @@
+package dnsprovider
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestRFC2136Provider runs against a name server accepting dynamic updates,
+// e.g. BIND or Knot, for the zone of SEND0_TEST_RFC2136_ZONE at the host:port
+// of SEND0_TEST_RFC2136_SERVER. SEND0_TEST_RFC2136_TSIG_KEY_NAME and
+// SEND0_TEST_RFC2136_TSIG_SECRET sign the updates
+func TestRFC2136Provider(t *testing.T) {
+	server := os.Getenv("SEND0_TEST_RFC2136_SERVER")
+	zone := os.Getenv("SEND0_TEST_RFC2136_ZONE")
+	if server == "" || zone == "" {
+		t.Skip("SEND0_TEST_RFC2136_SERVER and SEND0_TEST_RFC2136_ZONE are not set")
+	}
+	provider, err := NewRFC2136Provider(RFC2136Credentials{
+		Server:      server,
+		TSIGKeyName: os.Getenv("SEND0_TEST_RFC2136_TSIG_KEY_NAME"),
+		TSIGSecret:  os.Getenv("SEND0_TEST_RFC2136_TSIG_SECRET"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	name := "send0-test._domainkey." + zone
+	list := func() []Record {
+		t.Helper()
+		records, err := provider.List(ctx, zone, name, "TXT")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return records
+	}
+	t.Cleanup(func() {
+		for _, record := range list() {
+			_ = provider.Delete(ctx, zone, record)
+		}
+	})
+
+	// longer than a single TXT string
+	first := Record{Name: name, Type: "TXT", Value: "v=DKIM1; k=rsa; p=" + strings.Repeat("A", 300), TTL: 300}
+	err = provider.Upsert(ctx, zone, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := list()
+	if len(records) != 1 || !records[0].Equal(first) {
+		t.Fatalf("expected %+v, got %+v", first, records)
+	}
+
+	second := Record{Name: name, Type: "TXT", Value: "v=DKIM1; k=rsa; p=" + strings.Repeat("B", 300), TTL: 300}
+	err = provider.Upsert(ctx, zone, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records = list()
+	if len(records) != 1 || !records[0].Equal(second) {
+		t.Fatalf("expected the upsert to replace the record with %+v, got %+v", second, records)
+	}
+
+	err = provider.Delete(ctx, zone, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records = list(); len(records) != 0 {
+		t.Fatalf("expected the record to be deleted, got %+v", records)
+	}
+	// deleting a missing record is not an error
+	err = provider.Delete(ctx, zone, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
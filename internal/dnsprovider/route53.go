@@ -0,0 +1,139 @@
+package dnsprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/miekg/dns"
+)
+
+var _ DNSProvider = (*Route53Provider)(nil)
+
+// route53Region is the region of the global Route53 endpoint
+const route53Region = "us-east-1"
+
+type Route53Credentials struct {
+	AccessKeyId     string `json:"accessKeyId"`
+	SecretAccessKey string `json:"secretAccessKey"`
+	HostedZoneId    string `json:"hostedZoneId"` // Looked up by the zone name when empty
+}
+
+type Route53Provider struct {
+	client       *route53.Client
+	hostedZoneId string
+}
+
+func NewRoute53Provider(c Route53Credentials) (*Route53Provider, error) {
+	if c.AccessKeyId == "" || c.SecretAccessKey == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Route53Provider{
+		client: route53.New(route53.Options{
+			Region: route53Region,
+			Credentials: aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
+				c.AccessKeyId,
+				c.SecretAccessKey,
+				"",
+			)),
+		}),
+		hostedZoneId: c.HostedZoneId,
+	}, nil
+}
+
+func (p *Route53Provider) Upsert(ctx context.Context, zone string, record Record) error {
+	return p.change(ctx, zone, types.ChangeActionUpsert, record)
+}
+
+func (p *Route53Provider) Delete(ctx context.Context, zone string, record Record) error {
+	err := p.change(ctx, zone, types.ChangeActionDelete, record)
+	var invalidChangeBatch *types.InvalidChangeBatch
+	if errors.As(err, &invalidChangeBatch) && strings.Contains(invalidChangeBatch.ErrorMessage(), "not found") {
+		return nil
+	}
+
+	return err
+}
+
+func (p *Route53Provider) List(ctx context.Context, zone string, name string, recordType string) ([]Record, error) {
+	hostedZoneId, err := p.zoneId(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	// the record sets are sorted by name and type, the first one is the one
+	// of the name and type when it exists
+	resp, err := p.client.ListResourceRecordSets(ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(hostedZoneId),
+		StartRecordName: aws.String(name + "."),
+		StartRecordType: types.RRType(recordType),
+		MaxItems:        aws.Int32(1),
+	})
+	if err != nil {
+		return nil, err
+	}
+	records := []Record{}
+	for _, set := range resp.ResourceRecordSets {
+		if !strings.EqualFold(aws.ToString(set.Name), name+".") || string(set.Type) != recordType {
+			continue
+		}
+		for _, value := range set.ResourceRecords {
+			rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", aws.ToString(set.Name), aws.ToInt64(set.TTL), recordType, aws.ToString(value.Value)))
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, recordFromRR(rr))
+		}
+	}
+
+	return records, nil
+}
+
+func (p *Route53Provider) change(ctx context.Context, zone string, action types.ChangeAction, record Record) error {
+	hostedZoneId, err := p.zoneId(ctx, zone)
+	if err != nil {
+		return err
+	}
+	_, err = p.client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(hostedZoneId),
+		ChangeBatch: &types.ChangeBatch{
+			Changes: []types.Change{{
+				Action: action,
+				ResourceRecordSet: &types.ResourceRecordSet{
+					Name: aws.String(record.Name + "."),
+					Type: types.RRType(record.Type),
+					TTL:  aws.Int64(int64(record.TTL)),
+					ResourceRecords: []types.ResourceRecord{{
+						Value: aws.String(presentationValue(record)),
+					}},
+				},
+			}},
+		},
+	})
+
+	return err
+}
+
+func (p *Route53Provider) zoneId(ctx context.Context, zone string) (string, error) {
+	if p.hostedZoneId != "" {
+		return p.hostedZoneId, nil
+	}
+	resp, err := p.client.ListHostedZonesByName(ctx, &route53.ListHostedZonesByNameInput{
+		DNSName: aws.String(zone),
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, hostedZone := range resp.HostedZones {
+		if strings.TrimSuffix(aws.ToString(hostedZone.Name), ".") == zone {
+			return strings.TrimPrefix(aws.ToString(hostedZone.Id), "/hostedzone/"), nil
+		}
+	}
+
+	return "", errors.New("hosted zone not found")
+}
@@ -0,0 +1,99 @@
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/usesend0/send0/internal/config"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/storage/cache"
+)
+
+const (
+	DriverRedis  = "redis"
+	DriverMemory = "memory"
+)
+
+// Handler handles an event of a subscription, the event is delivered again
+// when the handler returns an error
+type Handler func(ctx context.Context, event *model.Event) error
+
+// EventBus delivers the published events to every consumer group, an event
+// is handled by one consumer of the group at least once
+type EventBus interface {
+	Publish(ctx context.Context, events []*model.Event) error
+	// Subscribe adds a consumer to the group, the consumer handles events
+	// until the context is done
+	Subscribe(ctx context.Context, group string, handler Handler)
+	// Listen handles every event published after the call until the context
+	// is done, without a consumer group. The events are not delivered again
+	// and the handler must not block
+	Listen(ctx context.Context, handler Handler)
+}
+
+func NewEventBus(cnf *config.Config, cache cache.Cache, logger *zerolog.Logger) (EventBus, error) {
+	switch cnf.EventBus.Driver {
+	case DriverRedis:
+		return NewRedisEventBus(cnf, cache.Connection(), logger), nil
+	case DriverMemory:
+		return NewMemoryEventBus(logger), nil
+	default:
+		return nil, fmt.Errorf("unsupported event bus driver %s", cnf.EventBus.Driver)
+	}
+}
+
+// listeners are the handlers of the Listen calls of a process
+type listeners struct {
+	mu       sync.RWMutex
+	next     int
+	reader   int // Listener whose context the reader of the process runs with
+	handlers map[int]*listener
+}
+
+type listener struct {
+	ctx     context.Context
+	handler Handler
+}
+
+// add registers the handler until the context is done. start is called with
+// the context of a listener when there is no reader, the reader runs until
+// that context is done and is started again with the context of another
+// listener when there are listeners left
+func (l *listeners) add(ctx context.Context, handler Handler, start func(ctx context.Context)) {
+	l.mu.Lock()
+	if l.handlers == nil {
+		l.handlers = make(map[int]*listener)
+	}
+	id := l.next
+	l.next++
+	l.handlers[id] = &listener{ctx: ctx, handler: handler}
+	if len(l.handlers) == 1 {
+		l.reader = id
+		start(ctx)
+	}
+	l.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.handlers, id)
+		if l.reader != id {
+			return
+		}
+		for next, listener := range l.handlers {
+			l.reader = next
+			start(listener.ctx)
+			return
+		}
+	}()
+}
+
+func (l *listeners) notify(ctx context.Context, event *model.Event) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, listener := range l.handlers {
+		_ = listener.handler(ctx, event)
+	}
+}
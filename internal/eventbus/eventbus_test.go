@@ -0,0 +1,70 @@
+package eventbus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/usesend0/send0/internal/config"
+	"github.com/usesend0/send0/internal/model"
+)
+
+func TestListenersStartReaderWithListenerContext(t *testing.T) {
+	var l listeners
+	started := make(chan context.Context, 3)
+	start := func(ctx context.Context) { started <- ctx }
+	handler := func(context.Context, *model.Event) error { return nil }
+	nextStart := func() context.Context {
+		t.Helper()
+		select {
+		case ctx := <-started:
+			return ctx
+		case <-time.After(time.Second):
+			t.Fatal("expected the reader to be started")
+			return nil
+		}
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	l.add(first, handler, start)
+	l.add(second, handler, start)
+	if ctx := nextStart(); ctx != first {
+		t.Fatal("expected the reader to run with the context of the first listener")
+	}
+
+	// the reader moves to the listener which is left
+	cancelFirst()
+	if ctx := nextStart(); ctx != second {
+		t.Fatal("expected the reader to run with the context of the second listener")
+	}
+
+	cancelSecond()
+	select {
+	case <-started:
+		t.Fatal("expected no reader without listeners")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRedisReadStopsWithContext(t *testing.T) {
+	logger := zerolog.Nop()
+	connection := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer connection.Close()
+	bus := NewRedisEventBus(&config.Config{}, connection, &logger)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		bus.read(ctx)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the reader to stop with the listener context")
+	}
+}
@@ -0,0 +1,74 @@
+package eventbus
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/usesend0/send0/internal/model"
+)
+
+var _ EventBus = (*MemoryEventBus)(nil)
+
+const memoryGroupBufferSize = 1000
+
+// MemoryEventBus delivers the events to the groups of the same process, the
+// events are lost when the process stops. It is meant for tests and local
+// development
+type MemoryEventBus struct {
+	mu        sync.RWMutex
+	logger    *zerolog.Logger
+	groups    map[string]chan *model.Event
+	listeners listeners
+}
+
+func NewMemoryEventBus(logger *zerolog.Logger) *MemoryEventBus {
+	return &MemoryEventBus{
+		logger: logger,
+		groups: make(map[string]chan *model.Event),
+	}
+}
+
+func (b *MemoryEventBus) Publish(ctx context.Context, events []*model.Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, event := range events {
+		b.listeners.notify(ctx, event)
+		for _, ch := range b.groups {
+			select {
+			case ch <- event:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *MemoryEventBus) Subscribe(ctx context.Context, group string, handler Handler) {
+	b.mu.Lock()
+	ch, ok := b.groups[group]
+	if !ok {
+		ch = make(chan *model.Event, memoryGroupBufferSize)
+		b.groups[group] = ch
+	}
+	b.mu.Unlock()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-ch:
+				err := handler(ctx, event)
+				if err != nil {
+					b.logger.Error().Err(err).Str("group", group).Msg("failed to handle event")
+				}
+			}
+		}
+	}()
+}
+
+func (b *MemoryEventBus) Listen(ctx context.Context, handler Handler) {
+	b.listeners.add(ctx, handler, func(context.Context) {})
+}
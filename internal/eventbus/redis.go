@@ -0,0 +1,276 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/usesend0/send0/internal/config"
+	"github.com/usesend0/send0/internal/model"
+)
+
+var _ EventBus = (*RedisEventBus)(nil)
+
+const redisEventField = "event"
+
+// RedisEventBus publishes the events to a Redis stream, every subscription
+// group is a consumer group of the stream. An event is acknowledged after it
+// was handled, events which stay pending are claimed by another consumer of
+// the group and handled again
+type RedisEventBus struct {
+	connection    *redis.Client
+	logger        *zerolog.Logger
+	stream        string
+	maxLen        int64
+	batchSize     int64
+	block         time.Duration
+	pendingIdle   time.Duration
+	maxDeliveries int64
+	consumers     atomic.Int64
+	listeners     listeners
+}
+
+func NewRedisEventBus(cnf *config.Config, connection *redis.Client, logger *zerolog.Logger) *RedisEventBus {
+	return &RedisEventBus{
+		connection:    connection,
+		logger:        logger,
+		stream:        cnf.EventBus.Stream,
+		maxLen:        cnf.EventBus.MaxLen,
+		batchSize:     cnf.EventBus.BatchSize,
+		block:         5 * time.Second,
+		pendingIdle:   time.Duration(cnf.EventBus.PendingIdleInSeconds) * time.Second,
+		maxDeliveries: cnf.EventBus.MaxDeliveries,
+	}
+}
+
+func (b *RedisEventBus) Publish(ctx context.Context, events []*model.Event) error {
+	pipe := b.connection.Pipeline()
+	for _, event := range events {
+		bytes, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: b.stream,
+			MaxLen: b.maxLen,
+			Approx: true,
+			Values: map[string]interface{}{
+				redisEventField: bytes,
+			},
+		})
+	}
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+func (b *RedisEventBus) Subscribe(ctx context.Context, group string, handler Handler) {
+	hostname, _ := os.Hostname()
+	consumer := fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), b.consumers.Add(1))
+	logger := b.logger.With().Str("group", group).Str("consumer", consumer).Logger()
+	err := b.connection.XGroupCreateMkStream(ctx, b.stream, group, "$").Err()
+	if err != nil && !isBusyGroup(err) {
+		logger.Error().Err(err).Msg("failed to create event consumer group")
+	}
+	go b.consume(ctx, group, consumer, handler, &logger)
+	go b.recover(ctx, group, consumer, handler, &logger)
+}
+
+// Listen reads the stream without a consumer group, one reader per process
+// notifies all the listeners. The reader stops with the last listener
+func (b *RedisEventBus) Listen(ctx context.Context, handler Handler) {
+	b.listeners.add(ctx, handler, func(ctx context.Context) {
+		go b.read(ctx)
+	})
+}
+
+func (b *RedisEventBus) read(ctx context.Context) {
+	lastId := "$"
+	for ctx.Err() == nil {
+		streams, err := b.connection.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{b.stream, lastId},
+			Count:   b.batchSize,
+			Block:   b.block,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			b.logger.Error().Err(err).Msg("failed to read events")
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				lastId = message.ID
+				event, err := decodeMessage(message)
+				if err != nil {
+					continue
+				}
+				b.listeners.notify(ctx, event)
+			}
+		}
+	}
+}
+
+// consume handles the new events of the group
+func (b *RedisEventBus) consume(
+	ctx context.Context,
+	group string,
+	consumer string,
+	handler Handler,
+	logger *zerolog.Logger,
+) {
+	for ctx.Err() == nil {
+		streams, err := b.connection.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: consumer,
+			Streams:  []string{b.stream, ">"},
+			Count:    b.batchSize,
+			Block:    b.block,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if isNoGroup(err) {
+				// the stream was removed, the group is created again
+				err = b.connection.XGroupCreateMkStream(ctx, b.stream, group, "$").Err()
+				if err != nil && !isBusyGroup(err) {
+					logger.Error().Err(err).Msg("failed to create event consumer group")
+				}
+				continue
+			}
+			logger.Error().Err(err).Msg("failed to read events")
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				b.handle(ctx, group, message, handler, logger)
+			}
+		}
+	}
+}
+
+// recover claims the events which were not acknowledged in time, because
+// the handler failed or the consumer stopped, and handles them again. Events
+// which failed too often are dropped
+func (b *RedisEventBus) recover(
+	ctx context.Context,
+	group string,
+	consumer string,
+	handler Handler,
+	logger *zerolog.Logger,
+) {
+	ticker := time.NewTicker(b.pendingIdle)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pending, err := b.connection.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: b.stream,
+			Group:  group,
+			Idle:   b.pendingIdle,
+			Start:  "-",
+			End:    "+",
+			Count:  b.batchSize,
+		}).Result()
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to find pending events")
+			continue
+		}
+		ids := make([]string, 0, len(pending))
+		for _, entry := range pending {
+			if entry.RetryCount >= b.maxDeliveries {
+				logger.Error().Str("messageId", entry.ID).Int64("deliveries", entry.RetryCount).Msg("dropping event")
+				b.ack(ctx, group, entry.ID, logger)
+				continue
+			}
+			ids = append(ids, entry.ID)
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		messages, err := b.connection.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   b.stream,
+			Group:    group,
+			Consumer: consumer,
+			MinIdle:  b.pendingIdle,
+			Messages: ids,
+		}).Result()
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to claim pending events")
+			continue
+		}
+		for _, message := range messages {
+			b.handle(ctx, group, message, handler, logger)
+		}
+	}
+}
+
+func (b *RedisEventBus) handle(
+	ctx context.Context,
+	group string,
+	message redis.XMessage,
+	handler Handler,
+	logger *zerolog.Logger,
+) {
+	event, err := decodeMessage(message)
+	if err != nil {
+		logger.Error().Err(err).Str("messageId", message.ID).Msg("invalid event message")
+		b.ack(ctx, group, message.ID, logger)
+		return
+	}
+	err = handler(ctx, event)
+	if err != nil {
+		// the event stays pending and is handled again
+		logger.Error().Err(err).Str("messageId", message.ID).Msg("failed to handle event")
+		return
+	}
+	b.ack(ctx, group, message.ID, logger)
+}
+
+func (b *RedisEventBus) ack(ctx context.Context, group string, id string, logger *zerolog.Logger) {
+	err := b.connection.XAck(ctx, b.stream, group, id).Err()
+	if err != nil {
+		logger.Error().Err(err).Str("messageId", id).Msg("failed to acknowledge event")
+	}
+}
+
+func decodeMessage(message redis.XMessage) (*model.Event, error) {
+	value, ok := message.Values[redisEventField].(string)
+	if !ok {
+		return nil, errors.New("missing event field")
+	}
+	event := new(model.Event)
+	err := json.Unmarshal([]byte(value), event)
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+func isBusyGroup(err error) bool {
+	return err != nil && len(err.Error()) >= 9 && err.Error()[:9] == "BUSYGROUP"
+}
+
+func isNoGroup(err error) bool {
+	return err != nil && len(err.Error()) >= 7 && err.Error()[:7] == "NOGROUP"
+}
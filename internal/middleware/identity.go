@@ -19,6 +19,8 @@ const (
 	Bearer string = "bearer"
 )
 
+const QueryParamToken = "token"
+
 func NewIdentityInterceptor(jwt *crypto.JWT) *identityInterceptor {
 	return &identityInterceptor{
 		jwt: jwt,
@@ -46,11 +48,7 @@ func (a *identityInterceptor) Handler(next http.Handler) http.Handler {
 			})
 		}()
 		if err != nil {
-			render.Status(r, http.StatusUnauthorized)
-			render.JSON(w, r, map[string]interface{}{
-				"success": false,
-				"error":   err.Error(),
-			})
+			unauthorized(w, r, err)
 			return
 		}
 		ctx = core.IdentityToContext(ctx, identity)
@@ -59,6 +57,52 @@ func (a *identityInterceptor) Handler(next http.Handler) http.Handler {
 	})
 }
 
+// QueryTokenHandler authenticates with a token of the scope in the token query
+// parameter, for clients such as EventSource which can't set the
+// authorization header. Requests without the parameter use the header
+func (a *identityInterceptor) QueryTokenHandler(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		headerHandler := a.Handler(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.URL.Query().Get(QueryParamToken)
+			if token == "" {
+				headerHandler.ServeHTTP(w, r)
+				return
+			}
+			identity, err := func() (core.Identity, error) {
+				claims, err := a.jwt.VerifyScopedToken(token, scope)
+				if err != nil {
+					return nil, err
+				}
+				if claims.WorkspaceId == "" {
+					return nil, errors.New("token has no workspace")
+				}
+
+				return core.NewIdentity(core.IdentityOptions{
+					JTI:         claims.ID,
+					Sub:         claims.Subject,
+					WorkspaceId: &claims.WorkspaceId,
+				})
+			}()
+			if err != nil {
+				unauthorized(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(core.IdentityToContext(r.Context(), identity)))
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	render.Status(r, http.StatusUnauthorized)
+	render.JSON(w, r, map[string]interface{}{
+		"success": false,
+		"error":   err.Error(),
+	})
+}
+
 func extractToken(h http.Header) (string, error) {
 	authHeader := h.Get(constant.HeaderAuthorization)
 	if authHeader == "" {
@@ -2,21 +2,34 @@ package model
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
 	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/uid"
 )
 
+const SNSKeySigningCertificate = "SNS_SIGNING_CERTIFICATE"
+
 type SNSTopicRepository interface {
 	Save(ctx context.Context, topic *SNSTopic) error
 	FindAll(ctx context.Context) ([]*SNSTopic, error)
-	UpdateStatus(ctx context.Context, region constant.AwsRegion, status constant.AwsSNSTopicStatus) error
+	FindByArn(ctx context.Context, arn string) (*SNSTopic, error)
+	UpdateStatus(ctx context.Context, arn string, status constant.AwsSNSTopicStatus) error
+	Delete(ctx context.Context, arn string) error
+	SaveSigningCertificate(ctx context.Context, url string, certificate []byte, ttl time.Duration) error
+	FindSigningCertificate(ctx context.Context, url string) ([]byte, error)
 }
 
 type SNSTopic struct {
 	Base
-	Region constant.AwsRegion         `json:"region" db:"region" gorm:"not null"`
-	Arn    string                     `json:"arn"`
-	Status constant.AwsSNSTopicStatus `json:"status"`
+	Region      constant.AwsRegion         `json:"region" db:"region" gorm:"not null"`
+	Arn         string                     `json:"arn"`
+	Status      constant.AwsSNSTopicStatus `json:"status"`
+	WorkspaceId *uid.UID                   `json:"workspaceId" db:"workspace_id"` // Set for a topic in the AWS account of a workspace
 }
 
 type snsTopicRepository struct {
@@ -35,11 +48,13 @@ func (r *snsTopicRepository) Save(ctx context.Context, topic *SNSTopic) error {
 		"region",
 		"arn",
 		"status",
+		"workspace_id",
 	).Values(
 		r.UID(topic.Id),
 		topic.Region,
 		topic.Arn,
 		topic.Status,
+		topic.WorkspaceId,
 	).ToSql()
 	if err != nil {
 		return err
@@ -55,6 +70,7 @@ func (r *snsTopicRepository) FindAll(ctx context.Context) ([]*SNSTopic, error) {
 		"region",
 		"arn",
 		"status",
+		"workspace_id",
 	).From(string(TableNameSNSTopic)).ToSql()
 	if err != nil {
 		return nil, err
@@ -71,6 +87,7 @@ func (r *snsTopicRepository) FindAll(ctx context.Context) ([]*SNSTopic, error) {
 			&topic.Region,
 			&topic.Arn,
 			&topic.Status,
+			&topic.WorkspaceId,
 		); err != nil {
 			return nil, err
 		}
@@ -80,9 +97,38 @@ func (r *snsTopicRepository) FindAll(ctx context.Context) ([]*SNSTopic, error) {
 	return topics, nil
 }
 
-func (r *snsTopicRepository) UpdateStatus(ctx context.Context, region constant.AwsRegion, status constant.AwsSNSTopicStatus) error {
+func (r *snsTopicRepository) FindByArn(ctx context.Context, arn string) (*SNSTopic, error) {
+	stmt, args, err := r.DB.Builder().Select(
+		"id",
+		"region",
+		"arn",
+		"status",
+		"workspace_id",
+	).From(string(TableNameSNSTopic)).Where("arn = ?", arn).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var topic SNSTopic
+	err = r.DB.Connection().QueryRow(ctx, stmt, args...).Scan(
+		&topic.Id,
+		&topic.Region,
+		&topic.Arn,
+		&topic.Status,
+		&topic.WorkspaceId,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &topic, nil
+}
+
+func (r *snsTopicRepository) UpdateStatus(ctx context.Context, arn string, status constant.AwsSNSTopicStatus) error {
 	stmt, args, err := r.DB.Builder().Update(string(TableNameSNSTopic)).Set("status", status).Where(
-		"region = ?", region,
+		"arn = ?", arn,
 	).ToSql()
 	if err != nil {
 		return err
@@ -90,3 +136,34 @@ func (r *snsTopicRepository) UpdateStatus(ctx context.Context, region constant.A
 	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
 	return err
 }
+
+func (r *snsTopicRepository) Delete(ctx context.Context, arn string) error {
+	stmt, args, err := r.DB.Builder().Delete(string(TableNameSNSTopic)).Where(
+		"arn = ?", arn,
+	).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+	return err
+}
+
+// SaveSigningCertificate caches the PEM certificate of the signing certificate
+// URL until the ttl passes
+func (r *snsTopicRepository) SaveSigningCertificate(ctx context.Context, url string, certificate []byte, ttl time.Duration) error {
+	key := fmt.Sprintf("%s:%s", SNSKeySigningCertificate, url)
+
+	return r.Cache.WithTTL(ttl).Set(ctx, key, string(certificate))
+}
+
+// FindSigningCertificate returns the cached PEM certificate of the signing
+// certificate URL, nil when it is not cached
+func (r *snsTopicRepository) FindSigningCertificate(ctx context.Context, url string) ([]byte, error) {
+	key := fmt.Sprintf("%s:%s", SNSKeySigningCertificate, url)
+	certificate, err := r.Cache.Connection().Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+
+	return certificate, err
+}
@@ -0,0 +1,146 @@
+package model
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+const (
+	AWSAccountStatusPending AWSAccountStatus = "PENDING" // The role hasn't been assumed yet
+	AWSAccountStatusActive  AWSAccountStatus = "ACTIVE"
+	AWSAccountStatusFailed  AWSAccountStatus = "FAILED"
+)
+
+type AWSAccountRepository interface {
+	Save(ctx context.Context, account *AWSAccount) error
+	Update(ctx context.Context, account *AWSAccount) error
+	FindByWorkspaceId(ctx context.Context, workspaceId uid.UID) (*AWSAccount, error)
+	FindByRoleArn(ctx context.Context, roleArn string) (*AWSAccount, error)
+	Delete(ctx context.Context, id uid.UID) error
+}
+
+type AWSAccountStatus string
+
+// AWSAccount is the AWS account of a customer a workspace sends through, SES
+// and SNS are called with the assumed role instead of the operator account
+type AWSAccount struct {
+	Base
+	RoleArn       string           `json:"roleArn" db:"role_arn" gorm:"not null;uniqueIndex"`
+	ExternalId    string           `json:"externalId" db:"external_id" gorm:"not null"` // Generated, set in the trust policy of the role
+	AccountId     string           `json:"accountId" db:"account_id" gorm:"not null;default:''"`
+	Status        AWSAccountStatus `json:"status" db:"status" gorm:"not null;default:'PENDING'"`
+	StatusMessage *string          `json:"statusMessage" db:"status_message"` // Why the role couldn't be assumed
+	WorkspaceId   uid.UID          `json:"workspaceId" db:"workspace_id" gorm:"not null;uniqueIndex"`
+}
+
+type awsAccountRepository struct {
+	*baseRepository
+}
+
+func NewAWSAccountRepository(baseRepository *baseRepository) AWSAccountRepository {
+	return &awsAccountRepository{
+		baseRepository,
+	}
+}
+
+func (r *awsAccountRepository) Save(ctx context.Context, account *AWSAccount) error {
+	stmt, args, err := r.DB.Builder().Insert(string(TableNameAWSAccount)).Columns(
+		"id",
+		"role_arn",
+		"external_id",
+		"account_id",
+		"status",
+		"status_message",
+		"workspace_id",
+	).Values(
+		r.UID(account.Id),
+		account.RoleArn,
+		account.ExternalId,
+		account.AccountId,
+		account.Status,
+		account.StatusMessage,
+		account.WorkspaceId,
+	).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *awsAccountRepository) Update(ctx context.Context, account *AWSAccount) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameAWSAccount)).
+		Set("role_arn", account.RoleArn).
+		Set("external_id", account.ExternalId).
+		Set("account_id", account.AccountId).
+		Set("status", account.Status).
+		Set("status_message", account.StatusMessage).
+		Where("id = ?", account.Id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *awsAccountRepository) FindByWorkspaceId(ctx context.Context, workspaceId uid.UID) (*AWSAccount, error) {
+	return r.findOne(ctx, squirrel.Eq{"workspace_id": workspaceId})
+}
+
+func (r *awsAccountRepository) FindByRoleArn(ctx context.Context, roleArn string) (*AWSAccount, error) {
+	return r.findOne(ctx, squirrel.Eq{"role_arn": roleArn})
+}
+
+func (r *awsAccountRepository) findOne(ctx context.Context, where squirrel.Eq) (*AWSAccount, error) {
+	stmt, args, err := r.DB.Builder().Select(
+		"id",
+		"role_arn",
+		"external_id",
+		"account_id",
+		"status",
+		"status_message",
+		"workspace_id",
+	).From(string(TableNameAWSAccount)).
+		Where(where).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var account AWSAccount
+	err = r.DB.Connection().QueryRow(ctx, stmt, args...).Scan(
+		&account.Id,
+		&account.RoleArn,
+		&account.ExternalId,
+		&account.AccountId,
+		&account.Status,
+		&account.StatusMessage,
+		&account.WorkspaceId,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+func (r *awsAccountRepository) Delete(ctx context.Context, id uid.UID) error {
+	stmt, args, err := r.DB.Builder().Delete(string(TableNameAWSAccount)).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
@@ -1,8 +1,13 @@
 package model
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
 	"github.com/usesend0/send0/internal/uid"
 )
 
@@ -12,42 +17,116 @@ const (
 	BroadcastStatusDraft     BroadcastStatus = "DRAFT"
 	BroadcastStatusScheduled BroadcastStatus = "SCHEDULED"
 	BroadcastStatusRunning   BroadcastStatus = "RUNNING"
+	BroadcastStatusPaused    BroadcastStatus = "PAUSED"
 	BroadcastStatusCompleted BroadcastStatus = "COMPLETED"
 	BroadcastStatusCanceled  BroadcastStatus = "CANCELED"
 )
 
+const (
+	BroadcastStatSent         BroadcastStatCounter = "sent"
+	BroadcastStatDelivered    BroadcastStatCounter = "delivered"
+	BroadcastStatOpened       BroadcastStatCounter = "opened"
+	BroadcastStatClicked      BroadcastStatCounter = "clicked"
+	BroadcastStatBounced      BroadcastStatCounter = "bounced"
+	BroadcastStatComplained   BroadcastStatCounter = "complained"
+	BroadcastStatUnsubscribed BroadcastStatCounter = "unsubscribed"
+)
+
+const (
+	BroadcastWinnerMetricOpenRate  BroadcastWinnerMetric = "OPEN_RATE"
+	BroadcastWinnerMetricClickRate BroadcastWinnerMetric = "CLICK_RATE"
+)
+
+const BroadcastStatTotal BroadcastStatCounter = "total"
+
 var BroadcastStatusTypeCreateQuery = fmt.Sprintf(
-	`CREATE TYPE %s AS ENUM ('%s','%s','%s','%s','%s');`,
+	`CREATE TYPE %s AS ENUM ('%s','%s','%s','%s','%s','%s');`,
 	DBTypeCampaignStatus,
 	BroadcastStatusDraft,
 	BroadcastStatusScheduled,
 	BroadcastStatusRunning,
+	BroadcastStatusPaused,
 	BroadcastStatusCompleted,
 	BroadcastStatusCanceled,
 )
 
+type BroadcastRepository interface {
+	Save(ctx context.Context, broadcast *Broadcast) error
+	Update(ctx context.Context, broadcast *Broadcast) error
+	FindById(ctx context.Context, id uid.UID) (*Broadcast, error)
+	FindAll(ctx context.Context, options BroadcastFindOptions) ([]*Broadcast, int, error)
+	FindDue(ctx context.Context, before time.Time) ([]*Broadcast, error)
+	FindByStatus(ctx context.Context, status BroadcastStatus) ([]*Broadcast, error)
+	FindUnleased(ctx context.Context) ([]*Broadcast, error)
+	ClaimLease(ctx context.Context, id uid.UID, owner string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, id uid.UID, owner string) error
+	UpdateStatus(ctx context.Context, id uid.UID, from, to BroadcastStatus) (bool, error)
+	UpdateLastContactId(ctx context.Context, id uid.UID, contactId uid.UID) error
+	Delete(ctx context.Context, id uid.UID) error
+	StartTestWindow(ctx context.Context, id uid.UID, testEndsAt time.Time) error
+	SaveStat(ctx context.Context, stat *BroadcastStat) error
+	FindStat(ctx context.Context, broadcastId uid.UID) (*BroadcastStat, error)
+	FindVariantStats(ctx context.Context, broadcastId uid.UID) ([]*BroadcastStat, error)
+	IncrementStat(ctx context.Context, broadcastId uid.UID, counter BroadcastStatCounter, delta int) error
+	IncrementVariantStat(ctx context.Context, variantId uid.UID, counter BroadcastStatCounter, delta int) error
+	SaveEvent(ctx context.Context, eventId uid.UID) (bool, error)
+	SaveVariant(ctx context.Context, variant *BroadcastVariant) error
+	FindVariants(ctx context.Context, broadcastId uid.UID) ([]*BroadcastVariant, error)
+	DeleteVariants(ctx context.Context, broadcastId uid.UID) error
+	UpdateVariantWinner(ctx context.Context, id uid.UID) error
+}
+
+type BroadcastStatCounter string
+type BroadcastWinnerMetric string
+
 type Broadcast struct {
 	Base
-	Name           string          `json:"name"`
-	From           string          `json:"from" db:"from"`
-	ReplyTo        *string         `json:"replyTo" db:"reply_to"`
-	TemplateId     int             `json:"templateId" db:"template_id" gorm:"not null"`
-	Delay          int             `json:"delay"`
-	DelayTimeZone  string          `json:"delayTimeZone" db:"delay_time_zone"`
-	Events         JSONBArray      `json:"events" db:"events" gorm:"type:jsonb;not null;default '[]'"` // Events to track
-	Status         BroadcastStatus `json:"status" db:"status" gorm:"type:campaign_status;not null;default:'DRAFT'"`
-	Segments       JSONBArray      `json:"segments" db:"segments" gorm:"type:jsonb;not null;default '[]'"`
-	OpenTracking   bool            `json:"openTracking" db:"open_tracking"`
-	ClickTracking  bool            `json:"clickTracking" db:"click_tracking"`
-	CCAddresses    JSONBArray      `json:"ccAddresses" db:"cc_addresses" gorm:"type:jsonb;not null;default:'[]'"`
-	BCCAddresses   JSONBArray      `json:"bccAddresses" db:"bcc_addresses" gorm:"type:jsonb;not null;default:'[]'"`
-	OrganizationId uid.UID         `json:"organizationId" db:"organization_id" gorm:"not null"`
-	WorkspaceId    uid.UID         `json:"workspaceId" db:"workspace_id" gorm:"not null"`
+	Name          string     `json:"name"`
+	From          string     `json:"from" db:"from"`
+	ReplyTo       *string    `json:"replyTo" db:"reply_to"`
+	TemplateId    uid.UID    `json:"templateId" db:"template_id" gorm:"not null"`
+	Delay         int        `json:"delay"`
+	DelayTimeZone string     `json:"delayTimeZone" db:"delay_time_zone"`
+	ScheduledAt   *time.Time `json:"scheduledAt" db:"scheduled_at" gorm:"type:timestamp with time zone"`
+	SendRate      int        `json:"sendRate" db:"send_rate" gorm:"not null;default:0"`             // Emails per second, 0 is unlimited
+	LastContactId uid.UID    `json:"-" db:"last_contact_id" gorm:"not null;default:0"`              // Last contact the broadcast was sent to
+	LocalSendTime string     `json:"localSendTime" db:"local_send_time" gorm:"not null;default:''"` // HH:MM in the timezone of each contact
+	// The replica sending a running broadcast, the lease is renewed while it
+	// runs and another replica takes over once it expires
+	LeaseOwner     string     `json:"-" db:"lease_owner" gorm:"not null;default:''"`
+	LeaseExpiresAt *time.Time `json:"-" db:"lease_expires_at" gorm:"type:timestamp with time zone"`
+	// A/B testing, the test audience is split evenly between the variants
+	TestPercentage      int                   `json:"testPercentage" db:"test_percentage" gorm:"not null;default:0"`
+	TestWindowInMinutes int                   `json:"testWindowInMinutes" db:"test_window_in_minutes" gorm:"not null;default:0"`
+	WinnerMetric        BroadcastWinnerMetric `json:"winnerMetric" db:"winner_metric" gorm:"type:text"`
+	TestEndsAt          *time.Time            `json:"testEndsAt" db:"test_ends_at" gorm:"type:timestamp with time zone"`
+	Variants            []*BroadcastVariant   `json:"variants,omitempty" db:"-" gorm:"-:all"`
+	Events              JSONBArray            `json:"events" db:"events" gorm:"type:jsonb;not null;default '[]'"` // Events to track
+	Status              BroadcastStatus       `json:"status" db:"status" gorm:"type:campaign_status;not null;default:'DRAFT'"`
+	Segments            JSONBArray            `json:"segments" db:"segments" gorm:"type:jsonb;not null;default '[]'"`
+	OpenTracking        bool                  `json:"openTracking" db:"open_tracking"`
+	ClickTracking       bool                  `json:"clickTracking" db:"click_tracking"`
+	CCAddresses         JSONBArray            `json:"ccAddresses" db:"cc_addresses" gorm:"type:jsonb;not null;default:'[]'"`
+	BCCAddresses        JSONBArray            `json:"bccAddresses" db:"bcc_addresses" gorm:"type:jsonb;not null;default:'[]'"`
+	OrganizationId      uid.UID               `json:"organizationId" db:"organization_id" gorm:"not null"`
+	WorkspaceId         uid.UID               `json:"workspaceId" db:"workspace_id" gorm:"not null"`
+}
+
+type BroadcastVariant struct {
+	Base
+	BroadcastId uid.UID  `json:"broadcastId" db:"broadcast_id" gorm:"not null"`
+	Name        string   `json:"name" db:"name" gorm:"not null"`
+	Subject     *string  `json:"subject" db:"subject"`
+	TemplateId  *uid.UID `json:"templateId" db:"template_id"`
+	FromName    *string  `json:"fromName" db:"from_name"`
+	IsWinner    bool     `json:"isWinner" db:"is_winner" gorm:"not null;default:false"`
+	WorkspaceId uid.UID  `json:"workspaceId" db:"workspace_id" gorm:"not null"`
 }
 
 type BroadcastStat struct {
 	Base
 	BroadcastId  uid.UID `json:"broadcastId" db:"broadcast_id" gorm:"not null"`
+	VariantId    uid.UID `json:"variantId" db:"variant_id" gorm:"not null;default:0"` // Empty for the broadcast totals
 	Total        int     `json:"total"`
 	Sent         int     `json:"sent"`
 	Opened       int     `json:"opened"`
@@ -58,3 +137,653 @@ type BroadcastStat struct {
 	Delivered    int     `json:"delivered"`
 	WorkspaceId  uid.UID `json:"workspaceId" db:"workspace_id" gorm:"not null"`
 }
+
+// BroadcastEvent is an event which was counted in the broadcast stats, an
+// event which is delivered again is not counted twice
+type BroadcastEvent struct {
+	EventId   uid.UID   `db:"event_id" gorm:"primaryKey;type:bigint"`
+	CreatedAt time.Time `db:"created_at" gorm:"type:timestamp with time zone;not null;default:now()"`
+}
+
+type BroadcastFindOptions struct {
+	Status      BroadcastStatus
+	WorkspaceId uid.UID
+	Offset      int
+	Limit       int
+}
+
+type broadcastRepository struct {
+	*baseRepository
+}
+
+func NewBroadcastRepository(baseRepository *baseRepository) BroadcastRepository {
+	return &broadcastRepository{
+		baseRepository,
+	}
+}
+
+func (r *broadcastRepository) Save(ctx context.Context, broadcast *Broadcast) error {
+	stmt, args, err := r.DB.Builder().Insert(string(TableNameBroadcast)).Columns(
+		"id",
+		"name",
+		`"from"`,
+		"reply_to",
+		"template_id",
+		"delay",
+		"delay_time_zone",
+		"scheduled_at",
+		"send_rate",
+		"local_send_time",
+		"last_contact_id",
+		"test_percentage",
+		"test_window_in_minutes",
+		"winner_metric",
+		"test_ends_at",
+		"events",
+		"status",
+		"segments",
+		"open_tracking",
+		"click_tracking",
+		"cc_addresses",
+		"bcc_addresses",
+		"organization_id",
+		"workspace_id",
+	).Values(
+		r.UID(broadcast.Id),
+		broadcast.Name,
+		broadcast.From,
+		broadcast.ReplyTo,
+		broadcast.TemplateId,
+		broadcast.Delay,
+		broadcast.DelayTimeZone,
+		broadcast.ScheduledAt,
+		broadcast.SendRate,
+		broadcast.LocalSendTime,
+		broadcast.LastContactId,
+		broadcast.TestPercentage,
+		broadcast.TestWindowInMinutes,
+		broadcast.WinnerMetric,
+		broadcast.TestEndsAt,
+		broadcast.Events,
+		broadcast.Status,
+		broadcast.Segments,
+		broadcast.OpenTracking,
+		broadcast.ClickTracking,
+		broadcast.CCAddresses,
+		broadcast.BCCAddresses,
+		broadcast.OrganizationId,
+		broadcast.WorkspaceId,
+	).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *broadcastRepository) Update(ctx context.Context, broadcast *Broadcast) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameBroadcast)).
+		Set("name", broadcast.Name).
+		Set(`"from"`, broadcast.From).
+		Set("reply_to", broadcast.ReplyTo).
+		Set("template_id", broadcast.TemplateId).
+		Set("delay", broadcast.Delay).
+		Set("delay_time_zone", broadcast.DelayTimeZone).
+		Set("scheduled_at", broadcast.ScheduledAt).
+		Set("send_rate", broadcast.SendRate).
+		Set("local_send_time", broadcast.LocalSendTime).
+		Set("test_percentage", broadcast.TestPercentage).
+		Set("test_window_in_minutes", broadcast.TestWindowInMinutes).
+		Set("winner_metric", broadcast.WinnerMetric).
+		Set("events", broadcast.Events).
+		Set("segments", broadcast.Segments).
+		Set("open_tracking", broadcast.OpenTracking).
+		Set("click_tracking", broadcast.ClickTracking).
+		Set("cc_addresses", broadcast.CCAddresses).
+		Set("bcc_addresses", broadcast.BCCAddresses).
+		Where("id = ?", broadcast.Id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *broadcastRepository) FindById(ctx context.Context, id uid.UID) (*Broadcast, error) {
+	stmt, args, err := r.selectBroadcast().Where("id = ?", id).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	broadcast, err := r.scanBroadcast(r.DB.Connection().QueryRow(ctx, stmt, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+
+	return broadcast, err
+}
+
+func (r *broadcastRepository) FindAll(ctx context.Context, options BroadcastFindOptions) ([]*Broadcast, int, error) {
+	var count int
+	where := squirrel.Eq{"workspace_id": options.WorkspaceId}
+	if options.Status != "" {
+		where["status"] = options.Status
+	}
+	stmt, args, err := r.DB.Builder().Select("COUNT(*)").From(string(TableNameBroadcast)).Where(where).ToSql()
+	if err != nil {
+		return nil, count, err
+	}
+	err = r.DB.Connection().QueryRow(ctx, stmt, args...).Scan(&count)
+	if err != nil {
+		return nil, count, err
+	}
+	stmt, args, err = r.selectBroadcast().
+		Where(where).
+		OrderBy("id DESC").
+		Offset(uint64(options.Offset)).
+		Limit(uint64(options.Limit)).
+		ToSql()
+	if err != nil {
+		return nil, count, err
+	}
+	broadcasts, err := r.queryBroadcasts(ctx, stmt, args...)
+	if err != nil {
+		return nil, count, err
+	}
+
+	return broadcasts, count, nil
+}
+
+// FindDue returns the scheduled broadcasts which should have been started
+// before the given time
+func (r *broadcastRepository) FindDue(ctx context.Context, before time.Time) ([]*Broadcast, error) {
+	stmt, args, err := r.selectBroadcast().
+		Where("status = ?", BroadcastStatusScheduled).
+		Where("scheduled_at <= ?", before).
+		OrderBy("scheduled_at ASC").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.queryBroadcasts(ctx, stmt, args...)
+}
+
+func (r *broadcastRepository) FindByStatus(ctx context.Context, status BroadcastStatus) ([]*Broadcast, error) {
+	stmt, args, err := r.selectBroadcast().Where("status = ?", status).OrderBy("id ASC").ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.queryBroadcasts(ctx, stmt, args...)
+}
+
+// FindUnleased returns the running broadcasts which no replica is sending,
+// their lease expired or was released
+func (r *broadcastRepository) FindUnleased(ctx context.Context) ([]*Broadcast, error) {
+	stmt, args, err := r.selectBroadcast().
+		Where("status = ?", BroadcastStatusRunning).
+		Where("(lease_expires_at IS NULL OR lease_expires_at < now())").
+		OrderBy("id ASC").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.queryBroadcasts(ctx, stmt, args...)
+}
+
+// ClaimLease takes or renews the lease of a running broadcast for the owner,
+// it reports false when the broadcast isn't running anymore or another owner
+// holds an unexpired lease
+func (r *broadcastRepository) ClaimLease(ctx context.Context, id uid.UID, owner string, ttl time.Duration) (bool, error) {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameBroadcast)).
+		Set("lease_owner", owner).
+		Set("lease_expires_at", squirrel.Expr("now() + ? * interval '1 millisecond'", ttl.Milliseconds())).
+		Where("id = ?", id).
+		Where("status = ?", BroadcastStatusRunning).
+		Where("(lease_owner = ? OR lease_expires_at IS NULL OR lease_expires_at < now())", owner).
+		ToSql()
+	if err != nil {
+		return false, err
+	}
+	tag, err := r.DB.Connection().Exec(ctx, stmt, args...)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// ReleaseLease lets another replica take over the broadcast right away, a
+// lease of another owner is kept
+func (r *broadcastRepository) ReleaseLease(ctx context.Context, id uid.UID, owner string) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameBroadcast)).
+		Set("lease_owner", "").
+		Set("lease_expires_at", nil).
+		Where("id = ?", id).
+		Where("lease_owner = ?", owner).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+// UpdateStatus moves the broadcast from one status to another, it reports
+// false when the broadcast was not in the expected status
+func (r *broadcastRepository) UpdateStatus(ctx context.Context, id uid.UID, from, to BroadcastStatus) (bool, error) {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameBroadcast)).
+		Set("status", to).
+		Where("id = ?", id).
+		Where("status = ?", from).
+		ToSql()
+	if err != nil {
+		return false, err
+	}
+	tag, err := r.DB.Connection().Exec(ctx, stmt, args...)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// UpdateLastContactId records the progress of a running broadcast so that it
+// can continue from the next contact
+func (r *broadcastRepository) UpdateLastContactId(ctx context.Context, id uid.UID, contactId uid.UID) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameBroadcast)).
+		Set("last_contact_id", contactId).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *broadcastRepository) Delete(ctx context.Context, id uid.UID) error {
+	stmt, args, err := r.DB.Builder().Delete(string(TableNameBroadcast)).Where("id = ?", id).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *broadcastRepository) SaveStat(ctx context.Context, stat *BroadcastStat) error {
+	stmt, args, err := r.DB.Builder().Insert(string(TableNameBroadcastStat)).Columns(
+		"id",
+		"broadcast_id",
+		"variant_id",
+		"total",
+		"sent",
+		"opened",
+		"clicked",
+		"unsubscribed",
+		"complained",
+		"bounced",
+		"delivered",
+		"workspace_id",
+	).Values(
+		r.UID(stat.Id),
+		stat.BroadcastId,
+		stat.VariantId,
+		stat.Total,
+		stat.Sent,
+		stat.Opened,
+		stat.Clicked,
+		stat.Unsubscribed,
+		stat.Complained,
+		stat.Bounced,
+		stat.Delivered,
+		stat.WorkspaceId,
+	).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *broadcastRepository) FindStat(ctx context.Context, broadcastId uid.UID) (*BroadcastStat, error) {
+	stmt, args, err := r.selectStat().
+		Where("broadcast_id = ?", broadcastId).
+		Where("variant_id = 0").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	stat, err := r.scanStat(r.DB.Connection().QueryRow(ctx, stmt, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+
+	return stat, err
+}
+
+func (r *broadcastRepository) FindVariantStats(ctx context.Context, broadcastId uid.UID) ([]*BroadcastStat, error) {
+	stmt, args, err := r.selectStat().
+		Where("broadcast_id = ?", broadcastId).
+		Where("variant_id <> 0").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]*BroadcastStat, 0)
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		stat, err := r.scanStat(rows)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats, rows.Err()
+}
+
+func (r *broadcastRepository) IncrementStat(
+	ctx context.Context,
+	broadcastId uid.UID,
+	counter BroadcastStatCounter,
+	delta int,
+) error {
+	column := string(counter)
+	stmt, args, err := r.DB.Builder().Update(string(TableNameBroadcastStat)).
+		Set(column, squirrel.Expr(column+" + ?", delta)).
+		Where("broadcast_id = ?", broadcastId).
+		Where("variant_id = 0").
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *broadcastRepository) IncrementVariantStat(
+	ctx context.Context,
+	variantId uid.UID,
+	counter BroadcastStatCounter,
+	delta int,
+) error {
+	column := string(counter)
+	stmt, args, err := r.DB.Builder().Update(string(TableNameBroadcastStat)).
+		Set(column, squirrel.Expr(column+" + ?", delta)).
+		Where("variant_id = ?", variantId).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+// SaveEvent records the event as counted, it returns false when the event
+// was counted before
+func (r *broadcastRepository) SaveEvent(ctx context.Context, eventId uid.UID) (bool, error) {
+	stmt, args, err := r.DB.Builder().Insert(string(TableNameBroadcastEvent)).
+		Columns("event_id").
+		Values(eventId).
+		Suffix("ON CONFLICT (event_id) DO NOTHING").
+		ToSql()
+	if err != nil {
+		return false, err
+	}
+	tag, err := r.DB.Connection().Exec(ctx, stmt, args...)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// StartTestWindow ends the test phase of an A/B tested broadcast, the
+// progress is reset as the remainder is sent from the first contact again
+func (r *broadcastRepository) StartTestWindow(ctx context.Context, id uid.UID, testEndsAt time.Time) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameBroadcast)).
+		Set("test_ends_at", testEndsAt).
+		Set("last_contact_id", uid.UID{}).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *broadcastRepository) SaveVariant(ctx context.Context, variant *BroadcastVariant) error {
+	stmt, args, err := r.DB.Builder().Insert(string(TableNameBroadcastVariant)).Columns(
+		"id",
+		"broadcast_id",
+		"name",
+		"subject",
+		"template_id",
+		"from_name",
+		"is_winner",
+		"workspace_id",
+	).Values(
+		r.UID(variant.Id),
+		variant.BroadcastId,
+		variant.Name,
+		variant.Subject,
+		variant.TemplateId,
+		variant.FromName,
+		variant.IsWinner,
+		variant.WorkspaceId,
+	).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *broadcastRepository) FindVariants(ctx context.Context, broadcastId uid.UID) ([]*BroadcastVariant, error) {
+	stmt, args, err := r.DB.Builder().Select(
+		"id",
+		"broadcast_id",
+		"name",
+		"subject",
+		"template_id",
+		"from_name",
+		"is_winner",
+		"workspace_id",
+	).From(string(TableNameBroadcastVariant)).
+		Where("broadcast_id = ?", broadcastId).
+		OrderBy("id ASC").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	variants := make([]*BroadcastVariant, 0)
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var variant BroadcastVariant
+		err = rows.Scan(
+			&variant.Id,
+			&variant.BroadcastId,
+			&variant.Name,
+			&variant.Subject,
+			&variant.TemplateId,
+			&variant.FromName,
+			&variant.IsWinner,
+			&variant.WorkspaceId,
+		)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, &variant)
+	}
+
+	return variants, rows.Err()
+}
+
+func (r *broadcastRepository) DeleteVariants(ctx context.Context, broadcastId uid.UID) error {
+	stmt, args, err := r.DB.Builder().Delete(string(TableNameBroadcastVariant)).
+		Where("broadcast_id = ?", broadcastId).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *broadcastRepository) UpdateVariantWinner(ctx context.Context, id uid.UID) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameBroadcastVariant)).
+		Set("is_winner", true).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *broadcastRepository) selectStat() squirrel.SelectBuilder {
+	return r.DB.Builder().Select(
+		"id",
+		"broadcast_id",
+		"variant_id",
+		"total",
+		"sent",
+		"opened",
+		"clicked",
+		"unsubscribed",
+		"complained",
+		"bounced",
+		"delivered",
+		"workspace_id",
+	).From(string(TableNameBroadcastStat))
+}
+
+func (r *broadcastRepository) scanStat(row pgx.Row) (*BroadcastStat, error) {
+	var stat BroadcastStat
+	err := row.Scan(
+		&stat.Id,
+		&stat.BroadcastId,
+		&stat.VariantId,
+		&stat.Total,
+		&stat.Sent,
+		&stat.Opened,
+		&stat.Clicked,
+		&stat.Unsubscribed,
+		&stat.Complained,
+		&stat.Bounced,
+		&stat.Delivered,
+		&stat.WorkspaceId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stat, nil
+}
+
+func (r *broadcastRepository) selectBroadcast() squirrel.SelectBuilder {
+	return r.DB.Builder().Select(
+		"id",
+		"name",
+		`"from"`,
+		"reply_to",
+		"template_id",
+		"delay",
+		"delay_time_zone",
+		"scheduled_at",
+		"send_rate",
+		"local_send_time",
+		"last_contact_id",
+		"test_percentage",
+		"test_window_in_minutes",
+		"winner_metric",
+		"test_ends_at",
+		"events",
+		"status",
+		"segments",
+		"open_tracking",
+		"click_tracking",
+		"cc_addresses",
+		"bcc_addresses",
+		"organization_id",
+		"workspace_id",
+	).From(string(TableNameBroadcast))
+}
+
+func (r *broadcastRepository) queryBroadcasts(ctx context.Context, stmt string, args ...interface{}) ([]*Broadcast, error) {
+	broadcasts := make([]*Broadcast, 0)
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		broadcast, err := r.scanBroadcast(rows)
+		if err != nil {
+			return nil, err
+		}
+		broadcasts = append(broadcasts, broadcast)
+	}
+
+	return broadcasts, rows.Err()
+}
+
+func (r *broadcastRepository) scanBroadcast(row pgx.Row) (*Broadcast, error) {
+	var broadcast Broadcast
+	err := row.Scan(
+		&broadcast.Id,
+		&broadcast.Name,
+		&broadcast.From,
+		&broadcast.ReplyTo,
+		&broadcast.TemplateId,
+		&broadcast.Delay,
+		&broadcast.DelayTimeZone,
+		&broadcast.ScheduledAt,
+		&broadcast.SendRate,
+		&broadcast.LocalSendTime,
+		&broadcast.LastContactId,
+		&broadcast.TestPercentage,
+		&broadcast.TestWindowInMinutes,
+		&broadcast.WinnerMetric,
+		&broadcast.TestEndsAt,
+		&broadcast.Events,
+		&broadcast.Status,
+		&broadcast.Segments,
+		&broadcast.OpenTracking,
+		&broadcast.ClickTracking,
+		&broadcast.CCAddresses,
+		&broadcast.BCCAddresses,
+		&broadcast.OrganizationId,
+		&broadcast.WorkspaceId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &broadcast, nil
+}
@@ -1,15 +1,367 @@
 package model
 
-import "github.com/usesend0/send0/internal/uid"
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type ContactRepository interface {
+	Save(ctx context.Context, contact *Contact) error
+	FindById(ctx context.Context, id uid.UID) (*Contact, error)
+	FindByEmail(ctx context.Context, workspaceId uid.UID, email string) (*Contact, error)
+	FindSubscribedBySegments(
+		ctx context.Context,
+		workspaceId uid.UID,
+		segmentIds []int64,
+		afterId uid.UID,
+		limit int,
+	) ([]*Contact, error)
+	FindSubscribedByTimeZone(
+		ctx context.Context,
+		workspaceId uid.UID,
+		segmentIds []int64,
+		timeZone string,
+		afterId uid.UID,
+		limit int,
+	) ([]*Contact, error)
+	FindSubscribedTimeZones(ctx context.Context, workspaceId uid.UID, segmentIds []int64) ([]string, error)
+	CountSubscribedBySegments(ctx context.Context, workspaceId uid.UID, segmentIds []int64) (int, error)
+	UpdateEmailVerified(ctx context.Context, id uid.UID, emailVerified bool) error
+	UpdateSuppressed(ctx context.Context, workspaceId uid.UID, emails []string, suppressed bool) error
+	IncrementOpenHour(ctx context.Context, id uid.UID, hour int) error
+	UpdateOpenTimeZone(ctx context.Context, id uid.UID, timeZone string) error
+}
+
+// contactTimeZone is the time zone of the contact attributes, or the one
+// inferred from the open hours. Empty when neither is known
+const contactTimeZone = "COALESCE(NULLIF(attributes->>'timezone', ''), open_time_zone)"
 
 type Contact struct {
 	Base
-	FirstName     string                 `json:"firstName" db:"first_name"`
-	LastName      string                 `json:"lastLame" db:"last_name"`
-	Email         string                 `json:"email" db:"email" gorm:"not null;unique"`
-	EmailVerified bool                   `json:"emailVerified" db:"email_verified" gorm:"not null;default false"`
-	Attributes    map[string]interface{} `json:"attributes" db:"attributes" gorm:"type:jsonb;not null;default '{}'"`
-	Tags          JSONBArray             `json:"tags" db:"tags" gorm:"type:jsonb;not null;default '[]'"`
-	Unsubscribed  bool                   `json:"unsubscribed" db:"unsubscribed" gorm:"not null;default false"`
-	WorkspaceId   uid.UID                `json:"workspaceId" db:"workspace_id" gorm:"not null"`
+	FirstName     string     `json:"firstName" db:"first_name"`
+	LastName      string     `json:"lastLame" db:"last_name"`
+	Email         string     `json:"email" db:"email" gorm:"not null;unique"`
+	EmailVerified bool       `json:"emailVerified" db:"email_verified" gorm:"not null;default false"`
+	Attributes    JSONBMap   `json:"attributes" db:"attributes" gorm:"type:jsonb;not null;default '{}'"`
+	Tags          JSONBArray `json:"tags" db:"tags" gorm:"type:jsonb;not null;default '[]'"`
+	Unsubscribed  bool       `json:"unsubscribed" db:"unsubscribed" gorm:"not null;default false"`
+	Suppressed    bool       `json:"suppressed" db:"suppressed" gorm:"not null;default false"`  // Hard bounced or complained
+	OpenHours     JSONBMap   `json:"-" db:"open_hours" gorm:"type:jsonb;not null;default '{}'"` // Number of opens per UTC hour
+	OpenTimeZone  string     `json:"-" db:"open_time_zone" gorm:"not null;default:''"`          // Time zone inferred from the open hours
+	WorkspaceId   uid.UID    `json:"workspaceId" db:"workspace_id" gorm:"not null"`
+}
+
+type contactRepository struct {
+	*baseRepository
+}
+
+func NewContactRepository(baseRepository *baseRepository) ContactRepository {
+	return &contactRepository{
+		baseRepository,
+	}
+}
+
+func (r *contactRepository) Save(ctx context.Context, contact *Contact) error {
+	if contact.Attributes == nil {
+		contact.Attributes = JSONBMap{}
+	}
+	if contact.OpenHours == nil {
+		contact.OpenHours = JSONBMap{}
+	}
+	stmt, args, err := r.DB.Builder().Insert(string(TableNameContact)).Columns(
+		"id",
+		"first_name",
+		"last_name",
+		"email",
+		"email_verified",
+		"attributes",
+		"tags",
+		"unsubscribed",
+		"suppressed",
+		"open_hours",
+		"open_time_zone",
+		"workspace_id",
+	).Values(
+		r.UID(contact.Id),
+		contact.FirstName,
+		contact.LastName,
+		contact.Email,
+		contact.EmailVerified,
+		contact.Attributes,
+		contact.Tags,
+		contact.Unsubscribed,
+		contact.Suppressed,
+		contact.OpenHours,
+		contact.OpenTimeZone,
+		contact.WorkspaceId,
+	).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *contactRepository) FindById(ctx context.Context, id uid.UID) (*Contact, error) {
+	stmt, args, err := r.selectContact().Where("id = ?", id).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.scanContact(r.DB.Connection().QueryRow(ctx, stmt, args...))
+}
+
+func (r *contactRepository) FindByEmail(ctx context.Context, workspaceId uid.UID, email string) (*Contact, error) {
+	stmt, args, err := r.selectContact().
+		Where("workspace_id = ?", workspaceId).
+		Where("email = ?", email).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.scanContact(r.DB.Connection().QueryRow(ctx, stmt, args...))
+}
+
+// FindSubscribedBySegments returns the contacts subscribed to any of the
+// segments, skipping unsubscribed and suppressed contacts. Contacts are
+// ordered by id so that the next page starts after the last returned id
+func (r *contactRepository) FindSubscribedBySegments(
+	ctx context.Context,
+	workspaceId uid.UID,
+	segmentIds []int64,
+	afterId uid.UID,
+	limit int,
+) ([]*Contact, error) {
+	return r.findPage(ctx, r.whereSubscribedBySegments(r.selectContact(), workspaceId, segmentIds), afterId, limit)
+}
+
+// FindSubscribedByTimeZone is FindSubscribedBySegments for the contacts of
+// the time zone, an empty time zone returns the contacts without one
+func (r *contactRepository) FindSubscribedByTimeZone(
+	ctx context.Context,
+	workspaceId uid.UID,
+	segmentIds []int64,
+	timeZone string,
+	afterId uid.UID,
+	limit int,
+) ([]*Contact, error) {
+	builder := r.whereSubscribedBySegments(r.selectContact(), workspaceId, segmentIds).
+		Where(contactTimeZone+" = ?", timeZone)
+
+	return r.findPage(ctx, builder, afterId, limit)
+}
+
+// FindSubscribedTimeZones returns the distinct time zones of the contacts
+// subscribed to any of the segments
+func (r *contactRepository) FindSubscribedTimeZones(
+	ctx context.Context,
+	workspaceId uid.UID,
+	segmentIds []int64,
+) ([]string, error) {
+	stmt, args, err := r.whereSubscribedBySegments(
+		r.DB.Builder().Select("DISTINCT "+contactTimeZone).From(string(TableNameContact)),
+		workspaceId,
+		segmentIds,
+	).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	timeZones := []string{}
+	for rows.Next() {
+		var timeZone string
+		err := rows.Scan(&timeZone)
+		if err != nil {
+			return nil, err
+		}
+		timeZones = append(timeZones, timeZone)
+	}
+
+	return timeZones, rows.Err()
+}
+
+// findPage returns the contacts after the id in id order
+func (r *contactRepository) findPage(
+	ctx context.Context,
+	builder squirrel.SelectBuilder,
+	afterId uid.UID,
+	limit int,
+) ([]*Contact, error) {
+	stmt, args, err := builder.
+		Where("id > ?", afterId).
+		OrderBy("id ASC").
+		Limit(uint64(limit)).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	contacts := make([]*Contact, 0, limit)
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		contact, err := r.scanContact(rows)
+		if err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, contact)
+	}
+
+	return contacts, rows.Err()
+}
+
+func (r *contactRepository) CountSubscribedBySegments(
+	ctx context.Context,
+	workspaceId uid.UID,
+	segmentIds []int64,
+) (int, error) {
+	var count int
+	stmt, args, err := r.whereSubscribedBySegments(
+		r.DB.Builder().Select("COUNT(*)").From(string(TableNameContact)),
+		workspaceId,
+		segmentIds,
+	).ToSql()
+	if err != nil {
+		return count, err
+	}
+	err = r.DB.Connection().QueryRow(ctx, stmt, args...).Scan(&count)
+
+	return count, err
+}
+
+func (r *contactRepository) UpdateEmailVerified(ctx context.Context, id uid.UID, emailVerified bool) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameContact)).
+		Set("email_verified", emailVerified).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *contactRepository) UpdateSuppressed(
+	ctx context.Context,
+	workspaceId uid.UID,
+	emails []string,
+	suppressed bool,
+) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameContact)).
+		Set("suppressed", suppressed).
+		Where("workspace_id = ?", workspaceId).
+		Where("email = ANY(?)", emails).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+// IncrementOpenHour counts an open of the contact in the given UTC hour
+func (r *contactRepository) IncrementOpenHour(ctx context.Context, id uid.UID, hour int) error {
+	key := strconv.Itoa(hour)
+	stmt, args, err := r.DB.Builder().Update(string(TableNameContact)).
+		Set("open_hours", squirrel.Expr(
+			"jsonb_set(open_hours, ?::text[], to_jsonb(COALESCE((open_hours->>?)::int, 0) + 1))",
+			"{"+key+"}",
+			key,
+		)).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+// UpdateOpenTimeZone sets the time zone inferred from the open hours
+func (r *contactRepository) UpdateOpenTimeZone(ctx context.Context, id uid.UID, timeZone string) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameContact)).
+		Set("open_time_zone", timeZone).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *contactRepository) whereSubscribedBySegments(
+	builder squirrel.SelectBuilder,
+	workspaceId uid.UID,
+	segmentIds []int64,
+) squirrel.SelectBuilder {
+	return builder.
+		Where("workspace_id = ?", workspaceId).
+		Where("unsubscribed = false").
+		Where("suppressed = false").
+		Where(
+			"EXISTS (SELECT 1 FROM "+string(TableNameSegmentContact)+
+				" WHERE contact_id = "+string(TableNameContact)+".id AND segment_id = ANY(?) AND subscribed = true)",
+			segmentIds,
+		)
+}
+
+func (r *contactRepository) selectContact() squirrel.SelectBuilder {
+	return r.DB.Builder().Select(
+		"id",
+		"first_name",
+		"last_name",
+		"email",
+		"email_verified",
+		"attributes",
+		"tags",
+		"unsubscribed",
+		"suppressed",
+		"open_hours",
+		"open_time_zone",
+		"workspace_id",
+	).From(string(TableNameContact))
+}
+
+func (r *contactRepository) scanContact(row pgx.Row) (*Contact, error) {
+	var contact Contact
+	err := row.Scan(
+		&contact.Id,
+		&contact.FirstName,
+		&contact.LastName,
+		&contact.Email,
+		&contact.EmailVerified,
+		&contact.Attributes,
+		&contact.Tags,
+		&contact.Unsubscribed,
+		&contact.Suppressed,
+		&contact.OpenHours,
+		&contact.OpenTimeZone,
+		&contact.WorkspaceId,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &contact, nil
 }
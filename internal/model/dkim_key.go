@@ -0,0 +1,170 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+const (
+	DKIMKeyStatusPending  DKIMKeyStatus = "PENDING"  // Published, SES still signs with the previous key
+	DKIMKeyStatusActive   DKIMKeyStatus = "ACTIVE"   // SES signs with the key
+	DKIMKeyStatusRetiring DKIMKeyStatus = "RETIRING" // Still published until the overlap ends
+	DKIMKeyStatusRetired  DKIMKeyStatus = "RETIRED"
+)
+
+type DKIMKeyRepository interface {
+	Save(ctx context.Context, key *DKIMKey) error
+	Update(ctx context.Context, key *DKIMKey) error
+	FindByDomainId(ctx context.Context, domainId uid.UID) ([]*DKIMKey, error)
+}
+
+type DKIMKeyStatus string
+
+// DKIMKey is a DKIM key of a domain, the keys of a domain are its rotation
+// history
+type DKIMKey struct {
+	Base
+	Selector    string         `json:"selector" db:"selector" gorm:"not null"`
+	Status      DKIMKeyStatus  `json:"status" db:"status" gorm:"not null"`
+	KeySize     int            `json:"keySize" db:"key_size" gorm:"not null"`
+	PrivateKey  JSONPrivateKey `json:"-" db:"private_key" gorm:"type:bytea"` // Discarded when the key is retired
+	PublicKey   string         `json:"publicKey" db:"public_key" gorm:"not null"`
+	ActivatedAt *time.Time     `json:"activatedAt" db:"activated_at"`
+	RetireAt    *time.Time     `json:"retireAt" db:"retire_at"` // End of the overlap of a retiring key
+	RetiredAt   *time.Time     `json:"retiredAt" db:"retired_at"`
+	DomainId    uid.UID        `json:"domainId" db:"domain_id" gorm:"not null;index"`
+	WorkspaceId uid.UID        `json:"workspaceId" db:"workspace_id" gorm:"not null"`
+}
+
+type dkimKeyRepository struct {
+	*baseRepository
+}
+
+func NewDKIMKeyRepository(baseRepository *baseRepository) DKIMKeyRepository {
+	return &dkimKeyRepository{
+		baseRepository,
+	}
+}
+
+func (r *dkimKeyRepository) Save(ctx context.Context, key *DKIMKey) error {
+	stmt, args, err := r.DB.Builder().Insert(string(TableNameDKIMKey)).Columns(
+		"id",
+		"selector",
+		"status",
+		"key_size",
+		"private_key",
+		"public_key",
+		"activated_at",
+		"retire_at",
+		"retired_at",
+		"domain_id",
+		"workspace_id",
+	).Values(
+		r.UID(key.Id),
+		key.Selector,
+		key.Status,
+		key.KeySize,
+		key.PrivateKey,
+		key.PublicKey,
+		key.ActivatedAt,
+		key.RetireAt,
+		key.RetiredAt,
+		key.DomainId,
+		key.WorkspaceId,
+	).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *dkimKeyRepository) Update(ctx context.Context, key *DKIMKey) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameDKIMKey)).
+		Set("status", key.Status).
+		Set("private_key", key.PrivateKey).
+		Set("activated_at", key.ActivatedAt).
+		Set("retire_at", key.RetireAt).
+		Set("retired_at", key.RetiredAt).
+		Where("id = ?", key.Id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+// FindByDomainId returns the keys of the domain, the newest first
+func (r *dkimKeyRepository) FindByDomainId(ctx context.Context, domainId uid.UID) ([]*DKIMKey, error) {
+	stmt, args, err := r.selectDKIMKey().
+		Where("domain_id = ?", domainId).
+		OrderBy("id DESC").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := make([]*DKIMKey, 0)
+	for rows.Next() {
+		key, err := r.scanDKIMKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (r *dkimKeyRepository) selectDKIMKey() squirrel.SelectBuilder {
+	return r.DB.Builder().Select(
+		"id",
+		"selector",
+		"status",
+		"key_size",
+		"private_key",
+		"public_key",
+		"activated_at",
+		"retire_at",
+		"retired_at",
+		"domain_id",
+		"workspace_id",
+	).From(string(TableNameDKIMKey))
+}
+
+func (r *dkimKeyRepository) scanDKIMKey(row pgx.Row) (*DKIMKey, error) {
+	var key DKIMKey
+	err := row.Scan(
+		&key.Id,
+		&key.Selector,
+		&key.Status,
+		&key.KeySize,
+		&key.PrivateKey,
+		&key.PublicKey,
+		&key.ActivatedAt,
+		&key.RetireAt,
+		&key.RetiredAt,
+		&key.DomainId,
+		&key.WorkspaceId,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
@@ -0,0 +1,270 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+var ErrDMARCReportExists = errors.New("dmarc report already exists")
+
+type DMARCReportRepository interface {
+	Save(ctx context.Context, report *DMARCReport) error
+	SaveRecords(ctx context.Context, report *DMARCReport) error
+	FindAll(ctx context.Context, options DMARCReportFindOptions) ([]*DMARCReport, int, error)
+	FindSourceStats(ctx context.Context, options DMARCReportFindOptions) ([]*DMARCSourceStat, error)
+}
+
+// DMARCReport is a DMARC aggregate report a receiver sent about a domain
+type DMARCReport struct {
+	Base
+	ReportId    string               `json:"reportId" db:"report_id" gorm:"not null;uniqueIndex:idx_dmarc_reports_org_report"`
+	OrgName     string               `json:"orgName" db:"org_name" gorm:"not null;uniqueIndex:idx_dmarc_reports_org_report"`
+	Email       string               `json:"email" db:"email" gorm:"not null"`
+	BeginAt     time.Time            `json:"beginAt" db:"begin_at" gorm:"type:timestamp with time zone;not null"`
+	EndAt       time.Time            `json:"endAt" db:"end_at" gorm:"type:timestamp with time zone;not null"`
+	Policy      string               `json:"policy" db:"policy" gorm:"not null"` // Published policy the receiver saw
+	Records     []*DMARCReportRecord `json:"records,omitempty" db:"-" gorm:"-:all"`
+	DomainId    uid.UID              `json:"domainId" db:"domain_id" gorm:"not null;uniqueIndex:idx_dmarc_reports_org_report,priority:1"`
+	WorkspaceId uid.UID              `json:"workspaceId" db:"workspace_id" gorm:"not null"`
+}
+
+// DMARCReportRecord is the result of the messages of a report sent from a
+// source IP
+type DMARCReportRecord struct {
+	Base
+	SourceIP    string  `json:"sourceIp" db:"source_ip" gorm:"not null"`
+	Count       int     `json:"count" db:"count" gorm:"not null"`
+	Disposition string  `json:"disposition" db:"disposition" gorm:"not null"` // none, quarantine or reject
+	DKIM        string  `json:"dkim" db:"dkim" gorm:"not null"`               // Aligned DKIM result, pass or fail
+	SPF         string  `json:"spf" db:"spf" gorm:"not null"`                 // Aligned SPF result, pass or fail
+	HeaderFrom  string  `json:"headerFrom" db:"header_from" gorm:"not null"`
+	ReportId    uid.UID `json:"reportId" db:"dmarc_report_id" gorm:"not null;index"`
+	DomainId    uid.UID `json:"domainId" db:"domain_id" gorm:"not null;index"`
+}
+
+// DMARCSourceStat sums the messages of a source IP over the matching reports
+type DMARCSourceStat struct {
+	SourceIP string `json:"sourceIp"`
+	Total    int    `json:"total"`
+	DKIMPass int    `json:"dkimPass"`
+	SPFPass  int    `json:"spfPass"`
+	Pass     int    `json:"pass"` // DKIM or SPF passed, which passes DMARC
+	Reports  int    `json:"reports"`
+}
+
+type DMARCReportFindOptions struct {
+	DomainId uid.UID
+	From     *time.Time
+	To       *time.Time
+	Offset   int
+	Limit    int
+}
+
+type dmarcReportRepository struct {
+	*baseRepository
+}
+
+func NewDMARCReportRepository(baseRepository *baseRepository) DMARCReportRepository {
+	return &dmarcReportRepository{
+		baseRepository,
+	}
+}
+
+// Save inserts the report without its records, a report of the same
+// organization with the same id about the domain returns ErrDMARCReportExists
+func (r *dmarcReportRepository) Save(ctx context.Context, report *DMARCReport) error {
+	stmt, args, err := r.DB.Builder().Insert(string(TableNameDMARCReport)).Columns(
+		"id",
+		"report_id",
+		"org_name",
+		"email",
+		"begin_at",
+		"end_at",
+		"policy",
+		"domain_id",
+		"workspace_id",
+	).Values(
+		r.UID(report.Id),
+		report.ReportId,
+		report.OrgName,
+		report.Email,
+		report.BeginAt,
+		report.EndAt,
+		report.Policy,
+		report.DomainId,
+		report.WorkspaceId,
+	).Suffix("ON CONFLICT (domain_id, org_name, report_id) DO NOTHING RETURNING id").ToSql()
+	if err != nil {
+		return err
+	}
+	err = r.DB.Connection().QueryRow(ctx, stmt, args...).Scan(&report.Id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrDMARCReportExists
+	}
+
+	return err
+}
+
+// SaveRecords inserts the records of the saved report
+func (r *dmarcReportRepository) SaveRecords(ctx context.Context, report *DMARCReport) error {
+	if len(report.Records) == 0 {
+		return nil
+	}
+	builder := r.DB.Builder().Insert(string(TableNameDMARCRecord)).Columns(
+		"id",
+		"source_ip",
+		"count",
+		"disposition",
+		"dkim",
+		"spf",
+		"header_from",
+		"dmarc_report_id",
+		"domain_id",
+	)
+	for _, record := range report.Records {
+		record.Id = r.UID(record.Id)
+		record.ReportId = report.Id
+		record.DomainId = report.DomainId
+		builder = builder.Values(
+			record.Id,
+			record.SourceIP,
+			record.Count,
+			record.Disposition,
+			record.DKIM,
+			record.SPF,
+			record.HeaderFrom,
+			record.ReportId,
+			record.DomainId,
+		)
+	}
+	stmt, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+// FindAll returns a page of the reports without their records, the newest
+// reports first
+func (r *dmarcReportRepository) FindAll(ctx context.Context, options DMARCReportFindOptions) ([]*DMARCReport, int, error) {
+	filters := dmarcReportFilters(options)
+	builder := r.DB.Builder().Select(
+		"id",
+		"report_id",
+		"org_name",
+		"email",
+		"begin_at",
+		"end_at",
+		"policy",
+		"domain_id",
+		"workspace_id",
+	).From(string(TableNameDMARCReport)).Where(filters).OrderBy("end_at DESC")
+	if options.Limit > 0 {
+		builder = builder.Offset(uint64(options.Offset)).Limit(uint64(options.Limit))
+	}
+	stmt, args, err := builder.ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	reports := make([]*DMARCReport, 0)
+	for rows.Next() {
+		var report DMARCReport
+		err = rows.Scan(
+			&report.Id,
+			&report.ReportId,
+			&report.OrgName,
+			&report.Email,
+			&report.BeginAt,
+			&report.EndAt,
+			&report.Policy,
+			&report.DomainId,
+			&report.WorkspaceId,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		reports = append(reports, &report)
+	}
+	if rows.Err() != nil {
+		return nil, 0, rows.Err()
+	}
+	stmt, args, err = r.DB.Builder().Select("COUNT(*)").
+		From(string(TableNameDMARCReport)).
+		Where(filters).
+		ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+	var count int
+	err = r.DB.Connection().QueryRow(ctx, stmt, args...).Scan(&count)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return reports, count, nil
+}
+
+// FindSourceStats sums the records of the matching reports by source IP, the
+// sources sending the most messages first
+func (r *dmarcReportRepository) FindSourceStats(ctx context.Context, options DMARCReportFindOptions) ([]*DMARCSourceStat, error) {
+	stmt, args, err := r.DB.Builder().Select(
+		"rec.source_ip",
+		"SUM(rec.count)",
+		"SUM(CASE WHEN rec.dkim = 'pass' THEN rec.count ELSE 0 END)",
+		"SUM(CASE WHEN rec.spf = 'pass' THEN rec.count ELSE 0 END)",
+		"SUM(CASE WHEN rec.dkim = 'pass' OR rec.spf = 'pass' THEN rec.count ELSE 0 END)",
+		"COUNT(DISTINCT rec.dmarc_report_id)",
+	).
+		From(string(TableNameDMARCRecord) + " rec").
+		Join(string(TableNameDMARCReport) + " dmarc_reports ON dmarc_reports.id = rec.dmarc_report_id").
+		Where(dmarcReportFilters(options)).
+		GroupBy("rec.source_ip").
+		OrderBy("SUM(rec.count) DESC").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := make([]*DMARCSourceStat, 0)
+	for rows.Next() {
+		var stat DMARCSourceStat
+		err = rows.Scan(&stat.SourceIP, &stat.Total, &stat.DKIMPass, &stat.SPFPass, &stat.Pass, &stat.Reports)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, &stat)
+	}
+
+	return stats, rows.Err()
+}
+
+func dmarcReportFilters(options DMARCReportFindOptions) squirrel.And {
+	filters := squirrel.And{}
+	if options.DomainId != (uid.UID{}) {
+		filters = append(filters, squirrel.Eq{"dmarc_reports.domain_id": options.DomainId})
+	}
+	if options.From != nil {
+		filters = append(filters, squirrel.GtOrEq{"dmarc_reports.end_at": options.From})
+	}
+	if options.To != nil {
+		filters = append(filters, squirrel.Lt{"dmarc_reports.begin_at": options.To})
+	}
+
+	return filters
+}
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type DNSProviderRepository interface {
+	Save(ctx context.Context, provider *DNSProvider) error
+	FindById(ctx context.Context, id uid.UID) (*DNSProvider, error)
+	FindByWorkspaceId(ctx context.Context, workspaceId uid.UID) ([]*DNSProvider, error)
+	Delete(ctx context.Context, id uid.UID) error
+}
+
+// DNSProvider is the account of a DNS provider the domain records are
+// published with
+type DNSProvider struct {
+	Base
+	Name        string  `json:"name" db:"name" gorm:"not null"`
+	Type        string  `json:"type" db:"type" gorm:"not null"`
+	Credentials []byte  `json:"-" db:"credentials" gorm:"type:bytea;not null"` // Encrypted JSON credentials of the type
+	WorkspaceId uid.UID `json:"workspaceId" db:"workspace_id" gorm:"not null"`
+}
+
+type dnsProviderRepository struct {
+	*baseRepository
+}
+
+func NewDNSProviderRepository(baseRepository *baseRepository) DNSProviderRepository {
+	return &dnsProviderRepository{
+		baseRepository,
+	}
+}
+
+func (r *dnsProviderRepository) Save(ctx context.Context, provider *DNSProvider) error {
+	stmt, args, err := r.DB.Builder().Insert(string(TableNameDNSProvider)).Columns(
+		"id",
+		"name",
+		"type",
+		"credentials",
+		"workspace_id",
+	).Values(
+		r.UID(provider.Id),
+		provider.Name,
+		provider.Type,
+		provider.Credentials,
+		provider.WorkspaceId,
+	).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *dnsProviderRepository) FindById(ctx context.Context, id uid.UID) (*DNSProvider, error) {
+	stmt, args, err := r.selectDNSProvider().
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.scanDNSProvider(r.DB.Connection().QueryRow(ctx, stmt, args...))
+}
+
+func (r *dnsProviderRepository) FindByWorkspaceId(ctx context.Context, workspaceId uid.UID) ([]*DNSProvider, error) {
+	stmt, args, err := r.selectDNSProvider().
+		Where("workspace_id = ?", workspaceId).
+		OrderBy("id DESC").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	providers := make([]*DNSProvider, 0)
+	for rows.Next() {
+		provider, err := r.scanDNSProvider(rows)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+
+	return providers, rows.Err()
+}
+
+func (r *dnsProviderRepository) Delete(ctx context.Context, id uid.UID) error {
+	stmt, args, err := r.DB.Builder().Delete(string(TableNameDNSProvider)).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *dnsProviderRepository) selectDNSProvider() squirrel.SelectBuilder {
+	return r.DB.Builder().Select(
+		"id",
+		"name",
+		"type",
+		"credentials",
+		"workspace_id",
+	).From(string(TableNameDNSProvider))
+}
+
+func (r *dnsProviderRepository) scanDNSProvider(row pgx.Row) (*DNSProvider, error) {
+	var provider DNSProvider
+	err := row.Scan(
+		&provider.Id,
+		&provider.Name,
+		&provider.Type,
+		&provider.Credentials,
+		&provider.WorkspaceId,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &provider, nil
+}
@@ -2,47 +2,77 @@ package model
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
 	"github.com/usesend0/send0/internal/constant"
 	"github.com/usesend0/send0/internal/uid"
+	"golang.org/x/net/publicsuffix"
 )
 
 var DomainStatusTypeCreateQuery = fmt.Sprintf(
-	`CREATE TYPE %s AS ENUM ('%s','%s','%s');`,
+	`CREATE TYPE %s AS ENUM ('%s','%s','%s','%s');`,
 	DBTypeDomainStatus,
 	constant.DomainStatusPending,
 	constant.DomainStatusActive,
 	constant.DomainStatusInactive,
+	constant.DomainStatusIncomplete,
 )
 
 type DomainRepository interface {
 	Save(ctx context.Context, domain *Domain) error
-	FindAll(ctx context.Context, options DomainFindOptions) ([]*Domain, error)
+	FindAll(ctx context.Context, options DomainFindOptions) ([]*Domain, int, error)
 	FindById(ctx context.Context, id uid.UID) (*Domain, error)
+	FindByIdForUpdate(ctx context.Context, id uid.UID) (*Domain, error)
 	FindByDomainName(ctx context.Context, workspaceId, organizationId uid.UID, domainName string) (*Domain, error)
 	Delete(ctx context.Context, id uid.UID) error
+	FindDueForVerification(ctx context.Context, checkedBefore time.Time, limit int) ([]*Domain, error)
+	UpdateVerification(ctx context.Context, domain *Domain, previousStatus constant.DomainStatus) (bool, error)
+	UpdateDNSProvider(ctx context.Context, id uid.UID, dnsProviderId *uid.UID) error
+	UpdateDKIM(ctx context.Context, domain *Domain) error
+	UpdateMailFrom(ctx context.Context, domain *Domain) error
+	UpdateFailover(ctx context.Context, domain *Domain) error
+	UpdateIPPools(ctx context.Context, domain *Domain) error
 }
 
 type Domain struct {
 	Base
-	Name           string                     `json:"name" db:"name" gorm:"not null"`
-	Region         constant.AwsRegion         `json:"region" db:"region" gorm:"not null"`
-	Status         constant.DomainStatus      `json:"status" db:"status" gorm:"not null;type:domain_status;default:'PENDING'"`
-	DKIMRecords    constant.JSONDomainRecords `json:"dkimRecords" db:"dkim_records" gorm:"type:jsonb;not null;default '[]'"`
-	SPFRecords     constant.JSONDomainRecords `json:"spfRecords" db:"spf_records" gorm:"type:jsonb;not null;default '[]'"`
-	DMARCRecords   constant.JSONDomainRecords `json:"dmarcRecords" db:"dmarc_records" gorm:"type:jsonb;not null;default '[]'"`
-	PrivateKey     JSONPrivateKey             `json:"-" db:"private_key" gorm:"not null"`
-	OrganizationId uid.UID                    `json:"organizationId" db:"organization_id" gorm:"not null"`
-	WorkspaceId    uid.UID                    `json:"workspaceId" db:"workspace_id" gorm:"not null"`
+	Name                           string                     `json:"name" db:"name" gorm:"not null"`
+	Region                         constant.AwsRegion         `json:"region" db:"region" gorm:"not null"`
+	Status                         constant.DomainStatus      `json:"status" db:"status" gorm:"not null;type:domain_status;default:'PENDING'"`
+	DKIMRecords                    constant.JSONDomainRecords `json:"dkimRecords" db:"dkim_records" gorm:"type:jsonb;not null;default '[]'"`
+	SPFRecords                     constant.JSONDomainRecords `json:"spfRecords" db:"spf_records" gorm:"type:jsonb;not null;default '[]'"`
+	DMARCRecords                   constant.JSONDomainRecords `json:"dmarcRecords" db:"dmarc_records" gorm:"type:jsonb;not null;default '[]'"`
+	PrivateKey                     JSONPrivateKey             `json:"-" db:"private_key" gorm:"not null"` // Key SES signs with
+	DKIMSelector                   string                     `json:"dkimSelector" db:"dkim_selector" gorm:"not null;default:'send0'"`
+	MailFromDomain                 string                     `json:"mailFromDomain" db:"mail_from_domain" gorm:"not null;default:''"`
+	MailFromStatus                 constant.MailFromStatus    `json:"mailFromStatus" db:"mail_from_status" gorm:"not null;default:'PENDING'"`
+	MailFromBehaviorOnMXFailure    constant.MailFromBehavior  `json:"mailFromBehaviorOnMxFailure" db:"mail_from_behavior_on_mx_failure" gorm:"not null;default:'USE_DEFAULT_VALUE'"`
+	SendRate                       int                        `json:"sendRate" db:"send_rate" gorm:"not null;default:0"` // Emails per second, 0 is unlimited
+	CheckedAt                      *time.Time                 `json:"checkedAt" db:"checked_at"`                         // Last verification of the records
+	DNSProviderId                  *uid.UID                   `json:"dnsProviderId" db:"dns_provider_id"`                // Publishes the records when set
+	FailoverRegion                 *constant.AwsRegion        `json:"failoverRegion" db:"failover_region"`               // Region the domain is also verified in
+	FailoverPolicy                 constant.FailoverPolicy    `json:"failoverPolicy" db:"failover_policy" gorm:"not null;default:'NONE'"`
+	IPPoolsPending                 bool                       `json:"-" db:"ip_pools_pending" gorm:"not null;default:false"`                // The IP pools failed to apply, the next verification applies them
+	MarketingConfigSetName         string                     `json:"-" db:"marketing_config_set_name" gorm:"not null;default:''"`          // Sends the broadcast emails once a marketing IP pool is applied
+	FailoverMarketingConfigSetName string                     `json:"-" db:"failover_marketing_config_set_name" gorm:"not null;default:''"` // Sends the broadcast emails in the failover region
+	OrganizationId                 uid.UID                    `json:"organizationId" db:"organization_id" gorm:"not null"`
+	WorkspaceId                    uid.UID                    `json:"workspaceId" db:"workspace_id" gorm:"not null"`
 }
 
 type DomainFindOptions struct {
 	Id             uid.UID
 	Name           string
 	Region         constant.AwsRegion
+	Status         constant.DomainStatus
 	OrganizationId uid.UID
 	WorkspaceId    uid.UID
+	Ascending      bool
+	Offset         int
+	Limit          int // Zero returns all the domains
 }
 
 type domainRepository struct {
@@ -65,6 +95,14 @@ func (r *domainRepository) Save(ctx context.Context, domain *Domain) error {
 		"spf_records",
 		"dmarc_records",
 		"private_key",
+		"dkim_selector",
+		"mail_from_domain",
+		"mail_from_status",
+		"mail_from_behavior_on_mx_failure",
+		"send_rate",
+		"dns_provider_id",
+		"failover_region",
+		"failover_policy",
 		"organization_id",
 		"workspace_id",
 	).Values(
@@ -76,6 +114,14 @@ func (r *domainRepository) Save(ctx context.Context, domain *Domain) error {
 		domain.SPFRecords,
 		domain.DMARCRecords,
 		domain.PrivateKey,
+		domain.DKIMSelector,
+		domain.MailFromDomain,
+		domain.MailFromStatus,
+		domain.MailFromBehaviorOnMXFailure,
+		domain.SendRate,
+		domain.DNSProviderId,
+		domain.FailoverRegion,
+		domain.FailoverPolicy,
 		domain.OrganizationId,
 		domain.WorkspaceId,
 	).ToSql()
@@ -87,66 +133,89 @@ func (r *domainRepository) Save(ctx context.Context, domain *Domain) error {
 	return err
 }
 
-func (r *domainRepository) FindAll(ctx context.Context, options DomainFindOptions) ([]*Domain, error) {
-	var domains []*Domain
-	stmt, args, err := r.DB.Builder().Select(
-		"id",
-		"updated_at",
-		"name",
-		"region",
-		"status",
-		"organization_id",
-		"workspace_id",
-	).From(string(TableNameDomain)).ToSql()
+// FindAll returns a page of the domains matching the options and the number
+// of matching domains, zero values don't filter
+func (r *domainRepository) FindAll(ctx context.Context, options DomainFindOptions) ([]*Domain, int, error) {
+	filters := squirrel.And{}
+	if options.Id != (uid.UID{}) {
+		filters = append(filters, squirrel.Eq{"id": options.Id})
+	}
+	if options.Name != "" {
+		filters = append(filters, squirrel.Eq{"name": options.Name})
+	}
+	if options.Region != "" {
+		filters = append(filters, squirrel.Eq{"region": options.Region})
+	}
+	if options.Status != "" {
+		filters = append(filters, squirrel.Eq{"status": options.Status})
+	}
+	if options.OrganizationId != (uid.UID{}) {
+		filters = append(filters, squirrel.Eq{"organization_id": options.OrganizationId})
+	}
+	if options.WorkspaceId != (uid.UID{}) {
+		filters = append(filters, squirrel.Eq{"workspace_id": options.WorkspaceId})
+	}
+	order := "id DESC"
+	if options.Ascending {
+		order = "id ASC"
+	}
+	builder := r.selectDomain().Where(filters).OrderBy(order)
+	if options.Limit > 0 {
+		builder = builder.Offset(uint64(options.Offset)).Limit(uint64(options.Limit))
+	}
+	stmt, args, err := builder.ToSql()
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
+	domains := make([]*Domain, 0)
 	for rows.Next() {
-		var domain Domain
-		err = rows.Scan(
-			&domain.Id,
-			&domain.UpdatedAt,
-			&domain.Name,
-			&domain.Region,
-			&domain.Status,
-			&domain.OrganizationId,
-			&domain.WorkspaceId,
-		)
+		domain, err := r.scanDomain(rows)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
-		domains = append(domains, &domain)
+		domains = append(domains, domain)
+	}
+	if rows.Err() != nil {
+		return nil, 0, rows.Err()
+	}
+	stmt, args, err = r.DB.Builder().Select("COUNT(*)").
+		From(string(TableNameDomain)).
+		Where(filters).
+		ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+	var count int
+	err = r.DB.Connection().QueryRow(ctx, stmt, args...).Scan(&count)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return domains, nil
+	return domains, count, nil
 }
 
 func (r *domainRepository) FindById(ctx context.Context, id uid.UID) (*Domain, error) {
-	var domain Domain
-	stmt, args, err := r.DB.Builder().Select("*").From(string(TableNameDomain)).Where("id = ?", id).ToSql()
+	stmt, args, err := r.selectDomain().Where("id = ?", id).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.scanDomain(r.DB.Connection().QueryRow(ctx, stmt, args...))
+}
+
+// FindByIdForUpdate locks the row of the domain until the transaction ends
+func (r *domainRepository) FindByIdForUpdate(ctx context.Context, id uid.UID) (*Domain, error) {
+	stmt, args, err := r.selectDomain().Where("id = ?", id).Suffix("FOR UPDATE").ToSql()
 	if err != nil {
 		return nil, err
 	}
-	err = r.DB.Connection().QueryRow(ctx, stmt, args...).Scan(
-		&domain.Id,
-		&domain.UpdatedAt,
-		&domain.Name,
-		&domain.Region,
-		&domain.Status,
-		&domain.DKIMRecords,
-		&domain.SPFRecords,
-		&domain.DMARCRecords,
-		&domain.PrivateKey,
-		&domain.OrganizationId,
-		&domain.WorkspaceId,
-	)
 
-	return &domain, err
+	return r.scanDomain(r.DB.Connection().QueryRow(ctx, stmt, args...))
 }
 
 func (r *domainRepository) FindByDomainName(
@@ -155,8 +224,7 @@ func (r *domainRepository) FindByDomainName(
 	organizationId uid.UID,
 	domainName string,
 ) (*Domain, error) {
-	var domain Domain
-	stmt, args, err := r.DB.Builder().Select("*").From(string(TableNameDomain)).
+	stmt, args, err := r.selectDomain().
 		Where("name = ?", domainName).
 		Where("workspace_id = ?", workspaceId).
 		Where("organization_id = ?", organizationId).
@@ -164,9 +232,214 @@ func (r *domainRepository) FindByDomainName(
 	if err != nil {
 		return nil, err
 	}
-	err = r.DB.Connection().QueryRow(ctx, stmt, args...).Scan(
+
+	return r.scanDomain(r.DB.Connection().QueryRow(ctx, stmt, args...))
+}
+
+func (r *domainRepository) Delete(ctx context.Context, id uid.UID) error {
+	stmt, args, err := r.DB.Builder().Delete(string(TableNameDomain)).Where("id = ?", id).ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+	return err
+}
+
+// FindDueForVerification returns the domains which were not checked since the
+// time, the domains checked the longest time ago first
+func (r *domainRepository) FindDueForVerification(
+	ctx context.Context,
+	checkedBefore time.Time,
+	limit int,
+) ([]*Domain, error) {
+	stmt, args, err := r.selectDomain().
+		Where("checked_at IS NULL OR checked_at < ?", checkedBefore).
+		OrderBy("checked_at ASC NULLS FIRST").
+		Limit(uint64(limit)).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	domains := make([]*Domain, 0)
+	for rows.Next() {
+		domain, err := r.scanDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+	}
+
+	return domains, rows.Err()
+}
+
+// UpdateVerification saves the status and the records of the domain when its
+// status is still the previous status, it returns false otherwise. The DKIM
+// records are overwritten, they must be read with FindByIdForUpdate in the
+// same transaction
+func (r *domainRepository) UpdateVerification(
+	ctx context.Context,
+	domain *Domain,
+	previousStatus constant.DomainStatus,
+) (bool, error) {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameDomain)).
+		Set("status", domain.Status).
+		Set("dkim_records", domain.DKIMRecords).
+		Set("spf_records", domain.SPFRecords).
+		Set("dmarc_records", domain.DMARCRecords).
+		Set("mail_from_domain", domain.MailFromDomain).
+		Set("mail_from_status", domain.MailFromStatus).
+		Set("checked_at", domain.CheckedAt).
+		Where("id = ?", domain.Id).
+		Where("status = ?", previousStatus).
+		ToSql()
+	if err != nil {
+		return false, err
+	}
+	result, err := r.DB.Connection().Exec(ctx, stmt, args...)
+	if err != nil {
+		return false, err
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// UpdateIPPools flags the domain whose IP pools failed to apply and keeps the
+// configuration sets of the marketing pools which are applied
+func (r *domainRepository) UpdateIPPools(ctx context.Context, domain *Domain) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameDomain)).
+		Set("ip_pools_pending", domain.IPPoolsPending).
+		Set("marketing_config_set_name", domain.MarketingConfigSetName).
+		Set("failover_marketing_config_set_name", domain.FailoverMarketingConfigSetName).
+		Where("id = ?", domain.Id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *domainRepository) UpdateDNSProvider(ctx context.Context, id uid.UID, dnsProviderId *uid.UID) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameDomain)).
+		Set("dns_provider_id", dnsProviderId).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+// UpdateDKIM saves the signing key, the selector and the DKIM records of the
+// domain
+func (r *domainRepository) UpdateDKIM(ctx context.Context, domain *Domain) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameDomain)).
+		Set("private_key", domain.PrivateKey).
+		Set("dkim_selector", domain.DKIMSelector).
+		Set("dkim_records", domain.DKIMRecords).
+		Where("id = ?", domain.Id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *domainRepository) UpdateMailFrom(ctx context.Context, domain *Domain) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameDomain)).
+		Set("mail_from_domain", domain.MailFromDomain).
+		Set("mail_from_status", domain.MailFromStatus).
+		Set("mail_from_behavior_on_mx_failure", domain.MailFromBehaviorOnMXFailure).
+		Where("id = ?", domain.Id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *domainRepository) UpdateFailover(ctx context.Context, domain *Domain) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameDomain)).
+		Set("failover_region", domain.FailoverRegion).
+		Set("failover_policy", domain.FailoverPolicy).
+		Where("id = ?", domain.Id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+// Records returns the DKIM, SPF and DMARC records of the domain
+func (d *Domain) Records() constant.JSONDomainRecords {
+	records := make(constant.JSONDomainRecords, 0, len(d.DKIMRecords)+len(d.SPFRecords)+len(d.DMARCRecords))
+	records = append(records, d.DKIMRecords...)
+	records = append(records, d.SPFRecords...)
+	records = append(records, d.DMARCRecords...)
+
+	return records
+}
+
+// RecordName returns the fully qualified name of the record, record names are
+// relative to the registered domain
+func (d *Domain) RecordName(record constant.DomainRecord) string {
+	baseDomain, err := publicsuffix.EffectiveTLDPlusOne(d.Name)
+	if err != nil {
+		baseDomain = d.Name
+	}
+	if record.Name == "" {
+		return baseDomain
+	}
+
+	return record.Name + "." + baseDomain
+}
+
+func (r *domainRepository) selectDomain() squirrel.SelectBuilder {
+	return r.DB.Builder().Select(
+		"id",
+		"name",
+		"region",
+		"status",
+		"dkim_records",
+		"spf_records",
+		"dmarc_records",
+		"private_key",
+		"dkim_selector",
+		"mail_from_domain",
+		"mail_from_status",
+		"mail_from_behavior_on_mx_failure",
+		"send_rate",
+		"checked_at",
+		"dns_provider_id",
+		"failover_region",
+		"failover_policy",
+		"ip_pools_pending",
+		"marketing_config_set_name",
+		"failover_marketing_config_set_name",
+		"organization_id",
+		"workspace_id",
+	).From(string(TableNameDomain))
+}
+
+func (r *domainRepository) scanDomain(row pgx.Row) (*Domain, error) {
+	var domain Domain
+	err := row.Scan(
 		&domain.Id,
-		&domain.UpdatedAt,
 		&domain.Name,
 		&domain.Region,
 		&domain.Status,
@@ -174,19 +447,27 @@ func (r *domainRepository) FindByDomainName(
 		&domain.SPFRecords,
 		&domain.DMARCRecords,
 		&domain.PrivateKey,
+		&domain.DKIMSelector,
+		&domain.MailFromDomain,
+		&domain.MailFromStatus,
+		&domain.MailFromBehaviorOnMXFailure,
+		&domain.SendRate,
+		&domain.CheckedAt,
+		&domain.DNSProviderId,
+		&domain.FailoverRegion,
+		&domain.FailoverPolicy,
+		&domain.IPPoolsPending,
+		&domain.MarketingConfigSetName,
+		&domain.FailoverMarketingConfigSetName,
 		&domain.OrganizationId,
 		&domain.WorkspaceId,
 	)
-
-	return &domain, err
-}
-
-func (r *domainRepository) Delete(ctx context.Context, id uid.UID) error {
-	stmt, args, err := r.DB.Builder().Delete(string(TableNameDomain)).Where("id = ?", id).ToSql()
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
-	return err
+	return &domain, nil
 }
@@ -7,6 +7,8 @@ import (
 	"encoding/json"
 	"errors"
 
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
 	"github.com/usesend0/send0/internal/uid"
 )
 
@@ -20,6 +22,10 @@ const (
 	EmailStatusRejected  EmailStatus = "REJECTED"
 )
 
+// ErrEmailExists is returned when the broadcast already has an email for the
+// contact
+var ErrEmailExists = errors.New("email already exists")
+
 var _ sql.Scanner = (*Recipient)(nil)
 var _ driver.Valuer = (*Recipient)(nil)
 
@@ -30,6 +36,9 @@ type EmailRepository interface {
 	Save(ctx context.Context, email *Email) error
 	FindById(ctx context.Context, id uid.UID) (*Email, error)
 	FindByMessageId(ctx context.Context, messageId string) (*Email, error)
+	FindByRequestIdAndContactIds(ctx context.Context, requestId string, contactIds []string) ([]*Email, error)
+	UpdateSent(ctx context.Context, id uid.UID, messageId string, sentAt string) error
+	UpdateStatus(ctx context.Context, id uid.UID, status EmailStatus) error
 }
 
 type EmailStatus string
@@ -69,6 +78,9 @@ type Email struct {
 	WorkspaceId    uid.UID      `json:"workspaceId" db:"workspace_id" gorm:"not null"`
 	EmailContent   EmailContent `json:"emailContent" db:"-" gorm:"-:all"`
 	MetaData       JSONBMap     `json:"metaData" db:"meta_data" gorm:"type:jsonb;not null;default '{}'"`
+	// A broadcast has one email per contact, nil for the other emails
+	BroadcastId *uid.UID `json:"-" db:"broadcast_id" gorm:"uniqueIndex:idx_emails_broadcast_contact,priority:1"`
+	ContactId   *uid.UID `json:"-" db:"contact_id" gorm:"uniqueIndex:idx_emails_broadcast_contact,priority:2"`
 }
 
 type EmailContent struct {
@@ -93,6 +105,8 @@ func NewEmailRepository(baseRepository *baseRepository) EmailRepository {
 	}
 }
 
+// Save saves the email with its content, a second email of a broadcast to the
+// same contact returns ErrEmailExists
 func (r *emailRepository) Save(ctx context.Context, email *Email) error {
 	stmt, args, err := r.DB.Builder().Insert(string(TableNameEmail)).Columns(
 		"id",
@@ -105,8 +119,12 @@ func (r *emailRepository) Save(ctx context.Context, email *Email) error {
 		"delay",
 		"delay_time_zone",
 		"sent_at",
+		"request_id",
+		"meta_data",
 		"organization_id",
 		"workspace_id",
+		"broadcast_id",
+		"contact_id",
 	).Values(
 		email.Id, // Always expect the id to be set
 		email.MessageId,
@@ -117,18 +135,25 @@ func (r *emailRepository) Save(ctx context.Context, email *Email) error {
 		email.Status,
 		email.Delay,
 		email.DelayTimeZone,
-		email.SentAt,
+		nullString(email.SentAt),
+		email.RequestId,
+		email.MetaData,
 		email.OrganizationId,
 		email.WorkspaceId,
-	).ToSql()
+		email.BroadcastId,
+		email.ContactId,
+	).Suffix("ON CONFLICT (broadcast_id, contact_id) DO NOTHING").ToSql()
 	if err != nil {
 		return err
 	}
-	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+	tag, err := r.DB.Connection().Exec(ctx, stmt, args...)
 	if err != nil {
 		r.Logger.Error().Err(err).Msg("failed to save email")
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return ErrEmailExists
+	}
 	stmt, args, err = r.DB.Builder().Insert(string(TableNameEmailContent)).Columns(
 		"id",
 		"subject",
@@ -161,31 +186,26 @@ func (r *emailRepository) Save(ctx context.Context, email *Email) error {
 }
 
 func (r *emailRepository) FindById(ctx context.Context, id uid.UID) (*Email, error) {
-	var email Email
 	var emailContent EmailContent
-	stmt, args, err := r.DB.Builder().Select().From(string(TableNameEmail)).Where("id = ?", id).ToSql()
+	stmt, args, err := r.selectEmail().Where("id = ?", id).ToSql()
 	if err != nil {
 		return nil, err
 	}
-	err = r.DB.Connection().QueryRow(ctx, stmt, args...).Scan(
-		&email.Id,
-		&email.MessageId,
-		&email.From,
-		&email.Recipients,
-		&email.CCRecipients,
-		&email.BCCRecipients,
-		&email.Status,
-		&email.Delay,
-		&email.DelayTimeZone,
-		&email.SentAt,
-		&email.OrganizationId,
-		&email.WorkspaceId,
-	)
-	if err != nil {
+	email, err := r.scanEmail(r.DB.Connection().QueryRow(ctx, stmt, args...))
+	if err != nil || email == nil {
 		return nil, err
 	}
 	// TODO: Use a join query to fetch email content
-	stmt, args, err = r.DB.Builder().Select().From(string(TableNameEmailContent)).Where("email_id = ?", email.Id).ToSql()
+	stmt, args, err = r.DB.Builder().Select(
+		"id",
+		"subject",
+		"html",
+		"text",
+		"attachments",
+		"email_id",
+		"organization_id",
+		"workspace_id",
+	).From(string(TableNameEmailContent)).Where("email_id = ?", email.Id).ToSql()
 	if err != nil {
 		return nil, err
 	}
@@ -204,16 +224,97 @@ func (r *emailRepository) FindById(ctx context.Context, id uid.UID) (*Email, err
 	}
 	email.EmailContent = emailContent
 
-	return &email, err
+	return email, err
 }
 
 func (r *emailRepository) FindByMessageId(ctx context.Context, messageId string) (*Email, error) {
-	var email Email
-	stmt, args, err := r.DB.Builder().Select().From(string(TableNameEmail)).Where("message_id = ?", messageId).ToSql()
+	stmt, args, err := r.selectEmail().Where("message_id = ?", messageId).ToSql()
 	if err != nil {
 		return nil, err
 	}
-	err = r.DB.Connection().QueryRow(ctx, stmt, args...).Scan(
+
+	return r.scanEmail(r.DB.Connection().QueryRow(ctx, stmt, args...))
+}
+
+// FindByRequestIdAndContactIds returns the emails of the request to the
+// contacts, without their content
+func (r *emailRepository) FindByRequestIdAndContactIds(
+	ctx context.Context,
+	requestId string,
+	contactIds []string,
+) ([]*Email, error) {
+	stmt, args, err := r.selectEmail().
+		Where("request_id = ?", requestId).
+		Where("meta_data->>'contactId' = ANY(?)", contactIds).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	emails := make([]*Email, 0)
+	for rows.Next() {
+		email, err := r.scanEmail(rows)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+
+	return emails, rows.Err()
+}
+
+func (r *emailRepository) UpdateSent(ctx context.Context, id uid.UID, messageId string, sentAt string) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameEmail)).
+		Set("message_id", messageId).
+		Set("sent_at", sentAt).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *emailRepository) UpdateStatus(ctx context.Context, id uid.UID, status EmailStatus) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameEmail)).
+		Set("status", status).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *emailRepository) selectEmail() squirrel.SelectBuilder {
+	return r.DB.Builder().Select(
+		"id",
+		"message_id",
+		"from_address",
+		"recipients",
+		"cc_recipients",
+		"bcc_recipients",
+		"status",
+		"delay",
+		"delay_time_zone",
+		"request_id",
+		"meta_data",
+		"organization_id",
+		"workspace_id",
+	).From(string(TableNameEmail))
+}
+
+func (r *emailRepository) scanEmail(row pgx.Row) (*Email, error) {
+	var email Email
+	err := row.Scan(
 		&email.Id,
 		&email.MessageId,
 		&email.From,
@@ -223,12 +324,19 @@ func (r *emailRepository) FindByMessageId(ctx context.Context, messageId string)
 		&email.Status,
 		&email.Delay,
 		&email.DelayTimeZone,
-		&email.SentAt,
+		&email.RequestId,
+		&email.MetaData,
 		&email.OrganizationId,
 		&email.WorkspaceId,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	return &email, err
+	return &email, nil
 }
 
 func (a *Recipient) Scan(src interface{}) error {
@@ -265,6 +373,14 @@ func (a Attachment) Value() (driver.Value, error) {
 	return json.Marshal(a)
 }
 
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
+
 func (a *Recipients) Addresses() []string {
 	var addresses []string
 	for _, recipient := range *a {
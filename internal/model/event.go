@@ -7,22 +7,45 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"time"
 
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
 	"github.com/usesend0/send0/internal/constant"
 	"github.com/usesend0/send0/internal/uid"
 )
 
+// ErrEventExists is returned when an event with the same source id was
+// already saved
+var ErrEventExists = errors.New("event already exists")
+
+// Meta data keys of the SES events the reputation is grouped by
+const (
+	EventMetaDataFromDomain       = "fromDomain"
+	EventMetaDataConfigurationSet = "configurationSet"
+)
+
 var EventTypeCreateQuery = fmt.Sprintf(
-	`CREATE TYPE %s AS ENUM ('%s','%s','%s','%s','%s','%s','%s','%s');`,
+	`CREATE TYPE %s AS ENUM ('%s','%s','%s','%s','%s','%s','%s','%s','%s','%s','%s','%s','%s','%s','%s','%s','%s');`,
 	DBTypeEventType,
 	constant.EventTypeEmailSend,
+	constant.EventTypeEmailSendFailed,
 	constant.EventTypeEmailDelivered,
+	constant.EventTypeEmailDeliveryDelayed,
 	constant.EventTypeEmailOpened,
 	constant.EventTypeEmailClicked,
 	constant.EventTypeEmailBounced,
 	constant.EventTypeEmailUnsubsribed,
 	constant.EventTypeEmailReported,
 	constant.EventTypeEmailRejected,
+	constant.EventTypeLinkClicked,
+	constant.EventTypeOptIn,
+	constant.EventTypeWebhookFailed,
+	constant.EventTypeDomainVerified,
+	constant.EventTypeDomainFailed,
+	constant.EventTypeBounceRateHigh,
+	constant.EventTypeComplaintRateHigh,
 )
 
 var _ sql.Scanner = (*EventMetaData)(nil)
@@ -30,6 +53,9 @@ var _ driver.Valuer = (*EventMetaData)(nil)
 
 type EventRepository interface {
 	Save(ctx context.Context, event *Event) error
+	FindById(ctx context.Context, id uid.UID) (*Event, error)
+	FindAll(ctx context.Context, options EventFindOptions) ([]*Event, error)
+	FindSendingStats(ctx context.Context, options EventStatsOptions) ([]*EventSendingStat, error)
 }
 
 type EventMetaData map[string]interface{}
@@ -42,6 +68,41 @@ type Event struct {
 	MetaData       EventMetaData      `json:"metaData" gorm:"type:jsonb;not null;default '{}'"`
 	OrganizationId uid.UID            `json:"organizationId" db:"organization_id" gorm:"not null"`
 	WorkspaceId    uid.UID            `json:"workspaceId" db:"workspace_id" gorm:"not null"`
+	SourceId       *string            `json:"-" db:"source_id" gorm:"uniqueIndex"` // Id of the notification the event was created from
+}
+
+// EventFindOptions filters the events of a workspace, the events are ordered
+// by id and the page starts after the cursor
+type EventFindOptions struct {
+	WorkspaceId uid.UID
+	EventTypes  []constant.EventType
+	EmailId     string
+	Recipient   string
+	BroadcastId string
+	MetaData    map[string]string // Empty values only require the key
+	From        *time.Time
+	To          *time.Time
+	Cursor      uid.UID
+	Ascending   bool
+	Limit       int
+}
+
+// EventStatsOptions groups the email events of a workspace since From by the
+// value of a meta data key
+type EventStatsOptions struct {
+	WorkspaceId uid.UID
+	GroupBy     string // EventMetaDataFromDomain or EventMetaDataConfigurationSet
+	Value       string // Only the events of this value when set
+	From        time.Time
+}
+
+// EventSendingStat counts the sent, bounced and complained emails of a meta
+// data value
+type EventSendingStat struct {
+	Value      string `json:"value"`
+	Sent       int    `json:"sent"`
+	Bounced    int    `json:"bounced"`
+	Complained int    `json:"complained"`
 }
 
 type eventRepository struct {
@@ -59,23 +120,227 @@ func (r *eventRepository) Save(ctx context.Context, event *Event) error {
 		"id",
 		"event_type",
 		"receipients",
+		"cc_recipients",
+		"bcc_recipients",
 		"meta_data",
 		"organization_id",
 		"workspace_id",
+		"source_id",
 	).Values(
 		r.UID(event.Id),
 		event.EventType,
 		event.Receipients,
+		event.CCRecipients,
+		event.BCCRecipients,
 		event.MetaData,
 		event.OrganizationId,
 		event.WorkspaceId,
-	).ToSql()
+		event.SourceId,
+	).Suffix("ON CONFLICT (source_id) DO NOTHING").ToSql()
 	if err != nil {
 		return err
 	}
-	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+	result, err := r.DB.Connection().Exec(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrEventExists
+	}
+
+	return nil
+}
+
+func (r *eventRepository) FindById(ctx context.Context, id uid.UID) (*Event, error) {
+	stmt, args, err := r.selectEvent().
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	event, err := r.scanEvent(r.DB.Connection().QueryRow(ctx, stmt, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+
+	return event, err
+}
+
+func (r *eventRepository) FindAll(ctx context.Context, options EventFindOptions) ([]*Event, error) {
+	builder := r.selectEvent().
+		Where("workspace_id = ?", options.WorkspaceId).
+		Limit(uint64(options.Limit))
+	if len(options.EventTypes) > 0 {
+		builder = builder.Where(squirrel.Eq{"event_type": options.EventTypes})
+	}
+	if options.EmailId != "" {
+		builder = builder.Where("meta_data->>'emailId' = ?", options.EmailId)
+	}
+	if options.BroadcastId != "" {
+		builder = builder.Where("meta_data->>'broadcastId' = ?", options.BroadcastId)
+	}
+	if options.Recipient != "" {
+		builder = builder.Where("receipients @> ?::jsonb", JSONBArray{options.Recipient})
+	}
+	for key, value := range options.MetaData {
+		if value == "" {
+			builder = builder.Where("meta_data->>? IS NOT NULL", key)
+			continue
+		}
+		builder = builder.Where("meta_data->>? = ?", key, value)
+	}
+	if options.From != nil {
+		builder = builder.Where("id >= ?", uid.FirstUIDAt(*options.From))
+	}
+	if options.To != nil {
+		builder = builder.Where("id < ?", uid.FirstUIDAt(*options.To))
+	}
+	zero := uid.UID{}
+	if options.Ascending {
+		builder = builder.OrderBy("id ASC")
+		if options.Cursor != zero {
+			builder = builder.Where("id > ?", options.Cursor)
+		}
+	} else {
+		builder = builder.OrderBy("id DESC")
+		if options.Cursor != zero {
+			builder = builder.Where("id < ?", options.Cursor)
+		}
+	}
+	stmt, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := make([]*Event, 0)
+	for rows.Next() {
+		event, err := r.scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// FindSendingStats counts the sent, bounced and complained emails by the value
+// of the meta data key, the values with the most sent emails first
+func (r *eventRepository) FindSendingStats(ctx context.Context, options EventStatsOptions) ([]*EventSendingStat, error) {
+	if options.GroupBy != EventMetaDataFromDomain && options.GroupBy != EventMetaDataConfigurationSet {
+		return nil, fmt.Errorf("events can not be grouped by %s", options.GroupBy)
+	}
+	value := fmt.Sprintf("meta_data->>'%s'", options.GroupBy)
+	builder := r.DB.Builder().Select(
+		value,
+		fmt.Sprintf("COUNT(*) FILTER (WHERE event_type = '%s')", constant.EventTypeEmailSend),
+		fmt.Sprintf("COUNT(*) FILTER (WHERE event_type = '%s')", constant.EventTypeEmailBounced),
+		fmt.Sprintf("COUNT(*) FILTER (WHERE event_type = '%s')", constant.EventTypeEmailReported),
+	).
+		From(string(TableNameEvent)).
+		Where("workspace_id = ?", options.WorkspaceId).
+		Where(squirrel.Eq{"event_type": []constant.EventType{
+			constant.EventTypeEmailSend,
+			constant.EventTypeEmailBounced,
+			constant.EventTypeEmailReported,
+		}}).
+		Where("id >= ?", uid.FirstUIDAt(options.From)).
+		Where(value + " IS NOT NULL").
+		GroupBy(value).
+		OrderBy("2 DESC")
+	if options.Value != "" {
+		builder = builder.Where(value+" = ?", options.Value)
+	}
+	stmt, args, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := make([]*EventSendingStat, 0)
+	for rows.Next() {
+		var stat EventSendingStat
+		err = rows.Scan(&stat.Value, &stat.Sent, &stat.Bounced, &stat.Complained)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, &stat)
+	}
+
+	return stats, rows.Err()
+}
+
+// Match tells if the event matches the filters of the options, the cursor and
+// the limit are ignored
+func (o *EventFindOptions) Match(event *Event) bool {
+	if event.WorkspaceId != o.WorkspaceId {
+		return false
+	}
+	if len(o.EventTypes) > 0 && !slices.Contains(o.EventTypes, event.EventType) {
+		return false
+	}
+	if o.EmailId != "" && fmt.Sprint(event.MetaData["emailId"]) != o.EmailId {
+		return false
+	}
+	if o.BroadcastId != "" && fmt.Sprint(event.MetaData["broadcastId"]) != o.BroadcastId {
+		return false
+	}
+	if o.Recipient != "" && !slices.Contains(event.Receipients, o.Recipient) {
+		return false
+	}
+	for key, value := range o.MetaData {
+		metaValue, ok := event.MetaData[key]
+		if !ok || (value != "" && fmt.Sprint(metaValue) != value) {
+			return false
+		}
+	}
+	if o.From != nil && event.Id.ID() < uid.FirstUIDAt(*o.From).ID() {
+		return false
+	}
+	if o.To != nil && event.Id.ID() >= uid.FirstUIDAt(*o.To).ID() {
+		return false
+	}
+
+	return true
+}
+
+func (r *eventRepository) selectEvent() squirrel.SelectBuilder {
+	return r.DB.Builder().Select(
+		"id",
+		"event_type",
+		"receipients",
+		"cc_recipients",
+		"bcc_recipients",
+		"meta_data",
+		"organization_id",
+		"workspace_id",
+	).From(string(TableNameEvent))
+}
+
+func (r *eventRepository) scanEvent(row pgx.Row) (*Event, error) {
+	var event Event
+	err := row.Scan(
+		&event.Id,
+		&event.EventType,
+		&event.Receipients,
+		&event.CCRecipients,
+		&event.BCCRecipients,
+		&event.MetaData,
+		&event.OrganizationId,
+		&event.WorkspaceId,
+	)
+	if err != nil {
+		return nil, err
+	}
 
-	return err
+	return &event, nil
 }
 
 func (a *EventMetaData) Scan(src interface{}) error {
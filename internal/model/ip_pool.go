@@ -0,0 +1,290 @@
+package model
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type IPPoolRepository interface {
+	Save(ctx context.Context, pool *IPPool) error
+	FindById(ctx context.Context, id uid.UID) (*IPPool, error)
+	FindByName(ctx context.Context, workspaceId uid.UID, name string) (*IPPool, error)
+	FindByWorkspaceId(ctx context.Context, workspaceId uid.UID) ([]*IPPool, error)
+	Delete(ctx context.Context, id uid.UID) error
+	SaveAssignment(ctx context.Context, assignment *IPPoolAssignment) error
+	UpdateAssignment(ctx context.Context, assignment *IPPoolAssignment) error
+	FindAssignmentById(ctx context.Context, id uid.UID) (*IPPoolAssignment, error)
+	FindAssignments(ctx context.Context, workspaceId uid.UID) ([]*IPPoolAssignment, error)
+	DeleteAssignment(ctx context.Context, id uid.UID) error
+	DeleteAssignmentsByDomainId(ctx context.Context, domainId uid.UID) error
+}
+
+// IPPool is a dedicated IP pool of SES, the pool is named after its id in the
+// SES account of the workspace
+type IPPool struct {
+	Base
+	Name        string                     `json:"name" db:"name" gorm:"not null;uniqueIndex:idx_ip_pools_workspace_name"`
+	Region      constant.AwsRegion         `json:"region" db:"region" gorm:"not null"`
+	ScalingMode constant.IPPoolScalingMode `json:"scalingMode" db:"scaling_mode" gorm:"not null;default:'STANDARD'"`
+	WorkspaceId uid.UID                    `json:"workspaceId" db:"workspace_id" gorm:"not null;uniqueIndex:idx_ip_pools_workspace_name"`
+}
+
+// IPPoolAssignment picks the pool the emails of a stream are sent from, an
+// assignment of a domain overrides the one of the workspace
+type IPPoolAssignment struct {
+	Base
+	Stream      constant.MessageStream `json:"stream" db:"stream" gorm:"not null"`
+	IPPoolId    uid.UID                `json:"ipPoolId" db:"ip_pool_id" gorm:"not null"`
+	DomainId    *uid.UID               `json:"domainId" db:"domain_id"` // Nil for every domain of the workspace in the region of the pool
+	WorkspaceId uid.UID                `json:"workspaceId" db:"workspace_id" gorm:"not null"`
+}
+
+type ipPoolRepository struct {
+	*baseRepository
+}
+
+func NewIPPoolRepository(baseRepository *baseRepository) IPPoolRepository {
+	return &ipPoolRepository{
+		baseRepository,
+	}
+}
+
+func (r *ipPoolRepository) Save(ctx context.Context, pool *IPPool) error {
+	stmt, args, err := r.DB.Builder().Insert(string(TableNameIPPool)).Columns(
+		"id",
+		"name",
+		"region",
+		"scaling_mode",
+		"workspace_id",
+	).Values(
+		r.UID(pool.Id),
+		pool.Name,
+		pool.Region,
+		pool.ScalingMode,
+		pool.WorkspaceId,
+	).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *ipPoolRepository) FindById(ctx context.Context, id uid.UID) (*IPPool, error) {
+	stmt, args, err := r.selectIPPool().
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.scanIPPool(r.DB.Connection().QueryRow(ctx, stmt, args...))
+}
+
+func (r *ipPoolRepository) FindByName(ctx context.Context, workspaceId uid.UID, name string) (*IPPool, error) {
+	stmt, args, err := r.selectIPPool().
+		Where("workspace_id = ?", workspaceId).
+		Where("name = ?", name).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.scanIPPool(r.DB.Connection().QueryRow(ctx, stmt, args...))
+}
+
+func (r *ipPoolRepository) FindByWorkspaceId(ctx context.Context, workspaceId uid.UID) ([]*IPPool, error) {
+	stmt, args, err := r.selectIPPool().
+		Where("workspace_id = ?", workspaceId).
+		OrderBy("id DESC").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pools := make([]*IPPool, 0)
+	for rows.Next() {
+		pool, err := r.scanIPPool(rows)
+		if err != nil {
+			return nil, err
+		}
+		pools = append(pools, pool)
+	}
+
+	return pools, rows.Err()
+}
+
+func (r *ipPoolRepository) Delete(ctx context.Context, id uid.UID) error {
+	stmt, args, err := r.DB.Builder().Delete(string(TableNameIPPool)).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *ipPoolRepository) SaveAssignment(ctx context.Context, assignment *IPPoolAssignment) error {
+	stmt, args, err := r.DB.Builder().Insert(string(TableNameIPPoolAssignment)).Columns(
+		"id",
+		"stream",
+		"ip_pool_id",
+		"domain_id",
+		"workspace_id",
+	).Values(
+		r.UID(assignment.Id),
+		assignment.Stream,
+		assignment.IPPoolId,
+		assignment.DomainId,
+		assignment.WorkspaceId,
+	).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *ipPoolRepository) UpdateAssignment(ctx context.Context, assignment *IPPoolAssignment) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameIPPoolAssignment)).
+		Set("ip_pool_id", assignment.IPPoolId).
+		Where("id = ?", assignment.Id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *ipPoolRepository) FindAssignmentById(ctx context.Context, id uid.UID) (*IPPoolAssignment, error) {
+	stmt, args, err := r.selectAssignment().
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.scanAssignment(r.DB.Connection().QueryRow(ctx, stmt, args...))
+}
+
+func (r *ipPoolRepository) FindAssignments(ctx context.Context, workspaceId uid.UID) ([]*IPPoolAssignment, error) {
+	stmt, args, err := r.selectAssignment().
+		Where("workspace_id = ?", workspaceId).
+		OrderBy("id DESC").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	assignments := make([]*IPPoolAssignment, 0)
+	for rows.Next() {
+		assignment, err := r.scanAssignment(rows)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, assignment)
+	}
+
+	return assignments, rows.Err()
+}
+
+func (r *ipPoolRepository) DeleteAssignment(ctx context.Context, id uid.UID) error {
+	stmt, args, err := r.DB.Builder().Delete(string(TableNameIPPoolAssignment)).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *ipPoolRepository) DeleteAssignmentsByDomainId(ctx context.Context, domainId uid.UID) error {
+	stmt, args, err := r.DB.Builder().Delete(string(TableNameIPPoolAssignment)).
+		Where("domain_id = ?", domainId).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *ipPoolRepository) selectIPPool() squirrel.SelectBuilder {
+	return r.DB.Builder().Select(
+		"id",
+		"name",
+		"region",
+		"scaling_mode",
+		"workspace_id",
+	).From(string(TableNameIPPool))
+}
+
+func (r *ipPoolRepository) scanIPPool(row pgx.Row) (*IPPool, error) {
+	var pool IPPool
+	err := row.Scan(
+		&pool.Id,
+		&pool.Name,
+		&pool.Region,
+		&pool.ScalingMode,
+		&pool.WorkspaceId,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &pool, nil
+}
+
+func (r *ipPoolRepository) selectAssignment() squirrel.SelectBuilder {
+	return r.DB.Builder().Select(
+		"id",
+		"stream",
+		"ip_pool_id",
+		"domain_id",
+		"workspace_id",
+	).From(string(TableNameIPPoolAssignment))
+}
+
+func (r *ipPoolRepository) scanAssignment(row pgx.Row) (*IPPoolAssignment, error) {
+	var assignment IPPoolAssignment
+	err := row.Scan(
+		&assignment.Id,
+		&assignment.Stream,
+		&assignment.IPPoolId,
+		&assignment.DomainId,
+		&assignment.WorkspaceId,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &assignment, nil
+}
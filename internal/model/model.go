@@ -17,19 +17,37 @@ import (
 )
 
 const (
-	TableNameAuthn        TableName = "authn"
-	TableNameClient       TableName = "clients"
-	TableNameDomain       TableName = "domains"
-	TableNameEmail        TableName = "emails"
-	TableNameEmailContent TableName = "email_contents"
-	TableNameEvent        TableName = "events"
-	TableNameOrganization TableName = "organizations"
-	TableNameSNSTopic     TableName = "sns_topics"
-	TableNameTag          TableName = "tags"
-	TableNameTeam         TableName = "teams"
-	TableNameTeamUser     TableName = "team_users"
-	TableNameUser         TableName = "users"
-	TableNameWorkspace    TableName = "workspaces"
+	TableNameAuthn            TableName = "authn"
+	TableNameAWSAccount       TableName = "aws_accounts"
+	TableNameBroadcast        TableName = "broadcasts"
+	TableNameBroadcastEvent   TableName = "broadcast_events"
+	TableNameBroadcastStat    TableName = "broadcast_stats"
+	TableNameBroadcastVariant TableName = "broadcast_variants"
+	TableNameClient           TableName = "clients"
+	TableNameContact          TableName = "contacts"
+	TableNameDKIMKey          TableName = "dkim_keys"
+	TableNameDMARCReport      TableName = "dmarc_reports"
+	TableNameDMARCRecord      TableName = "dmarc_report_records"
+	TableNameDNSProvider      TableName = "dns_providers"
+	TableNameDomain           TableName = "domains"
+	TableNameEmail            TableName = "emails"
+	TableNameEmailContent     TableName = "email_contents"
+	TableNameEvent            TableName = "events"
+	TableNameIPPool           TableName = "ip_pools"
+	TableNameIPPoolAssignment TableName = "ip_pool_assignments"
+	TableNameOrganization     TableName = "organizations"
+	TableNameSegment          TableName = "segments"
+	TableNameSegmentContact   TableName = "segment_contacts"
+	TableNameSender           TableName = "senders"
+	TableNameSNSTopic         TableName = "sns_topics"
+	TableNameTag              TableName = "tags"
+	TableNameTeam             TableName = "teams"
+	TableNameTeamUser         TableName = "team_users"
+	TableNameTemplate         TableName = "templates"
+	TableNameUser             TableName = "users"
+	TableNameWebhook          TableName = "webhooks"
+	TableNameWebhookEvent     TableName = "webhook_events"
+	TableNameWorkspace        TableName = "workspaces"
 )
 
 const (
@@ -57,11 +75,21 @@ type Transactioner[T interface{}] interface {
 type Repository struct {
 	*baseRepository
 	Authn        AuthnRepository
+	AWSAccount   AWSAccountRepository
+	Broadcast    BroadcastRepository
 	Client       ClientRepository
+	Contact      ContactRepository
+	DKIMKey      DKIMKeyRepository
+	DMARCReport  DMARCReportRepository
+	DNSProvider  DNSProviderRepository
 	Domain       DomainRepository
 	Email        EmailRepository
 	Event        EventRepository
+	IPPool       IPPoolRepository
 	Organization OrganizationRepository
+	RateLimit    RateLimitRepository
+	Segment      SegmentRepository
+	Sender       SenderRepository
 	SNSTopic     SNSTopicRepository
 	Team         TeamRepository
 	Template     TemplateRepository
@@ -90,11 +118,21 @@ func NewRepository(baseRepository *baseRepository) *Repository {
 	return &Repository{
 		baseRepository: baseRepository,
 		Authn:          NewAuthnRepository(baseRepository),
+		AWSAccount:     NewAWSAccountRepository(baseRepository),
+		Broadcast:      NewBroadcastRepository(baseRepository),
 		Client:         NewClientRepository(baseRepository),
+		Contact:        NewContactRepository(baseRepository),
+		DKIMKey:        NewDKIMKeyRepository(baseRepository),
+		DMARCReport:    NewDMARCReportRepository(baseRepository),
+		DNSProvider:    NewDNSProviderRepository(baseRepository),
 		Domain:         NewDomainRepository(baseRepository),
 		Email:          NewEmailRepository(baseRepository),
 		Event:          NewEventRepository(baseRepository),
+		IPPool:         NewIPPoolRepository(baseRepository),
 		Organization:   NewOrganizationRepository(baseRepository),
+		RateLimit:      NewRateLimitRepository(baseRepository),
+		Segment:        NewSegmentRepository(baseRepository),
+		Sender:         NewSenderRepository(baseRepository),
 		SNSTopic:       NewSNSTopicRepository(baseRepository),
 		Team:           NewTeamRepository(baseRepository),
 		Template:       NewTemplateRepository(baseRepository),
@@ -172,6 +210,8 @@ func (m JSONBMap) Value() (driver.Value, error) {
 
 func (p *JSONPrivateKey) Scan(src interface{}) error {
 	switch v := src.(type) {
+	case nil:
+		return nil
 	case []byte:
 		privateKey, err := crypto.BytesToPrivateKey(v)
 		if err != nil {
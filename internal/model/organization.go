@@ -2,13 +2,16 @@ package model
 
 import (
 	"context"
+	"errors"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/usesend0/send0/internal/uid"
 )
 
 type OrganizationRepository interface {
 	Create(ctx context.Context, organization *Organization) error
 	FindById(ctx context.Context, id uid.UID) (*Organization, error)
+	FindDefault(ctx context.Context, workspaceId uid.UID) (*Organization, error)
 	FindAll(ctx context.Context) ([]*Organization, int, error)
 }
 type Organization struct {
@@ -71,6 +74,33 @@ func (r *organizationRepository) FindById(ctx context.Context, id uid.UID) (*Org
 	return &organization, err
 }
 
+// FindDefault returns the default organization of the workspace
+func (r *organizationRepository) FindDefault(ctx context.Context, workspaceId uid.UID) (*Organization, error) {
+	stmt := `SELECT
+		id,
+		name,
+		is_default,
+		workspace_id
+	FROM organizations WHERE workspace_id = $1 AND is_default
+	ORDER BY id LIMIT 1`
+
+	var organization Organization
+	err := r.DB.Connection().QueryRow(ctx, stmt, workspaceId).Scan(
+		&organization.Id,
+		&organization.Name,
+		&organization.IsDefault,
+		&organization.WorkspaceId,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &organization, nil
+}
+
 func (r *organizationRepository) FindAll(ctx context.Context) ([]*Organization, int, error) {
 	var count int
 	err := r.DB.Connection().QueryRow(ctx, "SELECT COUNT(*) FROM organizations").Scan()
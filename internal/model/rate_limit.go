@@ -0,0 +1,65 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	RateLimitKeySESSend    RateLimitKey = "RATE_LIMIT_SES_SEND"
+	RateLimitKeyDomainSend RateLimitKey = "RATE_LIMIT_DOMAIN_SEND"
+)
+
+type RateLimitKey string
+
+type RateLimitRepository interface {
+	Reserve(ctx context.Context, key RateLimitKey, id string, limit float64, count int) (time.Duration, error)
+}
+
+type rateLimitRepository struct {
+	*baseRepository
+}
+
+func NewRateLimitRepository(baseRepository *baseRepository) RateLimitRepository {
+	return &rateLimitRepository{
+		baseRepository,
+	}
+}
+
+// reserveScript keeps the time the next event is allowed at in microseconds,
+// the events are spread evenly without a burst. It reserves the count events
+// and returns how long to wait for the last of them
+var reserveScript = redis.NewScript(`
+local now = redis.call('TIME')
+now = tonumber(now[1]) * 1000000 + tonumber(now[2])
+local at = tonumber(redis.call('GET', KEYS[1]) or now)
+if at < now then
+	at = now
+end
+local interval = tonumber(ARGV[1])
+local wait = at + interval * (tonumber(ARGV[2]) - 1) - now
+at = at + interval * tonumber(ARGV[2])
+redis.call('SET', KEYS[1], string.format('%d', at), 'PX', math.ceil((at - now) / 1000) + 1000)
+return wait
+`)
+
+// Reserve reserves count events of the id at the limit per second, shared by
+// every replica, and returns how long to wait before sending them
+func (r *rateLimitRepository) Reserve(ctx context.Context, key RateLimitKey, id string, limit float64, count int) (time.Duration, error) {
+	interval := int64(float64(time.Second/time.Microsecond) / limit)
+	wait, err := reserveScript.Run(
+		ctx,
+		r.Cache.Connection(),
+		[]string{fmt.Sprintf("%s:%s", key, id)},
+		interval,
+		count,
+	).Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(wait) * time.Microsecond, nil
+}
@@ -2,25 +2,35 @@ package model
 
 import (
 	"context"
+	"errors"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/usesend0/send0/internal/uid"
 )
 
 type SegmentRepository interface {
 	Create(ctx context.Context, segment *Segment) error
 	FindByID(ctx context.Context, id uid.UID) (*Segment, error)
+	SaveContact(ctx context.Context, segmentContact *SegmentContact) error
+	FindContactById(ctx context.Context, id uid.UID) (*SegmentContact, error)
+	FindContact(ctx context.Context, segmentId, contactId uid.UID) (*SegmentContact, error)
+	UpdateContactSubscribed(ctx context.Context, id uid.UID, subscribed bool) error
+	DeleteContact(ctx context.Context, id uid.UID) error
 }
 
 type Segment struct {
 	Base
-	Name           string     `json:"name"`
-	Description    *string    `json:"description omitempty" db:"description"`
-	IsDefault      bool       `json:"isDefault" db:"is_default" gorm:"not null;default:false"`
-	IsPrivate      bool       `json:"isPrivate" db:"is_private" gorm:"not null;default:false"`
-	TotalCount     int        `json:"totalCount" db:"total_count" gorm:"not null;default:0"`
-	Tags           JSONBArray `json:"tags" db:"tags" gorm:"type:jsonb;not null;default '[]'"`
-	OrganizationId uid.UID    `json:"organizationId" db:"organization_id" gorm:"not null"`
-	WorkspaceId    uid.UID    `json:"workspaceId" db:"workspace_id" gorm:"not null"`
+	Name             string     `json:"name"`
+	Description      *string    `json:"description omitempty" db:"description"`
+	IsDefault        bool       `json:"isDefault" db:"is_default" gorm:"not null;default:false"`
+	IsPrivate        bool       `json:"isPrivate" db:"is_private" gorm:"not null;default:false"`
+	IsOptIn          bool       `json:"isOptIn" db:"is_opt_in" gorm:"not null;default:false"`
+	OptInFrom        *string    `json:"optInFrom" db:"opt_in_from"`
+	OptInRedirectURL *string    `json:"optInRedirectUrl" db:"opt_in_redirect_url"`
+	TotalCount       int        `json:"totalCount" db:"total_count" gorm:"not null;default:0"`
+	Tags             JSONBArray `json:"tags" db:"tags" gorm:"type:jsonb;not null;default '[]'"`
+	OrganizationId   uid.UID    `json:"organizationId" db:"organization_id" gorm:"not null"`
+	WorkspaceId      uid.UID    `json:"workspaceId" db:"workspace_id" gorm:"not null"`
 }
 
 type SegmentContact struct {
@@ -48,20 +58,30 @@ func (r *segmentRepository) Create(ctx context.Context, segment *Segment) error
 		name,
 		description,
 		tags,
+		is_default,
 		is_private,
+		is_opt_in,
+		opt_in_from,
+		opt_in_redirect_url,
 		total_count,
+		organization_id,
 		workspace_id
-	) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
 
 	_, err := r.DB.Connection().Exec(
 		ctx,
 		stmt,
-		segment.Id,
+		r.UID(segment.Id),
 		segment.Name,
 		segment.Description,
 		segment.Tags,
+		segment.IsDefault,
 		segment.IsPrivate,
+		segment.IsOptIn,
+		segment.OptInFrom,
+		segment.OptInRedirectURL,
 		segment.TotalCount,
+		segment.OrganizationId,
 		segment.WorkspaceId,
 	)
 
@@ -70,11 +90,124 @@ func (r *segmentRepository) Create(ctx context.Context, segment *Segment) error
 
 func (r *segmentRepository) FindByID(ctx context.Context, id uid.UID) (*Segment, error) {
 	var segment Segment
-	stmt := `SELECT * FROM segments WHERE id = $1`
-	err := r.DB.Connection().QueryRow(ctx, stmt, id).Scan(&segment)
+	stmt := `SELECT
+		id,
+		name,
+		description,
+		tags,
+		is_default,
+		is_private,
+		is_opt_in,
+		opt_in_from,
+		opt_in_redirect_url,
+		total_count,
+		organization_id,
+		workspace_id
+	FROM segments WHERE id = $1`
+	err := r.DB.Connection().QueryRow(ctx, stmt, id).Scan(
+		&segment.Id,
+		&segment.Name,
+		&segment.Description,
+		&segment.Tags,
+		&segment.IsDefault,
+		&segment.IsPrivate,
+		&segment.IsOptIn,
+		&segment.OptInFrom,
+		&segment.OptInRedirectURL,
+		&segment.TotalCount,
+		&segment.OrganizationId,
+		&segment.WorkspaceId,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	return &segment, nil
 }
+
+func (r *segmentRepository) SaveContact(ctx context.Context, segmentContact *SegmentContact) error {
+	stmt, args, err := r.DB.Builder().Insert(string(TableNameSegmentContact)).Columns(
+		"id",
+		"segment_id",
+		"contact_id",
+		"subscribed",
+		"organization_id",
+		"workspace_id",
+	).Values(
+		r.UID(segmentContact.Id),
+		segmentContact.SegmentId,
+		segmentContact.ContactId,
+		segmentContact.Subscribed,
+		segmentContact.OrganizationId,
+		segmentContact.WorkspaceId,
+	).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *segmentRepository) FindContactById(ctx context.Context, id uid.UID) (*SegmentContact, error) {
+	stmt := `SELECT
+		id,
+		segment_id,
+		contact_id,
+		subscribed,
+		organization_id,
+		workspace_id
+	FROM segment_contacts WHERE id = $1`
+
+	return r.scanSegmentContact(r.DB.Connection().QueryRow(ctx, stmt, id))
+}
+
+func (r *segmentRepository) FindContact(ctx context.Context, segmentId, contactId uid.UID) (*SegmentContact, error) {
+	stmt := `SELECT
+		id,
+		segment_id,
+		contact_id,
+		subscribed,
+		organization_id,
+		workspace_id
+	FROM segment_contacts WHERE segment_id = $1 AND contact_id = $2`
+
+	return r.scanSegmentContact(r.DB.Connection().QueryRow(ctx, stmt, segmentId, contactId))
+}
+
+func (r *segmentRepository) UpdateContactSubscribed(ctx context.Context, id uid.UID, subscribed bool) error {
+	stmt := `UPDATE segment_contacts SET subscribed = $1 WHERE id = $2`
+	_, err := r.DB.Connection().Exec(ctx, stmt, subscribed, id)
+
+	return err
+}
+
+func (r *segmentRepository) DeleteContact(ctx context.Context, id uid.UID) error {
+	stmt := `DELETE FROM segment_contacts WHERE id = $1`
+	_, err := r.DB.Connection().Exec(ctx, stmt, id)
+
+	return err
+}
+
+func (r *segmentRepository) scanSegmentContact(row pgx.Row) (*SegmentContact, error) {
+	var segmentContact SegmentContact
+	err := row.Scan(
+		&segmentContact.Id,
+		&segmentContact.SegmentId,
+		&segmentContact.ContactId,
+		&segmentContact.Subscribed,
+		&segmentContact.OrganizationId,
+		&segmentContact.WorkspaceId,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &segmentContact, nil
+}
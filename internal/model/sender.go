@@ -1,11 +1,243 @@
 package model
 
-import "github.com/usesend0/send0/internal/uid"
+import (
+	"context"
+	"errors"
 
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+const (
+	SenderStatusPending SenderStatus = "PENDING" // Waiting for the domain or the mailbox to be verified
+	SenderStatusActive  SenderStatus = "ACTIVE"
+	SenderStatusFailed  SenderStatus = "FAILED"
+)
+
+type SenderRepository interface {
+	Save(ctx context.Context, sender *Sender) error
+	Update(ctx context.Context, sender *Sender) error
+	UpdateStatus(ctx context.Context, id uid.UID, status SenderStatus) error
+	SetDefault(ctx context.Context, sender *Sender) error
+	FindById(ctx context.Context, id uid.UID) (*Sender, error)
+	FindByWorkspaceId(ctx context.Context, workspaceId uid.UID) ([]*Sender, error)
+	FindByAddress(ctx context.Context, workspaceId uid.UID, address string) (*Sender, error)
+	FindDefault(ctx context.Context, workspaceId uid.UID) (*Sender, error)
+	Delete(ctx context.Context, id uid.UID) error
+}
+
+type SenderStatus string
+
+// Sender is an address emails are sent from, either under a domain of the
+// workspace or a single mailbox verified by SES
 type Sender struct {
 	Base
-	Address        string  `json:"address" db:"address" gorm:"not null"`
-	IsDefault      bool    `json:"isDefault" db:"is_default" gorm:"not null"`
-	OrganizationId uid.UID `json:"organizationId" db:"organization_id" gorm:"not null"`
-	WorkspaceId    uid.UID `json:"workspaceId" db:"workspace_id" gorm:"not null"`
+	Address        string             `json:"address" db:"address" gorm:"not null;uniqueIndex:idx_senders_workspace_address"`
+	Name           string             `json:"name" db:"name" gorm:"not null;default:''"` // Display name
+	ReplyTo        *string            `json:"replyTo" db:"reply_to"`                     // Default reply-to address
+	IsDefault      bool               `json:"isDefault" db:"is_default" gorm:"not null"`
+	Status         SenderStatus       `json:"status" db:"status" gorm:"not null;default:'PENDING'"`
+	Region         constant.AwsRegion `json:"region" db:"region" gorm:"not null"`
+	DomainId       *uid.UID           `json:"domainId" db:"domain_id"` // Nil for a mailbox identity
+	OrganizationId uid.UID            `json:"organizationId" db:"organization_id" gorm:"not null"`
+	WorkspaceId    uid.UID            `json:"workspaceId" db:"workspace_id" gorm:"not null;uniqueIndex:idx_senders_workspace_address"`
+}
+
+type senderRepository struct {
+	*baseRepository
+}
+
+func NewSenderRepository(baseRepository *baseRepository) SenderRepository {
+	return &senderRepository{
+		baseRepository,
+	}
+}
+
+func (r *senderRepository) Save(ctx context.Context, sender *Sender) error {
+	stmt, args, err := r.DB.Builder().Insert(string(TableNameSender)).Columns(
+		"id",
+		"address",
+		"name",
+		"reply_to",
+		"is_default",
+		"status",
+		"region",
+		"domain_id",
+		"organization_id",
+		"workspace_id",
+	).Values(
+		r.UID(sender.Id),
+		sender.Address,
+		sender.Name,
+		sender.ReplyTo,
+		sender.IsDefault,
+		sender.Status,
+		sender.Region,
+		sender.DomainId,
+		sender.OrganizationId,
+		sender.WorkspaceId,
+	).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *senderRepository) Update(ctx context.Context, sender *Sender) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameSender)).
+		Set("name", sender.Name).
+		Set("reply_to", sender.ReplyTo).
+		Where("id = ?", sender.Id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *senderRepository) UpdateStatus(ctx context.Context, id uid.UID, status SenderStatus) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameSender)).
+		Set("status", status).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+// SetDefault makes the sender the only default sender of its workspace
+func (r *senderRepository) SetDefault(ctx context.Context, sender *Sender) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameSender)).
+		Set("is_default", squirrel.Expr("id = ?", sender.Id)).
+		Where("workspace_id = ?", sender.WorkspaceId).
+		Where("(is_default OR id = ?)", sender.Id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *senderRepository) FindById(ctx context.Context, id uid.UID) (*Sender, error) {
+	stmt, args, err := r.selectSender().
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.scanSender(r.DB.Connection().QueryRow(ctx, stmt, args...))
+}
+
+func (r *senderRepository) FindByWorkspaceId(ctx context.Context, workspaceId uid.UID) ([]*Sender, error) {
+	stmt, args, err := r.selectSender().
+		Where("workspace_id = ?", workspaceId).
+		OrderBy("id DESC").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	senders := make([]*Sender, 0)
+	for rows.Next() {
+		sender, err := r.scanSender(rows)
+		if err != nil {
+			return nil, err
+		}
+		senders = append(senders, sender)
+	}
+
+	return senders, rows.Err()
+}
+
+// FindByAddress returns the sender of the workspace with the address, the
+// address is compared case insensitively
+func (r *senderRepository) FindByAddress(ctx context.Context, workspaceId uid.UID, address string) (*Sender, error) {
+	stmt, args, err := r.selectSender().
+		Where("workspace_id = ?", workspaceId).
+		Where("LOWER(address) = LOWER(?)", address).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.scanSender(r.DB.Connection().QueryRow(ctx, stmt, args...))
+}
+
+func (r *senderRepository) FindDefault(ctx context.Context, workspaceId uid.UID) (*Sender, error) {
+	stmt, args, err := r.selectSender().
+		Where("workspace_id = ?", workspaceId).
+		Where("is_default").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.scanSender(r.DB.Connection().QueryRow(ctx, stmt, args...))
+}
+
+func (r *senderRepository) Delete(ctx context.Context, id uid.UID) error {
+	stmt, args, err := r.DB.Builder().Delete(string(TableNameSender)).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *senderRepository) selectSender() squirrel.SelectBuilder {
+	return r.DB.Builder().Select(
+		"id",
+		"address",
+		"name",
+		"reply_to",
+		"is_default",
+		"status",
+		"region",
+		"domain_id",
+		"organization_id",
+		"workspace_id",
+	).From(string(TableNameSender))
+}
+
+func (r *senderRepository) scanSender(row pgx.Row) (*Sender, error) {
+	var sender Sender
+	err := row.Scan(
+		&sender.Id,
+		&sender.Address,
+		&sender.Name,
+		&sender.ReplyTo,
+		&sender.IsDefault,
+		&sender.Status,
+		&sender.Region,
+		&sender.DomainId,
+		&sender.OrganizationId,
+		&sender.WorkspaceId,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &sender, nil
 }
@@ -2,7 +2,9 @@ package model
 
 import (
 	"context"
+	"errors"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/usesend0/send0/internal/uid"
 )
 
@@ -18,6 +20,8 @@ const (
 
 type TemplateRepository interface {
 	Save(ctx context.Context, template *Template) error
+	FindById(ctx context.Context, id uid.UID) (*Template, error)
+	FindOptIn(ctx context.Context, workspaceId, organizationId uid.UID) (*Template, error)
 }
 
 type ContentEngine string
@@ -53,13 +57,13 @@ func (r *templateRepository) Save(ctx context.Context, template *Template) error
 		name,
 		content_engine,
 		is_transactional,
-		alt_subject,
+		subject,
 		content,
 		text_content,
 		is_opt_in,
 		organization_id,
 		workspace_id
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
 
 	_, err := r.DB.Connection().Exec(
 		ctx,
@@ -78,3 +82,62 @@ func (r *templateRepository) Save(ctx context.Context, template *Template) error
 
 	return err
 }
+
+func (r *templateRepository) FindById(ctx context.Context, id uid.UID) (*Template, error) {
+	stmt := `SELECT
+		id,
+		name,
+		content_engine,
+		is_transactional,
+		subject,
+		content,
+		text_content,
+		is_opt_in,
+		organization_id,
+		workspace_id
+	FROM templates WHERE id = $1`
+
+	return r.scanTemplate(r.DB.Connection().QueryRow(ctx, stmt, id))
+}
+
+func (r *templateRepository) FindOptIn(ctx context.Context, workspaceId, organizationId uid.UID) (*Template, error) {
+	stmt := `SELECT
+		id,
+		name,
+		content_engine,
+		is_transactional,
+		subject,
+		content,
+		text_content,
+		is_opt_in,
+		organization_id,
+		workspace_id
+	FROM templates WHERE workspace_id = $1 AND organization_id = $2 AND is_opt_in = true
+	ORDER BY id DESC LIMIT 1`
+
+	return r.scanTemplate(r.DB.Connection().QueryRow(ctx, stmt, workspaceId, organizationId))
+}
+
+func (r *templateRepository) scanTemplate(row pgx.Row) (*Template, error) {
+	var template Template
+	err := row.Scan(
+		&template.Id,
+		&template.Name,
+		&template.ContentEngine,
+		&template.IsTransactional,
+		&template.Subject,
+		&template.Content,
+		&template.TextContent,
+		&template.IsOptIn,
+		&template.OrganizationId,
+		&template.WorkspaceId,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &template, nil
+}
@@ -4,10 +4,16 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
 
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
 	"github.com/usesend0/send0/internal/constant"
 	"github.com/usesend0/send0/internal/crypto"
 	"github.com/usesend0/send0/internal/uid"
+	"github.com/usesend0/send0/pkg/webhook"
 )
 
 const (
@@ -15,45 +21,83 @@ const (
 	WebhookStatusInactive WebhookStatus = "INACTIVE"
 )
 
+const (
+	WebhookSigningModeRSA     WebhookSigningMode = "RSA"
+	WebhookSigningModeHMAC    WebhookSigningMode = "HMAC_SHA256"
+	WebhookSigningModeEd25519 WebhookSigningMode = "ED25519"
+)
+
 const (
 	WebhookLogStatusSuccess WebhookLogStatus = "SUCCESS"
 	WebhookLogStatusFailure WebhookLogStatus = "FAILURE"
 	WebhookLogStatusPending WebhookLogStatus = "PENDING"
 )
 
+// ErrWebhookLogExists is returned when the event has a log for the webhook
+// already, the event bus delivered it again
+var ErrWebhookLogExists = errors.New("webhook log already exists")
+
 var _ sql.Scanner = (*WebhookPayload)(nil)
 var _ driver.Valuer = (*WebhookPayload)(nil)
+var _ sql.Scanner = (*JSONBArrayWebhookRequests)(nil)
+var _ driver.Valuer = (*JSONBArrayWebhookRequests)(nil)
+var _ sql.Scanner = (*WebhookSigningSecrets)(nil)
+var _ driver.Valuer = (*WebhookSigningSecrets)(nil)
 
 type WebhookRepository interface {
 	Save(ctx context.Context, webhook *Webhook) error
 	FindById(ctx context.Context, id uid.UID) (*Webhook, error)
 	FindByWorkspaceId(ctx context.Context, workspaceId uid.UID) ([]*Webhook, error)
-	FindByEventType(ctx context.Context, eventType constant.EventType) (*Webhook, error)
+	FindByEventType(ctx context.Context, workspaceId uid.UID, eventType constant.EventType) ([]*Webhook, error)
+	Update(ctx context.Context, webhook *Webhook) error
+	UpdateSigningKey(ctx context.Context, webhook *Webhook) error
+	Delete(ctx context.Context, id uid.UID) error
+	RecordDelivery(ctx context.Context, id uid.UID, success bool) (int, error)
 	SaveLog(ctx context.Context, log *WebhookEvent) error
+	UpdateLog(ctx context.Context, log *WebhookEvent) error
+	FindLogById(ctx context.Context, id uid.UID) (*WebhookEvent, error)
+	FindLogs(ctx context.Context, options WebhookLogFindOptions) ([]*WebhookEvent, int, error)
+	ClaimDueLogs(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]*WebhookEvent, error)
 }
 
 type WebhookStatus string
 type WebhookEventType string
 type WebhookLogStatus string
+type WebhookSigningMode string
 
 type WebhookPayload string
 
 type Webhook struct {
 	Base
-	Status           WebhookStatus  `json:"status" db:"status" gorm:"not null"`
-	URL              string         `json:"url" db:"url" gorm:"not null"`
-	SigningKey       JSONPrivateKey `json:"-" db:"signing_key" gorm:"type:jsonb;not null;default '{}'"`
-	SigningKeyPublic string         `json:"signingKeyPublic" db:"-" gorm:"-:all"`
-	Events           JSONBArray     `json:"events" db:"events" gorm:"type:jsonb;not null;default '[]'"`
-	WorkspaceId      uid.UID        `json:"workspaceId" db:"workspace_id" gorm:"not null"`
+	Status           WebhookStatus         `json:"status" db:"status" gorm:"not null"`
+	URL              string                `json:"url" db:"url" gorm:"not null"`
+	SigningMode      WebhookSigningMode    `json:"signingMode" db:"signing_mode" gorm:"not null;default:'RSA'"`
+	SigningKey       JSONPrivateKey        `json:"-" db:"signing_key" gorm:"type:bytea"`                           // RSA signing mode only
+	SigningSecrets   WebhookSigningSecrets `json:"-" db:"signing_secrets" gorm:"type:jsonb;not null;default '[]'"` // Newest first
+	SigningKeyPublic string                `json:"signingKeyPublic,omitempty" db:"-" gorm:"-:all"`
+	SigningSecret    string                `json:"signingSecret,omitempty" db:"-" gorm:"-:all"`
+	Events           JSONBArray            `json:"events" db:"events" gorm:"type:jsonb;not null;default '[]'"`
+	FailureCount     int                   `json:"failureCount" db:"failure_count" gorm:"not null;default:0"` // Failed requests since the last successful one
+	WorkspaceId      uid.UID               `json:"workspaceId" db:"workspace_id" gorm:"not null"`
+}
+
+// WebhookSigningSecret is an HMAC secret or an Ed25519 private key, a
+// rotated secret is still used until it expires
+type WebhookSigningSecret struct {
+	Secret    string     `json:"secret"`
+	ExpiresAt *time.Time `json:"expiresAt"`
 }
 
+type WebhookSigningSecrets []WebhookSigningSecret
+
 type WehbookRequest struct {
 	Base
 	Signature      string `json:"signature"`
 	SendAt         string `json:"sendAt" db:"send_at" gorm:"type:timestamp with time zone;not null;default:now()"`
 	ResponseStatus int    `json:"responseStatus"`
 	ResponseBody   string `json:"responseBody"`
+	LatencyInMs    int64  `json:"latencyInMs"`
+	Error          string `json:"error,omitempty"`
 }
 
 type JSONBArrayWebhookRequests []WehbookRequest
@@ -64,10 +108,30 @@ type WebhookEvent struct {
 	EventType   WebhookEventType          `json:"eventType" db:"event_type" gorm:"not null"`
 	Payload     string                    `json:"payload" db:"payload" gorm:"type:jsonb;not null;default '{}'"`
 	Retries     int                       `json:"retries" db:"retries" gorm:"not null;default:0"`
-	NextSendAt  string                    `json:"nextSendAt" db:"next_send_at" gorm:"type:timestamp with time zone;not null;default:now()"`
+	NextSendAt  time.Time                 `json:"nextSendAt" db:"next_send_at" gorm:"type:timestamp with time zone;not null;default:now()"`
 	Requests    JSONBArrayWebhookRequests `json:"requests" db:"requests" gorm:"type:jsonb;not null;default '[]'"`
-	WebhookId   uid.UID                   `json:"webhookId" db:"webhook_id" gorm:"not null"`
+	WebhookId   uid.UID                   `json:"webhookId" db:"webhook_id" gorm:"not null;uniqueIndex:idx_webhook_events_event_webhook,priority:2"`
 	WorkspaceId uid.UID                   `json:"workspaceId" db:"workspace_id" gorm:"not null"`
+	// The event the log delivers, nil for the logs from before it was kept
+	EventId *uid.UID `json:"-" db:"event_id" gorm:"uniqueIndex:idx_webhook_events_event_webhook,priority:1"`
+}
+
+type WebhookLogFindOptions struct {
+	WebhookId uid.UID
+	Offset    int
+	Limit     int
+}
+
+var webhookLogColumns = []string{
+	"id",
+	"status",
+	"event_type",
+	"payload",
+	"retries",
+	"next_send_at",
+	"requests",
+	"webhook_id",
+	"workspace_id",
 }
 
 type webhookRepository struct {
@@ -79,44 +143,121 @@ func NewWebhookRepository(baseRepository *baseRepository) WebhookRepository {
 }
 
 func (r *webhookRepository) Save(ctx context.Context, webhook *Webhook) error {
-	stmt := `INSERT INTO webhooks (
-		id,
-		status,
-		url,
-		events,
-		signing_key,
-		workspace_id
-	) VALUES ($1, $2, $3, $4, $5, $6)`
-	_, err := r.DB.Connection().Exec(
-		ctx,
-		stmt,
-		webhook.Id,
+	if webhook.Events == nil {
+		webhook.Events = JSONBArray{}
+	}
+	if webhook.SigningSecrets == nil {
+		webhook.SigningSecrets = WebhookSigningSecrets{}
+	}
+	stmt, args, err := r.DB.Builder().Insert(string(TableNameWebhook)).Columns(
+		"id",
+		"status",
+		"url",
+		"events",
+		"signing_mode",
+		"signing_key",
+		"signing_secrets",
+		"workspace_id",
+	).Values(
+		r.UID(webhook.Id),
 		webhook.Status,
 		webhook.URL,
 		webhook.Events,
+		webhook.SigningMode,
 		webhook.SigningKey,
+		webhook.SigningSecrets,
 		webhook.WorkspaceId,
-	)
+	).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *webhookRepository) Update(ctx context.Context, webhook *Webhook) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameWebhook)).
+		Set("status", webhook.Status).
+		Set("url", webhook.URL).
+		Set("events", webhook.Events).
+		Set("failure_count", webhook.FailureCount).
+		Where("id = ?", webhook.Id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *webhookRepository) UpdateSigningKey(ctx context.Context, webhook *Webhook) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameWebhook)).
+		Set("signing_key", webhook.SigningKey).
+		Set("signing_secrets", webhook.SigningSecrets).
+		Where("id = ?", webhook.Id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
+
+	return err
+}
+
+func (r *webhookRepository) Delete(ctx context.Context, id uid.UID) error {
+	stmt, args, err := r.DB.Builder().Delete(string(TableNameWebhook)).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
 
 	return err
 }
 
+// RecordDelivery resets the failure count of the webhook after a successful
+// request and increments it otherwise, the new failure count is returned
+func (r *webhookRepository) RecordDelivery(ctx context.Context, id uid.UID, success bool) (int, error) {
+	failureCount := squirrel.Expr("failure_count + 1")
+	if success {
+		failureCount = squirrel.Expr("0")
+	}
+	stmt, args, err := r.DB.Builder().Update(string(TableNameWebhook)).
+		Set("failure_count", failureCount).
+		Where("id = ?", id).
+		Suffix("RETURNING failure_count").
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = r.DB.Connection().QueryRow(ctx, stmt, args...).Scan(&count)
+
+	return count, err
+}
+
+// SaveLog saves the log, a second log of the event for the webhook returns
+// ErrWebhookLogExists
 func (r *webhookRepository) SaveLog(ctx context.Context, log *WebhookEvent) error {
-	stmt := `INSERT INTO webhook_logs (
-		id,
-		status,
-		event_type,
-		payload,
-		retries,
-		next_send_at,
-		requests,
-		webhook_id,
-		workspace_id
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
-	_, err := r.DB.Connection().Exec(
-		ctx,
-		stmt,
-		log.Id,
+	if log.Requests == nil {
+		log.Requests = JSONBArrayWebhookRequests{}
+	}
+	stmt, args, err := r.DB.Builder().Insert(string(TableNameWebhookEvent)).Columns(
+		"id",
+		"status",
+		"event_type",
+		"payload",
+		"retries",
+		"next_send_at",
+		"requests",
+		"webhook_id",
+		"workspace_id",
+		"event_id",
+	).Values(
+		r.UID(log.Id),
 		log.Status,
 		log.EventType,
 		log.Payload,
@@ -125,70 +266,253 @@ func (r *webhookRepository) SaveLog(ctx context.Context, log *WebhookEvent) erro
 		log.Requests,
 		log.WebhookId,
 		log.WorkspaceId,
-	)
+		log.EventId,
+	).Suffix("ON CONFLICT (event_id, webhook_id) DO NOTHING").ToSql()
+	if err != nil {
+		return err
+	}
+	tag, err := r.DB.Connection().Exec(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookLogExists
+	}
+
+	return nil
+}
+
+func (r *webhookRepository) UpdateLog(ctx context.Context, log *WebhookEvent) error {
+	stmt, args, err := r.DB.Builder().Update(string(TableNameWebhookEvent)).
+		Set("status", log.Status).
+		Set("retries", log.Retries).
+		Set("next_send_at", log.NextSendAt).
+		Set("requests", log.Requests).
+		Where("id = ?", log.Id).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Connection().Exec(ctx, stmt, args...)
 
 	return err
 }
 
+func (r *webhookRepository) FindLogById(ctx context.Context, id uid.UID) (*WebhookEvent, error) {
+	stmt, args, err := r.selectLog().
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	log, err := r.scanLog(r.DB.Connection().QueryRow(ctx, stmt, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+
+	return log, err
+}
+
+func (r *webhookRepository) FindLogs(ctx context.Context, options WebhookLogFindOptions) ([]*WebhookEvent, int, error) {
+	stmt, args, err := r.selectLog().
+		Where("webhook_id = ?", options.WebhookId).
+		OrderBy("id DESC").
+		Offset(uint64(options.Offset)).
+		Limit(uint64(options.Limit)).
+		ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+	logs, err := r.queryLogs(ctx, stmt, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	stmt, args, err = r.DB.Builder().Select("COUNT(*)").
+		From(string(TableNameWebhookEvent)).
+		Where("webhook_id = ?", options.WebhookId).
+		ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+	var count int
+	err = r.DB.Connection().QueryRow(ctx, stmt, args...).Scan(&count)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return logs, count, nil
+}
+
+// ClaimDueLogs returns the pending logs which are due to be sent and moves
+// their next send time to the lease, so a log is only sent by one worker.
+// A log which is not updated before the lease ends is sent again
+func (r *webhookRepository) ClaimDueLogs(
+	ctx context.Context,
+	now time.Time,
+	leaseUntil time.Time,
+	limit int,
+) ([]*WebhookEvent, error) {
+	due := r.DB.Builder().Select("id").
+		From(string(TableNameWebhookEvent)).
+		Where("status = ?", WebhookLogStatusPending).
+		Where("next_send_at <= ?", now).
+		OrderBy("next_send_at").
+		Limit(uint64(limit)).
+		Suffix("FOR UPDATE SKIP LOCKED")
+	stmt, args, err := r.DB.Builder().Update(string(TableNameWebhookEvent)).
+		Set("next_send_at", leaseUntil).
+		Where(squirrel.Expr("id IN (?)", due)).
+		Suffix("RETURNING " + strings.Join(webhookLogColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.queryLogs(ctx, stmt, args...)
+}
+
 func (r *webhookRepository) FindById(ctx context.Context, id uid.UID) (*Webhook, error) {
-	var webhook Webhook
-	stmt := `SELECT * FROM webhooks WHERE id = $1`
-	err := r.DB.Connection().QueryRow(ctx, stmt, id).Scan(
-		&webhook.Id,
-		&webhook.Status,
-		&webhook.URL,
-		&webhook.Events,
-		&webhook.SigningKey,
-		&webhook.WorkspaceId,
-	)
+	stmt, args, err := r.selectWebhook().
+		Where("id = ?", id).
+		ToSql()
 	if err != nil {
 		return nil, err
 	}
-	// Encode the public key for the response
-	webhook.SigningKeyPublic, err = crypto.PublicKeyToEncoded(&webhook.SigningKey.PublicKey)
+	webhook, err := r.scanWebhook(r.DB.Connection().QueryRow(ctx, stmt, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+
+	return webhook, err
+}
+
+// FindByEventType returns the active webhooks of the workspace which are
+// subscribed to the event type
+func (r *webhookRepository) FindByEventType(
+	ctx context.Context,
+	workspaceId uid.UID,
+	eventType constant.EventType,
+) ([]*Webhook, error) {
+	stmt, args, err := r.selectWebhook().
+		Where("workspace_id = ?", workspaceId).
+		Where("status = ?", WebhookStatusActive).
+		Where("events @> ?::jsonb", JSONBArray{string(eventType)}).
+		ToSql()
 	if err != nil {
 		return nil, err
 	}
 
-	return &webhook, nil
+	return r.queryWebhooks(ctx, stmt, args...)
+}
+
+func (r *webhookRepository) FindByWorkspaceId(ctx context.Context, workspaceId uid.UID) ([]*Webhook, error) {
+	stmt, args, err := r.selectWebhook().
+		Where("workspace_id = ?", workspaceId).
+		OrderBy("id DESC").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.queryWebhooks(ctx, stmt, args...)
+}
+
+func (r *webhookRepository) selectWebhook() squirrel.SelectBuilder {
+	return r.DB.Builder().Select(
+		"id",
+		"status",
+		"url",
+		"events",
+		"signing_mode",
+		"signing_key",
+		"signing_secrets",
+		"failure_count",
+		"workspace_id",
+	).From(string(TableNameWebhook))
+}
+
+func (r *webhookRepository) queryWebhooks(ctx context.Context, stmt string, args ...interface{}) ([]*Webhook, error) {
+	webhooks := make([]*Webhook, 0)
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		webhook, err := r.scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (r *webhookRepository) selectLog() squirrel.SelectBuilder {
+	return r.DB.Builder().Select(webhookLogColumns...).From(string(TableNameWebhookEvent))
 }
 
-func (r *webhookRepository) FindByEventType(ctx context.Context, eventType constant.EventType) (*Webhook, error) {
+func (r *webhookRepository) queryLogs(ctx context.Context, stmt string, args ...interface{}) ([]*WebhookEvent, error) {
+	logs := make([]*WebhookEvent, 0)
+	rows, err := r.DB.Connection().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		log, err := r.scanLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, log)
+	}
+
+	return logs, rows.Err()
+}
+
+func (r *webhookRepository) scanLog(row pgx.Row) (*WebhookEvent, error) {
+	var log WebhookEvent
+	err := row.Scan(
+		&log.Id,
+		&log.Status,
+		&log.EventType,
+		&log.Payload,
+		&log.Retries,
+		&log.NextSendAt,
+		&log.Requests,
+		&log.WebhookId,
+		&log.WorkspaceId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &log, nil
+}
+
+func (r *webhookRepository) scanWebhook(row pgx.Row) (*Webhook, error) {
 	var webhook Webhook
-	stmt := `SELECT * FROM webhooks WHERE events @> $1`
-	err := r.DB.Connection().QueryRow(ctx, stmt, eventType).Scan(
+	err := row.Scan(
 		&webhook.Id,
 		&webhook.Status,
 		&webhook.URL,
 		&webhook.Events,
+		&webhook.SigningMode,
 		&webhook.SigningKey,
+		&webhook.SigningSecrets,
+		&webhook.FailureCount,
 		&webhook.WorkspaceId,
 	)
 	if err != nil {
 		return nil, err
 	}
-
-	return &webhook, nil
-}
-
-func (r *webhookRepository) FindByWorkspaceId(ctx context.Context, workspaceId uid.UID) ([]*Webhook, error) {
-	var webhooks []*Webhook
-	stmt := `SELECT * FROM webhooks WHERE workspace_id = $1`
-	row, err := r.DB.Connection().Query(ctx, stmt, workspaceId)
+	err = webhook.EncodeSigningKey()
 	if err != nil {
 		return nil, err
 	}
-	defer row.Close()
-	for row.Next() {
-		var webhook Webhook
-		err := row.Scan(&webhook)
-		if err != nil {
-			return nil, err
-		}
-		webhooks = append(webhooks, &webhook)
-	}
 
-	return webhooks, nil
+	return &webhook, nil
 }
 
 func (w *WebhookPayload) Scan(value interface{}) error {
@@ -198,3 +522,52 @@ func (w *WebhookPayload) Scan(value interface{}) error {
 func (w WebhookPayload) Value() (driver.Value, error) {
 	return valueJSONB(w)
 }
+
+func (w *JSONBArrayWebhookRequests) Scan(value interface{}) error {
+	return scanJSONB(value, w)
+}
+
+func (w JSONBArrayWebhookRequests) Value() (driver.Value, error) {
+	return valueJSONB(w)
+}
+
+// EncodeSigningKey sets the key receivers verify the requests with, the
+// public key in the RSA and ED25519 signing modes or the secret in the
+// HMAC_SHA256 signing mode
+func (w *Webhook) EncodeSigningKey() error {
+	var err error
+	switch w.SigningMode {
+	case WebhookSigningModeHMAC:
+		if len(w.SigningSecrets) > 0 {
+			w.SigningSecret = w.SigningSecrets[0].Secret
+		}
+	case WebhookSigningModeEd25519:
+		if len(w.SigningSecrets) > 0 {
+			w.SigningKeyPublic, err = webhook.PublicKey(w.SigningSecrets[0].Secret)
+		}
+	default:
+		w.SigningKeyPublic, err = crypto.PublicKeyToEncoded(&w.SigningKey.PublicKey)
+	}
+
+	return err
+}
+
+// Active returns the secrets which have not expired
+func (s WebhookSigningSecrets) Active(now time.Time) []string {
+	secrets := make([]string, 0, len(s))
+	for _, secret := range s {
+		if secret.ExpiresAt == nil || secret.ExpiresAt.After(now) {
+			secrets = append(secrets, secret.Secret)
+		}
+	}
+
+	return secrets
+}
+
+func (s *WebhookSigningSecrets) Scan(value interface{}) error {
+	return scanJSONB(value, s)
+}
+
+func (s WebhookSigningSecrets) Value() (driver.Value, error) {
+	return valueJSONB(s)
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go"
+	"github.com/usesend0/send0/internal/awsclient"
+	"github.com/usesend0/send0/internal/config"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+// awsAccountCacheTTL is how long the AWS account of a workspace is used before
+// it is read again, other instances see a changed account after it
+const awsAccountCacheTTL = time.Minute
+
+var ErrAWSAccountNotActive = errors.New("AWS account of the workspace is not active")
+
+// awsClients are shared by the services of every transaction so clients and
+// assumed role credentials are created once
+type awsClients struct {
+	ses      *awsclient.Cache[*sesv2.Client]
+	sns      *awsclient.Cache[*sns.Client]
+	sqs      *awsclient.Cache[*sqs.Client]
+	mu       sync.Mutex
+	accounts map[uid.UID]*cachedAWSAccount
+}
+
+type cachedAWSAccount struct {
+	account   *model.AWSAccount // Nil when the workspace uses the operator account
+	expiresAt time.Time
+}
+
+func newAWSClients(config *config.Config) *awsClients {
+	return &awsClients{
+		ses: awsclient.NewCache(func(region string, credentials aws.CredentialsProvider) *sesv2.Client {
+			return sesv2.New(sesv2.Options{
+				Region:      region,
+				Credentials: credentials,
+			})
+		}),
+		sns: awsclient.NewCache(func(region string, credentials aws.CredentialsProvider) *sns.Client {
+			options := sns.Options{
+				Region:      region,
+				Credentials: credentials,
+			}
+			if config.SNS.SNSEndPoint != "" {
+				options.BaseEndpoint = aws.String(config.SNS.SNSEndPoint)
+			}
+			return sns.New(options)
+		}),
+		sqs: awsclient.NewCache(func(region string, credentials aws.CredentialsProvider) *sqs.Client {
+			options := sqs.Options{
+				Region:      region,
+				Credentials: credentials,
+			}
+			if config.SNS.SQSEndPoint != "" {
+				options.BaseEndpoint = aws.String(config.SNS.SQSEndPoint)
+			}
+			return sqs.New(options)
+		}),
+		accounts: make(map[uid.UID]*cachedAWSAccount),
+	}
+}
+
+// checkSESRegions returns an error when a configured region doesn't support
+// SES
+func checkSESRegions(regions []constant.AwsRegion) error {
+	if len(regions) == 0 {
+		return errors.New("no SES region configured")
+	}
+	for _, region := range regions {
+		if !slices.Contains(constant.SupportedSESRegions, region) {
+			return fmt.Errorf("SES is not available in region %s", region)
+		}
+	}
+
+	return nil
+}
+
+func (s *baseService) sesRegionEnabled(region constant.AwsRegion) bool {
+	return slices.Contains(s.config.SES.Regions, region)
+}
+
+// sesCredentials returns the SES credentials of the region, the keys and role
+// of the region override the default ones
+func (s *baseService) sesCredentials(region constant.AwsRegion) awsclient.Credentials {
+	credentials := awsclient.Credentials{
+		AccessKeyId:     s.config.SES.AccessKeyId,
+		SecretAccessKey: s.config.SES.SecretAccessKey,
+		RoleArn:         s.config.SES.RoleArn,
+		ExternalId:      s.config.SES.ExternalId,
+	}
+	if accessKeyId, ok := s.config.SES.RegionAccessKeyIds[string(region)]; ok {
+		credentials.AccessKeyId = accessKeyId
+		credentials.SecretAccessKey = s.config.SES.RegionSecretAccessKeys[string(region)]
+	}
+	if roleArn, ok := s.config.SES.RegionRoleArns[string(region)]; ok {
+		credentials.RoleArn = roleArn
+	}
+
+	return credentials
+}
+
+// snsCredentials returns the SNS keys with the SES role of the region, SES
+// only publishes to topics of its own account
+func (s *baseService) snsCredentials(region constant.AwsRegion) awsclient.Credentials {
+	credentials := s.sesCredentials(region)
+	credentials.AccessKeyId = s.config.SNS.AccessKeyId
+	credentials.SecretAccessKey = s.config.SNS.SecretAccessKey
+
+	return credentials
+}
+
+// withAWSAccount returns the credentials which assume the role of the account
+// with the operator keys
+func withAWSAccount(credentials awsclient.Credentials, account *model.AWSAccount) awsclient.Credentials {
+	if account == nil {
+		return credentials
+	}
+	credentials.RoleArn = account.RoleArn
+	credentials.ExternalId = account.ExternalId
+
+	return credentials
+}
+
+// awsAccount returns the AWS account of the workspace, nil when the workspace
+// sends through the operator account
+func (s *baseService) awsAccount(ctx context.Context, workspaceId uid.UID) (*model.AWSAccount, error) {
+	s.awsClients.mu.Lock()
+	cached, ok := s.awsClients.accounts[workspaceId]
+	s.awsClients.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.account, nil
+	}
+	account, err := s.repository.AWSAccount.FindByWorkspaceId(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	s.awsClients.mu.Lock()
+	s.awsClients.accounts[workspaceId] = &cachedAWSAccount{
+		account:   account,
+		expiresAt: time.Now().Add(awsAccountCacheTTL),
+	}
+	s.awsClients.mu.Unlock()
+
+	return account, nil
+}
+
+// activeAWSAccount is awsAccount, an account which isn't active returns
+// ErrAWSAccountNotActive so the workspace never falls back to the operator
+// account
+func (s *baseService) activeAWSAccount(ctx context.Context, workspaceId uid.UID) (*model.AWSAccount, error) {
+	account, err := s.awsAccount(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	if account != nil && account.Status != model.AWSAccountStatusActive {
+		return nil, ErrAWSAccountNotActive
+	}
+
+	return account, nil
+}
+
+func (s *baseService) forgetAWSAccount(workspaceId uid.UID) {
+	s.awsClients.mu.Lock()
+	delete(s.awsClients.accounts, workspaceId)
+	s.awsClients.mu.Unlock()
+}
+
+// sesClient returns the client of the region in the account, a nil account is
+// the operator account
+func (s *baseService) sesClient(account *model.AWSAccount, region constant.AwsRegion) (*sesv2.Client, error) {
+	if !s.sesRegionEnabled(region) {
+		return nil, fmt.Errorf("SES service not available for region %s", region)
+	}
+
+	return s.awsClients.ses.Get(string(region), withAWSAccount(s.sesCredentials(region), account)), nil
+}
+
+// workspaceSESClient returns the client of the region in the account the
+// workspace sends through
+func (s *baseService) workspaceSESClient(ctx context.Context, workspaceId uid.UID, region constant.AwsRegion) (*sesv2.Client, error) {
+	account, err := s.activeAWSAccount(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.sesClient(account, region)
+}
+
+func (s *baseService) snsClient(account *model.AWSAccount, region constant.AwsRegion) *sns.Client {
+	return s.awsClients.sns.Get(string(region), withAWSAccount(s.snsCredentials(region), account))
+}
+
+func (s *baseService) sqsClient(region constant.AwsRegion) *sqs.Client {
+	return s.awsClients.sqs.Get(string(region), s.snsCredentials(region))
+}
+
+// isThrottlingError tells if SES rejected the request because the send rate
+// or the daily quota of the account is exceeded
+func isThrottlingError(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "TooManyRequestsException", "LimitExceededException", "ThrottlingException", "Throttling":
+		return true
+	}
+
+	return false
+}
+
+// isTransientSESError tells if a request SES didn't accept may succeed when it
+// is sent again, SES was throttled, failed or couldn't be reached. SES
+// rejecting the email itself is permanent
+func isTransientSESError(err error) bool {
+	if isThrottlingError(err) {
+		return true
+	}
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.HTTPStatusCode() >= 500
+	}
+	var apiErr smithy.APIError
+
+	return !errors.As(err, &apiErr)
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/usesend0/send0/internal/awsclient"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+var (
+	ErrInvalidRoleArn   = errors.New("invalid IAM role ARN")
+	ErrAWSAccountInUse  = errors.New("the workspace has domains or mailbox senders, delete them before changing its AWS account")
+	ErrAWSAccountFailed = errors.New("failed to set up the AWS account")
+	ErrRoleArnConnected = errors.New("the IAM role is connected to another workspace")
+)
+
+type AWSAccountService interface {
+	Connect(ctx context.Context, account *model.AWSAccount) error
+	Get(ctx context.Context, workspaceId uid.UID) (*model.AWSAccount, error)
+	Disconnect(ctx context.Context, account *model.AWSAccount) error
+}
+
+type awsAccountService struct {
+	*baseService
+	snsService SNSService
+}
+
+func NewAWSAccountService(baseService *baseService, snsService SNSService) AWSAccountService {
+	return &awsAccountService{
+		baseService: baseService,
+		snsService:  snsService,
+	}
+}
+
+// Connect makes the workspace send through the AWS account of the role. The
+// role is assumed with the external id and the SNS topics are created in the
+// account, the account stays FAILED with the reason when either fails. The
+// external id is always generated, a role connected to another workspace is
+// rejected
+func (s *awsAccountService) Connect(ctx context.Context, account *model.AWSAccount) error {
+	roleArn, err := arn.Parse(account.RoleArn)
+	if err != nil || roleArn.Service != "iam" || !strings.HasPrefix(roleArn.Resource, "role/") {
+		return ErrInvalidRoleArn
+	}
+	connected, err := s.repository.AWSAccount.FindByRoleArn(ctx, account.RoleArn)
+	if err != nil {
+		return err
+	}
+	if connected != nil && connected.WorkspaceId != account.WorkspaceId {
+		return ErrRoleArnConnected
+	}
+	existing, err := s.repository.AWSAccount.FindByWorkspaceId(ctx, account.WorkspaceId)
+	if err != nil {
+		return err
+	}
+	if existing == nil || existing.AccountId != roleArn.AccountID {
+		err = s.checkUnused(ctx, account.WorkspaceId)
+		if err != nil {
+			return err
+		}
+	}
+	account.ExternalId = externalId(account.WorkspaceId)
+	account.AccountId = roleArn.AccountID
+	account.Status = model.AWSAccountStatusPending
+	account.StatusMessage = nil
+	if existing != nil {
+		account.Id = existing.Id
+		err = s.repository.AWSAccount.Update(ctx, account)
+	} else {
+		account.Id = *s.uidGenerator.Next()
+		err = s.repository.AWSAccount.Save(ctx, account)
+	}
+	if err != nil {
+		return err
+	}
+	defer s.forgetAWSAccount(account.WorkspaceId)
+	err = s.setup(ctx, account)
+	if err != nil {
+		s.logger.Error().Err(err).Str("workspaceId", account.WorkspaceId.String()).Msg("failed to set up AWS account")
+		message := err.Error()
+		account.Status = model.AWSAccountStatusFailed
+		account.StatusMessage = &message
+		updateErr := s.repository.AWSAccount.Update(ctx, account)
+		if updateErr != nil {
+			return updateErr
+		}
+		return fmt.Errorf("%w: %s", ErrAWSAccountFailed, message)
+	}
+	account.Status = model.AWSAccountStatusActive
+
+	return s.repository.AWSAccount.Update(ctx, account)
+}
+
+// setup checks that the role can be assumed and creates the SNS topics SES
+// publishes the events of the account to
+func (s *awsAccountService) setup(ctx context.Context, account *model.AWSAccount) error {
+	region := s.config.SES.Regions[0]
+	stsClient := sts.New(sts.Options{
+		Region:      string(region),
+		Credentials: awsclient.CredentialsProvider(string(region), withAWSAccount(s.sesCredentials(region), account)),
+	})
+	identity, err := stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return err
+	}
+	if identity.Account == nil || *identity.Account != account.AccountId {
+		return errors.New("the role belongs to another AWS account")
+	}
+
+	return s.snsService.SetupAccountTopics(ctx, account)
+}
+
+// externalId is the external id the role of a workspace must be assumed with,
+// it's derived from the workspace so it stays the same across connections and
+// a workspace can't choose the one of another workspace
+func externalId(workspaceId uid.UID) string {
+	return constant.AppName + "-" + workspaceId.String()
+}
+
+func (s *awsAccountService) Get(ctx context.Context, workspaceId uid.UID) (*model.AWSAccount, error) {
+	return s.repository.AWSAccount.FindByWorkspaceId(ctx, workspaceId)
+}
+
+// Disconnect makes the workspace send through the operator account again, the
+// SNS topics of the account are deleted
+func (s *awsAccountService) Disconnect(ctx context.Context, account *model.AWSAccount) error {
+	err := s.checkUnused(ctx, account.WorkspaceId)
+	if err != nil {
+		return err
+	}
+	err = s.snsService.DeleteAccountTopics(ctx, account)
+	if err != nil {
+		return err
+	}
+	err = s.repository.AWSAccount.Delete(ctx, account.Id)
+	if err != nil {
+		return err
+	}
+	s.forgetAWSAccount(account.WorkspaceId)
+
+	return nil
+}
+
+// checkUnused returns ErrAWSAccountInUse when the workspace has SES
+// identities, they exist in the account they were created in only
+func (s *awsAccountService) checkUnused(ctx context.Context, workspaceId uid.UID) error {
+	_, count, err := s.repository.Domain.FindAll(ctx, model.DomainFindOptions{
+		WorkspaceId: workspaceId,
+		Limit:       1,
+	})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrAWSAccountInUse
+	}
+	senders, err := s.repository.Sender.FindByWorkspaceId(ctx, workspaceId)
+	if err != nil {
+		return err
+	}
+	for _, sender := range senders {
+		if sender.DomainId == nil {
+			return ErrAWSAccountInUse
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type fakeAWSAccountRepository struct {
+	model.AWSAccountRepository
+	accounts []*model.AWSAccount
+	finds    int
+}
+
+func (r *fakeAWSAccountRepository) FindByWorkspaceId(_ context.Context, workspaceId uid.UID) (*model.AWSAccount, error) {
+	r.finds++
+	for _, account := range r.accounts {
+		if account.WorkspaceId == workspaceId {
+			return account, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (r *fakeAWSAccountRepository) FindByRoleArn(_ context.Context, roleArn string) (*model.AWSAccount, error) {
+	for _, account := range r.accounts {
+		if account.RoleArn == roleArn {
+			return account, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func TestConnectRejectsRoleOfAnotherWorkspace(t *testing.T) {
+	roleArn := "arn:aws:iam::123456789012:role/send0"
+	repository := &model.Repository{
+		AWSAccount: &fakeAWSAccountRepository{
+			accounts: []*model.AWSAccount{{RoleArn: roleArn, WorkspaceId: *uid.NewUID(1)}},
+		},
+	}
+	service := NewAWSAccountService(newTestBaseService(repository), nil)
+
+	err := service.Connect(context.Background(), &model.AWSAccount{RoleArn: roleArn, WorkspaceId: *uid.NewUID(2)})
+	if !errors.Is(err, ErrRoleArnConnected) {
+		t.Fatalf("expected ErrRoleArnConnected, got %v", err)
+	}
+}
+
+func TestConnectRejectsInvalidRoleArn(t *testing.T) {
+	service := NewAWSAccountService(newTestBaseService(&model.Repository{}), nil)
+	for _, roleArn := range []string{"", "role/send0", "arn:aws:iam::123456789012:user/send0", "arn:aws:s3:::bucket"} {
+		err := service.Connect(context.Background(), &model.AWSAccount{RoleArn: roleArn, WorkspaceId: *uid.NewUID(1)})
+		if !errors.Is(err, ErrInvalidRoleArn) {
+			t.Errorf("%q: expected ErrInvalidRoleArn, got %v", roleArn, err)
+		}
+	}
+}
+
+func TestExternalIdIsStablePerWorkspace(t *testing.T) {
+	if externalId(*uid.NewUID(1)) != externalId(*uid.NewUID(1)) {
+		t.Fatal("expected the external id of a workspace to be stable")
+	}
+	if externalId(*uid.NewUID(1)) == externalId(*uid.NewUID(2)) {
+		t.Fatal("expected workspaces to have different external ids")
+	}
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/usesend0/send0/internal/awsclient"
+	"github.com/usesend0/send0/internal/config"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+func TestSESCredentialsOfTheRegion(t *testing.T) {
+	service := newTestBaseService(&model.Repository{})
+	service.config.SES = config.SES{
+		AccessKeyId:            "AKIADEFAULT",
+		SecretAccessKey:        "default",
+		RoleArn:                "arn:aws:iam::111111111111:role/send0",
+		ExternalId:             "external",
+		RegionAccessKeyIds:     map[string]string{"eu-west-1": "AKIAIRELAND"},
+		RegionSecretAccessKeys: map[string]string{"eu-west-1": "ireland"},
+		RegionRoleArns:         map[string]string{"sa-east-1": "arn:aws:iam::222222222222:role/send0"},
+	}
+	service.config.SNS = config.SNS{AccessKeyId: "AKIASNS", SecretAccessKey: "sns"}
+
+	for region, want := range map[constant.AwsRegion]awsclient.Credentials{
+		constant.AwsRegionNorthVirginia: {AccessKeyId: "AKIADEFAULT", SecretAccessKey: "default", RoleArn: "arn:aws:iam::111111111111:role/send0", ExternalId: "external"},
+		constant.AwsRegionIreland:       {AccessKeyId: "AKIAIRELAND", SecretAccessKey: "ireland", RoleArn: "arn:aws:iam::111111111111:role/send0", ExternalId: "external"},
+		constant.AwsRegionSaopaulo:      {AccessKeyId: "AKIADEFAULT", SecretAccessKey: "default", RoleArn: "arn:aws:iam::222222222222:role/send0", ExternalId: "external"},
+	} {
+		if got := service.sesCredentials(region); got != want {
+			t.Fatalf("expected the credentials %+v in %s, got %+v", want, region, got)
+		}
+	}
+	// SES publishes to the topics of the account of its role
+	want := awsclient.Credentials{AccessKeyId: "AKIASNS", SecretAccessKey: "sns", RoleArn: "arn:aws:iam::222222222222:role/send0", ExternalId: "external"}
+	if got := service.snsCredentials(constant.AwsRegionSaopaulo); got != want {
+		t.Fatalf("expected the SNS keys with the role of the region, got %+v", got)
+	}
+	// the account of a workspace replaces the role, the operator keys assume it
+	account := &model.AWSAccount{RoleArn: "arn:aws:iam::333333333333:role/send0", ExternalId: "workspace"}
+	want = awsclient.Credentials{AccessKeyId: "AKIAIRELAND", SecretAccessKey: "ireland", RoleArn: account.RoleArn, ExternalId: account.ExternalId}
+	if got := withAWSAccount(service.sesCredentials(constant.AwsRegionIreland), account); got != want {
+		t.Fatalf("expected the role of the account, got %+v", got)
+	}
+}
+
+func TestAWSAccountIsCached(t *testing.T) {
+	workspaceId := *uid.NewUID(1)
+	repository := &fakeAWSAccountRepository{accounts: []*model.AWSAccount{{
+		RoleArn:     "arn:aws:iam::123456789012:role/send0",
+		Status:      model.AWSAccountStatusActive,
+		WorkspaceId: workspaceId,
+	}}}
+	service := newTestBaseService(&model.Repository{AWSAccount: repository})
+	ctx := context.Background()
+
+	client, err := service.workspaceSESClient(ctx, workspaceId, constant.AwsRegionNorthVirginia)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := service.workspaceSESClient(ctx, workspaceId, constant.AwsRegionNorthVirginia)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other != client || repository.finds != 1 {
+		t.Fatalf("expected the account and its client to be reused, found the account %d times", repository.finds)
+	}
+	operator, err := service.workspaceSESClient(ctx, *uid.NewUID(2), constant.AwsRegionNorthVirginia)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if operator == client {
+		t.Fatal("expected a client of the operator account for a workspace without an account")
+	}
+
+	// an account which failed is read again
+	repository.accounts[0].Status = model.AWSAccountStatusFailed
+	service.forgetAWSAccount(workspaceId)
+	_, err = service.workspaceSESClient(ctx, workspaceId, constant.AwsRegionNorthVirginia)
+	if !errors.Is(err, ErrAWSAccountNotActive) {
+		t.Fatalf("expected ErrAWSAccountNotActive, got %v", err)
+	}
+}
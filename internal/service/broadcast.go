@@ -0,0 +1,1288 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+	"golang.org/x/time/rate"
+)
+
+const broadcastListenerId = "broadcast-stats"
+
+const (
+	broadcastMinVariants = 2
+	broadcastMaxVariants = 5
+)
+
+const localSendTimeLayout = "15:04"
+
+// broadcastSendRetries is how often sending to a contact is retried after a
+// retryable error, the retries wait for the first steps of the retry schedule
+const broadcastSendRetries = 5
+
+var ErrBroadcastNotEditable = errors.New("only draft broadcasts can be changed")
+var ErrBroadcastStatus = errors.New("broadcast status does not allow this action")
+var ErrBroadcastEmailInvalid = errors.New("broadcast email can not be built")
+
+var broadcastStatCounters = map[constant.EventType]model.BroadcastStatCounter{
+	constant.EventTypeEmailSend:        model.BroadcastStatSent,
+	constant.EventTypeEmailDelivered:   model.BroadcastStatDelivered,
+	constant.EventTypeEmailOpened:      model.BroadcastStatOpened,
+	constant.EventTypeEmailClicked:     model.BroadcastStatClicked,
+	constant.EventTypeEmailBounced:     model.BroadcastStatBounced,
+	constant.EventTypeEmailReported:    model.BroadcastStatComplained,
+	constant.EventTypeEmailUnsubsribed: model.BroadcastStatUnsubscribed,
+}
+
+type BroadcastService interface {
+	Create(ctx context.Context, broadcast *model.Broadcast) error
+	Update(ctx context.Context, broadcast *model.Broadcast) error
+	Delete(ctx context.Context, broadcast *model.Broadcast) error
+	Start(ctx context.Context, broadcast *model.Broadcast) error
+	Pause(ctx context.Context, broadcast *model.Broadcast) error
+	Resume(ctx context.Context, broadcast *model.Broadcast) error
+	Cancel(ctx context.Context, broadcast *model.Broadcast) error
+	StartScheduler(ctx context.Context)
+	StartListeners(ctx context.Context)
+}
+
+type broadcastRun struct {
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stopped bool
+}
+
+type broadcastService struct {
+	*baseService
+	mu              sync.Mutex
+	owner           string // Holds the leases of the broadcasts this replica runs
+	runs            map[uid.UID]*broadcastRun
+	emailService    EmailService
+	eventService    EventSevice
+	templateService TemplateService
+}
+
+func NewBroadcastService(
+	baseService *baseService,
+	emailService EmailService,
+	eventService EventSevice,
+	templateService TemplateService,
+) BroadcastService {
+	return &broadcastService{
+		baseService:     baseService,
+		owner:           baseService.uidGenerator.Next().String(),
+		runs:            make(map[uid.UID]*broadcastRun),
+		emailService:    emailService,
+		eventService:    eventService,
+		templateService: templateService,
+	}
+}
+
+func (s *broadcastService) Create(ctx context.Context, broadcast *model.Broadcast) error {
+	err := s.validate(ctx, broadcast)
+	if err != nil {
+		return err
+	}
+	broadcast.Id = *s.uidGenerator.Next()
+	broadcast.Status = model.BroadcastStatusDraft
+
+	return s.Transact(ctx, func(ctx context.Context, service *Service) error {
+		err := service.repository.Broadcast.Save(ctx, broadcast)
+		if err != nil {
+			return err
+		}
+
+		return saveVariants(ctx, service, broadcast)
+	})
+}
+
+// Update changes a draft broadcast, the variants are replaced when the
+// broadcast has variants set
+func (s *broadcastService) Update(ctx context.Context, broadcast *model.Broadcast) error {
+	if broadcast.Status != model.BroadcastStatusDraft {
+		return ErrBroadcastNotEditable
+	}
+	replaceVariants := broadcast.Variants != nil
+	if !replaceVariants {
+		variants, err := s.repository.Broadcast.FindVariants(ctx, broadcast.Id)
+		if err != nil {
+			return err
+		}
+		broadcast.Variants = variants
+	}
+	err := s.validate(ctx, broadcast)
+	if err != nil {
+		return err
+	}
+
+	return s.Transact(ctx, func(ctx context.Context, service *Service) error {
+		err := service.repository.Broadcast.Update(ctx, broadcast)
+		if err != nil || !replaceVariants {
+			return err
+		}
+		err = service.repository.Broadcast.DeleteVariants(ctx, broadcast.Id)
+		if err != nil {
+			return err
+		}
+
+		return saveVariants(ctx, service, broadcast)
+	})
+}
+
+func (s *broadcastService) Delete(ctx context.Context, broadcast *model.Broadcast) error {
+	if broadcast.Status != model.BroadcastStatusDraft {
+		return ErrBroadcastNotEditable
+	}
+
+	return s.Transact(ctx, func(ctx context.Context, service *Service) error {
+		err := service.repository.Broadcast.DeleteVariants(ctx, broadcast.Id)
+		if err != nil {
+			return err
+		}
+
+		return service.repository.Broadcast.Delete(ctx, broadcast.Id)
+	})
+}
+
+// Start schedules the broadcast when it has a scheduled time in the future,
+// otherwise it starts sending the broadcast right away. A broadcast with a
+// local send time starts right away and waits for the local time of every
+// contact on the scheduled day, or today when it is not scheduled. Contacts
+// whose local time had passed get it the next day
+func (s *broadcastService) Start(ctx context.Context, broadcast *model.Broadcast) error {
+	if broadcast.Status != model.BroadcastStatusDraft {
+		return ErrBroadcastNotEditable
+	}
+	if broadcast.LocalSendTime != "" {
+		if broadcast.ScheduledAt == nil {
+			now := time.Now().UTC()
+			broadcast.ScheduledAt = &now
+			err := s.repository.Broadcast.Update(ctx, broadcast)
+			if err != nil {
+				return err
+			}
+		}
+
+		return s.launch(ctx, broadcast, model.BroadcastStatusDraft)
+	}
+	if broadcast.ScheduledAt != nil && broadcast.ScheduledAt.After(time.Now()) {
+		ok, err := s.repository.Broadcast.UpdateStatus(
+			ctx,
+			broadcast.Id,
+			model.BroadcastStatusDraft,
+			model.BroadcastStatusScheduled,
+		)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrBroadcastNotEditable
+		}
+		broadcast.Status = model.BroadcastStatusScheduled
+
+		return nil
+	}
+
+	return s.launch(ctx, broadcast, model.BroadcastStatusDraft)
+}
+
+// Pause stops a running broadcast after the email being sent, the broadcast
+// continues from the next contact when it is resumed
+func (s *broadcastService) Pause(ctx context.Context, broadcast *model.Broadcast) error {
+	err := s.updateStatus(ctx, broadcast, model.BroadcastStatusRunning, model.BroadcastStatusPaused)
+	if err != nil {
+		return err
+	}
+	s.stop(broadcast.Id)
+
+	return nil
+}
+
+func (s *broadcastService) Resume(ctx context.Context, broadcast *model.Broadcast) error {
+	err := s.updateStatus(ctx, broadcast, model.BroadcastStatusPaused, model.BroadcastStatusRunning)
+	if err != nil {
+		return err
+	}
+	s.spawn(ctx, broadcast)
+
+	return nil
+}
+
+func (s *broadcastService) Cancel(ctx context.Context, broadcast *model.Broadcast) error {
+	switch broadcast.Status {
+	case model.BroadcastStatusDraft,
+		model.BroadcastStatusScheduled,
+		model.BroadcastStatusRunning,
+		model.BroadcastStatusPaused:
+	default:
+		return ErrBroadcastStatus
+	}
+	err := s.updateStatus(ctx, broadcast, broadcast.Status, model.BroadcastStatusCanceled)
+	if err != nil {
+		return err
+	}
+	s.stop(broadcast.Id)
+
+	return nil
+}
+
+// StartScheduler takes over the running broadcasts no replica is sending,
+// e.g. when the server stopped, and starts the scheduled broadcasts when they
+// are due
+func (s *broadcastService) StartScheduler(ctx context.Context) {
+	s.takeOver(ctx)
+	ticker := time.NewTicker(time.Duration(s.config.Broadcast.SchedulerIntervalInSeconds) * time.Second)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				s.takeOver(ctx)
+				broadcasts, err := s.repository.Broadcast.FindDue(ctx, now)
+				if err != nil {
+					s.logger.Error().Err(err).Msg("failed to find scheduled broadcasts")
+					continue
+				}
+				for _, broadcast := range broadcasts {
+					err = s.launch(ctx, broadcast, model.BroadcastStatusScheduled)
+					if err != nil {
+						s.logger.Error().Err(err).Str("broadcastId", broadcast.Id.String()).Msg("failed to start broadcast")
+					}
+				}
+			}
+		}
+	}()
+}
+
+// takeOver runs the running broadcasts whose lease expired, the replicas race
+// for the lease and only one of them sends
+func (s *broadcastService) takeOver(ctx context.Context) {
+	broadcasts, err := s.repository.Broadcast.FindUnleased(ctx)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to find running broadcasts")
+		return
+	}
+	for _, broadcast := range broadcasts {
+		s.spawn(ctx, broadcast)
+	}
+}
+
+// StartListeners keeps the broadcast stats up to date from the email events
+func (s *broadcastService) StartListeners(ctx context.Context) {
+	s.eventService.Subscribe(ctx, broadcastListenerId, s.handleEvent)
+}
+
+// launch moves the broadcast to RUNNING, records the number of recipients
+// and sends the broadcast in the background
+func (s *broadcastService) launch(ctx context.Context, broadcast *model.Broadcast, from model.BroadcastStatus) error {
+	segmentIds, err := broadcastSegmentIds(broadcast)
+	if err != nil {
+		return err
+	}
+	total, err := s.repository.Contact.CountSubscribedBySegments(ctx, broadcast.WorkspaceId, segmentIds)
+	if err != nil {
+		return err
+	}
+	if total == 0 {
+		return errors.New("broadcast has no subscribed recipients")
+	}
+	err = s.Transact(ctx, func(ctx context.Context, service *Service) error {
+		ok, err := service.repository.Broadcast.UpdateStatus(ctx, broadcast.Id, from, model.BroadcastStatusRunning)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrBroadcastNotEditable
+		}
+
+		err = service.repository.Broadcast.SaveStat(ctx, &model.BroadcastStat{
+			BroadcastId: broadcast.Id,
+			Total:       total,
+			WorkspaceId: broadcast.WorkspaceId,
+		})
+		if err != nil {
+			return err
+		}
+		variants, err := service.repository.Broadcast.FindVariants(ctx, broadcast.Id)
+		if err != nil {
+			return err
+		}
+		for _, variant := range variants {
+			err = service.repository.Broadcast.SaveStat(ctx, &model.BroadcastStat{
+				BroadcastId: broadcast.Id,
+				VariantId:   variant.Id,
+				WorkspaceId: broadcast.WorkspaceId,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	broadcast.Status = model.BroadcastStatusRunning
+	s.spawn(ctx, broadcast)
+
+	return nil
+}
+
+func (s *broadcastService) updateStatus(
+	ctx context.Context,
+	broadcast *model.Broadcast,
+	from model.BroadcastStatus,
+	to model.BroadcastStatus,
+) error {
+	if broadcast.Status != from {
+		return ErrBroadcastStatus
+	}
+	ok, err := s.repository.Broadcast.UpdateStatus(ctx, broadcast.Id, from, to)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrBroadcastStatus
+	}
+	broadcast.Status = to
+
+	return nil
+}
+
+// spawn runs the broadcast in the background, the run is detached from the
+// request context and only stops when the broadcast is paused or canceled.
+// A stopped run of the same broadcast is waited for so that two runs never
+// send at the same time, the lease keeps the runs of other replicas out
+func (s *broadcastService) spawn(ctx context.Context, broadcast *model.Broadcast) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	run := &broadcastRun{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	previous, ok := s.runs[broadcast.Id]
+	if ok && !previous.stopped {
+		s.mu.Unlock()
+		cancel()
+		return
+	}
+	s.runs[broadcast.Id] = run
+	s.mu.Unlock()
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			if s.runs[broadcast.Id] == run {
+				delete(s.runs, broadcast.Id)
+			}
+			s.mu.Unlock()
+			cancel()
+			close(run.done)
+		}()
+		if previous != nil {
+			<-previous.done
+		}
+		ok, err := s.repository.Broadcast.ClaimLease(ctx, broadcast.Id, s.owner, s.leaseTTL())
+		if err != nil {
+			s.logger.Error().Err(err).Str("broadcastId", broadcast.Id.String()).Msg("failed to claim broadcast lease")
+			return
+		}
+		if !ok {
+			// another replica sends the broadcast, or it stopped running
+			return
+		}
+		defer func() {
+			err := s.repository.Broadcast.ReleaseLease(context.WithoutCancel(ctx), broadcast.Id, s.owner)
+			if err != nil {
+				s.logger.Error().Err(err).Str("broadcastId", broadcast.Id.String()).Msg("failed to release broadcast lease")
+			}
+		}()
+		go s.renewLease(ctx, cancel, broadcast.Id)
+		s.run(ctx, broadcast.Id)
+	}()
+}
+
+// renewLease keeps the lease of the run while it waits between batches, the
+// run is stopped once the lease is lost, e.g. when the broadcast was paused
+// or canceled on another replica
+func (s *broadcastService) renewLease(ctx context.Context, cancel context.CancelFunc, broadcastId uid.UID) {
+	ttl := s.leaseTTL()
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	renewedAt := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			ok, err := s.repository.Broadcast.ClaimLease(ctx, broadcastId, s.owner, ttl)
+			if err != nil {
+				s.logger.Error().Err(err).Str("broadcastId", broadcastId.String()).Msg("failed to renew broadcast lease")
+				if now.Sub(renewedAt) < ttl {
+					continue
+				}
+			}
+			if !ok {
+				cancel()
+				return
+			}
+			renewedAt = now
+		}
+	}
+}
+
+func (s *broadcastService) leaseTTL() time.Duration {
+	return time.Duration(s.config.Broadcast.LeaseInSeconds) * time.Second
+}
+
+func (s *broadcastService) stop(broadcastId uid.UID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[broadcastId]
+	if ok {
+		run.stopped = true
+		run.cancel()
+	}
+}
+
+// run sends the broadcast to the subscribed contacts of its segments in
+// contact order. The last contact is recorded after every email so a paused
+// or interrupted broadcast continues from the next contact, contacts which
+// already have an email for the broadcast are skipped.
+//
+// An A/B tested broadcast is sent in two passes, the first pass sends the
+// variants to the test audience and the second pass sends the winning
+// variant to the remainder once the test window is over.
+//
+// A broadcast with a local send time is sent to the contacts of one time zone
+// after the other, it waits for the local send time of each time zone
+func (s *broadcastService) run(ctx context.Context, broadcastId uid.UID) {
+	logger := s.logger.With().Str("broadcastId", broadcastId.String()).Logger()
+	// emails in flight are always completed, even when the run is stopped
+	sendCtx := context.WithoutCancel(ctx)
+	broadcast, err := s.repository.Broadcast.FindById(ctx, broadcastId)
+	if err != nil || broadcast == nil {
+		logger.Error().Err(err).Msg("failed to find broadcast")
+		return
+	}
+	segmentIds, err := broadcastSegmentIds(broadcast)
+	if err != nil {
+		logger.Error().Err(err).Msg("invalid broadcast segments")
+		return
+	}
+	variants, err := s.repository.Broadcast.FindVariants(ctx, broadcast.Id)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to find broadcast variants")
+		return
+	}
+	testing := len(variants) > 0 && broadcast.TestEndsAt == nil
+	var winner *model.BroadcastVariant
+	if len(variants) > 0 && !testing {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(*broadcast.TestEndsAt)):
+		}
+		winner, err = s.pickWinner(ctx, broadcast, variants)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to pick broadcast winner")
+			return
+		}
+	}
+	var schedule *sendSchedule
+	if broadcast.LocalSendTime != "" {
+		schedule, err = s.newSendSchedule(broadcast)
+		if err != nil {
+			logger.Error().Err(err).Msg("invalid broadcast local send time")
+			return
+		}
+	}
+	templates := make(map[uid.UID]*model.Template)
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if broadcast.SendRate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(broadcast.SendRate), 1)
+	}
+	afterId := broadcast.LastContactId
+	if schedule != nil {
+		// the contacts of every time zone are paged from the first one
+		afterId = uid.UID{}
+	}
+	var retryAt *time.Time
+	retries := 0
+	for ctx.Err() == nil {
+		if retryAt != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(*retryAt)):
+			}
+			retryAt = nil
+		}
+		// the broadcast may have been paused or canceled on another replica
+		ok, err := s.repository.Broadcast.ClaimLease(ctx, broadcast.Id, s.owner, s.leaseTTL())
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to renew broadcast lease")
+			return
+		}
+		if !ok {
+			return
+		}
+		var contacts []*model.Contact
+		if schedule != nil {
+			contacts, err = s.scheduledContacts(ctx, broadcast, segmentIds, schedule, &afterId)
+		} else {
+			contacts, err = s.repository.Contact.FindSubscribedBySegments(
+				ctx,
+				broadcast.WorkspaceId,
+				segmentIds,
+				afterId,
+				s.config.Broadcast.BatchSize,
+			)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error().Err(err).Msg("failed to find broadcast recipients")
+			}
+			return
+		}
+		if len(contacts) == 0 {
+			break
+		}
+		emails, err := s.contactEmails(ctx, broadcast, contacts)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to find sent broadcast emails")
+			return
+		}
+		for _, contact := range contacts {
+			variant := winner
+			if testing {
+				variant = testVariant(broadcast, variants, contact)
+			}
+			email := emails[contact.Id.String()]
+			if (email != nil && isEmailSent(email)) || (testing && variant == nil) {
+				afterId = contact.Id
+				continue
+			}
+			err = limiter.Wait(ctx)
+			if err != nil {
+				// the run was stopped
+				return
+			}
+			if email != nil {
+				err = s.redeliver(sendCtx, email, variant)
+			} else {
+				err = s.send(sendCtx, broadcast, variant, contact, templates)
+			}
+			// afterId stays before the contact so the next page sends to it again
+			if err != nil && isRetryableSendError(err) && retries < broadcastSendRetries {
+				retries++
+				logger.Warn().Err(err).Str("contactId", contact.Id.String()).Int("retries", retries).Msg("failed to send broadcast email, retrying")
+				next := time.Now().Add(constant.RetrySchedule[retries])
+				retryAt = &next
+				break
+			}
+			retries = 0
+			if err != nil {
+				logger.Error().Err(err).Str("contactId", contact.Id.String()).Msg("failed to send broadcast email")
+			}
+			afterId = contact.Id
+			err = s.repository.Broadcast.UpdateLastContactId(sendCtx, broadcast.Id, afterId)
+			if err != nil {
+				logger.Error().Err(err).Msg("failed to update broadcast progress")
+				return
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if testing {
+		testEndsAt := time.Now().Add(time.Duration(broadcast.TestWindowInMinutes) * time.Minute)
+		err = s.repository.Broadcast.StartTestWindow(ctx, broadcast.Id, testEndsAt)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to start broadcast test window")
+			return
+		}
+		s.run(ctx, broadcast.Id)
+		return
+	}
+	_, err = s.repository.Broadcast.UpdateStatus(ctx, broadcast.Id, model.BroadcastStatusRunning, model.BroadcastStatusCompleted)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to complete broadcast")
+	}
+}
+
+// scheduledContacts returns the next page of the contacts of the first time
+// zone whose local send time has come, it waits for the send time. The time
+// zones are paged in the order of their send time, afterId starts over with
+// every time zone. No contacts are returned once every time zone is sent to
+func (s *broadcastService) scheduledContacts(
+	ctx context.Context,
+	broadcast *model.Broadcast,
+	segmentIds []int64,
+	schedule *sendSchedule,
+	afterId *uid.UID,
+) ([]*model.Contact, error) {
+	for {
+		if len(schedule.pending) == 0 {
+			// contacts may have moved to a time zone which wasn't there
+			timeZones, err := s.repository.Contact.FindSubscribedTimeZones(ctx, broadcast.WorkspaceId, segmentIds)
+			if err != nil {
+				return nil, err
+			}
+			schedule.add(timeZones)
+			if len(schedule.pending) == 0 {
+				return nil, nil
+			}
+		}
+		timeZone := schedule.pending[0]
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Until(schedule.releaseAt(timeZone))):
+		}
+		contacts, err := s.repository.Contact.FindSubscribedByTimeZone(
+			ctx,
+			broadcast.WorkspaceId,
+			segmentIds,
+			timeZone,
+			*afterId,
+			s.config.Broadcast.BatchSize,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if len(contacts) > 0 {
+			return contacts, nil
+		}
+		schedule.done[timeZone] = true
+		schedule.pending = schedule.pending[1:]
+		*afterId = uid.UID{}
+	}
+}
+
+// send renders and sends the broadcast, or its variant, to the contact
+func (s *broadcastService) send(
+	ctx context.Context,
+	broadcast *model.Broadcast,
+	variant *model.BroadcastVariant,
+	contact *model.Contact,
+	templates map[uid.UID]*model.Template,
+) error {
+	templateId := broadcast.TemplateId
+	if variant != nil && variant.TemplateId != nil {
+		templateId = *variant.TemplateId
+	}
+	template, ok := templates[templateId]
+	if !ok {
+		var err error
+		template, err = s.repository.Template.FindById(ctx, templateId)
+		if err != nil {
+			return err
+		}
+		if template == nil {
+			return fmt.Errorf("%w: template not found", ErrBroadcastEmailInvalid)
+		}
+		templates[templateId] = template
+	}
+	email, err := s.buildEmail(broadcast, variant, template, contact)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBroadcastEmailInvalid, err)
+	}
+	_, err = s.emailService.Send(ctx, broadcast.Id.String(), []*model.Email{email})
+	if errors.Is(err, model.ErrEmailExists) {
+		// another run sent to the contact since the batch was read
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.incrementVariantTotal(ctx, variant)
+
+	return nil
+}
+
+// incrementVariantTotal counts an email sent with the variant, the email is
+// sent already so a failure is only logged
+func (s *broadcastService) incrementVariantTotal(ctx context.Context, variant *model.BroadcastVariant) {
+	if variant == nil {
+		return
+	}
+	err := s.repository.Broadcast.IncrementVariantStat(ctx, variant.Id, model.BroadcastStatTotal, 1)
+	if err != nil {
+		s.logger.Error().Err(err).Str("variantId", variant.Id.String()).Msg("failed to update broadcast variant stat")
+	}
+}
+
+// isRetryableSendError reports whether sending to the contact may succeed
+// later, an email which can't be built or sent from the address of the
+// broadcast fails the same way again
+func isRetryableSendError(err error) bool {
+	return !errors.Is(err, ErrBroadcastEmailInvalid) &&
+		!errors.Is(err, ErrNoDefaultSender) &&
+		!errors.Is(err, ErrSenderNotAllowed)
+}
+
+// pickWinner returns the variant with the best open or click rate, the
+// winner is only picked once and kept for the rest of the broadcast
+func (s *broadcastService) pickWinner(
+	ctx context.Context,
+	broadcast *model.Broadcast,
+	variants []*model.BroadcastVariant,
+) (*model.BroadcastVariant, error) {
+	for _, variant := range variants {
+		if variant.IsWinner {
+			return variant, nil
+		}
+	}
+	stats, err := s.repository.Broadcast.FindVariantStats(ctx, broadcast.Id)
+	if err != nil {
+		return nil, err
+	}
+	winner := variants[0]
+	best := -1.0
+	for _, variant := range variants {
+		for _, stat := range stats {
+			if stat.VariantId != variant.Id {
+				continue
+			}
+			rate := variantRate(broadcast.WinnerMetric, stat)
+			if rate > best {
+				winner = variant
+				best = rate
+			}
+		}
+	}
+	err = s.repository.Broadcast.UpdateVariantWinner(ctx, winner.Id)
+	if err != nil {
+		return nil, err
+	}
+	winner.IsWinner = true
+
+	return winner, nil
+}
+
+// redeliver sends the saved email of the contact which wasn't sent, the run
+// stopped between saving and sending it or SES didn't accept it
+func (s *broadcastService) redeliver(ctx context.Context, email *model.Email, variant *model.BroadcastVariant) error {
+	email, err := s.repository.Email.FindById(ctx, email.Id)
+	if err != nil {
+		return err
+	}
+	if email == nil {
+		return errors.New("email not found")
+	}
+	err = s.emailService.Deliver(ctx, []*model.Email{email})
+	if err != nil {
+		return err
+	}
+	s.incrementVariantTotal(ctx, variant)
+
+	return nil
+}
+
+// contactEmails returns the emails of the broadcast by contact id
+func (s *broadcastService) contactEmails(
+	ctx context.Context,
+	broadcast *model.Broadcast,
+	contacts []*model.Contact,
+) (map[string]*model.Email, error) {
+	contactIds := make([]string, 0, len(contacts))
+	for _, contact := range contacts {
+		contactIds = append(contactIds, contact.Id.String())
+	}
+	emails, err := s.repository.Email.FindByRequestIdAndContactIds(ctx, broadcast.Id.String(), contactIds)
+	if err != nil {
+		return nil, err
+	}
+	contactEmails := make(map[string]*model.Email, len(emails))
+	for _, email := range emails {
+		contactId, _ := email.MetaData["contactId"].(string)
+		// a sent email wins over another attempt
+		if existing, ok := contactEmails[contactId]; ok && isEmailSent(existing) {
+			continue
+		}
+		contactEmails[contactId] = email
+	}
+
+	return contactEmails, nil
+}
+
+// isEmailSent reports whether SES accepted the email or rejected it, a pending
+// email without a message id, e.g. throttled by SES, is delivered again
+func isEmailSent(email *model.Email) bool {
+	return email.MessageId != "" || email.Status != string(model.EmailStatusPending)
+}
+
+func (s *broadcastService) buildEmail(
+	broadcast *model.Broadcast,
+	variant *model.BroadcastVariant,
+	template *model.Template,
+	contact *model.Contact,
+) (*model.Email, error) {
+	from := broadcast.From
+	metaData := model.JSONBMap{
+		"broadcastId": broadcast.Id.String(),
+		"contactId":   contact.Id.String(),
+	}
+	if variant != nil {
+		metaData["variantId"] = variant.Id.String()
+		if variant.Subject != nil {
+			variantTemplate := *template
+			variantTemplate.Subject = *variant.Subject
+			template = &variantTemplate
+		}
+		if variant.FromName != nil {
+			address, err := mail.ParseAddress(broadcast.From)
+			if err != nil {
+				return nil, err
+			}
+			address.Name = *variant.FromName
+			from = address.String()
+		}
+	}
+	emailContent, err := s.templateService.Render(template, ContactTemplateData(contact))
+	if err != nil {
+		return nil, err
+	}
+	ccRecipients, err := ParseRecipients(broadcast.CCAddresses)
+	if err != nil {
+		return nil, err
+	}
+	bccRecipients, err := ParseRecipients(broadcast.BCCAddresses)
+	if err != nil {
+		return nil, err
+	}
+
+	broadcastId, contactId := broadcast.Id, contact.Id
+
+	return &model.Email{
+		From:    from,
+		ReplyTo: broadcast.ReplyTo,
+		Recipients: model.Recipients{{
+			Address: contact.Email,
+		}},
+		CCRecipients:   ccRecipients,
+		BCCRecipients:  bccRecipients,
+		EmailContent:   *emailContent,
+		OrganizationId: broadcast.OrganizationId,
+		WorkspaceId:    broadcast.WorkspaceId,
+		MetaData:       metaData,
+		BroadcastId:    &broadcastId,
+		ContactId:      &contactId,
+	}, nil
+}
+
+// handleEvent updates the stats of the broadcast the event belongs to, the
+// event is handled again when the broadcast stat fails to update. The event
+// is recorded with the counts so a delivered again event isn't counted twice
+func (s *broadcastService) handleEvent(ctx context.Context, event *model.Event) error {
+	switch {
+	case event.EventType == constant.EventTypeEmailReported,
+		event.EventType == constant.EventTypeEmailBounced && event.MetaData["bounceType"] == constant.AwsSESBounceTypePermanent:
+		err := s.repository.Contact.UpdateSuppressed(ctx, event.WorkspaceId, event.Receipients, true)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("failed to suppress contacts")
+		}
+	}
+	if !isCountedEvent(event) {
+		return nil
+	}
+
+	return s.Transact(ctx, func(ctx context.Context, service *Service) error {
+		ok, err := service.repository.Broadcast.SaveEvent(ctx, event.Id)
+		if err != nil || !ok {
+			return err
+		}
+		if event.EventType == constant.EventTypeEmailOpened {
+			err = service.recordOpenHour(ctx, event)
+			if err != nil {
+				return err
+			}
+		}
+
+		return service.countBroadcastEvent(ctx, event)
+	})
+}
+
+// isCountedEvent tells if the event changes the broadcast stats or the open
+// hours of the contact
+func isCountedEvent(event *model.Event) bool {
+	if _, ok := event.MetaData["contactId"].(string); ok && event.EventType == constant.EventTypeEmailOpened {
+		return true
+	}
+	_, ok := event.MetaData["broadcastId"].(string)
+	_, counted := broadcastStatCounters[event.EventType]
+
+	return ok && counted
+}
+
+// countBroadcastEvent increments the counter of the event in the stats of the
+// broadcast and its variant
+func (s *baseService) countBroadcastEvent(ctx context.Context, event *model.Event) error {
+	counter, ok := broadcastStatCounters[event.EventType]
+	if !ok {
+		return nil
+	}
+	broadcastId, ok := event.MetaData["broadcastId"].(string)
+	if !ok {
+		return nil
+	}
+	id, err := uid.NewUIDFromString(broadcastId)
+	if err != nil {
+		return nil
+	}
+	err = s.repository.Broadcast.IncrementStat(ctx, *id, counter, 1)
+	if err != nil {
+		return err
+	}
+	variantId, ok := event.MetaData["variantId"].(string)
+	if !ok {
+		return nil
+	}
+	id, err = uid.NewUIDFromString(variantId)
+	if err != nil {
+		return nil
+	}
+
+	return s.repository.Broadcast.IncrementVariantStat(ctx, *id, counter, 1)
+}
+
+// recordOpenHour counts the UTC hour the contact opened the email in, the
+// open hours are used to infer the timezone of the contact
+func (s *baseService) recordOpenHour(ctx context.Context, event *model.Event) error {
+	contactId, ok := event.MetaData["contactId"].(string)
+	if !ok {
+		return nil
+	}
+	id, err := uid.NewUIDFromString(contactId)
+	if err != nil {
+		return nil
+	}
+	err = s.repository.Contact.IncrementOpenHour(ctx, *id, eventOpenedAt(event).Hour())
+	if err != nil {
+		return err
+	}
+	contact, err := s.repository.Contact.FindById(ctx, *id)
+	if err != nil || contact == nil {
+		return err
+	}
+	timeZone := inferTimeZone(contact.OpenHours, s.config.Broadcast.TypicalOpenHour, s.config.Broadcast.MinOpensForTimeZone)
+	if timeZone == contact.OpenTimeZone {
+		return nil
+	}
+
+	return s.repository.Contact.UpdateOpenTimeZone(ctx, *id, timeZone)
+}
+
+func (s *broadcastService) validate(ctx context.Context, broadcast *model.Broadcast) error {
+	template, err := s.repository.Template.FindById(ctx, broadcast.TemplateId)
+	if err != nil {
+		return err
+	}
+	if template == nil || template.WorkspaceId != broadcast.WorkspaceId {
+		return errors.New("template not found")
+	}
+	segmentIds, err := broadcastSegmentIds(broadcast)
+	if err != nil {
+		return err
+	}
+	for _, segmentId := range segmentIds {
+		segment, err := s.repository.Segment.FindByID(ctx, *uid.NewUID(segmentId))
+		if err != nil {
+			return err
+		}
+		if segment == nil || segment.WorkspaceId != broadcast.WorkspaceId {
+			return errors.New("segment not found")
+		}
+	}
+
+	if broadcast.DelayTimeZone != "" {
+		_, err = time.LoadLocation(broadcast.DelayTimeZone)
+		if err != nil {
+			return errors.New("invalid time zone")
+		}
+	}
+	if broadcast.LocalSendTime != "" {
+		_, err = time.Parse(localSendTimeLayout, broadcast.LocalSendTime)
+		if err != nil {
+			return errors.New("local send time must be formatted as HH:MM")
+		}
+		if len(broadcast.Variants) > 0 {
+			return errors.New("a broadcast with a local send time can not have variants")
+		}
+	}
+
+	return s.validateVariants(ctx, broadcast)
+}
+
+// newSendSchedule returns the schedule of a broadcast with a local send
+// time, the day is the scheduled day in the time zone of the broadcast. The
+// scheduled time is kept when the broadcast starts, so a restart doesn't move
+// a time zone to the next day
+func (s *broadcastService) newSendSchedule(broadcast *model.Broadcast) (*sendSchedule, error) {
+	sendTime, err := time.Parse(localSendTimeLayout, broadcast.LocalSendTime)
+	if err != nil {
+		return nil, err
+	}
+	fallback, err := time.LoadLocation(broadcast.DelayTimeZone)
+	if err != nil {
+		return nil, err
+	}
+	day := time.Now()
+	if broadcast.ScheduledAt != nil {
+		day = *broadcast.ScheduledAt
+	}
+	year, month, date := day.In(fallback).Date()
+
+	return &sendSchedule{
+		year:     year,
+		month:    month,
+		day:      date,
+		hour:     sendTime.Hour(),
+		minute:   sendTime.Minute(),
+		fallback: fallback,
+		from:     day,
+		done:     make(map[string]bool),
+	}, nil
+}
+
+func (s *broadcastService) validateVariants(ctx context.Context, broadcast *model.Broadcast) error {
+	if len(broadcast.Variants) == 0 {
+		broadcast.TestPercentage = 0
+		return nil
+	}
+	if len(broadcast.Variants) < broadcastMinVariants || len(broadcast.Variants) > broadcastMaxVariants {
+		return fmt.Errorf("a broadcast needs %d to %d variants", broadcastMinVariants, broadcastMaxVariants)
+	}
+	if broadcast.TestPercentage < 1 || broadcast.TestPercentage > 99 {
+		return errors.New("test percentage must be between 1 and 99")
+	}
+	if broadcast.TestWindowInMinutes < 1 {
+		return errors.New("test window must be at least a minute")
+	}
+	switch broadcast.WinnerMetric {
+	case "":
+		broadcast.WinnerMetric = model.BroadcastWinnerMetricOpenRate
+	case model.BroadcastWinnerMetricOpenRate, model.BroadcastWinnerMetricClickRate:
+	default:
+		return errors.New("invalid winner metric")
+	}
+	for _, variant := range broadcast.Variants {
+		if variant.Subject == nil && variant.TemplateId == nil && variant.FromName == nil {
+			return fmt.Errorf("variant %s must change the subject, template or from name", variant.Name)
+		}
+		if variant.TemplateId == nil {
+			continue
+		}
+		template, err := s.repository.Template.FindById(ctx, *variant.TemplateId)
+		if err != nil {
+			return err
+		}
+		if template == nil || template.WorkspaceId != broadcast.WorkspaceId {
+			return errors.New("template not found")
+		}
+	}
+
+	return nil
+}
+
+func broadcastSegmentIds(broadcast *model.Broadcast) ([]int64, error) {
+	segmentIds := make([]int64, 0, len(broadcast.Segments))
+	for _, segment := range broadcast.Segments {
+		segmentId, err := uid.NewUIDFromString(segment)
+		if err != nil {
+			return nil, err
+		}
+		segmentIds = append(segmentIds, segmentId.ID())
+	}
+
+	return segmentIds, nil
+}
+
+func saveVariants(ctx context.Context, service *Service, broadcast *model.Broadcast) error {
+	for _, variant := range broadcast.Variants {
+		variant.Id = *service.uidGenerator.Next()
+		variant.BroadcastId = broadcast.Id
+		variant.IsWinner = false
+		variant.WorkspaceId = broadcast.WorkspaceId
+		err := service.repository.Broadcast.SaveVariant(ctx, variant)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// testVariant returns the variant the contact receives during the test, the
+// contact is not part of the test audience when no variant is returned. The
+// split is derived from the contact id so it stays the same across restarts
+func testVariant(
+	broadcast *model.Broadcast,
+	variants []*model.BroadcastVariant,
+	contact *model.Contact,
+) *model.BroadcastVariant {
+	hash := fnv.New32a()
+	hash.Write([]byte(broadcast.Id.String() + contact.Id.String()))
+	sum := hash.Sum32()
+	if int(sum%100) >= broadcast.TestPercentage {
+		return nil
+	}
+
+	return variants[int(sum/100)%len(variants)]
+}
+
+func variantRate(metric model.BroadcastWinnerMetric, stat *model.BroadcastStat) float64 {
+	if stat.Total == 0 {
+		return 0
+	}
+	if metric == model.BroadcastWinnerMetricClickRate {
+		return float64(stat.Clicked) / float64(stat.Total)
+	}
+
+	return float64(stat.Opened) / float64(stat.Total)
+}
+
+// eventOpenedAt returns when SES saw the open, the notification can arrive
+// much later than the open. Events without the timestamp use their own time
+func eventOpenedAt(event *model.Event) time.Time {
+	timestamp, _ := event.MetaData["timestamp"].(string)
+	openedAt, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err == nil {
+		return openedAt.UTC()
+	}
+	if event.Id.ID() != 0 {
+		return event.Id.Timestamp().UTC()
+	}
+
+	return time.Now().UTC()
+}
+
+// sendSchedule releases a broadcast at the same local time in the time zone
+// of every contact
+type sendSchedule struct {
+	year     int
+	month    time.Month
+	day      int
+	hour     int
+	minute   int
+	fallback *time.Location
+	from     time.Time       // Time zones whose send time is before it are sent to the next day
+	pending  []string        // Time zones to send to, in the order of their send time
+	done     map[string]bool // Time zones which were sent to
+}
+
+// add queues the time zones which weren't sent to
+func (schedule *sendSchedule) add(timeZones []string) {
+	for _, timeZone := range timeZones {
+		if !schedule.done[timeZone] && !slices.Contains(schedule.pending, timeZone) {
+			schedule.pending = append(schedule.pending, timeZone)
+		}
+	}
+	slices.SortStableFunc(schedule.pending, func(a, b string) int {
+		return schedule.releaseAt(a).Compare(schedule.releaseAt(b))
+	})
+}
+
+// releaseAt returns when the broadcast is sent to the contacts of the time
+// zone, time zones whose local time had passed when the broadcast was
+// scheduled are sent to at the same local time the next day
+func (schedule *sendSchedule) releaseAt(timeZone string) time.Time {
+	location := schedule.location(timeZone)
+	releaseAt := time.Date(
+		schedule.year,
+		schedule.month,
+		schedule.day,
+		schedule.hour,
+		schedule.minute,
+		0,
+		0,
+		location,
+	)
+	if releaseAt.Before(schedule.from) {
+		return time.Date(
+			schedule.year,
+			schedule.month,
+			schedule.day+1,
+			schedule.hour,
+			schedule.minute,
+			0,
+			0,
+			location,
+		)
+	}
+
+	return releaseAt
+}
+
+// location returns the time zone, contacts without a valid time zone get the
+// time zone of the broadcast
+func (schedule *sendSchedule) location(timeZone string) *time.Location {
+	if timeZone == "" {
+		return schedule.fallback
+	}
+	location, err := loadTimeZone(timeZone)
+	if err != nil {
+		return schedule.fallback
+	}
+
+	return location
+}
+
+// inferTimeZone returns the fixed time zone, e.g. UTC+2, of the hours the
+// contact opens emails in. Contacts with too few opens have no time zone
+func inferTimeZone(openHours model.JSONBMap, typicalOpenHour int, minOpens int) string {
+	peakHour, peakOpens, opens := 0, 0.0, 0.0
+	for key, value := range openHours {
+		hour, err := strconv.Atoi(key)
+		count, ok := value.(float64)
+		if err != nil || !ok {
+			continue
+		}
+		opens += count
+		if count > peakOpens || (count == peakOpens && hour < peakHour) {
+			peakHour = hour
+			peakOpens = count
+		}
+	}
+	if opens == 0 || opens < float64(minOpens) {
+		return ""
+	}
+	// contacts are assumed to open most emails at the typical open hour
+	offset := typicalOpenHour - peakHour
+	if offset < -12 {
+		offset += 24
+	}
+	if offset > 14 {
+		offset -= 24
+	}
+
+	return fmt.Sprintf("UTC%+d", offset)
+}
+
+// loadTimeZone loads an IANA time zone or a fixed one of inferTimeZone
+func loadTimeZone(name string) (*time.Location, error) {
+	if offset, ok := strings.CutPrefix(name, "UTC"); ok && offset != "" {
+		hours, err := strconv.Atoi(offset)
+		if err != nil || hours < -12 || hours > 14 {
+			return nil, fmt.Errorf("invalid time zone %s", name)
+		}
+		return time.FixedZone(name, hours*60*60), nil
+	}
+
+	return time.LoadLocation(name)
+}
@@ -0,0 +1,528 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+func (r *fakeEmailRepository) FindByRequestIdAndContactIds(_ context.Context, requestId string, contactIds []string) ([]*model.Email, error) {
+	emails := []*model.Email{}
+	for _, email := range r.emails {
+		contactId, _ := email.MetaData["contactId"].(string)
+		if email.RequestId == requestId && slices.Contains(contactIds, contactId) {
+			emails = append(emails, email)
+		}
+	}
+
+	return emails, nil
+}
+
+func TestContactEmailsRedeliversPendingEmails(t *testing.T) {
+	broadcast := &model.Broadcast{Base: model.Base{Id: *uid.NewUID(1)}}
+	contacts := []*model.Contact{
+		{Base: model.Base{Id: *uid.NewUID(10)}},
+		{Base: model.Base{Id: *uid.NewUID(11)}},
+		{Base: model.Base{Id: *uid.NewUID(12)}},
+		{Base: model.Base{Id: *uid.NewUID(13)}},
+		{Base: model.Base{Id: *uid.NewUID(14)}},
+	}
+	email := func(contact *model.Contact, messageId string, status model.EmailStatus) *model.Email {
+		return &model.Email{
+			MessageId: messageId,
+			Status:    string(status),
+			RequestId: broadcast.Id.String(),
+			MetaData:  model.JSONBMap{"contactId": contact.Id.String()},
+		}
+	}
+	repository := &model.Repository{
+		Email: &fakeEmailRepository{
+			emails: []*model.Email{
+				email(contacts[0], "0100018f-sent", model.EmailStatusPending),
+				email(contacts[1], "", model.EmailStatusPending),
+				email(contacts[2], "", model.EmailStatusFailed),
+				email(contacts[3], "0100018f-delivered", model.EmailStatusDelivered),
+				email(contacts[3], "", model.EmailStatusPending),
+			},
+		},
+	}
+	service := &broadcastService{baseService: newTestBaseService(repository)}
+
+	emails, err := service.contactEmails(context.Background(), broadcast, contacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		contact *model.Contact
+		exists  bool
+		sent    bool
+	}{
+		{name: "accepted by SES", contact: contacts[0], exists: true, sent: true},
+		{name: "saved but not sent", contact: contacts[1], exists: true},
+		{name: "failed", contact: contacts[2], exists: true, sent: true},
+		{name: "sent and saved again", contact: contacts[3], exists: true, sent: true},
+		{name: "without an email", contact: contacts[4]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			email, ok := emails[test.contact.Id.String()]
+			if ok != test.exists {
+				t.Fatalf("expected an email %v, got %v", test.exists, ok)
+			}
+			if ok && isEmailSent(email) != test.sent {
+				t.Fatalf("expected sent %v, got %v", test.sent, isEmailSent(email))
+			}
+		})
+	}
+}
+
+func TestIsRetryableSendError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"transient", errors.New("connection reset"), true},
+		{"invalid email", fmt.Errorf("%w: template not found", ErrBroadcastEmailInvalid), false},
+		{"no default sender", ErrNoDefaultSender, false},
+		{"sender not allowed", fmt.Errorf("send: %w", ErrSenderNotAllowed), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableSendError(tt.err); got != tt.want {
+				t.Errorf("isRetryableSendError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventOpenedAt(t *testing.T) {
+	event := &model.Event{
+		Base:     model.Base{Id: *uid.NewUID(1)},
+		MetaData: model.EventMetaData{"timestamp": "2024-08-09T22:00:19.652Z"},
+	}
+	want := time.Date(2024, 8, 9, 22, 0, 19, 652000000, time.UTC)
+	if got := eventOpenedAt(event); !got.Equal(want) {
+		t.Fatalf("expected the open timestamp %s, got %s", want, got)
+	}
+
+	event.MetaData = model.EventMetaData{}
+	if got := eventOpenedAt(event); !got.Equal(event.Id.Timestamp().UTC()) {
+		t.Fatalf("expected the event time %s, got %s", event.Id.Timestamp(), got)
+	}
+}
+
+type fakeContactRepository struct {
+	model.ContactRepository
+	contacts []*model.Contact
+}
+
+func (r *fakeContactRepository) timeZone(contact *model.Contact) string {
+	if timeZone, _ := contact.Attributes["timezone"].(string); timeZone != "" {
+		return timeZone
+	}
+
+	return contact.OpenTimeZone
+}
+
+func (r *fakeContactRepository) FindSubscribedTimeZones(_ context.Context, _ uid.UID, _ []int64) ([]string, error) {
+	timeZones := []string{}
+	for _, contact := range r.contacts {
+		if !slices.Contains(timeZones, r.timeZone(contact)) {
+			timeZones = append(timeZones, r.timeZone(contact))
+		}
+	}
+
+	return timeZones, nil
+}
+
+func (r *fakeContactRepository) FindSubscribedByTimeZone(
+	_ context.Context,
+	_ uid.UID,
+	_ []int64,
+	timeZone string,
+	afterId uid.UID,
+	limit int,
+) ([]*model.Contact, error) {
+	contacts := []*model.Contact{}
+	for _, contact := range r.contacts {
+		if r.timeZone(contact) == timeZone && contact.Id.ID() > afterId.ID() && len(contacts) < limit {
+			contacts = append(contacts, contact)
+		}
+	}
+
+	return contacts, nil
+}
+
+func TestScheduledContactsPagesTimeZonesInSendOrder(t *testing.T) {
+	contact := func(id int64, attributeTimeZone string, openTimeZone string) *model.Contact {
+		return &model.Contact{
+			Base:         model.Base{Id: *uid.NewUID(id)},
+			Attributes:   model.JSONBMap{"timezone": attributeTimeZone},
+			OpenTimeZone: openTimeZone,
+		}
+	}
+	contacts := &fakeContactRepository{contacts: []*model.Contact{
+		contact(1, "America/New_York", ""),
+		contact(2, "", ""),
+		contact(3, "Asia/Tokyo", ""),
+		contact(4, "", "UTC+9"),
+		contact(5, "America/New_York", "UTC+1"),
+		contact(6, "Asia/Tokyo", ""),
+		contact(7, "Asia/Tokyo", ""),
+	}}
+	service := &broadcastService{baseService: newTestBaseService(&model.Repository{Contact: contacts})}
+	service.config.Broadcast.BatchSize = 2
+	// scheduled before the send time of every time zone, which has passed now
+	schedule := &sendSchedule{
+		year:     2024,
+		month:    time.January,
+		day:      1,
+		hour:     9,
+		fallback: time.UTC,
+		from:     time.Date(2023, time.December, 31, 12, 0, 0, 0, time.UTC),
+		done:     make(map[string]bool),
+	}
+
+	sent := []int64{}
+	afterId := uid.UID{}
+	for {
+		page, err := service.scheduledContacts(context.Background(), &model.Broadcast{}, nil, schedule, &afterId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, contact := range page {
+			sent = append(sent, contact.Id.ID())
+		}
+		afterId = page[len(page)-1].Id
+	}
+	// Tokyo and UTC+9 share the send time, then UTC and New York
+	want := []int64{3, 6, 7, 4, 2, 1, 5}
+	if !slices.Equal(sent, want) {
+		t.Fatalf("expected contacts %v, got %v", want, sent)
+	}
+}
+
+func TestReleaseAtMovesPassedTimeZonesToTheNextDay(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	newYork, _ := time.LoadLocation("America/New_York")
+	// 09:00 has passed in Tokyo when the broadcast is scheduled
+	schedule := &sendSchedule{
+		year:     2024,
+		month:    time.January,
+		day:      1,
+		hour:     9,
+		fallback: time.UTC,
+		from:     time.Date(2024, time.January, 1, 5, 0, 0, 0, time.UTC),
+		done:     make(map[string]bool),
+	}
+
+	tests := []struct {
+		timeZone string
+		want     time.Time
+	}{
+		{"", time.Date(2024, time.January, 1, 9, 0, 0, 0, time.UTC)},
+		{"America/New_York", time.Date(2024, time.January, 1, 9, 0, 0, 0, newYork)},
+		{"Asia/Tokyo", time.Date(2024, time.January, 2, 9, 0, 0, 0, tokyo)},
+	}
+	for _, tt := range tests {
+		if got := schedule.releaseAt(tt.timeZone); !got.Equal(tt.want) {
+			t.Fatalf("expected %q to be released at %s, got %s", tt.timeZone, tt.want, got)
+		}
+	}
+	// Tokyo is sent to last
+	schedule.add([]string{"Asia/Tokyo", "America/New_York", ""})
+	if want := []string{"", "America/New_York", "Asia/Tokyo"}; !slices.Equal(schedule.pending, want) {
+		t.Fatalf("expected time zones %v, got %v", want, schedule.pending)
+	}
+}
+
+func TestInferTimeZone(t *testing.T) {
+	tests := []struct {
+		name      string
+		openHours model.JSONBMap
+		want      string
+	}{
+		{"no opens", model.JSONBMap{}, ""},
+		{"too few opens", model.JSONBMap{"8": 2.0}, ""},
+		{"utc", model.JSONBMap{"10": 3.0, "22": 1.0}, "UTC+0"},
+		{"east", model.JSONBMap{"1": 4.0}, "UTC+9"},
+		{"west", model.JSONBMap{"15": 3.0}, "UTC-5"},
+		{"wraps around", model.JSONBMap{"23": 3.0}, "UTC+11"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inferTimeZone(tt.openHours, 10, 3); got != tt.want {
+				t.Fatalf("inferTimeZone() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTimeZone(t *testing.T) {
+	tests := []struct {
+		name    string
+		offset  int
+		wantErr bool
+	}{
+		{"UTC+9", 9 * 60 * 60, false},
+		{"UTC-5", -5 * 60 * 60, false},
+		{"UTC", 0, false},
+		{"UTC+15", 0, true},
+		{"UTCx", 0, true},
+		{"Not/AZone", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location, err := loadTimeZone(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadTimeZone() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if _, offset := time.Date(2024, time.January, 1, 0, 0, 0, 0, location).Zone(); offset != tt.offset {
+				t.Fatalf("expected offset %d, got %d", tt.offset, offset)
+			}
+		})
+	}
+}
+
+func TestIsCountedEvent(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType constant.EventType
+		metaData  model.EventMetaData
+		want      bool
+	}{
+		{"broadcast open", constant.EventTypeEmailOpened, model.EventMetaData{"broadcastId": "1", "contactId": "2"}, true},
+		{"opt-in open", constant.EventTypeEmailOpened, model.EventMetaData{"contactId": "2"}, true},
+		{"broadcast delivery", constant.EventTypeEmailDelivered, model.EventMetaData{"broadcastId": "1"}, true},
+		{"delivery", constant.EventTypeEmailDelivered, model.EventMetaData{}, false},
+		{"broadcast event without counter", constant.EventTypeEmailSendFailed, model.EventMetaData{"broadcastId": "1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &model.Event{EventType: tt.eventType, MetaData: tt.metaData}
+			if got := isCountedEvent(event); got != tt.want {
+				t.Fatalf("isCountedEvent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleEventCountsRedeliveredEventOnce(t *testing.T) {
+	repository := newTestRepository(t)
+	service := &broadcastService{baseService: newTestBaseService(repository)}
+	ctx := context.Background()
+	workspaceId := service.uidGenerator.Next()
+	broadcastId := service.uidGenerator.Next()
+	err := repository.Broadcast.SaveStat(ctx, &model.BroadcastStat{
+		Base:        model.Base{Id: *service.uidGenerator.Next()},
+		BroadcastId: *broadcastId,
+		WorkspaceId: *workspaceId,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	contact := &model.Contact{
+		Base:        model.Base{Id: *service.uidGenerator.Next()},
+		Email:       broadcastId.String() + "@example.com",
+		WorkspaceId: *workspaceId,
+	}
+	err = repository.Contact.Save(ctx, contact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := &model.Event{
+		Base:        model.Base{Id: *service.uidGenerator.Next()},
+		EventType:   constant.EventTypeEmailOpened,
+		WorkspaceId: *workspaceId,
+		MetaData: model.EventMetaData{
+			"broadcastId": broadcastId.String(),
+			"contactId":   contact.Id.String(),
+			"timestamp":   "2024-08-09T22:00:19.652Z",
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		err = service.handleEvent(ctx, event)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	stat, err := repository.Broadcast.FindStat(ctx, *broadcastId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Opened != 1 {
+		t.Fatalf("expected 1 open, got %d", stat.Opened)
+	}
+	contact, err = repository.Contact.FindById(ctx, contact.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opens, _ := contact.OpenHours["22"].(float64); opens != 1 {
+		t.Fatalf("expected 1 open at 22h, got %v", contact.OpenHours)
+	}
+}
+
+type fakeBroadcastRepository struct {
+	model.BroadcastRepository
+	leased atomic.Bool // ClaimLease succeeds
+	claims atomic.Int32
+}
+
+func (r *fakeBroadcastRepository) ClaimLease(_ context.Context, _ uid.UID, _ string, _ time.Duration) (bool, error) {
+	r.claims.Add(1)
+
+	return r.leased.Load(), nil
+}
+
+func TestRenewLeaseStopsRunWhenLeaseIsLost(t *testing.T) {
+	broadcasts := &fakeBroadcastRepository{}
+	broadcasts.leased.Store(true)
+	service := &broadcastService{baseService: newTestBaseService(&model.Repository{Broadcast: broadcasts})}
+	service.config.Broadcast.LeaseInSeconds = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		service.renewLease(ctx, cancel, *uid.NewUID(1))
+		close(done)
+	}()
+
+	time.Sleep(500 * time.Millisecond)
+	if ctx.Err() != nil || broadcasts.claims.Load() == 0 {
+		t.Fatalf("expected the lease to be renewed, renewed %d times", broadcasts.claims.Load())
+	}
+	// e.g. paused on another replica
+	broadcasts.leased.Store(false)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the run to stop")
+	}
+	if ctx.Err() == nil {
+		t.Fatal("expected the run context to be canceled")
+	}
+}
+
+func TestBroadcastLease(t *testing.T) {
+	repository := newTestRepository(t)
+	service := &broadcastService{baseService: newTestBaseService(repository)}
+	ctx := context.Background()
+	broadcast := &model.Broadcast{
+		Base:         model.Base{Id: *service.uidGenerator.Next()},
+		Status:       model.BroadcastStatusRunning,
+		Events:       model.JSONBArray{},
+		Segments:     model.JSONBArray{},
+		CCAddresses:  model.JSONBArray{},
+		BCCAddresses: model.JSONBArray{},
+		WorkspaceId:  *service.uidGenerator.Next(),
+	}
+	err := repository.Broadcast.Save(ctx, broadcast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claim := func(owner string) bool {
+		t.Helper()
+		ok, err := repository.Broadcast.ClaimLease(ctx, broadcast.Id, owner, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	unleased := func() bool {
+		t.Helper()
+		broadcasts, err := repository.Broadcast.FindUnleased(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return slices.ContainsFunc(broadcasts, func(b *model.Broadcast) bool { return b.Id == broadcast.Id })
+	}
+
+	if !unleased() {
+		t.Fatal("expected the new running broadcast to be unleased")
+	}
+	if !claim("a") {
+		t.Fatal("expected the first replica to claim the lease")
+	}
+	if claim("b") {
+		t.Fatal("expected another replica not to claim a held lease")
+	}
+	if !claim("a") {
+		t.Fatal("expected the owner to renew the lease")
+	}
+	if unleased() {
+		t.Fatal("expected the leased broadcast to be skipped")
+	}
+	err = repository.Broadcast.ReleaseLease(ctx, broadcast.Id, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claim("b") {
+		t.Fatal("expected a release of another owner to keep the lease")
+	}
+	err = repository.Broadcast.ReleaseLease(ctx, broadcast.Id, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claim("b") {
+		t.Fatal("expected a released lease to be claimed")
+	}
+	_, err = repository.Broadcast.UpdateStatus(ctx, broadcast.Id, model.BroadcastStatusRunning, model.BroadcastStatusPaused)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claim("b") {
+		t.Fatal("expected the lease of a paused broadcast not to be renewed")
+	}
+}
+
+func TestSaveBroadcastEmailOnce(t *testing.T) {
+	repository := newTestRepository(t)
+	service := &broadcastService{baseService: newTestBaseService(repository)}
+	ctx := context.Background()
+	broadcastId := service.uidGenerator.Next()
+	contactId := service.uidGenerator.Next()
+	workspaceId := service.uidGenerator.Next()
+	save := func() error {
+		id := service.uidGenerator.Next()
+		return repository.Email.Save(ctx, &model.Email{
+			Base:          model.Base{Id: *id},
+			From:          "hello@example.com",
+			Recipients:    model.Recipients{{Address: "contact@example.com"}},
+			CCRecipients:  model.Recipients{},
+			BCCRecipients: model.Recipients{},
+			Status:        string(model.EmailStatusPending),
+			RequestId:     broadcastId.String(),
+			MetaData:      model.JSONBMap{"contactId": contactId.String()},
+			EmailContent:  model.EmailContent{Base: model.Base{Id: *id}, EmailId: *id, WorkspaceId: *workspaceId},
+			WorkspaceId:   *workspaceId,
+			BroadcastId:   broadcastId,
+			ContactId:     contactId,
+		})
+	}
+
+	err := save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = save()
+	if !errors.Is(err, model.ErrEmailExists) {
+		t.Fatalf("expected model.ErrEmailExists, got %v", err)
+	}
+}
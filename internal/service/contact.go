@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/crypto"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type ContactService interface {
+	Create(ctx context.Context, contact *model.Contact, segmentIds []uid.UID) error
+	CreateSegment(ctx context.Context, segment *model.Segment) error
+	AddToSegment(ctx context.Context, contact *model.Contact, segment *model.Segment) (*model.SegmentContact, error)
+	Confirm(ctx context.Context, token string) (*model.Segment, error)
+}
+
+type contactService struct {
+	*baseService
+	jwt             *crypto.JWT
+	emailService    EmailService
+	eventService    EventSevice
+	templateService TemplateService
+}
+
+func NewContactService(
+	baseService *baseService,
+	emailService EmailService,
+	eventService EventSevice,
+	templateService TemplateService,
+) (ContactService, error) {
+	jwt, err := crypto.NewJWT(baseService.config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &contactService{
+		baseService:     baseService,
+		jwt:             jwt,
+		emailService:    emailService,
+		eventService:    eventService,
+		templateService: templateService,
+	}, nil
+}
+
+func (s *contactService) Create(ctx context.Context, contact *model.Contact, segmentIds []uid.UID) error {
+	existingContact, err := s.repository.Contact.FindByEmail(ctx, contact.WorkspaceId, contact.Email)
+	if err != nil {
+		return err
+	}
+	if existingContact != nil {
+		*contact = *existingContact
+	} else {
+		contact.Id = *s.uidGenerator.Next()
+		err = s.repository.Contact.Save(ctx, contact)
+		if err != nil {
+			return err
+		}
+	}
+	for _, segmentId := range segmentIds {
+		segment, err := s.repository.Segment.FindByID(ctx, segmentId)
+		if err != nil {
+			return err
+		}
+		if segment == nil || segment.WorkspaceId != contact.WorkspaceId {
+			return errors.New("segment not found")
+		}
+		_, err = s.AddToSegment(ctx, contact, segment)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *contactService) CreateSegment(ctx context.Context, segment *model.Segment) error {
+	if segment.IsOptIn && (segment.OptInFrom == nil || *segment.OptInFrom == "") {
+		return errors.New("opt-in segment requires an opt-in from address")
+	}
+	segment.Id = *s.uidGenerator.Next()
+
+	return s.repository.Segment.Create(ctx, segment)
+}
+
+// AddToSegment adds the contact to the segment, contacts of an opt-in segment
+// stay unsubscribed until they confirm through the link sent to them
+func (s *contactService) AddToSegment(
+	ctx context.Context,
+	contact *model.Contact,
+	segment *model.Segment,
+) (*model.SegmentContact, error) {
+	segmentContact, err := s.repository.Segment.FindContact(ctx, segment.Id, contact.Id)
+	if err != nil {
+		return nil, err
+	}
+	if segmentContact != nil {
+		return segmentContact, nil
+	}
+	segmentContact = &model.SegmentContact{
+		Base: model.Base{
+			Id: *s.uidGenerator.Next(),
+		},
+		SegmentId:      segment.Id,
+		ContactId:      contact.Id,
+		Subscribed:     !segment.IsOptIn,
+		OrganizationId: segment.OrganizationId,
+		WorkspaceId:    segment.WorkspaceId,
+	}
+	err = s.repository.Segment.SaveContact(ctx, segmentContact)
+	if err != nil {
+		return nil, err
+	}
+	if !segment.IsOptIn {
+		return segmentContact, nil
+	}
+	// the contact is saved before the opt-in is sent so the link always
+	// confirms it, a failed send removes the contact again so adding it again
+	// sends a new one
+	err = s.sendOptIn(ctx, contact, segment, segmentContact)
+	if err != nil {
+		s.logger.Error().Err(err).Str("contactId", contact.Id.String()).Msg("failed to send opt-in email")
+		deleteErr := s.repository.Segment.DeleteContact(ctx, segmentContact.Id)
+		if deleteErr != nil {
+			s.logger.Error().Err(deleteErr).Str("segmentContactId", segmentContact.Id.String()).Msg("failed to remove contact of failed opt-in")
+		}
+		return nil, errors.New("failed to send opt-in email")
+	}
+
+	return segmentContact, nil
+}
+
+func (s *contactService) Confirm(ctx context.Context, token string) (*model.Segment, error) {
+	claims, err := s.jwt.VerifyScopedToken(token, constant.TokenScopeOptIn)
+	if err != nil {
+		return nil, errors.New("invalid or expired confirmation link")
+	}
+	segmentContactId, err := uid.NewUIDFromString(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	segmentContact, err := s.repository.Segment.FindContactById(ctx, *segmentContactId)
+	if err != nil {
+		return nil, err
+	}
+	if segmentContact == nil {
+		return nil, errors.New("invalid or expired confirmation link")
+	}
+	segment, err := s.repository.Segment.FindByID(ctx, segmentContact.SegmentId)
+	if err != nil {
+		return nil, err
+	}
+	if segment == nil {
+		return nil, errors.New("segment not found")
+	}
+	if segmentContact.Subscribed {
+		return segment, nil
+	}
+	contact, err := s.repository.Contact.FindById(ctx, segmentContact.ContactId)
+	if err != nil {
+		return nil, err
+	}
+	if contact == nil {
+		return nil, errors.New("contact not found")
+	}
+	err = s.Transact(ctx, func(ctx context.Context, service *Service) error {
+		err := service.repository.Contact.UpdateEmailVerified(ctx, contact.Id, true)
+		if err != nil {
+			return err
+		}
+
+		return service.repository.Segment.UpdateContactSubscribed(ctx, segmentContact.Id, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	event := &model.Event{
+		EventType:      constant.EventTypeOptIn,
+		Receipients:    []string{contact.Email},
+		OrganizationId: segmentContact.OrganizationId,
+		WorkspaceId:    segmentContact.WorkspaceId,
+		MetaData: model.EventMetaData{
+			"contactId": contact.Id.String(),
+			"segmentId": segment.Id.String(),
+		},
+	}
+	s.eventService.Create(ctx, event)
+	s.eventService.Publish(ctx, []*model.Event{event})
+
+	return segment, nil
+}
+
+func (s *contactService) sendOptIn(
+	ctx context.Context,
+	contact *model.Contact,
+	segment *model.Segment,
+	segmentContact *model.SegmentContact,
+) error {
+	template, err := s.templateService.GetOptInTemplate(ctx, segment.WorkspaceId, segment.OrganizationId)
+	if err != nil {
+		return err
+	}
+	_, token, err := s.jwt.NewAccessToken(
+		segmentContact.Id.String(),
+		crypto.WithScope(constant.TokenScopeOptIn),
+		crypto.WithEmail(contact.Email),
+		crypto.WithExpiresIn(time.Duration(s.config.OptIn.LinkExpiryInHours)*time.Hour),
+	)
+	if err != nil {
+		return err
+	}
+	data := ContactTemplateData(contact)
+	data[string(constant.VariableOptInLink)] = s.config.Host + constant.OptInConfirmPath + "?token=" + url.QueryEscape(token)
+	emailContent, err := s.templateService.Render(template, data)
+	if err != nil {
+		return err
+	}
+	email := &model.Email{
+		From: *segment.OptInFrom,
+		Recipients: model.Recipients{{
+			Address: contact.Email,
+		}},
+		EmailContent:   *emailContent,
+		OrganizationId: segment.OrganizationId,
+		WorkspaceId:    segment.WorkspaceId,
+	}
+	_, err = s.emailService.Send(ctx, segmentContact.Id.String(), []*model.Email{email})
+
+	return err
+}
+
+// ContactTemplateData builds the data a template is rendered with for a
+// contact, the contact attributes are available along with the contact fields
+func ContactTemplateData(contact *model.Contact) map[string]interface{} {
+	data := make(map[string]interface{})
+	for key, value := range contact.Attributes {
+		data[key] = value
+	}
+	data["Name"] = formatName(contact.FirstName, contact.LastName)
+	data["FirstName"] = contact.FirstName
+	data["LastName"] = contact.LastName
+	data["Email"] = contact.Email
+
+	return data
+}
+
+func formatName(firstName, lastName string) string {
+	if lastName == "" {
+		return firstName
+	}
+	if firstName == "" {
+		return lastName
+	}
+
+	return firstName + " " + lastName
+}
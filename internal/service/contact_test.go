@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/usesend0/send0/internal/config"
+	"github.com/usesend0/send0/internal/crypto"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type fakeSegmentRepository struct {
+	model.SegmentRepository
+	contacts []*model.SegmentContact
+}
+
+func (r *fakeSegmentRepository) FindContact(_ context.Context, segmentId, contactId uid.UID) (*model.SegmentContact, error) {
+	for _, segmentContact := range r.contacts {
+		if segmentContact.SegmentId == segmentId && segmentContact.ContactId == contactId {
+			return segmentContact, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (r *fakeSegmentRepository) SaveContact(_ context.Context, segmentContact *model.SegmentContact) error {
+	r.contacts = append(r.contacts, segmentContact)
+
+	return nil
+}
+
+func (r *fakeSegmentRepository) DeleteContact(_ context.Context, id uid.UID) error {
+	r.contacts = slices.DeleteFunc(r.contacts, func(segmentContact *model.SegmentContact) bool {
+		return segmentContact.Id == id
+	})
+
+	return nil
+}
+
+type fakeTemplateService struct {
+	TemplateService
+	err error
+}
+
+func (s *fakeTemplateService) GetOptInTemplate(_ context.Context, _, _ uid.UID) (*model.Template, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return &model.Template{}, nil
+}
+
+func (s *fakeTemplateService) Render(_ *model.Template, _ map[string]interface{}) (*model.EmailContent, error) {
+	return &model.EmailContent{}, nil
+}
+
+// fakeOptInEmailService records whether the segment contact was saved when
+// the opt-in was sent
+type fakeOptInEmailService struct {
+	EmailService
+	segments *fakeSegmentRepository
+	err      error
+	saved    []bool
+}
+
+func (s *fakeOptInEmailService) Send(_ context.Context, requestId string, _ []*model.Email) ([]string, error) {
+	saved := false
+	for _, segmentContact := range s.segments.contacts {
+		saved = saved || segmentContact.Id.String() == requestId
+	}
+	s.saved = append(s.saved, saved)
+
+	return nil, s.err
+}
+
+// newTestJWT returns a JWT signing with a new key
+func newTestJWT(t *testing.T) *crypto.JWT {
+	t.Helper()
+	key, _, err := crypto.GenerateKeyPair(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes, err := crypto.PrivateKeyToBytes(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwt, err := crypto.NewJWT(&config.Config{JWT: config.JWT{PrivateKey: base64.StdEncoding.EncodeToString(bytes)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return jwt
+}
+
+func TestAddToSegmentKeepsContactOutWhenOptInFails(t *testing.T) {
+	segments := &fakeSegmentRepository{}
+	service := &contactService{
+		baseService:     newTestBaseService(&model.Repository{Segment: segments}),
+		templateService: &fakeTemplateService{err: errors.New("template not available")},
+	}
+	from := "news@example.com"
+	segment := &model.Segment{Base: model.Base{Id: *uid.NewUID(1)}, IsOptIn: true, OptInFrom: &from}
+	contact := &model.Contact{Base: model.Base{Id: *uid.NewUID(2)}, Email: "jane@example.com"}
+
+	_, err := service.AddToSegment(context.Background(), contact, segment)
+	if err == nil {
+		t.Fatal("expected the failed opt-in to be returned")
+	}
+	if len(segments.contacts) != 0 {
+		t.Fatalf("expected the contact not to be added, got %d segment contacts", len(segments.contacts))
+	}
+}
+
+func TestAddToSegmentSavesContactBeforeOptIn(t *testing.T) {
+	segments := &fakeSegmentRepository{}
+	emailService := &fakeOptInEmailService{segments: segments}
+	service := &contactService{
+		baseService:     newTestBaseService(&model.Repository{Segment: segments}),
+		jwt:             newTestJWT(t),
+		emailService:    emailService,
+		templateService: &fakeTemplateService{},
+	}
+	from := "news@example.com"
+	segment := &model.Segment{Base: model.Base{Id: *uid.NewUID(1)}, IsOptIn: true, OptInFrom: &from}
+	contact := &model.Contact{Base: model.Base{Id: *uid.NewUID(2)}, Email: "jane@example.com"}
+
+	segmentContact, err := service.AddToSegment(context.Background(), contact, segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emailService.saved) != 1 || !emailService.saved[0] {
+		t.Fatal("expected the contact to be saved before the opt-in is sent")
+	}
+	if segmentContact.Subscribed || len(segments.contacts) != 1 {
+		t.Fatalf("expected the contact to wait for the confirmation, got %+v", segments.contacts)
+	}
+
+	// a failed send removes the contact again
+	segments.contacts = nil
+	emailService.err = errors.New("throttled")
+	_, err = service.AddToSegment(context.Background(), contact, segment)
+	if err == nil {
+		t.Fatal("expected the failed opt-in to be returned")
+	}
+	if len(segments.contacts) != 0 {
+		t.Fatalf("expected the contact to be removed, got %d segment contacts", len(segments.contacts))
+	}
+}
+
+func TestAddToSegmentWithoutOptIn(t *testing.T) {
+	segments := &fakeSegmentRepository{}
+	service := &contactService{baseService: newTestBaseService(&model.Repository{Segment: segments})}
+	segment := &model.Segment{Base: model.Base{Id: *uid.NewUID(1)}}
+	contact := &model.Contact{Base: model.Base{Id: *uid.NewUID(2)}, Email: "jane@example.com"}
+
+	segmentContact, err := service.AddToSegment(context.Background(), contact, segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !segmentContact.Subscribed || len(segments.contacts) != 1 {
+		t.Fatalf("expected the contact to be subscribed, got %+v", segments.contacts)
+	}
+}
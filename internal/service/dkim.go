@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/crypto"
+	"github.com/usesend0/send0/internal/dnsprovider"
+	"github.com/usesend0/send0/internal/model"
+)
+
+var ErrDKIMRotationInProgress = errors.New("a DKIM rotation is already in progress")
+
+// newDKIMKey generates a key of the configured size for the selector, the
+// key is not saved
+func (s *domainService) newDKIMKey(domain *model.Domain, selector string, status model.DKIMKeyStatus) (*model.DKIMKey, error) {
+	privateKey, publicKey, err := crypto.GenerateKeyPair(s.config.Domain.DKIMKeySize)
+	if err != nil {
+		return nil, err
+	}
+	publicKeyBytes, err := crypto.PublicKeyToBytes(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.DKIMKey{
+		Base: model.Base{
+			Id: *s.uidGenerator.Next(),
+		},
+		Selector:    selector,
+		Status:      status,
+		KeySize:     s.config.Domain.DKIMKeySize,
+		PrivateKey:  model.ToJSONPrivateKey(*privateKey),
+		PublicKey:   crypto.TrimPrefixAndSuffix(publicKeyBytes),
+		DomainId:    domain.Id,
+		WorkspaceId: domain.WorkspaceId,
+	}, nil
+}
+
+// RotateDKIM publishes the record of a new key next to the current one, SES
+// switches to the new key once its record is verified
+func (s *domainService) RotateDKIM(ctx context.Context, domain *model.Domain) (*model.DKIMKey, error) {
+	keys, err := s.repository.DKIMKey.FindByDomainId(ctx, domain.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.Status == model.DKIMKeyStatusPending {
+			return nil, ErrDKIMRotationInProgress
+		}
+	}
+	subdomain, err := domainSubdomain(domain.Name)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.newDKIMKey(domain, s.dkimSelector(domain, keys, time.Now().UTC()), model.DKIMKeyStatusPending)
+	if err != nil {
+		return nil, err
+	}
+	record := dkimRecord(key.Selector, subdomain, key.PublicKey)
+	err = s.Transact(ctx, func(ctx context.Context, service *Service) error {
+		// the records and key a verification saved meanwhile are kept
+		current, err := service.repository.Domain.FindByIdForUpdate(ctx, domain.Id)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return errors.New("domain not found")
+		}
+		domain.DKIMRecords = append(current.DKIMRecords, record)
+		domain.DKIMSelector = current.DKIMSelector
+		domain.PrivateKey = current.PrivateKey
+		err = service.repository.DKIMKey.Save(ctx, key)
+		if err != nil {
+			return err
+		}
+		return service.repository.Domain.UpdateDKIM(ctx, domain)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if domain.DNSProviderId != nil {
+		err = s.applyChanges(ctx, domain, []*dnsprovider.Change{dkimRecordChange(domain, record, dnsprovider.ChangeActionUpsert)})
+		if err != nil {
+			s.logger.Error().Err(err).Str("domainId", domain.Id.String()).Msg("failed to publish DKIM record")
+		}
+	}
+
+	return key, nil
+}
+
+// advanceDKIMRotation moves the rotation of the domain forward: SES signs
+// with a pending key once its record is verified, retiring keys are removed
+// after the overlap and a new rotation starts when the key is due
+func (s *domainService) advanceDKIMRotation(ctx context.Context, domain *model.Domain) error {
+	keys, err := s.repository.DKIMKey.FindByDomainId(ctx, domain.Id)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	rotating := false
+	for _, key := range keys {
+		switch key.Status {
+		case model.DKIMKeyStatusPending:
+			rotating = true
+			err = s.activateDKIMKey(ctx, domain, keys, key, now)
+		case model.DKIMKeyStatusRetiring:
+			rotating = true
+			if key.RetireAt != nil && now.After(*key.RetireAt) {
+				err = s.retireDKIMKey(ctx, domain, key, now)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	interval := time.Duration(s.config.Domain.DKIMRotationIntervalInDays) * 24 * time.Hour
+	if rotating || interval <= 0 || domain.Status != constant.DomainStatusActive {
+		return nil
+	}
+	// domains without key history use the key created with the domain
+	activatedAt := domain.Id.Timestamp()
+	for _, key := range keys {
+		if key.Status == model.DKIMKeyStatusActive && key.ActivatedAt != nil {
+			activatedAt = *key.ActivatedAt
+			break
+		}
+	}
+	if now.Sub(activatedAt) < interval {
+		return nil
+	}
+	_, err = s.RotateDKIM(ctx, domain)
+
+	return err
+}
+
+// activateDKIMKey switches SES to the pending key once its record is active,
+// the previous keys stay published until the overlap ends
+func (s *domainService) activateDKIMKey(
+	ctx context.Context,
+	domain *model.Domain,
+	keys []*model.DKIMKey,
+	key *model.DKIMKey,
+	now time.Time,
+) error {
+	record, ok := findDKIMRecord(domain, key.Selector)
+	if !ok || record.Status != constant.DNSStatusActive {
+		return nil
+	}
+	privateKey, err := dkimPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	err = s.ses.PutDKIMSigningAttributes(ctx, domain, key.Selector, privateKey)
+	if err != nil {
+		return err
+	}
+	if domain.FailoverRegion != nil {
+		err = s.ses.PutDKIMSigningAttributes(ctx, failoverIdentity(domain, *domain.FailoverRegion), key.Selector, privateKey)
+		if err != nil {
+			return err
+		}
+	}
+	retireAt := now.Add(time.Duration(s.config.Domain.DKIMOverlapInHours) * time.Hour)
+	previous := make([]*model.DKIMKey, 0)
+	for _, k := range keys {
+		if k.Status == model.DKIMKeyStatusActive {
+			k.Status = model.DKIMKeyStatusRetiring
+			k.RetireAt = &retireAt
+			previous = append(previous, k)
+		}
+	}
+	// the key created with the domain before keys were tracked
+	var untracked *model.DKIMKey
+	if len(previous) == 0 {
+		untracked = &model.DKIMKey{
+			Base: model.Base{
+				Id: *s.uidGenerator.Next(),
+			},
+			Selector:    domain.DKIMSelector,
+			Status:      model.DKIMKeyStatusRetiring,
+			KeySize:     domain.PrivateKey.N.BitLen(),
+			PrivateKey:  domain.PrivateKey,
+			RetireAt:    &retireAt,
+			DomainId:    domain.Id,
+			WorkspaceId: domain.WorkspaceId,
+		}
+		if record, ok := findDKIMRecord(domain, domain.DKIMSelector); ok {
+			untracked.PublicKey = strings.TrimPrefix(record.Value, "p=")
+		}
+	}
+	key.Status = model.DKIMKeyStatusActive
+	key.ActivatedAt = &now
+	domain.DKIMSelector = key.Selector
+	domain.PrivateKey = key.PrivateKey
+
+	return s.Transact(ctx, func(ctx context.Context, service *Service) error {
+		if untracked != nil {
+			err := service.repository.DKIMKey.Save(ctx, untracked)
+			if err != nil {
+				return err
+			}
+		}
+		for _, k := range append(previous, key) {
+			err := service.repository.DKIMKey.Update(ctx, k)
+			if err != nil {
+				return err
+			}
+		}
+		return service.repository.Domain.UpdateDKIM(ctx, domain)
+	})
+}
+
+// retireDKIMKey removes the record of the key and discards its private key
+func (s *domainService) retireDKIMKey(ctx context.Context, domain *model.Domain, key *model.DKIMKey, now time.Time) error {
+	record, ok := findDKIMRecord(domain, key.Selector)
+	if ok && domain.DNSProviderId != nil {
+		err := s.applyChanges(ctx, domain, []*dnsprovider.Change{dkimRecordChange(domain, record, dnsprovider.ChangeActionDelete)})
+		if err != nil {
+			s.logger.Error().Err(err).Str("domainId", domain.Id.String()).Msg("failed to delete DKIM record")
+		}
+	}
+	records := make(constant.JSONDomainRecords, 0, len(domain.DKIMRecords))
+	for _, r := range domain.DKIMRecords {
+		if !isDKIMRecordOf(r, key.Selector) {
+			records = append(records, r)
+		}
+	}
+	domain.DKIMRecords = records
+	key.Status = model.DKIMKeyStatusRetired
+	key.PrivateKey = model.JSONPrivateKey{}
+	key.RetiredAt = &now
+
+	return s.Transact(ctx, func(ctx context.Context, service *Service) error {
+		err := service.repository.DKIMKey.Update(ctx, key)
+		if err != nil {
+			return err
+		}
+		return service.repository.Domain.UpdateDKIM(ctx, domain)
+	})
+}
+
+// dkimSelector returns an unused selector in the configured format
+func (s *domainService) dkimSelector(domain *model.Domain, keys []*model.DKIMKey, now time.Time) string {
+	used := map[string]bool{domain.DKIMSelector: true}
+	for _, key := range keys {
+		used[key.Selector] = true
+	}
+	base := constant.AppName + "-" + now.Format("20060102")
+	if s.config.Domain.DKIMSelectorFormat == constant.DKIMSelectorFormatCounter {
+		base = constant.AppName
+	}
+	selector := base
+	for i := len(keys) + 1; selector == constant.AppName || used[selector]; i++ {
+		selector = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	return selector
+}
+
+// dkimPrivateKey returns the private key in the format SES expects, base64
+// without the PEM header and footer
+func dkimPrivateKey(key *model.DKIMKey) (string, error) {
+	return signingKey(key.PrivateKey)
+}
+
+// signingKey returns the private key in the format SES expects
+func signingKey(key model.JSONPrivateKey) (string, error) {
+	privateKey := model.FromJSONPrivateKey(key)
+	privateKeyBytes, err := crypto.PrivateKeyToBytes(&privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	return crypto.TrimPrefixAndSuffix(privateKeyBytes), nil
+}
+
+func dkimRecord(selector string, subdomain string, publicKey string) constant.DomainRecord {
+	return constant.DomainRecord{
+		Name:   formatSubdomain([]string{selector, "_domainkey", subdomain}),
+		Value:  "p=" + publicKey,
+		TTL:    300,
+		Type:   "TXT",
+		Status: constant.DNSStatusPending,
+	}
+}
+
+func dkimRecordChange(domain *model.Domain, record constant.DomainRecord, action string) *dnsprovider.Change {
+	return &dnsprovider.Change{
+		Action: action,
+		Record: dnsprovider.Record{
+			Name:  domain.RecordName(record),
+			Type:  record.Type,
+			Value: record.Value,
+			TTL:   record.TTL,
+		},
+	}
+}
+
+func findDKIMRecord(domain *model.Domain, selector string) (constant.DomainRecord, bool) {
+	for _, record := range domain.DKIMRecords {
+		if isDKIMRecordOf(record, selector) {
+			return record, true
+		}
+	}
+
+	return constant.DomainRecord{}, false
+}
+
+func isDKIMRecordOf(record constant.DomainRecord, selector string) bool {
+	prefix := selector + "._domainkey"
+	return record.Name == prefix || strings.HasPrefix(record.Name, prefix+".")
+}
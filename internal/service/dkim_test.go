@@ -0,0 +1,84 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/usesend0/send0/internal/config"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+)
+
+func TestDKIMSelector(t *testing.T) {
+	now := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		format   string
+		current  string
+		selected []string
+		want     string
+	}{
+		{name: "dated", format: constant.DKIMSelectorFormatDated, current: "send0", want: "send0-20240701"},
+		{name: "dated rotated the same day", format: constant.DKIMSelectorFormatDated, current: "send0-20240701", selected: []string{"send0-20240701"}, want: "send0-20240701-2"},
+		{name: "counter", format: constant.DKIMSelectorFormatCounter, current: "send0", want: "send0-1"},
+		{name: "counter with keys", format: constant.DKIMSelectorFormatCounter, current: "send0-2", selected: []string{"send0-1", "send0-2"}, want: "send0-3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := &domainService{baseService: &baseService{config: &config.Config{
+				Domain: config.Domain{DKIMSelectorFormat: test.format},
+			}}}
+			keys := make([]*model.DKIMKey, 0, len(test.selected))
+			for _, selector := range test.selected {
+				keys = append(keys, &model.DKIMKey{Selector: selector})
+			}
+			got := service.dkimSelector(&model.Domain{DKIMSelector: test.current}, keys, now)
+			if got != test.want {
+				t.Fatalf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestMergeRecordStatusKeepsRecordsOfARotation(t *testing.T) {
+	active := dkimRecord("send0", "", "CURRENT")
+	checked := constant.JSONDomainRecords{active}
+	checked[0].Status = constant.DNSStatusActive
+	// a rotation added the record of the new key while the records were checked
+	current := constant.JSONDomainRecords{active, dkimRecord("send0-1", "", "NEW")}
+
+	records := mergeRecordStatus(current, checked)
+	if len(records) != 2 {
+		t.Fatalf("expected the 2 current records, got %+v", records)
+	}
+	if records[0].Status != constant.DNSStatusActive {
+		t.Fatalf("expected the checked record to be active, got %s", records[0].Status)
+	}
+	if records[1].Value != "p=NEW" || records[1].Status != constant.DNSStatusPending {
+		t.Fatalf("expected the record of the new key to stay pending, got %+v", records[1])
+	}
+	if current[0].Status != constant.DNSStatusPending {
+		t.Fatal("expected the current records to be left unchanged")
+	}
+}
+
+func TestDomainStatusRequiresTheRecordOfTheSigningKey(t *testing.T) {
+	domain := &model.Domain{
+		Status:       constant.DomainStatusActive,
+		DKIMSelector: "send0-1",
+		DKIMRecords: constant.JSONDomainRecords{
+			{Name: "send0._domainkey", Type: "TXT", Value: "p=OLD", Status: constant.DNSStatusActive},
+			{Name: "send0-1._domainkey", Type: "TXT", Value: "p=NEW", Status: constant.DNSStatusPending},
+		},
+		SPFRecords: constant.JSONDomainRecords{
+			{Name: "ses", Type: "TXT", Value: "v=spf1 include:amazonses.com -all", Status: constant.DNSStatusActive},
+		},
+	}
+	if status := domainStatus(domain, true, nil); status != constant.DomainStatusIncomplete {
+		t.Fatalf("expected %s while the record of the signing key is pending, got %s", constant.DomainStatusIncomplete, status)
+	}
+	domain.DKIMRecords[1].Status = constant.DNSStatusActive
+	if status := domainStatus(domain, true, nil); status != constant.DomainStatusActive {
+		t.Fatalf("expected %s, got %s", constant.DomainStatusActive, status)
+	}
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+// maxDMARCReportSize limits the size of a decompressed report
+const maxDMARCReportSize = 50 << 20
+
+var ErrInvalidDMARCReport = errors.New("invalid dmarc report")
+var ErrDMARCReportDomainNotFound = errors.New("no domain of the workspace matches the dmarc report")
+
+// dmarcFeedback is a DMARC aggregate report as defined in RFC 7489 appendix C
+type dmarcFeedback struct {
+	XMLName        xml.Name `xml:"feedback"`
+	ReportMetadata struct {
+		OrgName   string `xml:"org_name"`
+		Email     string `xml:"email"`
+		ReportId  string `xml:"report_id"`
+		DateRange struct {
+			Begin int64 `xml:"begin"`
+			End   int64 `xml:"end"`
+		} `xml:"date_range"`
+	} `xml:"report_metadata"`
+	PolicyPublished struct {
+		Domain string `xml:"domain"`
+		P      string `xml:"p"`
+	} `xml:"policy_published"`
+	Records []struct {
+		Row struct {
+			SourceIP        string `xml:"source_ip"`
+			Count           int    `xml:"count"`
+			PolicyEvaluated struct {
+				Disposition string `xml:"disposition"`
+				DKIM        string `xml:"dkim"`
+				SPF         string `xml:"spf"`
+			} `xml:"policy_evaluated"`
+		} `xml:"row"`
+		Identifiers struct {
+			HeaderFrom string `xml:"header_from"`
+		} `xml:"identifiers"`
+	} `xml:"record"`
+}
+
+// ImportDMARCReport parses an aggregate report, plain, gzipped or zipped, and
+// saves it for the domain of the workspace it is about. A report which was
+// already imported returns model.ErrDMARCReportExists
+func (s *domainService) ImportDMARCReport(ctx context.Context, workspaceId uid.UID, data []byte) (*model.DMARCReport, error) {
+	data, err := decompressDMARCReport(data)
+	if err != nil {
+		return nil, err
+	}
+	var feedback dmarcFeedback
+	err = xml.Unmarshal(data, &feedback)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidDMARCReport, err.Error())
+	}
+	metadata := feedback.ReportMetadata
+	if metadata.OrgName == "" || metadata.ReportId == "" || feedback.PolicyPublished.Domain == "" {
+		return nil, ErrInvalidDMARCReport
+	}
+	report := &model.DMARCReport{
+		Base: model.Base{
+			Id: *s.uidGenerator.Next(),
+		},
+		ReportId:    metadata.ReportId,
+		OrgName:     metadata.OrgName,
+		Email:       metadata.Email,
+		BeginAt:     time.Unix(metadata.DateRange.Begin, 0).UTC(),
+		EndAt:       time.Unix(metadata.DateRange.End, 0).UTC(),
+		Policy:      feedback.PolicyPublished.P,
+		Records:     make([]*model.DMARCReportRecord, 0, len(feedback.Records)),
+		WorkspaceId: workspaceId,
+	}
+	names := []string{feedback.PolicyPublished.Domain}
+	for _, record := range feedback.Records {
+		report.Records = append(report.Records, &model.DMARCReportRecord{
+			Base: model.Base{
+				Id: *s.uidGenerator.Next(),
+			},
+			SourceIP:    record.Row.SourceIP,
+			Count:       record.Row.Count,
+			Disposition: strings.ToLower(record.Row.PolicyEvaluated.Disposition),
+			DKIM:        strings.ToLower(record.Row.PolicyEvaluated.DKIM),
+			SPF:         strings.ToLower(record.Row.PolicyEvaluated.SPF),
+			HeaderFrom:  strings.ToLower(record.Identifiers.HeaderFrom),
+		})
+		names = append(names, record.Identifiers.HeaderFrom)
+	}
+	// the policy is usually published for the registered domain while the
+	// domain may be a subdomain
+	for _, name := range names {
+		domains, _, err := s.repository.Domain.FindAll(ctx, model.DomainFindOptions{
+			Name:        strings.ToLower(strings.TrimSuffix(name, ".")),
+			WorkspaceId: workspaceId,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(domains) > 0 {
+			report.DomainId = domains[0].Id
+			break
+		}
+	}
+	if report.DomainId == (uid.UID{}) {
+		return nil, fmt.Errorf("%w: %s", ErrDMARCReportDomainNotFound, feedback.PolicyPublished.Domain)
+	}
+	err = s.Transact(ctx, func(ctx context.Context, service *Service) error {
+		err := service.repository.DMARCReport.Save(ctx, report)
+		if err != nil {
+			return err
+		}
+		return service.repository.DMARCReport.SaveRecords(ctx, report)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// decompressDMARCReport returns the XML of a gzip file or of the first file of
+// a zip archive, receivers send reports in either
+func decompressDMARCReport(data []byte) ([]byte, error) {
+	var reader io.Reader
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidDMARCReport, err.Error())
+		}
+		defer gz.Close()
+		reader = gz
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidDMARCReport, err.Error())
+		}
+		if len(archive.File) == 0 {
+			return nil, ErrInvalidDMARCReport
+		}
+		file, err := archive.File[0].Open()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidDMARCReport, err.Error())
+		}
+		defer file.Close()
+		reader = file
+	default:
+		return data, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, maxDMARCReportSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidDMARCReport, err.Error())
+	}
+	if len(data) > maxDMARCReportSize {
+		return nil, fmt.Errorf("%w: report is too large", ErrInvalidDMARCReport)
+	}
+
+	return data, nil
+}
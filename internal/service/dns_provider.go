@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/usesend0/send0/internal/crypto"
+	"github.com/usesend0/send0/internal/dnsprovider"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+var ErrEncryptionKeyNotConfigured = errors.New("encryption key is not configured")
+
+type DNSProviderService interface {
+	Create(ctx context.Context, provider *model.DNSProvider, credentials json.RawMessage) error
+	Get(ctx context.Context, id uid.UID) (*model.DNSProvider, error)
+	List(ctx context.Context, workspaceId uid.UID) ([]*model.DNSProvider, error)
+	Delete(ctx context.Context, provider *model.DNSProvider) error
+	Client(provider *model.DNSProvider) (dnsprovider.DNSProvider, error)
+}
+
+type dnsProviderService struct {
+	*baseService
+}
+
+func NewDNSProviderService(baseService *baseService) DNSProviderService {
+	return &dnsProviderService{
+		baseService,
+	}
+}
+
+// Create checks the credentials against the provider type and saves them
+// encrypted with the configured encryption key
+func (s *dnsProviderService) Create(ctx context.Context, provider *model.DNSProvider, credentials json.RawMessage) error {
+	if s.config.EncryptionKey == "" {
+		return ErrEncryptionKeyNotConfigured
+	}
+	_, err := dnsprovider.NewDNSProvider(provider.Type, credentials)
+	if err != nil {
+		return err
+	}
+	provider.Credentials, err = crypto.Encrypt(s.config.EncryptionKey, credentials)
+	if err != nil {
+		return err
+	}
+	provider.Id = *s.uidGenerator.Next()
+
+	return s.repository.DNSProvider.Save(ctx, provider)
+}
+
+func (s *dnsProviderService) Get(ctx context.Context, id uid.UID) (*model.DNSProvider, error) {
+	return s.repository.DNSProvider.FindById(ctx, id)
+}
+
+func (s *dnsProviderService) List(ctx context.Context, workspaceId uid.UID) ([]*model.DNSProvider, error) {
+	return s.repository.DNSProvider.FindByWorkspaceId(ctx, workspaceId)
+}
+
+func (s *dnsProviderService) Delete(ctx context.Context, provider *model.DNSProvider) error {
+	return s.repository.DNSProvider.Delete(ctx, provider.Id)
+}
+
+// Client decrypts the credentials and returns the client of the provider
+func (s *dnsProviderService) Client(provider *model.DNSProvider) (dnsprovider.DNSProvider, error) {
+	if s.config.EncryptionKey == "" {
+		return nil, ErrEncryptionKeyNotConfigured
+	}
+	credentials, err := crypto.Decrypt(s.config.EncryptionKey, provider.Credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	return dnsprovider.NewDNSProvider(provider.Type, credentials)
+}
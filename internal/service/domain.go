@@ -3,68 +3,125 @@ package service
 import (
 	"context"
 	"errors"
+	"net"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
 	"github.com/usesend0/send0/internal/constant"
-	"github.com/usesend0/send0/internal/crypto"
+	"github.com/usesend0/send0/internal/dnsprovider"
 	"github.com/usesend0/send0/internal/model"
 	"github.com/usesend0/send0/internal/uid"
 	"golang.org/x/net/publicsuffix"
 )
 
-const dkimSignatureBitSize = 1024
+// domainReconcilerInterval is how often the reconciler looks for domains due
+// for verification
+const domainReconcilerInterval = time.Minute
+
+var (
+	ErrDNSProviderNotFound = errors.New("dns provider not found")
+	ErrRegionNotEnabled    = errors.New("SES is not enabled in the region")
+)
 
 type DomainService interface {
 	Create(ctx context.Context, domain *model.Domain) error
 	Delete(ctx context.Context, domainId uid.UID) error
+	Get(ctx context.Context, domainId uid.UID) (*model.Domain, error)
+	Verify(ctx context.Context, domain *model.Domain) error
+	StartReconciler(ctx context.Context)
+	PublishRecords(ctx context.Context, domain *model.Domain, dryRun bool) ([]*dnsprovider.Change, error)
+	RotateDKIM(ctx context.Context, domain *model.Domain) (*model.DKIMKey, error)
+	DKIMKeys(ctx context.Context, domain *model.Domain) ([]*model.DKIMKey, error)
+	UpdateMailFrom(ctx context.Context, domain *model.Domain, behaviorOnMXFailure constant.MailFromBehavior) error
+	UpdateFailover(ctx context.Context, domain *model.Domain, region *constant.AwsRegion, policy constant.FailoverPolicy) error
+	Health(ctx context.Context, domain *model.Domain) (*DomainHealthReport, error)
+	ImportDMARCReport(ctx context.Context, workspaceId uid.UID, data []byte) (*model.DMARCReport, error)
 }
 
 type domainService struct {
 	*baseService
-	ses SESService
+	ses                SESService
+	eventService       EventSevice
+	dnsProviderService DNSProviderService
+	ipPoolService      IPPoolService
+	resolver           *net.Resolver
 }
 
-func NewDomainService(baseService *baseService, sesService SESService) DomainService {
+func NewDomainService(
+	baseService *baseService,
+	sesService SESService,
+	eventService EventSevice,
+	dnsProviderService DNSProviderService,
+	ipPoolService IPPoolService,
+) DomainService {
 	return &domainService{
 		baseService,
 		sesService,
+		eventService,
+		dnsProviderService,
+		ipPoolService,
+		net.DefaultResolver,
 	}
 }
 
 func (s *domainService) Create(ctx context.Context, domain *model.Domain) error {
-	name := domain.Name
-	suffix, icann := publicsuffix.PublicSuffix(name)
-	if !icann {
-		return errors.New("invalid domain")
+	if !s.sesRegionEnabled(domain.Region) {
+		return ErrRegionNotEnabled
 	}
-	nameParts := strings.Split(name, ".")
-	suffixParts := strings.Split(suffix, ".")
-	// get the subdomain from the domain
-	subdomain := strings.Join(nameParts[:len(nameParts)-len(suffixParts)-1], ".")
-	privateKey, publicKey, err := crypto.GenerateKeyPair(dkimSignatureBitSize)
+	if domain.DNSProviderId != nil {
+		_, err := s.findDNSProvider(ctx, domain)
+		if err != nil {
+			return err
+		}
+	}
+	subdomain, err := domainSubdomain(domain.Name)
 	if err != nil {
 		return err
 	}
-	privateKeyBytes, err := crypto.PrivateKeyToBytes(privateKey)
+	domain.Id = *s.uidGenerator.Next()
+	domain.Status = constant.DomainStatusPending
+	domain.FailoverPolicy = constant.FailoverPolicyNone
+	now := time.Now().UTC()
+	domain.DKIMSelector = s.dkimSelector(domain, nil, now)
+	key, err := s.newDKIMKey(domain, domain.DKIMSelector, model.DKIMKeyStatusActive)
 	if err != nil {
 		return err
 	}
-	publicKeyBytes, err := crypto.PublicKeyToBytes(publicKey)
+	key.ActivatedAt = &now
+	domain = s.setupRecords(domain, subdomain, key.PublicKey)
+	domain.PrivateKey = key.PrivateKey
+	err = s.Transact(ctx, func(ctx context.Context, service *Service) error {
+		err := service.repository.Domain.Save(ctx, domain)
+		if err != nil {
+			return err
+		}
+		return service.repository.DKIMKey.Save(ctx, key)
+	})
 	if err != nil {
 		return err
 	}
-	domain = s.setupRecords(domain, subdomain, publicKeyBytes)
-	domain.Id = *s.uidGenerator.Next()
-	domain.Status = constant.DomainStatusPending
-	domain.PrivateKey = model.ToJSONPrivateKey(*privateKey)
-	err = s.repository.Domain.Save(ctx, domain)
+	privateKey, err := dkimPrivateKey(key)
 	if err != nil {
 		return err
 	}
-	err = s.ses.CreateEmailIdentity(ctx, domain, crypto.TrimPrefixAndSuffix(privateKeyBytes))
+	err = s.ses.CreateEmailIdentity(ctx, domain, privateKey)
 	if err != nil {
 		return errors.New("failed to create domain")
 	}
+	err = s.ipPoolService.ApplyDomain(ctx, domain)
+	if err != nil {
+		s.logger.Error().Err(err).Str("domainId", domain.Id.String()).Msg("failed to apply IP pools")
+	}
+	if domain.DNSProviderId != nil {
+		// the records can be published again once the provider is fixed
+		_, err = s.PublishRecords(ctx, domain, false)
+		if err != nil {
+			s.logger.Error().Err(err).Str("domainId", domain.Id.String()).Msg("failed to publish domain records")
+		}
+	}
 
 	return nil
 }
@@ -82,18 +139,480 @@ func (s *domainService) Delete(ctx context.Context, domainId uid.UID) error {
 		s.logger.Error().Err(err).Msg("failed to delete email identity")
 		return errors.New("failed to delete domain")
 	}
+	err = s.ipPoolService.RemoveDomain(ctx, domain)
+	if err != nil {
+		s.logger.Error().Err(err).Str("domainId", domain.Id.String()).Msg("failed to remove IP pools")
+	}
+	if domain.FailoverRegion != nil {
+		err = s.ses.DeleteEmailIdentity(ctx, failoverIdentity(domain, *domain.FailoverRegion))
+		if err != nil {
+			s.logger.Error().Err(err).Str("domainId", domain.Id.String()).Msg("failed to delete failover email identity")
+		}
+	}
+	if domain.DNSProviderId != nil {
+		_, err = s.syncRecords(ctx, domain, dnsprovider.ChangeActionDelete, false)
+		if err != nil {
+			s.logger.Error().Err(err).Str("domainId", domain.Id.String()).Msg("failed to delete domain records")
+		}
+	}
 
 	return s.repository.Domain.Delete(ctx, domainId)
 }
 
-func (s *domainService) setupRecords(domain *model.Domain, subdomain string, publicKeyBytes []byte) *model.Domain {
-	domain.DKIMRecords = constant.JSONDomainRecords{{
-		Name:   formatSubdomain([]string{constant.AppName, "_domainkey", subdomain}),
-		Value:  "p=" + crypto.TrimPrefixAndSuffix(publicKeyBytes),
-		TTL:    300,
-		Type:   "TXT",
-		Status: constant.DNSStatusPending,
-	}}
+func (s *domainService) Get(ctx context.Context, domainId uid.UID) (*model.Domain, error) {
+	return s.repository.Domain.FindById(ctx, domainId)
+}
+
+func (s *domainService) DKIMKeys(ctx context.Context, domain *model.Domain) ([]*model.DKIMKey, error) {
+	return s.repository.DKIMKey.FindByDomainId(ctx, domain.Id)
+}
+
+// UpdateMailFrom configures the custom MAIL FROM domain of the domain with
+// SES again, SES checks its MX record before using it
+func (s *domainService) UpdateMailFrom(
+	ctx context.Context,
+	domain *model.Domain,
+	behaviorOnMXFailure constant.MailFromBehavior,
+) error {
+	if domain.MailFromDomain == "" && len(domain.SPFRecords) > 0 {
+		domain.MailFromDomain = domain.RecordName(domain.SPFRecords[0])
+	}
+	if behaviorOnMXFailure != "" {
+		domain.MailFromBehaviorOnMXFailure = behaviorOnMXFailure
+	}
+	err := s.ses.PutMailFromAttributes(ctx, domain)
+	if err != nil {
+		return err
+	}
+	domain.MailFromStatus = constant.MailFromStatusPending
+
+	return s.repository.Domain.UpdateMailFrom(ctx, domain)
+}
+
+// UpdateFailover sets the region the emails of the domain are sent from when
+// the primary region is throttled. The domain is verified in the failover
+// region with the same DKIM key so the published records stay valid
+func (s *domainService) UpdateFailover(
+	ctx context.Context,
+	domain *model.Domain,
+	region *constant.AwsRegion,
+	policy constant.FailoverPolicy,
+) error {
+	if region != nil && (*region == domain.Region || !s.sesRegionEnabled(*region)) {
+		return ErrRegionNotEnabled
+	}
+	if region == nil {
+		policy = constant.FailoverPolicyNone
+	}
+	previous := domain.FailoverRegion
+	if region != nil && (previous == nil || *previous != *region) {
+		privateKey, err := signingKey(domain.PrivateKey)
+		if err != nil {
+			return err
+		}
+		err = s.ses.CreateEmailIdentity(ctx, failoverIdentity(domain, *region), privateKey)
+		if err != nil {
+			return err
+		}
+	}
+	domain.FailoverRegion = region
+	domain.FailoverPolicy = policy
+	err := s.repository.Domain.UpdateFailover(ctx, domain)
+	if err != nil {
+		return err
+	}
+	if previous != nil && (region == nil || *previous != *region) {
+		err = s.ses.DeleteEmailIdentity(ctx, failoverIdentity(domain, *previous))
+		if err != nil {
+			s.logger.Error().Err(err).Str("domainId", domain.Id.String()).Msg("failed to delete failover email identity")
+		}
+		err = s.ses.DeleteConfigurationSet(ctx, domain.WorkspaceId, *previous, marketingConfigSetName(domain))
+		if err != nil {
+			s.logger.Error().Err(err).Str("domainId", domain.Id.String()).Msg("failed to delete failover marketing configuration set")
+		}
+	}
+	// the pools of the failover region, pools which fail to apply are applied
+	// again by the next verification of the domain
+	err = s.ipPoolService.ApplyDomain(ctx, domain)
+	if err != nil {
+		s.logger.Error().Err(err).Str("domainId", domain.Id.String()).Msg("failed to apply IP pools")
+	}
+
+	return nil
+}
+
+// failoverIdentity returns a copy of the domain in the region, SES manages the
+// identity of the region through the copy. The custom MAIL FROM domain points
+// to the primary region so the failover region uses the SES default
+func failoverIdentity(domain *model.Domain, region constant.AwsRegion) *model.Domain {
+	failover := *domain
+	failover.Region = region
+	failover.MailFromDomain = ""
+	failover.MailFromBehaviorOnMXFailure = constant.MailFromBehaviorUseDefaultValue
+
+	return &failover
+}
+
+// PublishRecords creates or updates the records of the domain with its DNS
+// provider, a dry run only returns the changes which would be made
+func (s *domainService) PublishRecords(ctx context.Context, domain *model.Domain, dryRun bool) ([]*dnsprovider.Change, error) {
+	return s.syncRecords(ctx, domain, dnsprovider.ChangeActionUpsert, dryRun)
+}
+
+// syncRecords compares the records of the domain with the live records of its
+// zone and makes the changes the action needs, a dry run only returns them
+func (s *domainService) syncRecords(ctx context.Context, domain *model.Domain, action string, dryRun bool) ([]*dnsprovider.Change, error) {
+	client, err := s.dnsClient(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	zone := domainZone(domain)
+	changes, err := recordChanges(ctx, client, zone, domain, action)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return changes, nil
+	}
+
+	return changes, dnsprovider.Apply(ctx, client, zone, changes)
+}
+
+// applyChanges makes the changes with the DNS provider of the domain
+func (s *domainService) applyChanges(ctx context.Context, domain *model.Domain, changes []*dnsprovider.Change) error {
+	client, err := s.dnsClient(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	return dnsprovider.Apply(ctx, client, domainZone(domain), changes)
+}
+
+func (s *domainService) dnsClient(ctx context.Context, domain *model.Domain) (dnsprovider.DNSProvider, error) {
+	provider, err := s.findDNSProvider(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.dnsProviderService.Client(provider)
+}
+
+// findDNSProvider returns the DNS provider of the domain, providers of other
+// workspaces are not found
+func (s *domainService) findDNSProvider(ctx context.Context, domain *model.Domain) (*model.DNSProvider, error) {
+	if domain.DNSProviderId == nil {
+		return nil, ErrDNSProviderNotFound
+	}
+	provider, err := s.dnsProviderService.Get(ctx, *domain.DNSProviderId)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil || provider.WorkspaceId != domain.WorkspaceId {
+		return nil, ErrDNSProviderNotFound
+	}
+
+	return provider, nil
+}
+
+// recordChanges returns the changes of the action the live records of the
+// zone need. Records which are already live aren't upserted and records which
+// aren't live aren't deleted. The DMARC record is only published when the name
+// has no DMARC record and is never deleted, the policy belongs to the customer
+func recordChanges(ctx context.Context, client dnsprovider.DNSProvider, zone string, domain *model.Domain, action string) ([]*dnsprovider.Change, error) {
+	changes := []*dnsprovider.Change{}
+	for _, record := range domain.Records() {
+		change := &dnsprovider.Change{
+			Action: action,
+			Record: dnsprovider.Record{
+				Name:     domain.RecordName(record),
+				Type:     record.Type,
+				Value:    record.Value,
+				TTL:      record.TTL,
+				Priority: record.Priority,
+			},
+		}
+		isDMARC := isDMARCRecord(record)
+		if isDMARC && action == dnsprovider.ChangeActionDelete {
+			continue
+		}
+		live, err := client.List(ctx, zone, change.Record.Name, change.Record.Type)
+		if err != nil {
+			return nil, err
+		}
+		exists := slices.ContainsFunc(live, change.Record.Equal)
+		switch {
+		case action == dnsprovider.ChangeActionDelete && !exists:
+			continue
+		case action == dnsprovider.ChangeActionUpsert && exists:
+			continue
+		case action == dnsprovider.ChangeActionUpsert && isDMARC && slices.ContainsFunc(live, func(r dnsprovider.Record) bool {
+			return isDMARCRecord(constant.DomainRecord{Type: r.Type, Value: r.Value})
+		}):
+			continue
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+func isDMARCRecord(record constant.DomainRecord) bool {
+	return record.Type == "TXT" && strings.HasPrefix(strings.ToLower(record.Value), "v=dmarc1")
+}
+
+// domainZone is the registered domain, the records are published in its zone
+func domainZone(domain *model.Domain) string {
+	zone, err := publicsuffix.EffectiveTLDPlusOne(domain.Name)
+	if err != nil {
+		return domain.Name
+	}
+
+	return zone
+}
+
+// StartReconciler verifies the domains in the background, every domain is
+// checked once per verification interval
+func (s *domainService) StartReconciler(ctx context.Context) {
+	ticker := time.NewTicker(domainReconcilerInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				interval := time.Duration(s.config.Domain.VerificationIntervalInSeconds) * time.Second
+				domains, err := s.repository.Domain.FindDueForVerification(ctx, now.Add(-interval), s.config.Domain.VerificationBatchSize)
+				if err != nil {
+					s.logger.Error().Err(err).Msg("failed to find domains due for verification")
+					continue
+				}
+				for _, domain := range domains {
+					err = s.Verify(ctx, domain)
+					if err != nil {
+						s.logger.Error().Err(err).Str("domainId", domain.Id.String()).Msg("failed to verify domain")
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Verify checks the SES identity and the DNS records of the domain, updates
+// their status and emits an event when the domain becomes active or inactive
+func (s *domainService) Verify(ctx context.Context, domain *model.Domain) error {
+	identity, err := s.ses.GetEmailIdentity(ctx, domain)
+	if err != nil {
+		return err
+	}
+	for _, records := range []constant.JSONDomainRecords{domain.DKIMRecords, domain.SPFRecords, domain.DMARCRecords} {
+		for i := range records {
+			records[i].Status = s.verifyRecord(ctx, domain.RecordName(records[i]), records[i])
+		}
+	}
+	previousStatus := domain.Status
+	var updated bool
+	err = s.Transact(ctx, func(ctx context.Context, service *Service) error {
+		// a DKIM rotation may have changed the records while they were checked
+		current, err := service.repository.Domain.FindByIdForUpdate(ctx, domain.Id)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return errors.New("domain not found")
+		}
+		domain.DKIMRecords = mergeRecordStatus(current.DKIMRecords, domain.DKIMRecords)
+		domain.DKIMSelector = current.DKIMSelector
+		domain.PrivateKey = current.PrivateKey
+		updateMailFrom(domain, identity.MailFromAttributes)
+		domain.Status = domainStatus(domain, identity.VerifiedForSendingStatus, identity.DkimAttributes)
+		now := time.Now().UTC()
+		domain.CheckedAt = &now
+		updated, err = service.repository.Domain.UpdateVerification(ctx, domain, previousStatus)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// another check changed the status first
+	if !updated {
+		return nil
+	}
+	err = s.advanceDKIMRotation(ctx, domain)
+	if err != nil {
+		s.logger.Error().Err(err).Str("domainId", domain.Id.String()).Msg("failed to rotate DKIM key")
+	}
+	err = s.ipPoolService.ReconcileDomain(ctx, domain)
+	if err != nil {
+		s.logger.Error().Err(err).Str("domainId", domain.Id.String()).Msg("failed to reconcile IP pools")
+	}
+	if domain.Status == previousStatus {
+		return nil
+	}
+	var eventType constant.EventType
+	switch domain.Status {
+	case constant.DomainStatusActive:
+		eventType = constant.EventTypeDomainVerified
+	case constant.DomainStatusInactive:
+		eventType = constant.EventTypeDomainFailed
+	default:
+		return nil
+	}
+	event := &model.Event{
+		Base: model.Base{
+			Id: *s.uidGenerator.Next(),
+		},
+		EventType:   eventType,
+		Receipients: model.JSONBArray{},
+		MetaData: model.EventMetaData{
+			"domainId":       domain.Id.String(),
+			"domain":         domain.Name,
+			"status":         domain.Status,
+			"previousStatus": previousStatus,
+		},
+		OrganizationId: domain.OrganizationId,
+		WorkspaceId:    domain.WorkspaceId,
+	}
+	s.eventService.Create(ctx, event)
+	s.eventService.Publish(ctx, []*model.Event{event})
+
+	return nil
+}
+
+// mergeRecordStatus returns the current records with the status of the same
+// checked record, records which weren't checked keep their status
+func mergeRecordStatus(current constant.JSONDomainRecords, checked constant.JSONDomainRecords) constant.JSONDomainRecords {
+	records := make(constant.JSONDomainRecords, len(current))
+	copy(records, current)
+	for i := range records {
+		for _, record := range checked {
+			if record.Name == records[i].Name && record.Type == records[i].Type && record.Value == records[i].Value {
+				records[i].Status = record.Status
+				break
+			}
+		}
+	}
+
+	return records
+}
+
+// verifyRecord resolves the record, the status is kept when the lookup fails
+// for another reason than a missing record
+func (s *domainService) verifyRecord(ctx context.Context, name string, record constant.DomainRecord) constant.DNSStatus {
+	var values []string
+	var err error
+	switch record.Type {
+	case "TXT":
+		values, err = s.resolver.LookupTXT(ctx, name)
+	case "MX":
+		var mxs []*net.MX
+		mxs, err = s.resolver.LookupMX(ctx, name)
+		for _, mx := range mxs {
+			values = append(values, mx.Host)
+		}
+	default:
+		return record.Status
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return constant.DNSStatusInactive
+	}
+	if err != nil {
+		s.logger.Warn().Err(err).Str("name", name).Msg("failed to resolve domain record")
+		return record.Status
+	}
+
+	return recordStatus(record, values)
+}
+
+// recordStatus compares the resolved values with the expected record, a
+// record of the same kind with another value is incomplete
+func recordStatus(record constant.DomainRecord, values []string) constant.DNSStatus {
+	status := constant.DNSStatusInactive
+	expected := strings.TrimSuffix(record.Value, ".")
+	kind := strings.ToLower(strings.Fields(expected + " ")[0])
+	for _, value := range values {
+		value = strings.TrimSuffix(value, ".")
+		lower := strings.ToLower(value)
+		switch {
+		case record.Type == "MX":
+			if strings.EqualFold(value, expected) {
+				return constant.DNSStatusActive
+			}
+			status = constant.DNSStatusIncomplete
+		case kind == "v=spf1":
+			if !strings.HasPrefix(lower, "v=spf1") {
+				continue
+			}
+			if strings.Contains(lower, "include:amazonses.com") {
+				return constant.DNSStatusActive
+			}
+			status = constant.DNSStatusIncomplete
+		case strings.HasPrefix(kind, "v=dmarc1"):
+			if strings.HasPrefix(lower, "v=dmarc1") {
+				return constant.DNSStatusActive
+			}
+		default:
+			// DKIM keys may be split by spaces
+			compact := strings.Join(strings.Fields(value), "")
+			if strings.Contains(compact, expected) {
+				return constant.DNSStatusActive
+			}
+			if strings.Contains(compact, "p=") {
+				status = constant.DNSStatusIncomplete
+			}
+		}
+	}
+
+	return status
+}
+
+// updateMailFrom sets the status of the custom MAIL FROM domain SES checked,
+// the domain keeps its status when SES has no MAIL FROM attributes
+func updateMailFrom(domain *model.Domain, attributes *types.MailFromAttributes) {
+	if attributes == nil {
+		return
+	}
+	if domain.MailFromDomain == "" {
+		domain.MailFromDomain = aws.ToString(attributes.MailFromDomain)
+	}
+	domain.MailFromStatus = constant.MailFromStatus(attributes.MailFromDomainStatus)
+}
+
+// domainStatus is active when SES verified the domain and the DKIM record of
+// the signing key, the SPF and MX records are set up, DMARC is recommended but
+// not required
+func domainStatus(domain *model.Domain, verified bool, dkim *types.DkimAttributes) constant.DomainStatus {
+	required := make([]constant.DomainRecord, 0, len(domain.DKIMRecords)+len(domain.SPFRecords))
+	for _, record := range domain.DKIMRecords {
+		if isDKIMRecordOf(record, domain.DKIMSelector) {
+			required = append(required, record)
+		}
+	}
+	required = append(required, domain.SPFRecords...)
+	active := 0
+	for _, record := range required {
+		if record.Status == constant.DNSStatusActive {
+			active++
+		}
+	}
+	dkimFailed := dkim != nil && dkim.Status == types.DkimStatusFailed
+	switch {
+	case verified && active == len(required):
+		return constant.DomainStatusActive
+	case dkimFailed:
+		return constant.DomainStatusInactive
+	case active > 0:
+		return constant.DomainStatusIncomplete
+	case domain.Status == constant.DomainStatusPending:
+		return constant.DomainStatusPending
+	default:
+		return constant.DomainStatusInactive
+	}
+}
+
+func (s *domainService) setupRecords(domain *model.Domain, subdomain string, publicKey string) *model.Domain {
+	domain.DKIMRecords = constant.JSONDomainRecords{dkimRecord(domain.DKIMSelector, subdomain, publicKey)}
 	domain.SPFRecords = constant.JSONDomainRecords{
 		{
 			Name:   formatSubdomain([]string{constant.CustomDomainPrefix, subdomain}),
@@ -118,6 +637,28 @@ func (s *domainService) setupRecords(domain *model.Domain, subdomain string, pub
 		Type:   "TXT",
 		Status: constant.DNSStatusPending,
 	}}
+	// the SPF and MX records are the ones of the custom MAIL FROM domain
+	domain.MailFromDomain = domain.RecordName(domain.SPFRecords[0])
+	domain.MailFromStatus = constant.MailFromStatusPending
+	if domain.MailFromBehaviorOnMXFailure == "" {
+		domain.MailFromBehaviorOnMXFailure = constant.MailFromBehavior(s.config.Domain.MailFromBehaviorOnMXFailure)
+	}
 
 	return domain
 }
+
+// domainSubdomain returns the part of the domain name before the registered
+// domain
+func domainSubdomain(name string) (string, error) {
+	suffix, icann := publicsuffix.PublicSuffix(name)
+	if !icann {
+		return "", errors.New("invalid domain")
+	}
+	nameParts := strings.Split(name, ".")
+	suffixParts := strings.Split(suffix, ".")
+	if len(nameParts) <= len(suffixParts) {
+		return "", errors.New("invalid domain")
+	}
+
+	return strings.Join(nameParts[:len(nameParts)-len(suffixParts)-1], "."), nil
+}
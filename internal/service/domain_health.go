@@ -0,0 +1,442 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+const (
+	HealthStatusPass = "PASS"
+	HealthStatusWarn = "WARN"
+	HealthStatusFail = "FAIL"
+)
+
+// spfMaxLookups is the limit of DNS lookups while evaluating SPF, receivers
+// fail SPF above it
+const spfMaxLookups = 10
+
+// dkimRecommendedKeySize is the smallest DKIM key size which is not flagged
+const dkimRecommendedKeySize = 2048
+
+// reverseDNSMaxHosts limits the mail servers checked for reverse DNS
+const reverseDNSMaxHosts = 3
+
+type DomainHealthCheck struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Score    int    `json:"score"`
+	MaxScore int    `json:"maxScore"`
+	Value    string `json:"value,omitempty"` // Record found in DNS
+	Message  string `json:"message"`
+	Fix      string `json:"fix,omitempty"`
+}
+
+type DomainHealthReport struct {
+	DomainId  uid.UID              `json:"domainId"`
+	Domain    string               `json:"domain"`
+	Score     int                  `json:"score"` // Out of 100
+	Checks    []*DomainHealthCheck `json:"checks"`
+	CheckedAt time.Time            `json:"checkedAt"`
+}
+
+// Health checks the live DNS records of the domain which affect
+// deliverability, every check is scored and failed checks come with a fix
+func (s *domainService) Health(ctx context.Context, domain *model.Domain) (*DomainHealthReport, error) {
+	report := &DomainHealthReport{
+		DomainId:  domain.Id,
+		Domain:    domain.Name,
+		Checks:    make([]*DomainHealthCheck, 0),
+		CheckedAt: time.Now().UTC(),
+	}
+	checks := []func(ctx context.Context, domain *model.Domain) *DomainHealthCheck{
+		s.checkSPF,
+		s.checkDKIM,
+		s.checkDMARC,
+		s.checkMX,
+		s.checkReverseDNS,
+		s.checkBIMI,
+	}
+	score, maxScore := 0, 0
+	for _, check := range checks {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		result := check(ctx, domain)
+		report.Checks = append(report.Checks, result)
+		score += result.Score
+		maxScore += result.MaxScore
+	}
+	if maxScore > 0 {
+		report.Score = score * 100 / maxScore
+	}
+
+	return report, nil
+}
+
+func newHealthCheck(name string, maxScore int) *DomainHealthCheck {
+	return &DomainHealthCheck{
+		Name:     name,
+		MaxScore: maxScore,
+	}
+}
+
+// set records the result of the check, a warning scores half of the points
+func (c *DomainHealthCheck) set(status string, message string, fix string) *DomainHealthCheck {
+	c.Status = status
+	c.Message = message
+	c.Fix = fix
+	switch status {
+	case HealthStatusPass:
+		c.Score = c.MaxScore
+	case HealthStatusWarn:
+		c.Score = c.MaxScore / 2
+	default:
+		c.Score = 0
+	}
+
+	return c
+}
+
+// checkSPF checks the SPF record of the MAIL FROM domain, the domain SPF is
+// evaluated for
+func (s *domainService) checkSPF(ctx context.Context, domain *model.Domain) *DomainHealthCheck {
+	check := newHealthCheck("spf", 25)
+	name := domain.MailFromDomain
+	if name == "" {
+		name = domain.Name
+	}
+	fix := fmt.Sprintf("Publish the TXT record %s \"v=spf1 include:amazonses.com -all\"", name)
+	records, err := s.lookupTXT(ctx, name)
+	if err != nil {
+		return check.set(HealthStatusWarn, "The SPF record could not be resolved: "+err.Error(), "")
+	}
+	spf := filterRecords(records, "v=spf1")
+	switch {
+	case len(spf) == 0:
+		return check.set(HealthStatusFail, "No SPF record is published for "+name, fix)
+	case len(spf) > 1:
+		check.Value = strings.Join(spf, "\n")
+		return check.set(HealthStatusFail, "Multiple SPF records are published, receivers treat this as an error", "Merge the SPF records of "+name+" into one")
+	}
+	check.Value = spf[0]
+	lookups, err := s.spfLookups(ctx, spf[0], map[string]bool{name: true})
+	if err != nil {
+		return check.set(HealthStatusWarn, "The includes of the SPF record could not be resolved: "+err.Error(), "")
+	}
+	terms := strings.Fields(strings.ToLower(spf[0]))
+	all := ""
+	if len(terms) > 0 && strings.HasSuffix(terms[len(terms)-1], "all") {
+		all = terms[len(terms)-1]
+	}
+	switch {
+	case lookups > spfMaxLookups:
+		return check.set(HealthStatusFail, fmt.Sprintf("The SPF record needs %d DNS lookups, receivers fail SPF above %d", lookups, spfMaxLookups), "Remove unused includes or flatten them into ip4 and ip6 mechanisms")
+	case !containsTerm(terms, "include:amazonses.com"):
+		return check.set(HealthStatusFail, "The SPF record doesn't include amazonses.com", fix)
+	case all == "+all" || all == "all":
+		return check.set(HealthStatusFail, "The SPF record allows every server to send", "End the SPF record with -all or ~all")
+	case all == "" || all == "?all":
+		return check.set(HealthStatusWarn, "The SPF record doesn't fail other servers", "End the SPF record with -all or ~all")
+	}
+
+	return check.set(HealthStatusPass, fmt.Sprintf("The SPF record includes amazonses.com and needs %d DNS lookups", lookups), "")
+}
+
+// spfLookups counts the DNS lookups the mechanisms of the SPF record need,
+// includes and redirects are followed. path holds the domains of the includes
+// leading to the record, a domain included twice elsewhere is no loop
+func (s *domainService) spfLookups(ctx context.Context, record string, path map[string]bool) (int, error) {
+	lookups := 0
+	for _, term := range strings.Fields(strings.ToLower(record))[1:] {
+		term = strings.TrimLeft(term, "+-~?")
+		var target string
+		switch {
+		case strings.HasPrefix(term, "include:"):
+			target = strings.TrimPrefix(term, "include:")
+		case strings.HasPrefix(term, "redirect="):
+			target = strings.TrimPrefix(term, "redirect=")
+		case term == "a", term == "mx", term == "ptr",
+			strings.HasPrefix(term, "a:"), strings.HasPrefix(term, "a/"),
+			strings.HasPrefix(term, "mx:"), strings.HasPrefix(term, "mx/"),
+			strings.HasPrefix(term, "ptr:"), strings.HasPrefix(term, "exists:"):
+			lookups++
+			continue
+		default:
+			continue
+		}
+		lookups++
+		// a loop is reported as too many lookups
+		if path[target] || lookups > spfMaxLookups {
+			return spfMaxLookups + 1, nil
+		}
+		records, err := s.lookupTXT(ctx, target)
+		if err != nil {
+			return 0, err
+		}
+		path[target] = true
+		for _, included := range filterRecords(records, "v=spf1") {
+			n, err := s.spfLookups(ctx, included, path)
+			if err != nil {
+				return 0, err
+			}
+			lookups += n
+		}
+		delete(path, target)
+		if lookups > spfMaxLookups {
+			return spfMaxLookups + 1, nil
+		}
+	}
+
+	return lookups, nil
+}
+
+// checkDKIM checks the record of the selector SES signs with
+func (s *domainService) checkDKIM(ctx context.Context, domain *model.Domain) *DomainHealthCheck {
+	check := newHealthCheck("dkim", 25)
+	record, ok := findDKIMRecord(domain, domain.DKIMSelector)
+	if !ok {
+		return check.set(HealthStatusFail, "The domain has no DKIM record for the selector "+domain.DKIMSelector, "Rotate the DKIM key of the domain")
+	}
+	name := domain.RecordName(record)
+	fix := fmt.Sprintf("Publish the TXT record %s \"%s\"", name, record.Value)
+	records, err := s.lookupTXT(ctx, name)
+	if err != nil {
+		return check.set(HealthStatusWarn, "The DKIM record could not be resolved: "+err.Error(), "")
+	}
+	if len(records) == 0 {
+		return check.set(HealthStatusFail, "No DKIM record is published for the selector "+domain.DKIMSelector, fix)
+	}
+	check.Value = records[0]
+	if recordStatus(record, records) != constant.DNSStatusActive {
+		return check.set(HealthStatusFail, "The DKIM record doesn't match the signing key", fix)
+	}
+	if domain.PrivateKey.N != nil && domain.PrivateKey.N.BitLen() < dkimRecommendedKeySize {
+		return check.set(HealthStatusWarn, fmt.Sprintf("The DKIM key has %d bits, %d bits are recommended", domain.PrivateKey.N.BitLen(), dkimRecommendedKeySize), "Rotate the DKIM key of the domain")
+	}
+
+	return check.set(HealthStatusPass, "The DKIM record of the selector "+domain.DKIMSelector+" is published", "")
+}
+
+// checkDMARC checks the policy of the domain, the policy of the registered
+// domain applies to subdomains without their own
+func (s *domainService) checkDMARC(ctx context.Context, domain *model.Domain) *DomainHealthCheck {
+	check := newHealthCheck("dmarc", 20)
+	names := []string{"_dmarc." + domain.Name}
+	if zone := domainZone(domain); zone != domain.Name {
+		names = append(names, "_dmarc."+zone)
+	}
+	var dmarc []string
+	for _, name := range names {
+		records, err := s.lookupTXT(ctx, name)
+		if err != nil {
+			return check.set(HealthStatusWarn, "The DMARC record could not be resolved: "+err.Error(), "")
+		}
+		dmarc = filterRecords(records, "v=dmarc1")
+		if len(dmarc) > 0 {
+			break
+		}
+	}
+	if len(dmarc) == 0 {
+		return check.set(HealthStatusFail, "No DMARC record is published", fmt.Sprintf("Publish the TXT record %s \"v=DMARC1; p=none; rua=mailto:dmarc@%s\" and move to p=quarantine once the reports pass", names[0], domainZone(domain)))
+	}
+	check.Value = dmarc[0]
+	tags := dmarcTags(dmarc[0])
+	pct := 100
+	if value, ok := tags["pct"]; ok {
+		pct, _ = strconv.Atoi(value)
+	}
+	switch {
+	case tags["p"] == "none":
+		return check.set(HealthStatusWarn, "The DMARC policy only monitors, spoofed emails are delivered", "Review the DMARC reports and change the policy to p=quarantine, then p=reject")
+	case tags["p"] != "quarantine" && tags["p"] != "reject":
+		return check.set(HealthStatusFail, "The DMARC record has no valid policy", "Set the policy of the DMARC record to p=none, p=quarantine or p=reject")
+	case pct < 100:
+		return check.set(HealthStatusWarn, fmt.Sprintf("The DMARC policy applies to %d%% of the emails", pct), "Remove the pct tag of the DMARC record")
+	case tags["rua"] == "":
+		return check.set(HealthStatusWarn, "The DMARC record doesn't request aggregate reports", "Add rua=mailto:<address> to the DMARC record and import the reports")
+	}
+
+	return check.set(HealthStatusPass, "The DMARC policy is "+tags["p"], "")
+}
+
+// checkMX checks the MAIL FROM domain receives bounces through SES and the
+// domain can receive replies
+func (s *domainService) checkMX(ctx context.Context, domain *model.Domain) *DomainHealthCheck {
+	check := newHealthCheck("mx", 15)
+	name := domain.MailFromDomain
+	if name == "" {
+		name = domain.Name
+	}
+	expected := fmt.Sprintf("feedback-smtp.%s.amazonses.com", domain.Region)
+	hosts, err := s.lookupMX(ctx, name)
+	if err != nil {
+		return check.set(HealthStatusWarn, "The MX record could not be resolved: "+err.Error(), "")
+	}
+	check.Value = strings.Join(hosts, ", ")
+	if !containsTerm(hosts, expected) {
+		return check.set(HealthStatusFail, "The MAIL FROM domain "+name+" doesn't route bounces to SES", fmt.Sprintf("Publish the MX record %s 10 %s", name, expected))
+	}
+	if name == domain.Name {
+		return check.set(HealthStatusPass, "Bounces are routed to SES", "")
+	}
+	hosts, err = s.lookupMX(ctx, domain.Name)
+	if err != nil {
+		return check.set(HealthStatusWarn, "The MX record could not be resolved: "+err.Error(), "")
+	}
+	if len(hosts) == 0 {
+		return check.set(HealthStatusWarn, "The domain has no MX record, replies can't be delivered", "Publish an MX record for "+domain.Name)
+	}
+
+	return check.set(HealthStatusPass, "Bounces are routed to SES and the domain receives replies", "")
+}
+
+// checkReverseDNS checks the mail servers of the domain have forward
+// confirmed reverse DNS, SES manages the reverse DNS of its sending IPs
+func (s *domainService) checkReverseDNS(ctx context.Context, domain *model.Domain) *DomainHealthCheck {
+	check := newHealthCheck("reverseDns", 10)
+	hosts, err := s.lookupMX(ctx, domain.Name)
+	if err != nil {
+		return check.set(HealthStatusWarn, "The MX record could not be resolved: "+err.Error(), "")
+	}
+	if len(hosts) == 0 {
+		return check.set(HealthStatusWarn, "The domain has no mail servers to check", "")
+	}
+	if len(hosts) > reverseDNSMaxHosts {
+		hosts = hosts[:reverseDNSMaxHosts]
+	}
+	missing := make([]string, 0)
+	for _, host := range hosts {
+		addrs, err := s.resolver.LookupHost(ctx, host)
+		if err != nil {
+			missing = append(missing, host)
+			continue
+		}
+		for _, addr := range addrs {
+			if !s.forwardConfirmed(ctx, addr) {
+				missing = append(missing, host+" ("+addr+")")
+			}
+		}
+	}
+	if len(missing) > 0 {
+		check.Value = strings.Join(missing, ", ")
+		return check.set(HealthStatusFail, "Mail servers without forward confirmed reverse DNS: "+check.Value, "Ask the provider of the mail servers to set PTR records which resolve back to the addresses")
+	}
+
+	return check.set(HealthStatusPass, "The mail servers have forward confirmed reverse DNS", "")
+}
+
+// checkBIMI checks the BIMI record which shows the brand logo in supporting
+// inboxes, it requires an enforced DMARC policy
+func (s *domainService) checkBIMI(ctx context.Context, domain *model.Domain) *DomainHealthCheck {
+	check := newHealthCheck("bimi", 5)
+	name := "default._bimi." + domain.Name
+	records, err := s.lookupTXT(ctx, name)
+	if err != nil {
+		return check.set(HealthStatusWarn, "The BIMI record could not be resolved: "+err.Error(), "")
+	}
+	bimi := filterRecords(records, "v=bimi1")
+	if len(bimi) == 0 {
+		return check.set(HealthStatusWarn, "No BIMI record is published", fmt.Sprintf("Publish the TXT record %s \"v=BIMI1; l=<https URL of an SVG logo>\" once DMARC is enforced", name))
+	}
+	check.Value = bimi[0]
+
+	return check.set(HealthStatusPass, "A BIMI record is published", "")
+}
+
+func (s *domainService) forwardConfirmed(ctx context.Context, addr string) bool {
+	names, err := s.resolver.LookupAddr(ctx, addr)
+	if err != nil {
+		return false
+	}
+	for _, name := range names {
+		addrs, err := s.resolver.LookupHost(ctx, name)
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if a == addr {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// lookupTXT resolves the TXT records of the name, a missing name has no
+// records
+func (s *domainService) lookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, err := s.resolver.LookupTXT(ctx, name)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return []string{}, nil
+	}
+
+	return records, err
+}
+
+// lookupMX resolves the mail servers of the name without the trailing dot, a
+// missing name has no mail servers
+func (s *domainService) lookupMX(ctx context.Context, name string) ([]string, error) {
+	mxs, err := s.resolver.LookupMX(ctx, name)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]string, 0, len(mxs))
+	for _, mx := range mxs {
+		hosts = append(hosts, strings.ToLower(strings.TrimSuffix(mx.Host, ".")))
+	}
+
+	return hosts, nil
+}
+
+// filterRecords returns the records starting with the version tag
+func filterRecords(records []string, version string) []string {
+	filtered := make([]string, 0)
+	for _, record := range records {
+		lower := strings.ToLower(strings.TrimSpace(record))
+		if lower == version || strings.HasPrefix(lower, version+" ") || strings.HasPrefix(lower, version+";") {
+			filtered = append(filtered, strings.TrimSpace(record))
+		}
+	}
+
+	return filtered
+}
+
+func containsTerm(terms []string, term string) bool {
+	for _, t := range terms {
+		if strings.EqualFold(strings.TrimLeft(t, "+"), term) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dmarcTags parses the tags of a DMARC record, names and values are lower
+// cased
+func dmarcTags(record string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(record, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.ToLower(strings.TrimSpace(name))] = strings.ToLower(strings.TrimSpace(value))
+	}
+
+	return tags
+}
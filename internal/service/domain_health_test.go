@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// newTestResolver returns a resolver answering TXT queries from the records,
+// served by an in-process DNS server
+func newTestResolver(t *testing.T, records map[string][]string) *net.Resolver {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		question := r.Question[0]
+		values, ok := records[strings.TrimSuffix(question.Name, ".")]
+		if !ok {
+			m.Rcode = dns.RcodeNameError
+		}
+		if question.Qtype == dns.TypeTXT {
+			for _, value := range values {
+				m.Answer = append(m.Answer, &dns.TXT{
+					Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+					Txt: []string{value},
+				})
+			}
+		}
+		w.WriteMsg(m)
+	})}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}
+}
+
+func TestSPFLookups(t *testing.T) {
+	tests := []struct {
+		name    string
+		records map[string][]string
+		want    int
+	}{
+		{
+			name: "flat",
+			records: map[string][]string{
+				"example.com": {"v=spf1 a mx include:amazonses.com -all"},
+			},
+			want: 3,
+		},
+		{
+			name: "domain included on two branches",
+			records: map[string][]string{
+				"example.com":   {"v=spf1 include:a.example.net include:b.example.net -all"},
+				"a.example.net": {"v=spf1 include:_spf.example.org -all"},
+				"b.example.net": {"v=spf1 include:_spf.example.org -all"},
+			},
+			want: 4,
+		},
+		{
+			name: "loop",
+			records: map[string][]string{
+				"example.com":   {"v=spf1 include:a.example.net -all"},
+				"a.example.net": {"v=spf1 include:example.com -all"},
+			},
+			want: spfMaxLookups + 1,
+		},
+		{
+			name: "redirect to itself",
+			records: map[string][]string{
+				"example.com": {"v=spf1 redirect=example.com"},
+			},
+			want: spfMaxLookups + 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &domainService{resolver: newTestResolver(t, tt.records)}
+			got, err := service.spfLookups(context.Background(), tt.records["example.com"][0], map[string]bool{"example.com": true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %d lookups, got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/dnsprovider"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+// fakeDNSProvider is a zone in memory, an upsert replaces the records of the
+// name and type like the providers do
+type fakeDNSProvider struct {
+	records []dnsprovider.Record
+	changes int
+}
+
+func (p *fakeDNSProvider) Upsert(_ context.Context, _ string, record dnsprovider.Record) error {
+	p.changes++
+	records := []dnsprovider.Record{}
+	for _, r := range p.records {
+		if !strings.EqualFold(r.Name, record.Name) || r.Type != record.Type {
+			records = append(records, r)
+		}
+	}
+	p.records = append(records, record)
+
+	return nil
+}
+
+func (p *fakeDNSProvider) Delete(_ context.Context, _ string, record dnsprovider.Record) error {
+	p.changes++
+	records := []dnsprovider.Record{}
+	for _, r := range p.records {
+		if !r.Equal(record) {
+			records = append(records, r)
+		}
+	}
+	p.records = records
+
+	return nil
+}
+
+func (p *fakeDNSProvider) List(_ context.Context, _ string, name string, recordType string) ([]dnsprovider.Record, error) {
+	records := []dnsprovider.Record{}
+	for _, r := range p.records {
+		if strings.EqualFold(r.Name, name) && r.Type == recordType {
+			records = append(records, r)
+		}
+	}
+
+	return records, nil
+}
+
+type fakeDNSProviderService struct {
+	DNSProviderService
+	provider *model.DNSProvider
+	client   dnsprovider.DNSProvider
+}
+
+func (s *fakeDNSProviderService) Get(_ context.Context, id uid.UID) (*model.DNSProvider, error) {
+	if s.provider.Id != id {
+		return nil, nil
+	}
+
+	return s.provider, nil
+}
+
+func (s *fakeDNSProviderService) Client(_ *model.DNSProvider) (dnsprovider.DNSProvider, error) {
+	return s.client, nil
+}
+
+func newTestDomain(t *testing.T, zone *fakeDNSProvider) (*domainService, *model.Domain) {
+	t.Helper()
+	workspaceId := *uid.NewUID(1)
+	provider := &model.DNSProvider{Base: model.Base{Id: *uid.NewUID(2)}, WorkspaceId: workspaceId}
+	service := NewDomainService(
+		newTestBaseService(&model.Repository{}),
+		nil,
+		nil,
+		&fakeDNSProviderService{provider: provider, client: zone},
+		nil,
+	).(*domainService)
+	domain := &model.Domain{
+		Name:          "example.com",
+		Region:        constant.AwsRegionNorthVirginia,
+		DKIMSelector:  "s1",
+		DNSProviderId: &provider.Id,
+		WorkspaceId:   workspaceId,
+	}
+
+	return service, service.setupRecords(domain, "", "KEY")
+}
+
+func changedRecords(changes []*dnsprovider.Change) []string {
+	records := make([]string, 0, len(changes))
+	for _, change := range changes {
+		records = append(records, change.Action+" "+change.Record.Type+" "+change.Record.Name)
+	}
+
+	return records
+}
+
+func TestPublishRecordsToAnEmptyZone(t *testing.T) {
+	zone := &fakeDNSProvider{}
+	service, domain := newTestDomain(t, zone)
+
+	changes, err := service.PublishRecords(context.Background(), domain, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"UPSERT TXT s1._domainkey.example.com",
+		"UPSERT TXT ses.example.com",
+		"UPSERT MX ses.example.com",
+		"UPSERT TXT _dmarc.example.com",
+	}
+	if got := changedRecords(changes); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected changes %v, got %v", want, got)
+	}
+	if len(zone.records) != len(want) {
+		t.Fatalf("expected %d records in the zone, got %+v", len(want), zone.records)
+	}
+	// publishing again changes nothing
+	changes, err = service.PublishRecords(context.Background(), domain, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("expected no changes, got %v", changedRecords(changes))
+	}
+}
+
+func TestPublishRecordsKeepsTheDMARCRecordOfTheZone(t *testing.T) {
+	dmarc := dnsprovider.Record{Name: "_dmarc.example.com", Type: "TXT", Value: "v=DMARC1; p=reject; rua=mailto:dmarc@example.com", TTL: 3600}
+	zone := &fakeDNSProvider{records: []dnsprovider.Record{dmarc}}
+	service, domain := newTestDomain(t, zone)
+
+	changes, err := service.PublishRecords(context.Background(), domain, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range changes {
+		if change.Record.Name == dmarc.Name {
+			t.Fatalf("expected the DMARC record to be kept, got %s", change.Action)
+		}
+	}
+	records, _ := zone.List(context.Background(), "example.com", dmarc.Name, "TXT")
+	if len(records) != 1 || records[0] != dmarc {
+		t.Fatalf("expected the DMARC record %+v, got %+v", dmarc, records)
+	}
+}
+
+func TestPublishRecordsDryRunDiffsLiveRecords(t *testing.T) {
+	zone := &fakeDNSProvider{}
+	service, domain := newTestDomain(t, zone)
+	spf := domain.SPFRecords[0]
+	zone.records = []dnsprovider.Record{
+		{Name: domain.RecordName(spf), Type: spf.Type, Value: spf.Value, TTL: spf.TTL},
+		// an outdated DKIM key
+		{Name: "s1._domainkey.example.com", Type: "TXT", Value: "p=OLD", TTL: 300},
+	}
+
+	changes, err := service.PublishRecords(context.Background(), domain, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"UPSERT TXT s1._domainkey.example.com",
+		"UPSERT MX ses.example.com",
+		"UPSERT TXT _dmarc.example.com",
+	}
+	if got := changedRecords(changes); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected changes %v, got %v", want, got)
+	}
+	if zone.changes != 0 {
+		t.Fatalf("expected a dry run to leave the zone unchanged, got %d changes", zone.changes)
+	}
+}
+
+func TestDeleteRecordsKeepsDMARC(t *testing.T) {
+	zone := &fakeDNSProvider{}
+	service, domain := newTestDomain(t, zone)
+	_, err := service.PublishRecords(context.Background(), domain, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := service.syncRecords(context.Background(), domain, dnsprovider.ChangeActionDelete, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"DELETE TXT s1._domainkey.example.com",
+		"DELETE TXT ses.example.com",
+		"DELETE MX ses.example.com",
+	}
+	if got := changedRecords(changes); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected changes %v, got %v", want, got)
+	}
+	if len(zone.records) != 1 || zone.records[0].Name != "_dmarc.example.com" {
+		t.Fatalf("expected only the DMARC record to be left, got %+v", zone.records)
+	}
+}
+
+type fakeMailFromSESService struct {
+	SESService
+	err error
+	put []string // The MAIL FROM domains put
+}
+
+func (s *fakeMailFromSESService) PutMailFromAttributes(_ context.Context, domain *model.Domain) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.put = append(s.put, domain.MailFromDomain+" "+string(domain.MailFromBehaviorOnMXFailure))
+
+	return nil
+}
+
+func (r *fakeDomainRepository) UpdateMailFrom(_ context.Context, _ *model.Domain) error {
+	return nil
+}
+
+func TestUpdateMailFromStatus(t *testing.T) {
+	_, domain := newTestDomain(t, &fakeDNSProvider{})
+	if domain.MailFromDomain != "ses.example.com" || domain.MailFromStatus != constant.MailFromStatusPending {
+		t.Fatalf("expected a pending MAIL FROM domain, got %s %s", domain.MailFromDomain, domain.MailFromStatus)
+	}
+
+	for _, status := range []types.MailFromDomainStatus{
+		types.MailFromDomainStatusSuccess,
+		types.MailFromDomainStatusTemporaryFailure,
+		types.MailFromDomainStatusFailed,
+	} {
+		updateMailFrom(domain, &types.MailFromAttributes{
+			MailFromDomain:       aws.String("other.example.com"),
+			MailFromDomainStatus: status,
+		})
+		if domain.MailFromStatus != constant.MailFromStatus(status) {
+			t.Fatalf("expected the status %s, got %s", status, domain.MailFromStatus)
+		}
+		// the MAIL FROM domain of the records stays
+		if domain.MailFromDomain != "ses.example.com" {
+			t.Fatalf("expected the MAIL FROM domain of the records, got %s", domain.MailFromDomain)
+		}
+	}
+
+	// an identity without MAIL FROM attributes keeps the status
+	updateMailFrom(domain, nil)
+	if domain.MailFromStatus != constant.MailFromStatusFailed {
+		t.Fatalf("expected the status to stay, got %s", domain.MailFromStatus)
+	}
+	// a domain created before the MAIL FROM domain was tracked takes the one
+	// of SES
+	domain.MailFromDomain = ""
+	updateMailFrom(domain, &types.MailFromAttributes{
+		MailFromDomain:       aws.String("bounce.example.com"),
+		MailFromDomainStatus: types.MailFromDomainStatusSuccess,
+	})
+	if domain.MailFromDomain != "bounce.example.com" || domain.MailFromStatus != constant.MailFromStatusSuccess {
+		t.Fatalf("expected the MAIL FROM domain of SES, got %s %s", domain.MailFromDomain, domain.MailFromStatus)
+	}
+}
+
+func TestUpdateMailFromIsPendingUntilSESChecksIt(t *testing.T) {
+	service, domain := newTestDomain(t, &fakeDNSProvider{})
+	ses := &fakeMailFromSESService{}
+	service.ses = ses
+	service.repository.Domain = &fakeDomainRepository{}
+	domain.MailFromStatus = constant.MailFromStatusFailed
+	domain.MailFromDomain = ""
+
+	err := service.UpdateMailFrom(context.Background(), domain, constant.MailFromBehaviorRejectMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ses.put) != 1 || ses.put[0] != "ses.example.com REJECT_MESSAGE" {
+		t.Fatalf("expected the MAIL FROM domain of the records to be put, got %v", ses.put)
+	}
+	if domain.MailFromStatus != constant.MailFromStatusPending {
+		t.Fatalf("expected the MAIL FROM domain to be pending, got %s", domain.MailFromStatus)
+	}
+
+	// the status stays when SES doesn't take the MAIL FROM domain
+	domain.MailFromStatus = constant.MailFromStatusSuccess
+	ses.err = errors.New("throttled")
+	err = service.UpdateMailFrom(context.Background(), domain, "")
+	if err == nil {
+		t.Fatal("expected the SES error")
+	}
+	if domain.MailFromStatus != constant.MailFromStatusSuccess {
+		t.Fatalf("expected the status to stay, got %s", domain.MailFromStatus)
+	}
+}
@@ -10,32 +10,88 @@ import (
 
 	"github.com/usesend0/send0/internal/constant"
 	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
 )
 
+// ErrEmailNotSent is returned when SES didn't accept an email for a reason
+// which may go away, e.g. throttling. The email stays pending and can be
+// delivered again
+var ErrEmailNotSent = errors.New("email was not sent, it can be delivered again")
+
+var errSendingIdentityNotFound = errors.New("Domain not found or not active")
+
 type EmailService interface {
 	Send(ctx context.Context, requestId string, email []*model.Email) ([]string, error)
+	Deliver(ctx context.Context, emails []*model.Email) error
 }
 
 type emailService struct {
 	*baseService
-	sesService   SESService
-	eventService EventSevice
+	sesService    SESService
+	eventService  EventSevice
+	senderService SenderService
+}
+
+// sendingIdentity is the SES identity an email is sent through, the domain is
+// nil for a mailbox sender
+type sendingIdentity struct {
+	region         constant.AwsRegion
+	failoverRegion *constant.AwsRegion // Sends when the region is throttled
+	configSetName  string
+	domain         *model.Domain
+	// Send the broadcast emails when an IP pool is applied to the domain in
+	// the region
+	marketingConfigSetName         string
+	failoverMarketingConfigSetName string
 }
 
-func NewEmailService(baseService *baseService, sesService SESService, eventService EventSevice) EmailService {
+// configSet returns the configuration set the email is sent through in the
+// primary or the failover region, the configuration set of the domain has the
+// same name in both
+func (i *sendingIdentity) configSet(email *model.Email, failover bool) string {
+	name := i.marketingConfigSetName
+	if failover {
+		name = i.failoverMarketingConfigSetName
+	}
+	if _, ok := email.MetaData["broadcastId"]; ok && name != "" {
+		return name
+	}
+
+	return i.configSetName
+}
+
+func NewEmailService(
+	baseService *baseService,
+	sesService SESService,
+	eventService EventSevice,
+	senderService SenderService,
+) EmailService {
 	return &emailService{
-		baseService:  baseService,
-		sesService:   sesService,
-		eventService: eventService,
+		baseService:   baseService,
+		sesService:    sesService,
+		eventService:  eventService,
+		senderService: senderService,
 	}
 }
 
+// Send saves the emails and sends them through SES, an email whose from
+// address the workspace can't send from is rejected before any is saved. A
+// broadcast email to a contact which has one already returns
+// model.ErrEmailExists. The ids are returned with ErrEmailNotSent when an
+// email is saved but couldn't be sent yet
 func (s *emailService) Send(ctx context.Context, requestId string, emails []*model.Email) ([]string, error) {
+	for _, email := range emails {
+		err := s.senderService.Resolve(ctx, email)
+		if err != nil {
+			return nil, err
+		}
+	}
 	emailIds := make([]string, 0, len(emails))
 	err := s.Transact(ctx, func(ctx context.Context, service *Service) error {
 		for _, email := range emails {
 			email.Id = *s.uidGenerator.Next()
 			email.RequestId = requestId
+			email.Status = string(model.EmailStatusPending)
 			email.EmailContent.EmailId = email.Id
 			email.EmailContent.OrganizationId = email.OrganizationId
 			email.EmailContent.WorkspaceId = email.WorkspaceId
@@ -47,60 +103,104 @@ func (s *emailService) Send(ctx context.Context, requestId string, emails []*mod
 		}
 		return nil
 	})
+	if errors.Is(err, model.ErrEmailExists) {
+		return nil, err
+	}
 	if err != nil {
 		s.logger.Error().Err(err).Msg("failed sending emails")
 		return nil, errors.New("failed sending emails")
 	}
-	// TODO: send emails through SES, if it fails, update the status of the email to FAILED
+	err = s.deliver(ctx, emails)
+
+	return emailIds, err
+}
 
-	return emailIds, nil
+// Deliver sends saved emails which weren't sent, e.g. when the process
+// stopped between saving and sending them or SES was throttled
+func (s *emailService) Deliver(ctx context.Context, emails []*model.Email) error {
+	return s.deliver(ctx, emails)
 }
 
-func (s *emailService) SendEmails(ctx context.Context, emails []*model.Email) ([]string, error) {
-	domains := make(map[string]*model.Domain)
+// deliver sends the persisted emails through SES, emails which SES rejected
+// are marked as failed and an EMAIL_SEND_FAILED event is emitted. Emails which
+// weren't sent for a transient reason stay pending and ErrEmailNotSent is
+// returned
+func (s *emailService) deliver(ctx context.Context, emails []*model.Email) error {
+	identities := make(map[string]*sendingIdentity)
 	events := make([]*model.Event, 0)
+	var notSent []error
 	for _, email := range emails {
 		err := func() error {
 			fromAddress, err := mail.ParseAddress(email.From)
 			if err != nil {
 				return err
 			}
-			domainName := strings.Split(fromAddress.Address, "@")[1]
-			domain, ok := domains[domainName]
+			address := strings.ToLower(fromAddress.Address)
+			identity, ok := identities[address]
 			if !ok {
-				domain, err = s.repository.Domain.FindByDomainName(ctx, email.WorkspaceId, email.OrganizationId, domainName)
-				if err != nil {
+				identity, err = s.sendingIdentity(ctx, email.WorkspaceId, address)
+				if errors.Is(err, errSendingIdentityNotFound) {
 					return err
 				}
-				if domain == nil || domain.Status != constant.DomainStatusActive {
-					return errors.New("Domain not found or not active")
+				if err != nil {
+					return fmt.Errorf("%w: %w", ErrEmailNotSent, err)
+				}
+				identities[address] = identity
+			}
+			if identity.domain != nil {
+				err = s.throttle(ctx, identity.domain)
+				if err != nil {
+					return fmt.Errorf("%w: %w", ErrEmailNotSent, err)
 				}
-				domains[domainName] = domain
 			}
-			messageId, err := s.sesService.SendEmail(
-				ctx,
-				domain.Region,
-				domain.Id.String(),
-				email.From,
-				email.Recipients.Addresses(),
-				email.CCRecipients.Addresses(),
-				email.BCCRecipients.Addresses(),
-				email.EmailContent.Subject,
-				email.EmailContent.Html,
-				email.EmailContent.Text,
-			)
-			if err != nil {
-				return err
+			var replyTo []string
+			if email.ReplyTo != nil {
+				replyTo = []string{*email.ReplyTo}
+			}
+			send := func(region constant.AwsRegion, configSetName string) (*string, error) {
+				return s.sesService.SendEmail(
+					ctx,
+					email.WorkspaceId,
+					region,
+					configSetName,
+					email.From,
+					email.Recipients.Addresses(),
+					email.CCRecipients.Addresses(),
+					email.BCCRecipients.Addresses(),
+					replyTo,
+					email.EmailContent.Subject,
+					email.EmailContent.Html,
+					email.EmailContent.Text,
+				)
+			}
+			messageId, err := send(identity.region, identity.configSet(email, false))
+			if err != nil && identity.failoverRegion != nil && isThrottlingError(err) {
+				s.logger.Warn().Err(err).Str("emailId", email.Id.String()).Msg("region throttled, sending from the failover region")
+				messageId, err = send(*identity.failoverRegion, identity.configSet(email, true))
+			}
+			if err != nil && isTransientSESError(err) {
+				return fmt.Errorf("%w: %w", ErrEmailNotSent, err)
 			}
-			email.SentAt = time.Now().UTC().String()
-			email.MessageId = *messageId
-			err = s.repository.Email.Save(ctx, email)
 			if err != nil {
 				return err
 			}
-			return nil
+			email.SentAt = time.Now().UTC().Format(time.RFC3339)
+			email.MessageId = *messageId
+
+			return s.repository.Email.UpdateSent(ctx, email.Id, email.MessageId, email.SentAt)
 		}()
+		if errors.Is(err, ErrEmailNotSent) {
+			s.logger.Warn().Err(err).Str("emailId", email.Id.String()).Msg("email not sent, it stays pending")
+			notSent = append(notSent, err)
+			continue
+		}
 		if err != nil {
+			s.logger.Error().Err(err).Str("emailId", email.Id.String()).Msg("failed to deliver email")
+			email.Status = string(model.EmailStatusFailed)
+			updateErr := s.repository.Email.UpdateStatus(ctx, email.Id, model.EmailStatusFailed)
+			if updateErr != nil {
+				s.logger.Error().Err(updateErr).Msg("failed to update email status")
+			}
 			events = append(events, &model.Event{
 				Receipients:    email.Recipients.Addresses(),
 				CCRecipients:   email.CCRecipients.Addresses(),
@@ -109,15 +209,68 @@ func (s *emailService) SendEmails(ctx context.Context, emails []*model.Email) ([
 				OrganizationId: email.OrganizationId,
 				WorkspaceId:    email.WorkspaceId,
 				MetaData: map[string]interface{}{
-					"error": err.Error(),
+					"emailId": email.Id.String(),
+					"error":   err.Error(),
 				},
 			})
 		}
 	}
-	// TODO: do something with the events
-	fmt.Println(events)
+	for _, event := range events {
+		s.eventService.Create(ctx, event)
+	}
+	s.eventService.Publish(ctx, events)
+
+	return errors.Join(notSent...)
+}
+
+// sendingIdentity returns the active domain of the from address, or the
+// active mailbox sender with the address
+func (s *emailService) sendingIdentity(ctx context.Context, workspaceId uid.UID, address string) (*sendingIdentity, error) {
+	domains, _, err := s.repository.Domain.FindAll(ctx, model.DomainFindOptions{
+		Name:        senderDomainName(address),
+		Status:      constant.DomainStatusActive,
+		WorkspaceId: workspaceId,
+		Limit:       1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(domains) > 0 {
+		identity := &sendingIdentity{
+			region:                 domains[0].Region,
+			configSetName:          domains[0].Id.String(),
+			domain:                 domains[0],
+			marketingConfigSetName: domains[0].MarketingConfigSetName,
+		}
+		if domains[0].FailoverPolicy == constant.FailoverPolicyOnThrottle {
+			identity.failoverRegion = domains[0].FailoverRegion
+			identity.failoverMarketingConfigSetName = domains[0].FailoverMarketingConfigSetName
+		}
+		return identity, nil
+	}
+	sender, err := s.repository.Sender.FindByAddress(ctx, workspaceId, address)
+	if err != nil {
+		return nil, err
+	}
+	if sender == nil || sender.DomainId != nil || sender.Status != model.SenderStatusActive {
+		return nil, errSendingIdentityNotFound
+	}
+
+	return &sendingIdentity{
+		region:        sender.Region,
+		configSetName: sender.Id.String(),
+	}, nil
+}
+
+// throttle waits until the domain is allowed to send the next email, domains
+// without a send rate are only limited by the SES account send rate. The rate
+// is shared by every replica
+func (s *emailService) throttle(ctx context.Context, domain *model.Domain) error {
+	if domain.SendRate <= 0 {
+		return nil
+	}
 
-	return nil, nil
+	return s.waitRateLimit(ctx, model.RateLimitKeyDomainSend, domain.Id.String(), float64(domain.SendRate), 1)
 }
 
 func ParseRecipients(recipients []string) ([]model.Recipient, error) {
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+func (r *fakeEmailRepository) UpdateSent(_ context.Context, id uid.UID, messageId string, _ string) error {
+	for _, email := range r.emails {
+		if email.Id == id {
+			email.MessageId = messageId
+		}
+	}
+
+	return nil
+}
+
+func (r *fakeEmailRepository) UpdateStatus(_ context.Context, id uid.UID, status model.EmailStatus) error {
+	for _, email := range r.emails {
+		if email.Id == id {
+			email.Status = string(status)
+		}
+	}
+
+	return nil
+}
+
+type fakeSendEmailSESService struct {
+	SESService
+	errs       map[string]error // The error of a recipient
+	throttled  map[constant.AwsRegion]bool
+	configSets map[constant.AwsRegion]string // The configuration set of the last email
+}
+
+func (s *fakeSendEmailSESService) SendEmail(
+	_ context.Context,
+	_ uid.UID,
+	region constant.AwsRegion,
+	configSetName string,
+	_ string,
+	to []string,
+	_ []string,
+	_ []string,
+	_ []string,
+	_ *string,
+	_ *string,
+	_ *string,
+) (*string, error) {
+	if err := s.errs[to[0]]; err != nil {
+		return nil, err
+	}
+	if s.throttled[region] {
+		return nil, &smithy.GenericAPIError{Code: "ThrottlingException"}
+	}
+	if s.configSets != nil {
+		s.configSets[region] = configSetName
+	}
+	messageId := "message-" + to[0]
+
+	return &messageId, nil
+}
+
+func TestIsTransientSESError(t *testing.T) {
+	for name, test := range map[string]struct {
+		err       error
+		transient bool
+	}{
+		"throttling":     {err: &smithy.GenericAPIError{Code: "ThrottlingException"}, transient: true},
+		"sending paused": {err: &smithy.GenericAPIError{Code: "SendingPausedException"}},
+		"rejected":       {err: &smithy.GenericAPIError{Code: "MessageRejected"}},
+		"unreachable":    {err: errors.New("dial tcp: i/o timeout"), transient: true},
+	} {
+		if got := isTransientSESError(test.err); got != test.transient {
+			t.Fatalf("expected %s to be transient %t, got %t", name, test.transient, got)
+		}
+	}
+}
+
+func TestDeliverKeepsThrottledEmailsPending(t *testing.T) {
+	workspaceId := *uid.NewUID(1)
+	domain := &model.Domain{
+		Base:        model.Base{Id: *uid.NewUID(2)},
+		Name:        "example.com",
+		Status:      constant.DomainStatusActive,
+		Region:      constant.AwsRegionNorthVirginia,
+		WorkspaceId: workspaceId,
+	}
+	newEmail := func(id int64, recipient string) *model.Email {
+		return &model.Email{
+			Base:        model.Base{Id: *uid.NewUID(id)},
+			From:        "hello@example.com",
+			Recipients:  model.Recipients{{Address: recipient}},
+			Status:      string(model.EmailStatusPending),
+			WorkspaceId: workspaceId,
+		}
+	}
+	sent := newEmail(3, "sent@example.org")
+	throttled := newEmail(4, "throttled@example.org")
+	rejected := newEmail(5, "rejected@example.org")
+	emailRepository := &fakeEmailRepository{emails: []*model.Email{sent, throttled, rejected}}
+	eventService := &fakeEventService{}
+	service := &emailService{
+		baseService: newTestBaseService(&model.Repository{
+			Domain: &fakeDomainRepository{domains: []*model.Domain{domain}},
+			Email:  emailRepository,
+		}),
+		sesService: &fakeSendEmailSESService{errs: map[string]error{
+			"throttled@example.org": &smithy.GenericAPIError{Code: "ThrottlingException"},
+			"rejected@example.org":  &smithy.GenericAPIError{Code: "MessageRejected"},
+		}},
+		eventService: eventService,
+	}
+
+	err := service.deliver(context.Background(), emailRepository.emails)
+	if !errors.Is(err, ErrEmailNotSent) {
+		t.Fatalf("expected ErrEmailNotSent, got %v", err)
+	}
+	if sent.MessageId != "message-sent@example.org" {
+		t.Fatalf("expected the email to be sent, got %+v", sent)
+	}
+	if throttled.Status != string(model.EmailStatusPending) || throttled.MessageId != "" {
+		t.Fatalf("expected the throttled email to stay pending, got %+v", throttled)
+	}
+	if isEmailSent(throttled) {
+		t.Fatal("expected the throttled email to be delivered again")
+	}
+	if rejected.Status != string(model.EmailStatusFailed) {
+		t.Fatalf("expected the rejected email to fail, got %+v", rejected)
+	}
+	if len(eventService.published) != 1 || eventService.published[0].EventType != constant.EventTypeEmailSendFailed {
+		t.Fatalf("expected 1 EMAIL_SEND_FAILED event, got %+v", eventService.published)
+	}
+}
+
+func TestDeliverFailsOverWithTheMarketingConfigSet(t *testing.T) {
+	workspaceId := *uid.NewUID(1)
+	failoverRegion := constant.AwsRegionIreland
+	domain := &model.Domain{
+		Base:                           model.Base{Id: *uid.NewUID(2)},
+		Name:                           "example.com",
+		Status:                         constant.DomainStatusActive,
+		Region:                         constant.AwsRegionNorthVirginia,
+		FailoverRegion:                 &failoverRegion,
+		FailoverPolicy:                 constant.FailoverPolicyOnThrottle,
+		MarketingConfigSetName:         "2-marketing",
+		FailoverMarketingConfigSetName: "2-marketing",
+		WorkspaceId:                    workspaceId,
+	}
+	email := &model.Email{
+		Base:        model.Base{Id: *uid.NewUID(3)},
+		From:        "news@example.com",
+		Recipients:  model.Recipients{{Address: "jane@example.org"}},
+		Status:      string(model.EmailStatusPending),
+		MetaData:    model.JSONBMap{"broadcastId": "4"},
+		WorkspaceId: workspaceId,
+	}
+	ses := &fakeSendEmailSESService{
+		throttled:  map[constant.AwsRegion]bool{constant.AwsRegionNorthVirginia: true},
+		configSets: make(map[constant.AwsRegion]string),
+	}
+	service := &emailService{
+		baseService: newTestBaseService(&model.Repository{
+			Domain: &fakeDomainRepository{domains: []*model.Domain{domain}},
+			Email:  &fakeEmailRepository{emails: []*model.Email{email}},
+		}),
+		sesService:   ses,
+		eventService: &fakeEventService{},
+	}
+
+	err := service.deliver(context.Background(), []*model.Email{email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ses.configSets[failoverRegion]; got != domain.FailoverMarketingConfigSetName {
+		t.Fatalf("expected the marketing configuration set of the failover region, got %q", got)
+	}
+
+	// without a marketing pool in the failover region the configuration set
+	// of the domain sends it
+	domain.FailoverMarketingConfigSetName = ""
+	email.MessageId = ""
+	err = service.deliver(context.Background(), []*model.Email{email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ses.configSets[failoverRegion]; got != domain.Id.String() {
+		t.Fatalf("expected the configuration set of the domain, got %q", got)
+	}
+}
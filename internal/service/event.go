@@ -2,96 +2,293 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"runtime"
 
 	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
 	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/eventbus"
 	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
 )
 
 const eventSaveMaxRetries = 3
 
+var ErrSESEventWorkspace = errors.New("the notification topic belongs to another workspace")
+
+// Tags SES adds to the mail of every event
+const (
+	sesTagFromDomain       = "ses:from-domain"
+	sesTagConfigurationSet = "ses:configuration-set"
+)
+
+const (
+	eventStreamBufferSize = 1000
+	eventStreamReplaySize = 100
+)
+
 type EventSevice interface {
 	Create(ctx context.Context, event *model.Event)
-	CreateSESEvent(ctx context.Context, message sesNotificationMessage) error
-	StartListeners()
-	Publish(event []*model.Event)
-	Subscribe(id string) chan *model.Event
+	CreateSESEvent(ctx context.Context, notificationId string, topicWorkspaceId *uid.UID, message sesNotificationMessage) error
+	Publish(ctx context.Context, events []*model.Event)
+	Subscribe(ctx context.Context, group string, handler eventbus.Handler)
+	Stream(ctx context.Context, options model.EventFindOptions) <-chan *model.Event
 }
 
 type eventService struct {
 	*baseService
-	subs map[string]chan *model.Event
 }
 
 func NewEventService(baseService *baseService) EventSevice {
 	return &eventService{
 		baseService,
-		make(map[string]chan *model.Event),
 	}
 }
 
 func (s *eventService) Create(ctx context.Context, event *model.Event) {
+	if event.Id == (uid.UID{}) {
+		event.Id = *s.uidGenerator.Next()
+	}
 	for i := 0; i < eventSaveMaxRetries; i++ {
 		err := s.repository.Event.Save(ctx, event)
 		if err == nil {
-			break
+			return
 		}
 	}
 
 	s.logger.Error().Err(fmt.Errorf("failed to save event")).Msg("eventService.Create")
 }
 
-func (s *eventService) CreateSESEvent(ctx context.Context, message sesNotificationMessage) error {
-	email, err := s.repository.Email.FindByMessageId(context.Background(), message.Mail.MessageId)
+// CreateSESEvent saves and publishes the event of an SES notification, a
+// notification which was already saved returns model.ErrEventExists. A
+// notification of the topic of a workspace AWS account must be about an email
+// of that workspace
+func (s *eventService) CreateSESEvent(ctx context.Context, notificationId string, topicWorkspaceId *uid.UID, message sesNotificationMessage) error {
+	email, err := s.repository.Email.FindByMessageId(ctx, message.Mail.MessageId)
 	if err != nil {
 		return err
 	}
+	if email == nil {
+		return fmt.Errorf("email not found for message id %s", message.Mail.MessageId)
+	}
+	if topicWorkspaceId != nil && email.WorkspaceId != *topicWorkspaceId {
+		return ErrSESEventWorkspace
+	}
+	eventType, ok := constant.AwsSESEventTypeToEventType[message.EventType]
+	if !ok {
+		return fmt.Errorf("unsupported SES event type %s", message.EventType)
+	}
+	recipients, metaData := sesEventDetails(message)
+	metaData["emailId"] = email.Id.String()
+	metaData["Message"] = message
+	for _, key := range []string{"broadcastId", "contactId", "variantId"} {
+		if value, ok := email.MetaData[key]; ok {
+			metaData[key] = value
+		}
+	}
 	event := &model.Event{
-		MetaData: model.EventMetaData{
-			"Message": message,
+		Base: model.Base{
+			Id: *s.uidGenerator.Next(),
 		},
+		EventType:      eventType,
+		Receipients:    recipients,
+		CCRecipients:   model.JSONBArray{},
+		BCCRecipients:  model.JSONBArray{},
+		MetaData:       metaData,
 		OrganizationId: email.OrganizationId,
 		WorkspaceId:    email.WorkspaceId,
 	}
-	switch message.EventType {
-	case types.EventTypeBounce:
-		event.EventType = constant.EventTypeEmailBounced
+	if notificationId != "" {
+		event.SourceId = &notificationId
 	}
+	err = s.repository.Event.Save(ctx, event)
+	if err != nil {
+		return err
+	}
+	s.Publish(ctx, []*model.Event{event})
 
-	return s.repository.Event.Save(ctx, event)
+	return nil
 }
 
-func (s *eventService) StartListeners() {
-	cpus := runtime.NumCPU()
-	for i := 0; i < cpus; i++ {
-		go s.listen()
+// sesEventDetails returns the recipients the notification is about and its
+// normalized meta data, the recipients default to the email destination
+func sesEventDetails(message sesNotificationMessage) (model.JSONBArray, model.EventMetaData) {
+	recipients := model.JSONBArray{}
+	metaData := model.EventMetaData{}
+	setMetaData := func(key string, value string) {
+		if value != "" {
+			metaData[key] = value
+		}
 	}
-}
-
-func (s *eventService) listen() {
-	ch := s.Subscribe(fmt.Sprintf("EL-%s", s.uidGenerator.Next()))
-	for event := range ch {
-		fmt.Println(event)
+	switch message.EventType {
+	case types.EventTypeBounce:
+		if message.Bounce == nil {
+			break
+		}
+		setMetaData("bounceType", message.Bounce.BounceType)
+		setMetaData("bounceSubType", message.Bounce.BounceSubType)
+		for _, recipient := range message.Bounce.BouncedRecipients {
+			recipients = append(recipients, recipient.EmailAddress)
+			if _, ok := metaData["diagnosticCode"]; !ok {
+				setMetaData("diagnosticCode", recipient.DiagnosticCode)
+			}
+		}
+	case types.EventTypeComplaint:
+		if message.Complaint == nil {
+			break
+		}
+		setMetaData("complaintFeedbackType", message.Complaint.ComplaintFeedbackType)
+		setMetaData("complaintSubType", message.Complaint.ComplaintSubType)
+		setMetaData("userAgent", message.Complaint.UserAgent)
+		for _, recipient := range message.Complaint.ComplainedRecipients {
+			recipients = append(recipients, recipient.EmailAddress)
+		}
+	case types.EventTypeDelivery:
+		if message.Delivery == nil {
+			break
+		}
+		setMetaData("smtpResponse", message.Delivery.SmtpResponse)
+		metaData["processingTimeMillis"] = message.Delivery.ProcessingTimeMillis
+		recipients = append(recipients, message.Delivery.Recipients...)
+	case types.EventTypeReject:
+		if message.Reject == nil {
+			break
+		}
+		setMetaData("rejectReason", message.Reject.Reason)
+	case types.EventTypeOpen:
+		if message.Open == nil {
+			break
+		}
+		setMetaData("timestamp", message.Open.Timestamp)
+		setMetaData("userAgent", message.Open.UserAgent)
+		setMetaData("ipAddress", message.Open.IpAddress)
+	case types.EventTypeClick:
+		if message.Click == nil {
+			break
+		}
+		setMetaData("timestamp", message.Click.Timestamp)
+		setMetaData("userAgent", message.Click.UserAgent)
+		setMetaData("ipAddress", message.Click.IpAddress)
+		setMetaData("link", message.Click.Link)
+		if len(message.Click.LinkTags) > 0 {
+			metaData["linkTags"] = message.Click.LinkTags
+		}
+	case types.EventTypeDeliveryDelay:
+		if message.DeliveryDelay == nil {
+			break
+		}
+		setMetaData("delayType", message.DeliveryDelay.DelayType)
+		setMetaData("expirationTime", message.DeliveryDelay.ExpirationTime)
+		for _, recipient := range message.DeliveryDelay.DelayedRecipients {
+			recipients = append(recipients, recipient.EmailAddress)
+			if _, ok := metaData["diagnosticCode"]; !ok {
+				setMetaData("diagnosticCode", recipient.DiagnosticCode)
+			}
+		}
+	case types.EventTypeSubscription:
+		if message.Subscription == nil {
+			break
+		}
+		setMetaData("contactList", message.Subscription.ContactList)
 	}
+	if len(recipients) == 0 {
+		recipients = append(recipients, message.Mail.Destination...)
+	}
+	// the reputation of the sending domain and configuration set is computed
+	// from these
+	if values := message.Mail.Tags[sesTagFromDomain]; len(values) > 0 {
+		setMetaData(model.EventMetaDataFromDomain, values[0])
+	}
+	if values := message.Mail.Tags[sesTagConfigurationSet]; len(values) > 0 {
+		setMetaData(model.EventMetaDataConfigurationSet, values[0])
+	}
+
+	return recipients, metaData
 }
 
-func (s *eventService) Publish(event []*model.Event) {
-	for _, event := range event {
-		for _, ch := range s.subs {
-			ch <- event
-		}
+// Publish sends the saved events to the event bus, a failure is logged as
+// the events are already stored
+func (s *eventService) Publish(ctx context.Context, events []*model.Event) {
+	err := s.eventBus.Publish(ctx, events)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to publish events")
 	}
 }
 
-func (s *eventService) Subscribe(id string) chan *model.Event {
-	if ch, ok := s.subs[id]; ok {
-		return ch
-	}
+// Subscribe adds a consumer to the group, every group receives each event
+// and one consumer of the group handles it
+func (s *eventService) Subscribe(ctx context.Context, group string, handler eventbus.Handler) {
+	s.eventBus.Subscribe(ctx, group, handler)
+}
 
-	ch := make(chan *model.Event, 100)
-	s.subs[id] = ch
+// Stream returns the events of the workspace matching the options as they are
+// published. With a cursor the events after it are read from the events
+// table first. The channel is closed when the context is done or when the
+// reader falls behind, the reader can resume from the last event it received
+func (s *eventService) Stream(ctx context.Context, options model.EventFindOptions) <-chan *model.Event {
+	ctx, cancel := context.WithCancel(ctx)
+	live := make(chan *model.Event, eventStreamBufferSize)
+	s.eventBus.Listen(ctx, func(_ context.Context, event *model.Event) error {
+		if !options.Match(event) {
+			return nil
+		}
+		select {
+		case live <- event:
+		default:
+			cancel()
+		}
+		return nil
+	})
+	ch := make(chan *model.Event)
+	go func() {
+		defer close(ch)
+		defer cancel()
+		send := func(event *model.Event) bool {
+			select {
+			case ch <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		// the events published while replaying are skipped up to the last
+		// replayed event
+		replayed := options.Cursor
+		if replayed != (uid.UID{}) {
+			options.Ascending = true
+			options.Limit = eventStreamReplaySize
+			for {
+				events, err := s.repository.Event.FindAll(ctx, options)
+				if err != nil {
+					s.logger.Error().Err(err).Msg("failed to replay events")
+					return
+				}
+				for _, event := range events {
+					if !send(event) {
+						return
+					}
+					replayed = event.Id
+				}
+				if len(events) < options.Limit {
+					break
+				}
+				options.Cursor = replayed
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-live:
+				if event.Id.ID() <= replayed.ID() {
+					continue
+				}
+				if !send(event) {
+					return
+				}
+			}
+		}
+	}()
 
 	return ch
 }
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type fakeEmailRepository struct {
+	model.EmailRepository
+	emails []*model.Email
+}
+
+func (r *fakeEmailRepository) FindByMessageId(_ context.Context, messageId string) (*model.Email, error) {
+	for _, email := range r.emails {
+		if email.MessageId == messageId {
+			return email, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func TestCreateSESEventRejectsEmailOfAnotherWorkspace(t *testing.T) {
+	messageId := "0100018f"
+	repository := &model.Repository{
+		Email: &fakeEmailRepository{
+			emails: []*model.Email{{MessageId: messageId, WorkspaceId: *uid.NewUID(1)}},
+		},
+	}
+	service := NewEventService(newTestBaseService(repository))
+	message := sesNotificationMessage{
+		EventType: types.EventTypeDelivery,
+		Mail:      mailPayload{MessageId: messageId},
+	}
+
+	err := service.CreateSESEvent(context.Background(), "notification", uid.NewUID(2), message)
+	if !errors.Is(err, ErrSESEventWorkspace) {
+		t.Fatalf("expected ErrSESEventWorkspace, got %v", err)
+	}
+}
+
+func TestStreamReplaysTheEventsAfterTheCursor(t *testing.T) {
+	workspaceId := *uid.NewUID(1)
+	newEvent := func(id int64) *model.Event {
+		return &model.Event{
+			Base:        model.Base{Id: *uid.NewUID(id)},
+			EventType:   constant.EventTypeEmailDelivered,
+			WorkspaceId: workspaceId,
+		}
+	}
+	repository := &fakeEventRepository{}
+	for id := int64(10); id <= 12; id++ {
+		repository.events = append(repository.events, newEvent(id))
+	}
+	base := newTestBaseService(&model.Repository{Event: repository})
+	service := NewEventService(base)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := service.Stream(ctx, model.EventFindOptions{WorkspaceId: workspaceId, Cursor: *uid.NewUID(10)})
+	received := make([]string, 0)
+	receive := func() {
+		t.Helper()
+		select {
+		case event := <-events:
+			received = append(received, event.Id.String())
+		case <-time.After(time.Second):
+			t.Fatalf("expected an event after %v", received)
+		}
+	}
+	receive()
+	receive()
+	// the replayed event which is published again is skipped, and so is the
+	// event of another workspace
+	other := newEvent(13)
+	other.WorkspaceId = *uid.NewUID(2)
+	err := base.eventBus.Publish(ctx, []*model.Event{newEvent(12), other, newEvent(14)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive()
+	if got := fmt.Sprint(received); got != "[11 12 14]" {
+		t.Fatalf("expected the events [11 12 14], got %s", got)
+	}
+}
@@ -0,0 +1,456 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+// marketingConfigSetSuffix names the configuration set the broadcast emails
+// of a domain are sent through, it only exists while a pool applies to the
+// domain so the marketing emails stay off a transactional pool
+const marketingConfigSetSuffix = "-marketing"
+
+var (
+	ErrIPPoolExists         = errors.New("an IP pool with the name already exists")
+	ErrIPPoolInUse          = errors.New("the IP pool is assigned, remove its assignments first")
+	ErrIPPoolRegionMismatch = errors.New("the IP pool is in another region than the domain")
+	ErrInvalidScalingMode   = errors.New("invalid scaling mode, must be STANDARD or MANAGED")
+	ErrInvalidMessageStream = errors.New("invalid stream, must be TRANSACTIONAL or MARKETING")
+	ErrIPPoolNotApplied     = errors.New("failed to apply the IP pool to the configuration sets, it is applied again on the next domain verification")
+)
+
+type IPPoolService interface {
+	Create(ctx context.Context, pool *model.IPPool) error
+	Get(ctx context.Context, id uid.UID) (*model.IPPool, error)
+	List(ctx context.Context, workspaceId uid.UID) ([]*model.IPPool, error)
+	DedicatedIPs(ctx context.Context, pool *model.IPPool) ([]*DedicatedIP, error)
+	Delete(ctx context.Context, pool *model.IPPool) error
+	Assign(ctx context.Context, assignment *model.IPPoolAssignment) error
+	GetAssignment(ctx context.Context, id uid.UID) (*model.IPPoolAssignment, error)
+	Assignments(ctx context.Context, workspaceId uid.UID) ([]*model.IPPoolAssignment, error)
+	Unassign(ctx context.Context, assignment *model.IPPoolAssignment) error
+	ApplyDomain(ctx context.Context, domain *model.Domain) error
+	ReconcileDomain(ctx context.Context, domain *model.Domain) error
+	RemoveDomain(ctx context.Context, domain *model.Domain) error
+}
+
+// DedicatedIP is an IP of a pool, SES sends a growing share of the emails
+// from it until the warm-up is DONE
+type DedicatedIP struct {
+	Ip               string `json:"ip"`
+	WarmupStatus     string `json:"warmupStatus"`     // IN_PROGRESS, DONE or NOT_APPLICABLE
+	WarmupPercentage int32  `json:"warmupPercentage"` // 100 when the warm-up is done
+}
+
+type ipPoolService struct {
+	*baseService
+	ses SESService
+}
+
+func NewIPPoolService(baseService *baseService, sesService SESService) IPPoolService {
+	return &ipPoolService{
+		baseService,
+		sesService,
+	}
+}
+
+// Create creates the pool in the SES account of the workspace, a pool is
+// STANDARD unless MANAGED is given
+func (s *ipPoolService) Create(ctx context.Context, pool *model.IPPool) error {
+	if !s.sesRegionEnabled(pool.Region) {
+		return ErrRegionNotEnabled
+	}
+	if pool.ScalingMode == "" {
+		pool.ScalingMode = constant.IPPoolScalingModeStandard
+	}
+	if pool.ScalingMode != constant.IPPoolScalingModeStandard && pool.ScalingMode != constant.IPPoolScalingModeManaged {
+		return ErrInvalidScalingMode
+	}
+	existing, err := s.repository.IPPool.FindByName(ctx, pool.WorkspaceId, pool.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrIPPoolExists
+	}
+	pool.Id = *s.uidGenerator.Next()
+	err = s.ses.CreateDedicatedIpPool(ctx, pool)
+	if err != nil {
+		return err
+	}
+
+	return s.repository.IPPool.Save(ctx, pool)
+}
+
+func (s *ipPoolService) Get(ctx context.Context, id uid.UID) (*model.IPPool, error) {
+	return s.repository.IPPool.FindById(ctx, id)
+}
+
+func (s *ipPoolService) List(ctx context.Context, workspaceId uid.UID) ([]*model.IPPool, error) {
+	return s.repository.IPPool.FindByWorkspaceId(ctx, workspaceId)
+}
+
+// DedicatedIPs returns the IPs of the pool with their warm-up status, SES
+// doesn't list the IPs of a MANAGED pool until it leases them
+func (s *ipPoolService) DedicatedIPs(ctx context.Context, pool *model.IPPool) ([]*DedicatedIP, error) {
+	ips, err := s.ses.GetDedicatedIps(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	dedicatedIPs := make([]*DedicatedIP, 0, len(ips))
+	for _, ip := range ips {
+		dedicatedIPs = append(dedicatedIPs, &DedicatedIP{
+			Ip:               aws.ToString(ip.Ip),
+			WarmupStatus:     string(ip.WarmupStatus),
+			WarmupPercentage: aws.ToInt32(ip.WarmupPercentage),
+		})
+	}
+
+	return dedicatedIPs, nil
+}
+
+func (s *ipPoolService) Delete(ctx context.Context, pool *model.IPPool) error {
+	assignments, err := s.repository.IPPool.FindAssignments(ctx, pool.WorkspaceId)
+	if err != nil {
+		return err
+	}
+	for _, assignment := range assignments {
+		if assignment.IPPoolId == pool.Id {
+			return ErrIPPoolInUse
+		}
+	}
+	err = s.ses.DeleteDedicatedIpPool(ctx, pool)
+	if err != nil {
+		return err
+	}
+
+	return s.repository.IPPool.Delete(ctx, pool.Id)
+}
+
+// Assign picks the pool for the stream of the domain, or of every domain of
+// the workspace in the region of the pool when no domain is given. The
+// previous assignment of the stream is replaced
+func (s *ipPoolService) Assign(ctx context.Context, assignment *model.IPPoolAssignment) error {
+	if assignment.Stream != constant.MessageStreamTransactional && assignment.Stream != constant.MessageStreamMarketing {
+		return ErrInvalidMessageStream
+	}
+	pool, err := s.repository.IPPool.FindById(ctx, assignment.IPPoolId)
+	if err != nil {
+		return err
+	}
+	if pool == nil || pool.WorkspaceId != assignment.WorkspaceId {
+		return errors.New("IP pool not found")
+	}
+	if assignment.DomainId != nil {
+		domain, err := s.repository.Domain.FindById(ctx, *assignment.DomainId)
+		if err != nil {
+			return err
+		}
+		if domain == nil || domain.WorkspaceId != assignment.WorkspaceId {
+			return errors.New("domain not found")
+		}
+		if domain.Region != pool.Region {
+			return ErrIPPoolRegionMismatch
+		}
+	}
+	assignments, pools, err := s.workspacePools(ctx, assignment.WorkspaceId)
+	if err != nil {
+		return err
+	}
+	var existing *model.IPPoolAssignment
+	for _, other := range assignments {
+		if other.Stream == assignment.Stream &&
+			equalDomainIds(other.DomainId, assignment.DomainId) &&
+			pools[other.IPPoolId] != nil && pools[other.IPPoolId].Region == pool.Region {
+			existing = other
+			break
+		}
+	}
+	if existing != nil {
+		assignment.Id = existing.Id
+		err = s.repository.IPPool.UpdateAssignment(ctx, assignment)
+	} else {
+		assignment.Id = *s.uidGenerator.Next()
+		err = s.repository.IPPool.SaveAssignment(ctx, assignment)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.apply(ctx, assignment.WorkspaceId, pool.Region, assignment.DomainId)
+}
+
+func (s *ipPoolService) GetAssignment(ctx context.Context, id uid.UID) (*model.IPPoolAssignment, error) {
+	return s.repository.IPPool.FindAssignmentById(ctx, id)
+}
+
+func (s *ipPoolService) Assignments(ctx context.Context, workspaceId uid.UID) ([]*model.IPPoolAssignment, error) {
+	return s.repository.IPPool.FindAssignments(ctx, workspaceId)
+}
+
+// Unassign removes the assignment, the stream falls back to the pool of the
+// workspace or to the shared IPs of SES
+func (s *ipPoolService) Unassign(ctx context.Context, assignment *model.IPPoolAssignment) error {
+	pool, err := s.repository.IPPool.FindById(ctx, assignment.IPPoolId)
+	if err != nil {
+		return err
+	}
+	err = s.repository.IPPool.DeleteAssignment(ctx, assignment.Id)
+	if err != nil {
+		return err
+	}
+	if pool == nil {
+		return nil
+	}
+
+	return s.apply(ctx, assignment.WorkspaceId, pool.Region, assignment.DomainId)
+}
+
+// ApplyDomain sets the pools of the workspace on the configuration sets of a
+// new domain, or of a domain whose failover region changed
+func (s *ipPoolService) ApplyDomain(ctx context.Context, domain *model.Domain) error {
+	pools, failoverPools, err := s.domainRegionPools(ctx, domain)
+	if err != nil {
+		return err
+	}
+	if len(pools) == 0 && len(failoverPools) == 0 &&
+		domain.MarketingConfigSetName == "" && domain.FailoverMarketingConfigSetName == "" {
+		return nil
+	}
+
+	return s.applyDomainPools(ctx, domain, pools, failoverPools)
+}
+
+// ReconcileDomain applies the pools of a domain again when they failed to
+// apply, the verification of the domain calls it
+func (s *ipPoolService) ReconcileDomain(ctx context.Context, domain *model.Domain) error {
+	if !domain.IPPoolsPending {
+		return nil
+	}
+	pools, failoverPools, err := s.domainRegionPools(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	return s.applyDomainPools(ctx, domain, pools, failoverPools)
+}
+
+// RemoveDomain deletes the marketing configuration sets and the assignments
+// of a deleted domain
+func (s *ipPoolService) RemoveDomain(ctx context.Context, domain *model.Domain) error {
+	err := s.repository.IPPool.DeleteAssignmentsByDomainId(ctx, domain.Id)
+	if err != nil {
+		return err
+	}
+	if domain.FailoverRegion != nil {
+		err = s.ses.DeleteConfigurationSet(ctx, domain.WorkspaceId, *domain.FailoverRegion, marketingConfigSetName(domain))
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.ses.DeleteConfigurationSet(ctx, domain.WorkspaceId, domain.Region, marketingConfigSetName(domain))
+}
+
+// apply updates the configuration sets of the domain, or of every domain of
+// the workspace in the region or failing over to it. The assignments are saved already, a domain which fails is left pending for
+// its next verification and the others are still updated
+func (s *ipPoolService) apply(ctx context.Context, workspaceId uid.UID, region constant.AwsRegion, domainId *uid.UID) error {
+	domains, _, err := s.repository.Domain.FindAll(ctx, model.DomainFindOptions{
+		WorkspaceId: workspaceId,
+	})
+	if err != nil {
+		return err
+	}
+	var failed bool
+	for _, domain := range domains {
+		if domainId != nil && domain.Id != *domainId {
+			continue
+		}
+		if domain.Region != region && (domain.FailoverRegion == nil || *domain.FailoverRegion != region) {
+			continue
+		}
+		pools, failoverPools, err := s.domainRegionPools(ctx, domain)
+		if err != nil {
+			return err
+		}
+		err = s.applyDomainPools(ctx, domain, pools, failoverPools)
+		if err != nil {
+			failed = true
+		}
+	}
+	if failed {
+		return ErrIPPoolNotApplied
+	}
+
+	return nil
+}
+
+// domainRegionPools returns the pools of the domain in its region and in its
+// failover region, there are no failover pools without a failover region
+func (s *ipPoolService) domainRegionPools(
+	ctx context.Context,
+	domain *model.Domain,
+) (map[constant.MessageStream]*model.IPPool, map[constant.MessageStream]*model.IPPool, error) {
+	pools, err := s.domainPools(ctx, domain)
+	if err != nil || domain.FailoverRegion == nil {
+		return pools, nil, err
+	}
+	failoverPools, err := s.domainPools(ctx, failoverIdentity(domain, *domain.FailoverRegion))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pools, failoverPools, nil
+}
+
+// applyDomainPools applies the pools to the domain in its region and in its
+// failover region, and tracks whether they are pending. The broadcast emails
+// are sent through a marketing configuration set once it is applied, and not
+// while the pools are pending
+func (s *ipPoolService) applyDomainPools(
+	ctx context.Context,
+	domain *model.Domain,
+	pools map[constant.MessageStream]*model.IPPool,
+	failoverPools map[constant.MessageStream]*model.IPPool,
+) error {
+	err := s.applyDomain(ctx, domain, pools)
+	if err == nil && domain.FailoverRegion != nil {
+		err = s.applyDomain(ctx, failoverIdentity(domain, *domain.FailoverRegion), failoverPools)
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Str("domainId", domain.Id.String()).Msg("failed to apply IP pools")
+		s.updateIPPools(ctx, domain, true, "", "")
+		return err
+	}
+	var name, failoverName string
+	if len(pools) > 0 {
+		name = marketingConfigSetName(domain)
+	}
+	if len(failoverPools) > 0 {
+		failoverName = marketingConfigSetName(domain)
+	}
+	s.updateIPPools(ctx, domain, false, name, failoverName)
+
+	return nil
+}
+
+func (s *ipPoolService) updateIPPools(
+	ctx context.Context,
+	domain *model.Domain,
+	pending bool,
+	marketingConfigSetName string,
+	failoverMarketingConfigSetName string,
+) {
+	if domain.IPPoolsPending == pending &&
+		domain.MarketingConfigSetName == marketingConfigSetName &&
+		domain.FailoverMarketingConfigSetName == failoverMarketingConfigSetName {
+		return
+	}
+	updated := *domain
+	updated.IPPoolsPending = pending
+	updated.MarketingConfigSetName = marketingConfigSetName
+	updated.FailoverMarketingConfigSetName = failoverMarketingConfigSetName
+	err := s.repository.Domain.UpdateIPPools(ctx, &updated)
+	if err != nil {
+		s.logger.Error().Err(err).Str("domainId", domain.Id.String()).Msg("failed to update IP pools of domain")
+		return
+	}
+	*domain = updated
+}
+
+// applyDomain sends the transactional emails of the domain from the
+// transactional pool and the broadcast emails from the marketing pool
+func (s *ipPoolService) applyDomain(ctx context.Context, domain *model.Domain, pools map[constant.MessageStream]*model.IPPool) error {
+	err := s.ses.PutConfigurationSetIPPool(
+		ctx,
+		domain.WorkspaceId,
+		domain.Region,
+		domain.Id.String(),
+		pools[constant.MessageStreamTransactional],
+	)
+	if err != nil {
+		return err
+	}
+	if len(pools) == 0 {
+		return s.ses.DeleteConfigurationSet(ctx, domain.WorkspaceId, domain.Region, marketingConfigSetName(domain))
+	}
+
+	return s.ses.PutConfigurationSetIPPool(
+		ctx,
+		domain.WorkspaceId,
+		domain.Region,
+		marketingConfigSetName(domain),
+		pools[constant.MessageStreamMarketing],
+	)
+}
+
+// domainPools returns the pool of each stream of the domain, the assignment
+// of the domain wins over the one of the workspace
+func (s *ipPoolService) domainPools(ctx context.Context, domain *model.Domain) (map[constant.MessageStream]*model.IPPool, error) {
+	assignments, pools, err := s.workspacePools(ctx, domain.WorkspaceId)
+	if err != nil {
+		return nil, err
+	}
+	domainPools := make(map[constant.MessageStream]*model.IPPool)
+	// the workspace assignments first so the domain ones override them
+	slices.SortStableFunc(assignments, func(a, b *model.IPPoolAssignment) int {
+		if a.DomainId == nil && b.DomainId != nil {
+			return -1
+		}
+		if a.DomainId != nil && b.DomainId == nil {
+			return 1
+		}
+		return 0
+	})
+	for _, assignment := range assignments {
+		pool, ok := pools[assignment.IPPoolId]
+		if !ok || pool.Region != domain.Region {
+			continue
+		}
+		if assignment.DomainId != nil && *assignment.DomainId != domain.Id {
+			continue
+		}
+		domainPools[assignment.Stream] = pool
+	}
+
+	return domainPools, nil
+}
+
+func (s *ipPoolService) workspacePools(ctx context.Context, workspaceId uid.UID) ([]*model.IPPoolAssignment, map[uid.UID]*model.IPPool, error) {
+	assignments, err := s.repository.IPPool.FindAssignments(ctx, workspaceId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(assignments) == 0 {
+		return assignments, nil, nil
+	}
+	list, err := s.repository.IPPool.FindByWorkspaceId(ctx, workspaceId)
+	if err != nil {
+		return nil, nil, err
+	}
+	pools := make(map[uid.UID]*model.IPPool, len(list))
+	for _, pool := range list {
+		pools[pool.Id] = pool
+	}
+
+	return assignments, pools, nil
+}
+
+func marketingConfigSetName(domain *model.Domain) string {
+	return domain.Id.String() + marketingConfigSetSuffix
+}
+
+func equalDomainIds(a *uid.UID, b *uid.UID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
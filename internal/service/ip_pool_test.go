@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type fakeIPPoolRepository struct {
+	model.IPPoolRepository
+	pools       []*model.IPPool
+	assignments []*model.IPPoolAssignment
+}
+
+func (r *fakeIPPoolRepository) FindByWorkspaceId(_ context.Context, _ uid.UID) ([]*model.IPPool, error) {
+	return r.pools, nil
+}
+
+func (r *fakeIPPoolRepository) FindAssignments(_ context.Context, _ uid.UID) ([]*model.IPPoolAssignment, error) {
+	// a copy, domainPools sorts them
+	return append([]*model.IPPoolAssignment{}, r.assignments...), nil
+}
+
+type fakeIPPoolSESService struct {
+	SESService
+	failing map[string]bool // Configuration sets which fail
+	applied map[string]*model.IPPool
+}
+
+func (s *fakeIPPoolSESService) PutConfigurationSetIPPool(
+	_ context.Context,
+	_ uid.UID,
+	_ constant.AwsRegion,
+	name string,
+	pool *model.IPPool,
+) error {
+	if s.failing[name] {
+		return errors.New("throttled")
+	}
+	s.applied[name] = pool
+
+	return nil
+}
+
+func (s *fakeIPPoolSESService) DeleteConfigurationSet(_ context.Context, _ uid.UID, _ constant.AwsRegion, name string) error {
+	delete(s.applied, name)
+
+	return nil
+}
+
+func TestDomainPools(t *testing.T) {
+	workspaceId := *uid.NewUID(1)
+	domain := &model.Domain{Base: model.Base{Id: *uid.NewUID(2)}, Region: constant.AwsRegionNorthVirginia, WorkspaceId: workspaceId}
+	otherDomainId := uid.NewUID(3)
+	workspacePool := &model.IPPool{Base: model.Base{Id: *uid.NewUID(4)}, Region: constant.AwsRegionNorthVirginia}
+	domainPool := &model.IPPool{Base: model.Base{Id: *uid.NewUID(5)}, Region: constant.AwsRegionNorthVirginia}
+	irelandPool := &model.IPPool{Base: model.Base{Id: *uid.NewUID(6)}, Region: constant.AwsRegionIreland}
+	service := &ipPoolService{baseService: newTestBaseService(&model.Repository{
+		IPPool: &fakeIPPoolRepository{
+			pools: []*model.IPPool{workspacePool, domainPool, irelandPool},
+			assignments: []*model.IPPoolAssignment{
+				// the domain assignment comes first but still wins
+				{Stream: constant.MessageStreamTransactional, IPPoolId: domainPool.Id, DomainId: &domain.Id},
+				{Stream: constant.MessageStreamTransactional, IPPoolId: workspacePool.Id},
+				{Stream: constant.MessageStreamMarketing, IPPoolId: workspacePool.Id},
+				{Stream: constant.MessageStreamMarketing, IPPoolId: domainPool.Id, DomainId: otherDomainId},
+				{Stream: constant.MessageStreamMarketing, IPPoolId: irelandPool.Id},
+			},
+		},
+	})}
+
+	pools, err := service.domainPools(context.Background(), domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 2 {
+		t.Fatalf("expected a pool for both streams, got %v", pools)
+	}
+	if pools[constant.MessageStreamTransactional] != domainPool {
+		t.Fatalf("expected the domain pool for the transactional stream, got %+v", pools[constant.MessageStreamTransactional])
+	}
+	if pools[constant.MessageStreamMarketing] != workspacePool {
+		t.Fatalf("expected the workspace pool for the marketing stream, got %+v", pools[constant.MessageStreamMarketing])
+	}
+
+	// a domain of another region has no pool of the workspace
+	pools, err = service.domainPools(context.Background(), &model.Domain{Base: model.Base{Id: *otherDomainId}, Region: constant.AwsRegionTokyo, WorkspaceId: workspaceId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 0 {
+		t.Fatalf("expected no pools in another region, got %v", pools)
+	}
+}
+
+func TestApplyLeavesFailedDomainsPending(t *testing.T) {
+	workspaceId := *uid.NewUID(1)
+	failing := &model.Domain{Base: model.Base{Id: *uid.NewUID(2)}, Region: constant.AwsRegionNorthVirginia, WorkspaceId: workspaceId}
+	applied := &model.Domain{Base: model.Base{Id: *uid.NewUID(3)}, Region: constant.AwsRegionNorthVirginia, WorkspaceId: workspaceId}
+	pool := &model.IPPool{Base: model.Base{Id: *uid.NewUID(4)}, Region: constant.AwsRegionNorthVirginia}
+	domainRepository := &fakeDomainRepository{
+		domains: []*model.Domain{failing, applied},
+		pending: make(map[uid.UID]bool),
+	}
+	ses := &fakeIPPoolSESService{
+		failing: map[string]bool{failing.Id.String(): true},
+		applied: make(map[string]*model.IPPool),
+	}
+	service := &ipPoolService{
+		baseService: newTestBaseService(&model.Repository{
+			Domain: domainRepository,
+			IPPool: &fakeIPPoolRepository{
+				pools:       []*model.IPPool{pool},
+				assignments: []*model.IPPoolAssignment{{Stream: constant.MessageStreamTransactional, IPPoolId: pool.Id}},
+			},
+		}),
+		ses: ses,
+	}
+	ctx := context.Background()
+
+	err := service.apply(ctx, workspaceId, constant.AwsRegionNorthVirginia, nil)
+	if !errors.Is(err, ErrIPPoolNotApplied) {
+		t.Fatalf("expected ErrIPPoolNotApplied, got %v", err)
+	}
+	if !failing.IPPoolsPending || !domainRepository.pending[failing.Id] {
+		t.Fatal("expected the failed domain to be pending")
+	}
+	if applied.IPPoolsPending || ses.applied[applied.Id.String()] != pool {
+		t.Fatal("expected the pool to be applied to the other domain")
+	}
+	// the broadcast emails of the pending domain aren't sent through a
+	// configuration set which may not exist
+	if failing.MarketingConfigSetName != "" {
+		t.Fatalf("expected no marketing configuration set while pending, got %s", failing.MarketingConfigSetName)
+	}
+	if applied.MarketingConfigSetName != marketingConfigSetName(applied) {
+		t.Fatalf("expected the marketing configuration set once applied, got %q", applied.MarketingConfigSetName)
+	}
+
+	// the verification of a domain which isn't pending doesn't call SES
+	delete(ses.applied, applied.Id.String())
+	err = service.ReconcileDomain(ctx, applied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ses.applied[applied.Id.String()]; ok {
+		t.Fatal("expected the domain which isn't pending to be skipped")
+	}
+
+	delete(ses.failing, failing.Id.String())
+	err = service.ReconcileDomain(ctx, failing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failing.IPPoolsPending || domainRepository.pending[failing.Id] {
+		t.Fatal("expected the reconciled domain not to be pending")
+	}
+	if ses.applied[failing.Id.String()] != pool {
+		t.Fatal("expected the pool to be applied on reconcile")
+	}
+	if failing.MarketingConfigSetName != marketingConfigSetName(failing) {
+		t.Fatalf("expected the marketing configuration set on reconcile, got %q", failing.MarketingConfigSetName)
+	}
+}
+
+func TestApplyDomainAppliesTheFailoverRegionPools(t *testing.T) {
+	workspaceId := *uid.NewUID(1)
+	failoverRegion := constant.AwsRegionIreland
+	domain := &model.Domain{
+		Base:           model.Base{Id: *uid.NewUID(2)},
+		Region:         constant.AwsRegionNorthVirginia,
+		FailoverRegion: &failoverRegion,
+		WorkspaceId:    workspaceId,
+	}
+	irelandPool := &model.IPPool{Base: model.Base{Id: *uid.NewUID(3)}, Region: constant.AwsRegionIreland}
+	ses := &fakeIPPoolSESService{applied: make(map[string]*model.IPPool)}
+	service := &ipPoolService{
+		baseService: newTestBaseService(&model.Repository{
+			Domain: &fakeDomainRepository{domains: []*model.Domain{domain}, pending: make(map[uid.UID]bool)},
+			IPPool: &fakeIPPoolRepository{
+				pools:       []*model.IPPool{irelandPool},
+				assignments: []*model.IPPoolAssignment{{Stream: constant.MessageStreamMarketing, IPPoolId: irelandPool.Id}},
+			},
+		}),
+		ses: ses,
+	}
+
+	err := service.ApplyDomain(context.Background(), domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ses.applied[marketingConfigSetName(domain)] != irelandPool {
+		t.Fatal("expected the marketing pool of the failover region to be applied")
+	}
+	if domain.MarketingConfigSetName != "" {
+		t.Fatalf("expected no marketing configuration set in the primary region, got %q", domain.MarketingConfigSetName)
+	}
+	if domain.FailoverMarketingConfigSetName != marketingConfigSetName(domain) {
+		t.Fatalf("expected the marketing configuration set in the failover region, got %q", domain.FailoverMarketingConfigSetName)
+	}
+}
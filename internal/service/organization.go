@@ -2,13 +2,18 @@ package service
 
 import (
 	"context"
+	"errors"
 
 	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
 )
 
+var ErrNoDefaultOrganization = errors.New("workspace has no default organization")
+
 type OrganizationService interface {
 	Create(ctx context.Context, organization *model.Organization) error
 	List(ctx context.Context) ([]*model.Organization, int, error)
+	Default(ctx context.Context, workspaceId uid.UID) (*model.Organization, error)
 }
 
 type organizationService struct {
@@ -28,3 +33,16 @@ func (s *organizationService) Create(ctx context.Context, organization *model.Or
 func (s *organizationService) List(ctx context.Context) ([]*model.Organization, int, error) {
 	return s.repository.Organization.FindAll(ctx)
 }
+
+// Default returns the organization new resources of the workspace belong to
+func (s *organizationService) Default(ctx context.Context, workspaceId uid.UID) (*model.Organization, error) {
+	organization, err := s.repository.Organization.FindDefault(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	if organization == nil {
+		return nil, ErrNoDefaultOrganization
+	}
+
+	return organization, nil
+}
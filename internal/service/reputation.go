@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+const reputationListenerId = "reputation"
+
+type ReputationService interface {
+	Accounts(ctx context.Context, workspaceId uid.UID) ([]*SESAccount, error)
+	Metrics(ctx context.Context, workspaceId uid.UID) (*ReputationMetrics, error)
+	StartListeners(ctx context.Context)
+}
+
+// SESAccount is the sending quota and status of the SES account of a region,
+// Error is set instead when the account couldn't be fetched
+type SESAccount struct {
+	Region                  constant.AwsRegion `json:"region"`
+	Max24HourSend           float64            `json:"max24HourSend"`
+	MaxSendRate             float64            `json:"maxSendRate"`
+	SentLast24Hours         float64            `json:"sentLast24Hours"`
+	ProductionAccessEnabled bool               `json:"productionAccessEnabled"` // False in the sandbox
+	SendingEnabled          bool               `json:"sendingEnabled"`
+	EnforcementStatus       string             `json:"enforcementStatus"` // HEALTHY, PROBATION or SHUTDOWN
+	Error                   *string            `json:"error,omitempty"`
+}
+
+// ReputationMetrics are the bounce and complaint rates of the workspace over
+// the reputation window
+type ReputationMetrics struct {
+	From              time.Time         `json:"from"`
+	Domains           []*ReputationStat `json:"domains"`
+	ConfigurationSets []*ReputationStat `json:"configurationSets"`
+}
+
+type ReputationStat struct {
+	model.EventSendingStat
+	BounceRate    float64 `json:"bounceRate"`
+	ComplaintRate float64 `json:"complaintRate"`
+}
+
+type reputationService struct {
+	*baseService
+	ses          SESService
+	eventService EventSevice
+}
+
+func NewReputationService(baseService *baseService, sesService SESService, eventService EventSevice) ReputationService {
+	return &reputationService{
+		baseService,
+		sesService,
+		eventService,
+	}
+}
+
+// Accounts returns the SES account of every enabled region, a region which
+// fails doesn't fail the others
+func (s *reputationService) Accounts(ctx context.Context, workspaceId uid.UID) ([]*SESAccount, error) {
+	_, err := s.activeAWSAccount(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	accounts := make([]*SESAccount, 0, len(s.config.SES.Regions))
+	for _, region := range s.config.SES.Regions {
+		account := &SESAccount{Region: region}
+		accounts = append(accounts, account)
+		resp, err := s.ses.GetAccount(ctx, workspaceId, region)
+		if err != nil {
+			s.logger.Error().Err(err).Str("region", string(region)).Msg("failed to get SES account")
+			message := err.Error()
+			account.Error = &message
+			continue
+		}
+		if resp.SendQuota != nil {
+			account.Max24HourSend = resp.SendQuota.Max24HourSend
+			account.MaxSendRate = resp.SendQuota.MaxSendRate
+			account.SentLast24Hours = resp.SendQuota.SentLast24Hours
+		}
+		account.ProductionAccessEnabled = resp.ProductionAccessEnabled
+		account.SendingEnabled = resp.SendingEnabled
+		account.EnforcementStatus = aws.ToString(resp.EnforcementStatus)
+	}
+
+	return accounts, nil
+}
+
+// Metrics computes the rates from the SES events of the workspace by sending
+// domain and configuration set
+func (s *reputationService) Metrics(ctx context.Context, workspaceId uid.UID) (*ReputationMetrics, error) {
+	metrics := &ReputationMetrics{
+		From: time.Now().UTC().Add(-s.window()),
+	}
+	for _, group := range []struct {
+		key   string
+		stats *[]*ReputationStat
+	}{
+		{model.EventMetaDataFromDomain, &metrics.Domains},
+		{model.EventMetaDataConfigurationSet, &metrics.ConfigurationSets},
+	} {
+		stats, err := s.repository.Event.FindSendingStats(ctx, model.EventStatsOptions{
+			WorkspaceId: workspaceId,
+			GroupBy:     group.key,
+			From:        metrics.From,
+		})
+		if err != nil {
+			return nil, err
+		}
+		*group.stats = make([]*ReputationStat, 0, len(stats))
+		for _, stat := range stats {
+			*group.stats = append(*group.stats, reputationStat(stat))
+		}
+	}
+
+	return metrics, nil
+}
+
+// StartListeners checks the rates of the sending domain and configuration set
+// of every bounce and complaint
+func (s *reputationService) StartListeners(ctx context.Context) {
+	s.eventService.Subscribe(ctx, reputationListenerId, s.handleEvent)
+}
+
+func (s *reputationService) handleEvent(ctx context.Context, event *model.Event) error {
+	if event.EventType != constant.EventTypeEmailBounced && event.EventType != constant.EventTypeEmailReported {
+		return nil
+	}
+	for _, key := range []string{model.EventMetaDataFromDomain, model.EventMetaDataConfigurationSet} {
+		value, ok := event.MetaData[key].(string)
+		if !ok || value == "" {
+			continue
+		}
+		err := s.checkRates(ctx, event, key, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkRates emits an event when the rate of the event type crosses its
+// threshold, once per window for the same value. The source id of the alert
+// makes instances checking the same rates concurrently save it once
+func (s *reputationService) checkRates(ctx context.Context, event *model.Event, key string, value string) error {
+	now := time.Now().UTC()
+	from := now.Add(-s.window())
+	stats, err := s.repository.Event.FindSendingStats(ctx, model.EventStatsOptions{
+		WorkspaceId: event.WorkspaceId,
+		GroupBy:     key,
+		Value:       value,
+		From:        from,
+	})
+	if err != nil {
+		return err
+	}
+	if len(stats) == 0 || stats[0].Sent < s.config.Reputation.MinSent {
+		return nil
+	}
+	stat := reputationStat(stats[0])
+	eventType := constant.EventTypeBounceRateHigh
+	rate, threshold := stat.BounceRate, s.config.Reputation.BounceRateThreshold
+	if event.EventType == constant.EventTypeEmailReported {
+		eventType = constant.EventTypeComplaintRateHigh
+		rate, threshold = stat.ComplaintRate, s.config.Reputation.ComplaintRateThreshold
+	}
+	if rate <= threshold {
+		return nil
+	}
+	alerts, err := s.repository.Event.FindAll(ctx, model.EventFindOptions{
+		WorkspaceId: event.WorkspaceId,
+		EventTypes:  []constant.EventType{eventType},
+		MetaData:    map[string]string{key: value},
+		From:        &from,
+		Limit:       1,
+	})
+	if err != nil {
+		return err
+	}
+	if len(alerts) > 0 {
+		return nil
+	}
+	sourceId := rateAlertSourceId(eventType, event.WorkspaceId, key, value, now, s.window())
+	alert := &model.Event{
+		Base: model.Base{
+			Id: *s.uidGenerator.Next(),
+		},
+		EventType:     eventType,
+		Receipients:   model.JSONBArray{},
+		CCRecipients:  model.JSONBArray{},
+		BCCRecipients: model.JSONBArray{},
+		MetaData: model.EventMetaData{
+			key:             value,
+			"rate":          rate,
+			"threshold":     threshold,
+			"sent":          stat.Sent,
+			"bounced":       stat.Bounced,
+			"complained":    stat.Complained,
+			"windowInHours": s.config.Reputation.WindowInHours,
+		},
+		OrganizationId: event.OrganizationId,
+		WorkspaceId:    event.WorkspaceId,
+		SourceId:       &sourceId,
+	}
+	err = s.repository.Event.Save(ctx, alert)
+	if errors.Is(err, model.ErrEventExists) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.logger.Warn().Str("workspaceId", event.WorkspaceId.String()).Str(key, value).Str("eventType", string(eventType)).Msg("rate above reputation threshold")
+	s.eventService.Publish(ctx, []*model.Event{alert})
+
+	return nil
+}
+
+// rateAlertSourceId identifies the alert of a value in the window bucket of
+// the time
+func rateAlertSourceId(
+	eventType constant.EventType,
+	workspaceId uid.UID,
+	key string,
+	value string,
+	at time.Time,
+	window time.Duration,
+) string {
+	return fmt.Sprintf("%s:%s:%s:%s:%d", eventType, workspaceId.String(), key, value, at.Truncate(window).Unix())
+}
+
+func (s *reputationService) window() time.Duration {
+	return time.Duration(s.config.Reputation.WindowInHours) * time.Hour
+}
+
+func reputationStat(stat *model.EventSendingStat) *ReputationStat {
+	reputation := &ReputationStat{EventSendingStat: *stat}
+	if stat.Sent > 0 {
+		reputation.BounceRate = float64(stat.Bounced) / float64(stat.Sent)
+		reputation.ComplaintRate = float64(stat.Complained) / float64(stat.Sent)
+	}
+
+	return reputation
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/usesend0/send0/internal/config"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type fakeEventRepository struct {
+	model.EventRepository
+	stats  []*model.EventSendingStat
+	saved  map[string]*model.Event
+	events []*model.Event // In the order of their ids
+}
+
+func (r *fakeEventRepository) FindSendingStats(_ context.Context, _ model.EventStatsOptions) ([]*model.EventSendingStat, error) {
+	return r.stats, nil
+}
+
+// FindAll finds the events after the cursor in ascending order, the alert of a
+// concurrent instance isn't in the events
+func (r *fakeEventRepository) FindAll(_ context.Context, options model.EventFindOptions) ([]*model.Event, error) {
+	events := make([]*model.Event, 0)
+	for _, event := range r.events {
+		if event.Id.ID() > options.Cursor.ID() && len(events) < options.Limit {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+func (r *fakeEventRepository) Save(_ context.Context, event *model.Event) error {
+	if event.SourceId != nil {
+		if _, ok := r.saved[*event.SourceId]; ok {
+			return model.ErrEventExists
+		}
+		r.saved[*event.SourceId] = event
+	}
+
+	return nil
+}
+
+type fakeEventService struct {
+	EventSevice
+	published []*model.Event
+}
+
+func (s *fakeEventService) Create(_ context.Context, _ *model.Event) {}
+
+func (s *fakeEventService) Publish(_ context.Context, events []*model.Event) {
+	s.published = append(s.published, events...)
+}
+
+func TestCheckRatesSavesAlertOnce(t *testing.T) {
+	eventRepository := &fakeEventRepository{
+		stats: []*model.EventSendingStat{{Value: "example.com", Sent: 100, Bounced: 10}},
+		saved: make(map[string]*model.Event),
+	}
+	eventService := &fakeEventService{}
+	service := &reputationService{
+		baseService:  newTestBaseService(&model.Repository{Event: eventRepository}),
+		eventService: eventService,
+	}
+	service.config.Reputation = config.Reputation{WindowInHours: 24, MinSent: 100, BounceRateThreshold: 0.05}
+	event := &model.Event{
+		EventType:   constant.EventTypeEmailBounced,
+		WorkspaceId: *uid.NewUID(1),
+	}
+
+	for i := 0; i < 2; i++ {
+		err := service.checkRates(context.Background(), event, model.EventMetaDataFromDomain, "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(eventRepository.saved) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(eventRepository.saved))
+	}
+	if len(eventService.published) != 1 || eventService.published[0].EventType != constant.EventTypeBounceRateHigh {
+		t.Fatalf("expected 1 published bounce rate alert, got %+v", eventService.published)
+	}
+}
+
+func TestRateAlertSourceId(t *testing.T) {
+	window := 24 * time.Hour
+	at := time.Date(2024, 8, 9, 10, 0, 0, 0, time.UTC)
+	workspaceId := *uid.NewUID(1)
+	sourceId := rateAlertSourceId(constant.EventTypeBounceRateHigh, workspaceId, model.EventMetaDataFromDomain, "example.com", at, window)
+
+	if got := rateAlertSourceId(constant.EventTypeBounceRateHigh, workspaceId, model.EventMetaDataFromDomain, "example.com", at.Add(13*time.Hour), window); got != sourceId {
+		t.Fatalf("expected the same source id in the window, got %s and %s", sourceId, got)
+	}
+	for name, other := range map[string]string{
+		"next window": rateAlertSourceId(constant.EventTypeBounceRateHigh, workspaceId, model.EventMetaDataFromDomain, "example.com", at.Add(window), window),
+		"event type":  rateAlertSourceId(constant.EventTypeComplaintRateHigh, workspaceId, model.EventMetaDataFromDomain, "example.com", at, window),
+		"workspace":   rateAlertSourceId(constant.EventTypeBounceRateHigh, *uid.NewUID(2), model.EventMetaDataFromDomain, "example.com", at, window),
+		"key":         rateAlertSourceId(constant.EventTypeBounceRateHigh, workspaceId, model.EventMetaDataConfigurationSet, "example.com", at, window),
+		"value":       rateAlertSourceId(constant.EventTypeBounceRateHigh, workspaceId, model.EventMetaDataFromDomain, "example.org", at, window),
+	} {
+		if other == sourceId {
+			t.Fatalf("expected another source id for the %s, got %s", name, other)
+		}
+	}
+}
+
+func TestFindSendingStats(t *testing.T) {
+	repository := newTestRepository(t)
+	service := &reputationService{baseService: newTestBaseService(repository)}
+	ctx := context.Background()
+	workspaceId := service.uidGenerator.Next()
+	saveEvents := func(eventType constant.EventType, domain string, configurationSet string, count int) {
+		t.Helper()
+		for i := 0; i < count; i++ {
+			err := repository.Event.Save(ctx, &model.Event{
+				Base:           model.Base{Id: *service.uidGenerator.Next()},
+				EventType:      eventType,
+				Receipients:    model.JSONBArray{},
+				CCRecipients:   model.JSONBArray{},
+				BCCRecipients:  model.JSONBArray{},
+				MetaData:       model.EventMetaData{model.EventMetaDataFromDomain: domain, model.EventMetaDataConfigurationSet: configurationSet},
+				OrganizationId: *workspaceId,
+				WorkspaceId:    *workspaceId,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	saveEvents(constant.EventTypeEmailSend, "example.com", "marketing", 4)
+	saveEvents(constant.EventTypeEmailBounced, "example.com", "marketing", 2)
+	saveEvents(constant.EventTypeEmailReported, "example.com", "transactional", 1)
+	saveEvents(constant.EventTypeEmailSend, "example.org", "transactional", 6)
+	saveEvents(constant.EventTypeEmailOpened, "example.org", "transactional", 3)
+	from := time.Now().Add(-time.Hour)
+
+	stats, err := repository.Event.FindSendingStats(ctx, model.EventStatsOptions{
+		WorkspaceId: *workspaceId,
+		GroupBy:     model.EventMetaDataFromDomain,
+		From:        from,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []model.EventSendingStat{
+		{Value: "example.org", Sent: 6},
+		{Value: "example.com", Sent: 4, Bounced: 2, Complained: 1},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("expected %d domains, got %d", len(want), len(stats))
+	}
+	for i := range want {
+		if *stats[i] != want[i] {
+			t.Fatalf("expected %+v, got %+v", want[i], *stats[i])
+		}
+	}
+
+	stats, err = repository.Event.FindSendingStats(ctx, model.EventStatsOptions{
+		WorkspaceId: *workspaceId,
+		GroupBy:     model.EventMetaDataConfigurationSet,
+		Value:       "marketing",
+		From:        from,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || *stats[0] != (model.EventSendingStat{Value: "marketing", Sent: 4, Bounced: 2}) {
+		t.Fatalf("expected the marketing configuration set, got %+v", stats)
+	}
+
+	stats, err = repository.Event.FindSendingStats(ctx, model.EventStatsOptions{
+		WorkspaceId: *workspaceId,
+		GroupBy:     model.EventMetaDataFromDomain,
+		From:        time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 0 {
+		t.Fatalf("expected no events after from, got %+v", stats)
+	}
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+var (
+	ErrSenderExists         = errors.New("sender already exists")
+	ErrSenderRegionRequired = errors.New("region is required for a mailbox sender")
+	ErrNoDefaultSender      = errors.New("from is required as the workspace has no default sender")
+	ErrSenderNotAllowed     = errors.New("from address is not an active domain or sender of the workspace")
+)
+
+type SenderService interface {
+	Create(ctx context.Context, sender *model.Sender) error
+	Get(ctx context.Context, id uid.UID) (*model.Sender, error)
+	List(ctx context.Context, workspaceId uid.UID) ([]*model.Sender, error)
+	Update(ctx context.Context, sender *model.Sender) error
+	SetDefault(ctx context.Context, sender *model.Sender) error
+	Verify(ctx context.Context, sender *model.Sender) error
+	Delete(ctx context.Context, sender *model.Sender) error
+	Resolve(ctx context.Context, email *model.Email) error
+}
+
+type senderService struct {
+	*baseService
+	sesService SESService
+}
+
+func NewSenderService(baseService *baseService, sesService SESService) SenderService {
+	return &senderService{
+		baseService: baseService,
+		sesService:  sesService,
+	}
+}
+
+// Create saves a sender under a domain of the workspace, an address outside
+// of the domains is a mailbox sender verified by an SES email address identity.
+// The first sender of the workspace becomes its default
+func (s *senderService) Create(ctx context.Context, sender *model.Sender) error {
+	address, err := mail.ParseAddress(sender.Address)
+	if err != nil {
+		return err
+	}
+	sender.Address = strings.ToLower(address.Address)
+	existing, err := s.repository.Sender.FindByAddress(ctx, sender.WorkspaceId, sender.Address)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrSenderExists
+	}
+	domain, err := s.findDomain(ctx, sender.WorkspaceId, senderDomainName(sender.Address), "")
+	if err != nil {
+		return err
+	}
+	sender.Id = *s.uidGenerator.Next()
+	sender.Status = model.SenderStatusPending
+	if domain != nil {
+		sender.DomainId = &domain.Id
+		sender.OrganizationId = domain.OrganizationId
+		sender.Region = domain.Region
+		if domain.Status == constant.DomainStatusActive {
+			sender.Status = model.SenderStatusActive
+		}
+	} else {
+		if sender.Region == "" {
+			return ErrSenderRegionRequired
+		}
+		if !s.sesRegionEnabled(sender.Region) {
+			return fmt.Errorf("unsupported region %s", sender.Region)
+		}
+	}
+	defaultSender, err := s.repository.Sender.FindDefault(ctx, sender.WorkspaceId)
+	if err != nil {
+		return err
+	}
+	isDefault := sender.IsDefault || defaultSender == nil
+	sender.IsDefault = false
+	err = s.repository.Sender.Save(ctx, sender)
+	if err != nil {
+		return err
+	}
+	if sender.DomainId == nil {
+		err = s.sesService.CreateSenderIdentity(ctx, sender)
+		if err != nil {
+			deleteErr := s.repository.Sender.Delete(ctx, sender.Id)
+			if deleteErr != nil {
+				s.logger.Error().Err(deleteErr).Msg("failed to delete sender")
+			}
+			return err
+		}
+	}
+	if isDefault {
+		return s.SetDefault(ctx, sender)
+	}
+
+	return nil
+}
+
+func (s *senderService) Get(ctx context.Context, id uid.UID) (*model.Sender, error) {
+	return s.repository.Sender.FindById(ctx, id)
+}
+
+func (s *senderService) List(ctx context.Context, workspaceId uid.UID) ([]*model.Sender, error) {
+	return s.repository.Sender.FindByWorkspaceId(ctx, workspaceId)
+}
+
+// Update saves the display name and the default reply-to of the sender
+func (s *senderService) Update(ctx context.Context, sender *model.Sender) error {
+	if sender.ReplyTo != nil {
+		_, err := mail.ParseAddress(*sender.ReplyTo)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.repository.Sender.Update(ctx, sender)
+}
+
+// SetDefault makes the sender the default of its workspace, the previous
+// default is unset
+func (s *senderService) SetDefault(ctx context.Context, sender *model.Sender) error {
+	err := s.repository.Sender.SetDefault(ctx, sender)
+	if err != nil {
+		return err
+	}
+	sender.IsDefault = true
+
+	return nil
+}
+
+// Verify refreshes the status of the sender, from its domain or from the SES
+// identity of a mailbox sender
+func (s *senderService) Verify(ctx context.Context, sender *model.Sender) error {
+	status := model.SenderStatusPending
+	if sender.DomainId != nil {
+		domain, err := s.repository.Domain.FindById(ctx, *sender.DomainId)
+		if err != nil {
+			return err
+		}
+		if domain == nil {
+			status = model.SenderStatusFailed
+		} else if domain.Status == constant.DomainStatusActive {
+			status = model.SenderStatusActive
+		}
+	} else {
+		identity, err := s.sesService.GetSenderIdentity(ctx, sender)
+		if err != nil {
+			return err
+		}
+		if identity.VerifiedForSendingStatus {
+			status = model.SenderStatusActive
+		} else if identity.VerificationStatus == types.VerificationStatusFailed {
+			status = model.SenderStatusFailed
+		}
+	}
+	if status == sender.Status {
+		return nil
+	}
+	sender.Status = status
+
+	return s.repository.Sender.UpdateStatus(ctx, sender.Id, status)
+}
+
+// Delete removes the sender, the SES identity of a mailbox sender is deleted
+// as well
+func (s *senderService) Delete(ctx context.Context, sender *model.Sender) error {
+	if sender.DomainId == nil {
+		err := s.sesService.DeleteSenderIdentity(ctx, sender)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.repository.Sender.Delete(ctx, sender.Id)
+}
+
+// Resolve checks the from address of the email before it is saved. Without a
+// from the default sender of the workspace is used, otherwise the address must
+// be under an active domain of the workspace or be an active mailbox sender.
+// The display name and reply-to of a matching sender fill the missing ones
+func (s *senderService) Resolve(ctx context.Context, email *model.Email) error {
+	if strings.TrimSpace(email.From) == "" {
+		sender, err := s.repository.Sender.FindDefault(ctx, email.WorkspaceId)
+		if err != nil {
+			return err
+		}
+		if sender == nil {
+			return ErrNoDefaultSender
+		}
+		err = s.checkSender(ctx, sender)
+		if err != nil {
+			return err
+		}
+		applySender(email, &mail.Address{}, sender)
+
+		return nil
+	}
+	from, err := mail.ParseAddress(email.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address: %w", err)
+	}
+	// senders are saved lowercased
+	sender, err := s.repository.Sender.FindByAddress(ctx, email.WorkspaceId, strings.ToLower(from.Address))
+	if err != nil {
+		return err
+	}
+	domain, err := s.findDomain(ctx, email.WorkspaceId, senderDomainName(from.Address), constant.DomainStatusActive)
+	if err != nil {
+		return err
+	}
+	if domain == nil {
+		if sender == nil || sender.DomainId != nil {
+			return ErrSenderNotAllowed
+		}
+		err = s.checkSender(ctx, sender)
+		if err != nil {
+			return err
+		}
+	}
+	if sender != nil {
+		applySender(email, from, sender)
+	}
+
+	return nil
+}
+
+// checkSender returns ErrSenderNotAllowed when the sender can't send, a
+// pending sender is verified again first
+func (s *senderService) checkSender(ctx context.Context, sender *model.Sender) error {
+	if sender.Status != model.SenderStatusActive {
+		err := s.Verify(ctx, sender)
+		if err != nil {
+			return err
+		}
+	}
+	if sender.Status != model.SenderStatusActive {
+		return ErrSenderNotAllowed
+	}
+
+	return nil
+}
+
+// findDomain returns the domain of the workspace with the name, an empty
+// status matches any status
+func (s *senderService) findDomain(ctx context.Context, workspaceId uid.UID, name string, status constant.DomainStatus) (*model.Domain, error) {
+	domains, _, err := s.repository.Domain.FindAll(ctx, model.DomainFindOptions{
+		Name:        name,
+		Status:      status,
+		WorkspaceId: workspaceId,
+		Limit:       1,
+	})
+	if err != nil || len(domains) == 0 {
+		return nil, err
+	}
+
+	return domains[0], nil
+}
+
+func applySender(email *model.Email, from *mail.Address, sender *model.Sender) {
+	if from.Name == "" {
+		from.Name = sender.Name
+	}
+	from.Address = sender.Address
+	email.From = from.String()
+	if email.ReplyTo == nil {
+		email.ReplyTo = sender.ReplyTo
+	}
+}
+
+func senderDomainName(address string) string {
+	return strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+}
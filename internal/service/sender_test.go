@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type fakeSenderRepository struct {
+	model.SenderRepository
+	senders []*model.Sender
+}
+
+func (r *fakeSenderRepository) FindByAddress(_ context.Context, workspaceId uid.UID, address string) (*model.Sender, error) {
+	for _, sender := range r.senders {
+		if sender.WorkspaceId == workspaceId && sender.Address == address {
+			return sender, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (r *fakeSenderRepository) FindDefault(_ context.Context, workspaceId uid.UID) (*model.Sender, error) {
+	for _, sender := range r.senders {
+		if sender.WorkspaceId == workspaceId && sender.IsDefault {
+			return sender, nil
+		}
+	}
+
+	return nil, nil
+}
+
+type fakeDomainRepository struct {
+	model.DomainRepository
+	domains []*model.Domain
+	pending map[uid.UID]bool
+}
+
+func (r *fakeDomainRepository) FindAll(_ context.Context, options model.DomainFindOptions) ([]*model.Domain, int, error) {
+	domains := []*model.Domain{}
+	for _, domain := range r.domains {
+		if domain.WorkspaceId != options.WorkspaceId ||
+			(options.Name != "" && domain.Name != options.Name) ||
+			(options.Status != "" && domain.Status != options.Status) {
+			continue
+		}
+		domains = append(domains, domain)
+	}
+
+	return domains, len(domains), nil
+}
+
+func (r *fakeDomainRepository) UpdateIPPools(_ context.Context, domain *model.Domain) error {
+	r.pending[domain.Id] = domain.IPPoolsPending
+
+	return nil
+}
+
+func TestResolveSender(t *testing.T) {
+	workspaceId := *uid.NewUID(1)
+	domainId := uid.NewUID(2)
+	replyTo := "support@example.com"
+	repository := &model.Repository{
+		Domain: &fakeDomainRepository{
+			domains: []*model.Domain{
+				{Base: model.Base{Id: *domainId}, Name: "example.com", Status: constant.DomainStatusActive, WorkspaceId: workspaceId},
+				{Name: "pending.com", Status: constant.DomainStatusPending, WorkspaceId: workspaceId},
+			},
+		},
+		Sender: &fakeSenderRepository{
+			senders: []*model.Sender{
+				{Address: "hello@example.com", Name: "Example", ReplyTo: &replyTo, IsDefault: true, Status: model.SenderStatusActive, DomainId: domainId, WorkspaceId: workspaceId},
+				{Address: "jane@gmail.com", Status: model.SenderStatusActive, WorkspaceId: workspaceId},
+			},
+		},
+	}
+	service := NewSenderService(newTestBaseService(repository), nil)
+
+	tests := []struct {
+		name    string
+		from    string
+		want    string
+		wantErr error
+	}{
+		{name: "default sender", from: "", want: `"Example" <hello@example.com>`},
+		{name: "sender", from: "hello@example.com", want: `"Example" <hello@example.com>`},
+		{name: "sender with another case", from: "Hello@Example.com", want: `"Example" <hello@example.com>`},
+		{name: "sender with a name", from: "Team <hello@example.com>", want: `"Team" <hello@example.com>`},
+		{name: "address of an active domain", from: "news@example.com", want: "news@example.com"},
+		{name: "mailbox sender", from: "Jane@Gmail.com", want: "<jane@gmail.com>"},
+		{name: "address of a pending domain", from: "news@pending.com", wantErr: ErrSenderNotAllowed},
+		{name: "unknown address", from: "news@unknown.com", wantErr: ErrSenderNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			email := &model.Email{From: test.from, WorkspaceId: workspaceId}
+			err := service.Resolve(context.Background(), email)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("expected %v, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if email.From != test.want {
+				t.Fatalf("expected from %q, got %q", test.want, email.From)
+			}
+		})
+	}
+}
+
+func TestResolveSenderWithoutDefault(t *testing.T) {
+	repository := &model.Repository{Sender: &fakeSenderRepository{}}
+	service := NewSenderService(newTestBaseService(repository), nil)
+
+	err := service.Resolve(context.Background(), &model.Email{WorkspaceId: *uid.NewUID(1)})
+	if !errors.Is(err, ErrNoDefaultSender) {
+		t.Fatalf("expected ErrNoDefaultSender, got %v", err)
+	}
+}
@@ -3,9 +3,11 @@ package service
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/usesend0/send0/internal/config"
+	"github.com/usesend0/send0/internal/eventbus"
 	"github.com/usesend0/send0/internal/model"
 	"github.com/usesend0/send0/internal/uid"
 )
@@ -14,11 +16,21 @@ var _ model.Transactioner[*Service] = (*Service)(nil)
 
 type Service struct {
 	*baseService
+	AWSAccount   AWSAccountService
+	Broadcast    BroadcastService
 	Client       ClientService
+	Contact      ContactService
+	DNSProvider  DNSProviderService
 	Domain       DomainService
 	Email        EmailService
+	Event        EventSevice
+	IPPool       IPPoolService
 	Organization OrganizationService
+	Reputation   ReputationService
+	Template     TemplateService
+	Webhook      WebhookService
 	Workspace    WorkspaceService
+	Sender       SenderService
 	SNS          SNSService
 	SES          SESService
 }
@@ -28,14 +40,24 @@ type baseService struct {
 	repository   *model.Repository
 	logger       *zerolog.Logger
 	uidGenerator uid.UIDGenerator
+	eventBus     eventbus.EventBus
+	awsClients   *awsClients
 }
 
-func NewBaseService(config *config.Config, uidGenerator uid.UIDGenerator, logger *zerolog.Logger, repository *model.Repository) *baseService {
+func NewBaseService(
+	config *config.Config,
+	uidGenerator uid.UIDGenerator,
+	logger *zerolog.Logger,
+	repository *model.Repository,
+	eventBus eventbus.EventBus,
+) *baseService {
 	return &baseService{
 		config:       config,
 		repository:   repository,
 		logger:       logger,
 		uidGenerator: uidGenerator,
+		eventBus:     eventBus,
+		awsClients:   newAWSClients(config),
 	}
 }
 
@@ -51,15 +73,38 @@ func NewService(baseService *baseService) (*Service, error) {
 	if err != nil {
 		return nil, err
 	}
-	domainService := NewDomainService(baseService, sesService)
-	emailService := NewEmailService(baseService, sesService, eventService)
+	awsAccountService := NewAWSAccountService(baseService, snsService)
+	dnsProviderService := NewDNSProviderService(baseService)
+	ipPoolService := NewIPPoolService(baseService, sesService)
+	domainService := NewDomainService(baseService, sesService, eventService, dnsProviderService, ipPoolService)
+	senderService := NewSenderService(baseService, sesService)
+	emailService := NewEmailService(baseService, sesService, eventService, senderService)
+	reputationService := NewReputationService(baseService, sesService, eventService)
+	templateService := NewTemplateService(baseService)
+	contactService, err := NewContactService(baseService, emailService, eventService, templateService)
+	if err != nil {
+		return nil, err
+	}
+
+	broadcastService := NewBroadcastService(baseService, emailService, eventService, templateService)
+	webhookService := NewWebhookService(baseService, eventService)
 
 	return &Service{
 		baseService:  baseService,
+		AWSAccount:   awsAccountService,
+		Broadcast:    broadcastService,
+		Contact:      contactService,
+		DNSProvider:  dnsProviderService,
 		Domain:       domainService,
 		Email:        emailService,
+		Event:        eventService,
+		IPPool:       ipPoolService,
 		Organization: orgaznizationService,
+		Reputation:   reputationService,
+		Template:     templateService,
+		Webhook:      webhookService,
 		Workspace:    workspcaeService,
+		Sender:       senderService,
 		SNS:          snsService,
 		SES:          sesService,
 	}, nil
@@ -67,7 +112,9 @@ func NewService(baseService *baseService) (*Service, error) {
 
 func (s *baseService) Transact(ctx context.Context, fn func(ctx context.Context, service *Service) error) error {
 	return s.repository.Transact(ctx, func(ctx context.Context, repo *model.Repository) error {
-		service, err := NewService(NewBaseService(s.config, s.uidGenerator, s.logger, repo))
+		baseService := NewBaseService(s.config, s.uidGenerator, s.logger, repo, s.eventBus)
+		baseService.awsClients = s.awsClients
+		service, err := NewService(baseService)
 		if err != nil {
 			return err
 		}
@@ -76,6 +123,21 @@ func (s *baseService) Transact(ctx context.Context, fn func(ctx context.Context,
 	})
 }
 
+// waitRateLimit waits until count events of the id are allowed at the limit
+// per second, the limit is shared by every replica
+func (s *baseService) waitRateLimit(ctx context.Context, key model.RateLimitKey, id string, limit float64, count int) error {
+	wait, err := s.repository.RateLimit.Reserve(ctx, key, id, limit, count)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
 func formatSubdomain(parts []string) string {
 	filteredParts := []string{}
 	for _, part := range parts {
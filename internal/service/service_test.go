@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/usesend0/send0/internal/config"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/eventbus"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/storage/cache"
+	"github.com/usesend0/send0/internal/storage/db"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+// newTestBaseService returns a base service over the given repositories, the
+// repositories a test doesn't set panic when they're called
+func newTestBaseService(repository *model.Repository) *baseService {
+	cnf := &config.Config{
+		Env: constant.EnvDevelopment,
+		SES: config.SES{
+			Regions: []constant.AwsRegion{constant.AwsRegionNorthVirginia},
+		},
+	}
+	logger := zerolog.Nop()
+
+	return NewBaseService(cnf, uid.NewUIDGenerator(cnf, &logger), &logger, repository, eventbus.NewMemoryEventBus(&logger))
+}
+
+// newTestRepository returns the repositories of the database at the URL of
+// SEND0_TEST_POSTGRES_URL, the schema of the migrations must be applied. The
+// test is skipped when it is not set
+func newTestRepository(t *testing.T) *model.Repository {
+	t.Helper()
+	url := os.Getenv("SEND0_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("SEND0_TEST_POSTGRES_URL is not set")
+	}
+	cnf := &config.Config{
+		Env:      constant.EnvDevelopment,
+		Postgres: config.Postgres{URL: url, PoolSize: 2},
+	}
+	logger := zerolog.Nop()
+	database, err := db.NewDB(logger.WithContext(context.Background()), cnf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	return model.NewRepository(model.NewBaseRepository(nil, database, uid.NewUIDGenerator(cnf, &logger), &logger))
+}
+
+func TestWaitRateLimitIsShared(t *testing.T) {
+	url := os.Getenv("SEND0_TEST_REDIS_URL")
+	if url == "" {
+		t.Skip("SEND0_TEST_REDIS_URL is not set")
+	}
+	cnf := &config.Config{Env: constant.EnvDevelopment, Redis: config.Redis{URL: url}}
+	logger := zerolog.Nop()
+	ctx := logger.WithContext(context.Background())
+	newReplica := func() *baseService {
+		c, err := cache.NewCache(ctx, cnf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+
+		return newTestBaseService(model.NewRepository(model.NewBaseRepository(c, nil, uid.NewUIDGenerator(cnf, &logger), &logger)))
+	}
+	replicas := []*baseService{newReplica(), newReplica()}
+	id := replicas[0].uidGenerator.Next().String()
+
+	// 4 events at 20 per second take 150ms whichever replica sends them
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		err := replicas[i%2].waitRateLimit(ctx, model.RateLimitKeyDomainSend, id, 20, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+		t.Fatalf("expected the replicas to share the rate, took %s", elapsed)
+	}
+}
@@ -2,78 +2,130 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
 	"github.com/usesend0/send0/internal/constant"
 	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+// How long the max send rate of an account is used before it's fetched again,
+// a rate which couldn't be fetched is retried sooner
+const (
+	sesMaxSendRateRefreshInterval = time.Hour
+	sesMaxSendRateRetryInterval   = time.Minute
 )
 
 type sesService struct {
 	*baseService
-	svcs       map[constant.AwsRegion]*sesv2.Client
+	mu         sync.Mutex
+	sendRates  map[sesSendRateKey]*sesSendRate
 	snsService SNSService
 }
 
+type sesSendRate struct {
+	maxSendRate float64
+	refreshAt   time.Time
+}
+
+// sesSendRateKey is the account and region a send rate is for, the zero
+// account id is the operator account
+type sesSendRateKey struct {
+	accountId uid.UID
+	region    constant.AwsRegion
+}
+
 type SESService interface {
 	SendEmail(
 		ctx context.Context,
+		workspaceId uid.UID,
 		region constant.AwsRegion,
 		configSetName string,
 		from string,
 		to []string,
 		cc []string,
 		bcc []string,
+		replyTo []string,
 		subject *string,
 		html *string,
 		text *string,
 	) (*string, error)
+	MaxSendRate(ctx context.Context, workspaceId uid.UID, region constant.AwsRegion) (float64, error)
+	GetAccount(ctx context.Context, workspaceId uid.UID, region constant.AwsRegion) (*sesv2.GetAccountOutput, error)
 	CreateEmailIdentity(ctx context.Context, domain *model.Domain, privateKey string) error
 	DeleteEmailIdentity(ctx context.Context, domain *model.Domain) error
+	GetEmailIdentity(ctx context.Context, domain *model.Domain) (*sesv2.GetEmailIdentityOutput, error)
+	PutDKIMSigningAttributes(ctx context.Context, domain *model.Domain, selector string, privateKey string) error
+	PutMailFromAttributes(ctx context.Context, domain *model.Domain) error
+	CreateSenderIdentity(ctx context.Context, sender *model.Sender) error
+	GetSenderIdentity(ctx context.Context, sender *model.Sender) (*sesv2.GetEmailIdentityOutput, error)
+	DeleteSenderIdentity(ctx context.Context, sender *model.Sender) error
+	CreateDedicatedIpPool(ctx context.Context, pool *model.IPPool) error
+	DeleteDedicatedIpPool(ctx context.Context, pool *model.IPPool) error
+	GetDedicatedIps(ctx context.Context, pool *model.IPPool) ([]types.DedicatedIp, error)
+	PutConfigurationSetIPPool(ctx context.Context, workspaceId uid.UID, region constant.AwsRegion, name string, pool *model.IPPool) error
+	DeleteConfigurationSet(ctx context.Context, workspaceId uid.UID, region constant.AwsRegion, name string) error
 }
 
 func NewSESService(baseService *baseService, snsService SNSService) (SESService, error) {
-	svcs := make(map[constant.AwsRegion]*sesv2.Client)
-	for _, region := range constant.SupportedSESRegions {
-		svcs[region] = sesv2.New(sesv2.Options{
-			Region: string(region),
-			Credentials: aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
-				baseService.config.SES.AccessKeyId,
-				baseService.config.SES.SecretAccessKey,
-				"",
-			)),
-		})
+	err := checkSESRegions(baseService.config.SES.Regions)
+	if err != nil {
+		return nil, err
 	}
 
 	return &sesService{
 		baseService: baseService,
-		svcs:        svcs,
+		sendRates:   make(map[sesSendRateKey]*sesSendRate),
 		snsService:  snsService,
 	}, nil
 }
 
 func (s *sesService) SendEmail(
 	ctx context.Context,
+	workspaceId uid.UID,
 	region constant.AwsRegion,
 	configSetName string,
 	from string,
 	to []string,
 	cc []string,
 	bcc []string,
+	replyTo []string,
 	subject *string,
 	html *string,
 	text *string,
 ) (*string, error) {
-	svc, ok := s.svcs[region]
-	if !ok {
-		return nil, fmt.Errorf("SES service not available for region %s", region)
+	account, err := s.activeAWSAccount(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	svc, err := s.sesClient(account, region)
+	if err != nil {
+		return nil, err
 	}
-	if len(to) == 0 || len(cc) == 0 || len(bcc) == 0 {
+	if len(to)+len(cc)+len(bcc) == 0 {
 		return nil, fmt.Errorf("no recipients provided")
 	}
+	// SES counts every recipient against the max send rate of the account
+	key := sesSendRateKey{region: region}
+	if account != nil {
+		key.accountId = account.Id
+	}
+	err = s.waitRateLimit(
+		ctx,
+		model.RateLimitKeySESSend,
+		fmt.Sprintf("%s:%s", key.accountId, region),
+		s.cachedMaxSendRate(ctx, account, key),
+		len(to)+len(cc)+len(bcc),
+	)
+	if err != nil {
+		return nil, err
+	}
 	message := &types.Message{
 		Body: &types.Body{
 			Html: &types.Content{
@@ -97,6 +149,7 @@ func (s *sesService) SendEmail(
 			Simple: message,
 		},
 		FromEmailAddress:     aws.String(from),
+		ReplyToAddresses:     replyTo,
 		ConfigurationSetName: aws.String(configSetName),
 	})
 	if err != nil {
@@ -106,12 +159,82 @@ func (s *sesService) SendEmail(
 	return resp.MessageId, nil
 }
 
-func (s *sesService) CreateEmailIdentity(ctx context.Context, domain *model.Domain, privateKey string) error {
-	svc, ok := s.svcs[domain.Region]
+func (s *sesService) MaxSendRate(ctx context.Context, workspaceId uid.UID, region constant.AwsRegion) (float64, error) {
+	account, err := s.activeAWSAccount(ctx, workspaceId)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.maxSendRate(ctx, account, region)
+}
+
+func (s *sesService) maxSendRate(ctx context.Context, account *model.AWSAccount, region constant.AwsRegion) (float64, error) {
+	svc, err := s.sesClient(account, region)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := svc.GetAccount(ctx, &sesv2.GetAccountInput{})
+	if err != nil {
+		return 0, err
+	}
+	if resp.SendQuota == nil {
+		return 0, fmt.Errorf("SES send quota not available for region %s", region)
+	}
+
+	return resp.SendQuota.MaxSendRate, nil
+}
+
+// GetAccount returns the sending quota and status of the SES account the
+// workspace sends through in the region
+func (s *sesService) GetAccount(ctx context.Context, workspaceId uid.UID, region constant.AwsRegion) (*sesv2.GetAccountOutput, error) {
+	svc, err := s.workspaceSESClient(ctx, workspaceId, region)
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.GetAccount(ctx, &sesv2.GetAccountInput{})
+}
+
+// cachedMaxSendRate returns the max send rate of the SES account in the region,
+// every replica shares it. The rate is fetched outside the lock by one sender
+// while the others keep the current rate, the default rate is used until it's
+// fetched
+func (s *sesService) cachedMaxSendRate(ctx context.Context, account *model.AWSAccount, key sesSendRateKey) float64 {
+	now := time.Now()
+	s.mu.Lock()
+	cached, ok := s.sendRates[key]
 	if !ok {
-		return fmt.Errorf("SES service not available for region %s", domain.Region)
+		cached = &sesSendRate{maxSendRate: s.config.SES.DefaultMaxSendRate}
+		s.sendRates[key] = cached
+	}
+	maxSendRate := cached.maxSendRate
+	refresh := !now.Before(cached.refreshAt)
+	if refresh {
+		cached.refreshAt = now.Add(sesMaxSendRateRetryInterval)
 	}
-	err := s.createConfigurationSet(domain)
+	s.mu.Unlock()
+	if !refresh {
+		return maxSendRate
+	}
+	fetched, err := s.maxSendRate(ctx, account, key.region)
+	if err != nil || fetched <= 0 {
+		s.logger.Error().Err(err).Str("region", string(key.region)).Msg("failed to get SES max send rate")
+		return maxSendRate
+	}
+	s.mu.Lock()
+	cached.maxSendRate = fetched
+	cached.refreshAt = time.Now().Add(sesMaxSendRateRefreshInterval)
+	s.mu.Unlock()
+
+	return fetched
+}
+
+func (s *sesService) CreateEmailIdentity(ctx context.Context, domain *model.Domain, privateKey string) error {
+	svc, err := s.workspaceSESClient(ctx, domain.WorkspaceId, domain.Region)
+	if err != nil {
+		return err
+	}
+	err = s.createConfigurationSet(ctx, domain.WorkspaceId, domain.Region, domain.Id.String())
 	if err != nil {
 		s.logger.Error().Err(err).Msg("failed to create configuration set")
 		return err
@@ -120,7 +243,7 @@ func (s *sesService) CreateEmailIdentity(ctx context.Context, domain *model.Doma
 		EmailIdentity: aws.String(domain.Name),
 		DkimSigningAttributes: &types.DkimSigningAttributes{
 			DomainSigningPrivateKey: aws.String(privateKey),
-			DomainSigningSelector:   aws.String(constant.AppName),
+			DomainSigningSelector:   aws.String(domain.DKIMSelector),
 		},
 		ConfigurationSetName: aws.String(domain.Id.String()),
 	})
@@ -128,30 +251,239 @@ func (s *sesService) CreateEmailIdentity(ctx context.Context, domain *model.Doma
 		s.logger.Error().Err(err).Msg("failed to create email identity")
 		return err
 	}
+	err = s.PutMailFromAttributes(ctx, domain)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to create mail from domain")
+		return err
+	}
+	return nil
+}
+
+// PutMailFromAttributes makes SES send the emails of the domain from its
+// custom MAIL FROM domain, which aligns SPF with the From domain for DMARC
+func (s *sesService) PutMailFromAttributes(ctx context.Context, domain *model.Domain) error {
+	svc, err := s.workspaceSESClient(ctx, domain.WorkspaceId, domain.Region)
+	if err != nil {
+		return err
+	}
 	_, err = svc.PutEmailIdentityMailFromAttributes(ctx, &sesv2.PutEmailIdentityMailFromAttributesInput{
-		EmailIdentity:  aws.String(domain.Name),
-		MailFromDomain: aws.String(formatSubdomain([]string{constant.CustomDomainPrefix, domain.Name})),
+		EmailIdentity:       aws.String(domain.Name),
+		MailFromDomain:      aws.String(domain.MailFromDomain),
+		BehaviorOnMxFailure: types.BehaviorOnMxFailure(domain.MailFromBehaviorOnMXFailure),
 	})
+
+	return err
+}
+
+// PutDKIMSigningAttributes makes SES sign the emails of the domain with the
+// key, the record of the selector must be published
+func (s *sesService) PutDKIMSigningAttributes(ctx context.Context, domain *model.Domain, selector string, privateKey string) error {
+	svc, err := s.workspaceSESClient(ctx, domain.WorkspaceId, domain.Region)
+	if err != nil {
+		return err
+	}
+	_, err = svc.PutEmailIdentityDkimSigningAttributes(ctx, &sesv2.PutEmailIdentityDkimSigningAttributesInput{
+		EmailIdentity:           aws.String(domain.Name),
+		SigningAttributesOrigin: types.DkimSigningAttributesOriginExternal,
+		SigningAttributes: &types.DkimSigningAttributes{
+			DomainSigningPrivateKey: aws.String(privateKey),
+			DomainSigningSelector:   aws.String(selector),
+		},
+	})
+
+	return err
+}
+
+func (s *sesService) GetEmailIdentity(ctx context.Context, domain *model.Domain) (*sesv2.GetEmailIdentityOutput, error) {
+	svc, err := s.workspaceSESClient(ctx, domain.WorkspaceId, domain.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.GetEmailIdentity(ctx, &sesv2.GetEmailIdentityInput{
+		EmailIdentity: aws.String(domain.Name),
+	})
+}
+
+// CreateSenderIdentity creates the email address identity of a mailbox
+// sender, SES sends a verification email to the address. Emails of the sender
+// use a configuration set named after it
+func (s *sesService) CreateSenderIdentity(ctx context.Context, sender *model.Sender) error {
+	svc, err := s.workspaceSESClient(ctx, sender.WorkspaceId, sender.Region)
+	if err != nil {
+		return err
+	}
+	err = s.createConfigurationSet(ctx, sender.WorkspaceId, sender.Region, sender.Id.String())
 	if err != nil {
-		s.logger.Error().Err(err).Msg("failed to create mail from domain")
 		return err
 	}
+	_, err = svc.CreateEmailIdentity(ctx, &sesv2.CreateEmailIdentityInput{
+		EmailIdentity:        aws.String(sender.Address),
+		ConfigurationSetName: aws.String(sender.Id.String()),
+	})
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to create email address identity")
+		return err
+	}
+
 	return nil
 }
 
-func (s *sesService) createConfigurationSet(domain *model.Domain) error {
-	svc, ok := s.svcs[domain.Region]
-	if !ok {
-		return fmt.Errorf("SES service not available for region %s", domain.Region)
+func (s *sesService) GetSenderIdentity(ctx context.Context, sender *model.Sender) (*sesv2.GetEmailIdentityOutput, error) {
+	svc, err := s.workspaceSESClient(ctx, sender.WorkspaceId, sender.Region)
+	if err != nil {
+		return nil, err
 	}
-	_, err := svc.CreateConfigurationSet(context.Background(), &sesv2.CreateConfigurationSetInput{
-		ConfigurationSetName: aws.String(domain.Id.String()),
+
+	return svc.GetEmailIdentity(ctx, &sesv2.GetEmailIdentityInput{
+		EmailIdentity: aws.String(sender.Address),
+	})
+}
+
+func (s *sesService) DeleteSenderIdentity(ctx context.Context, sender *model.Sender) error {
+	svc, err := s.workspaceSESClient(ctx, sender.WorkspaceId, sender.Region)
+	if err != nil {
+		return err
+	}
+	_, err = svc.DeleteEmailIdentity(ctx, &sesv2.DeleteEmailIdentityInput{
+		EmailIdentity: aws.String(sender.Address),
+	})
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to delete email address identity")
+		return err
+	}
+	err = s.deleteConfigurationSetEventDestination(ctx, sender.WorkspaceId, sender.Region, sender.Id.String())
+	if err != nil {
+		return err
+	}
+
+	return s.deleteConfigurationSet(ctx, sender.WorkspaceId, sender.Region, sender.Id.String())
+}
+
+func (s *sesService) CreateDedicatedIpPool(ctx context.Context, pool *model.IPPool) error {
+	svc, err := s.workspaceSESClient(ctx, pool.WorkspaceId, pool.Region)
+	if err != nil {
+		return err
+	}
+	_, err = svc.CreateDedicatedIpPool(ctx, &sesv2.CreateDedicatedIpPoolInput{
+		PoolName:    aws.String(pool.Id.String()),
+		ScalingMode: types.ScalingMode(pool.ScalingMode),
+	})
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to create dedicated IP pool")
+		return err
+	}
+
+	return nil
+}
+
+func (s *sesService) DeleteDedicatedIpPool(ctx context.Context, pool *model.IPPool) error {
+	svc, err := s.workspaceSESClient(ctx, pool.WorkspaceId, pool.Region)
+	if err != nil {
+		return err
+	}
+	_, err = svc.DeleteDedicatedIpPool(ctx, &sesv2.DeleteDedicatedIpPoolInput{
+		PoolName: aws.String(pool.Id.String()),
+	})
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to delete dedicated IP pool")
+		return err
+	}
+
+	return nil
+}
+
+// GetDedicatedIps returns the IPs of the pool with their warm-up status
+func (s *sesService) GetDedicatedIps(ctx context.Context, pool *model.IPPool) ([]types.DedicatedIp, error) {
+	svc, err := s.workspaceSESClient(ctx, pool.WorkspaceId, pool.Region)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]types.DedicatedIp, 0)
+	input := &sesv2.GetDedicatedIpsInput{
+		PoolName: aws.String(pool.Id.String()),
+	}
+	for {
+		resp, err := svc.GetDedicatedIps(ctx, input)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("failed to get dedicated IPs")
+			return nil, err
+		}
+		ips = append(ips, resp.DedicatedIps...)
+		if aws.ToString(resp.NextToken) == "" {
+			return ips, nil
+		}
+		input.NextToken = resp.NextToken
+	}
+}
+
+// PutConfigurationSetIPPool sends the emails of the configuration set from the
+// pool, a nil pool sends them from the shared IPs of SES. The configuration
+// set is created when it doesn't exist
+func (s *sesService) PutConfigurationSetIPPool(
+	ctx context.Context,
+	workspaceId uid.UID,
+	region constant.AwsRegion,
+	name string,
+	pool *model.IPPool,
+) error {
+	svc, err := s.workspaceSESClient(ctx, workspaceId, region)
+	if err != nil {
+		return err
+	}
+	_, err = svc.GetConfigurationSet(ctx, &sesv2.GetConfigurationSetInput{
+		ConfigurationSetName: aws.String(name),
+	})
+	var notFound *types.NotFoundException
+	if errors.As(err, &notFound) {
+		err = s.createConfigurationSet(ctx, workspaceId, region, name)
+	}
+	if err != nil {
+		return err
+	}
+	input := &sesv2.PutConfigurationSetDeliveryOptionsInput{
+		ConfigurationSetName: aws.String(name),
+	}
+	if pool != nil {
+		input.SendingPoolName = aws.String(pool.Id.String())
+	}
+	_, err = svc.PutConfigurationSetDeliveryOptions(ctx, input)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to put configuration set delivery options")
+		return err
+	}
+
+	return nil
+}
+
+// DeleteConfigurationSet deletes the configuration set with its event
+// destination, a configuration set which doesn't exist is ignored
+func (s *sesService) DeleteConfigurationSet(ctx context.Context, workspaceId uid.UID, region constant.AwsRegion, name string) error {
+	err := s.deleteConfigurationSetEventDestination(ctx, workspaceId, region, name)
+	var notFound *types.NotFoundException
+	if errors.As(err, &notFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.deleteConfigurationSet(ctx, workspaceId, region, name)
+}
+
+func (s *sesService) createConfigurationSet(ctx context.Context, workspaceId uid.UID, region constant.AwsRegion, name string) error {
+	svc, err := s.workspaceSESClient(ctx, workspaceId, region)
+	if err != nil {
+		return err
+	}
+	_, err = svc.CreateConfigurationSet(ctx, &sesv2.CreateConfigurationSetInput{
+		ConfigurationSetName: aws.String(name),
 	})
 	if err != nil {
 		s.logger.Error().Err(err).Msg("failed to create configuration set")
 		return err
 	}
-	err = s.createConfigurationSetEventDestination(domain)
+	err = s.createConfigurationSetEventDestination(ctx, workspaceId, region, name)
 	if err != nil {
 		return err
 	}
@@ -159,17 +491,17 @@ func (s *sesService) createConfigurationSet(domain *model.Domain) error {
 	return nil
 }
 
-func (s *sesService) createConfigurationSetEventDestination(domain *model.Domain) error {
-	svc, ok := s.svcs[domain.Region]
-	if !ok {
-		return fmt.Errorf("SES service not available for region %s", domain.Region)
+func (s *sesService) createConfigurationSetEventDestination(ctx context.Context, workspaceId uid.UID, region constant.AwsRegion, name string) error {
+	svc, err := s.workspaceSESClient(ctx, workspaceId, region)
+	if err != nil {
+		return err
 	}
-	topic, ok := s.snsService.Topics()[domain.Region]
-	if !ok {
-		return fmt.Errorf("SNS topic not available for region %s", domain.Region)
+	topic, err := s.snsService.Topic(ctx, workspaceId, region)
+	if err != nil {
+		return err
 	}
-	_, err := svc.CreateConfigurationSetEventDestination(context.Background(), &sesv2.CreateConfigurationSetEventDestinationInput{
-		ConfigurationSetName: aws.String(domain.Id.String()),
+	_, err = svc.CreateConfigurationSetEventDestination(ctx, &sesv2.CreateConfigurationSetEventDestinationInput{
+		ConfigurationSetName: aws.String(name),
 		EventDestination: &types.EventDestinationDefinition{
 			SnsDestination: &types.SnsDestination{
 				TopicArn: aws.String(topic.Arn),
@@ -197,11 +529,11 @@ func (s *sesService) createConfigurationSetEventDestination(domain *model.Domain
 }
 
 func (s *sesService) DeleteEmailIdentity(ctx context.Context, domain *model.Domain) error {
-	svc, ok := s.svcs[domain.Region]
-	if !ok {
-		return fmt.Errorf("SES service not available for region %s", domain.Region)
+	svc, err := s.workspaceSESClient(ctx, domain.WorkspaceId, domain.Region)
+	if err != nil {
+		return err
 	}
-	_, err := svc.DeleteEmailIdentity(ctx, &sesv2.DeleteEmailIdentityInput{
+	_, err = svc.DeleteEmailIdentity(ctx, &sesv2.DeleteEmailIdentityInput{
 		EmailIdentity: aws.String(domain.Name),
 	})
 	if err != nil {
@@ -209,25 +541,25 @@ func (s *sesService) DeleteEmailIdentity(ctx context.Context, domain *model.Doma
 		return err
 	}
 	// Delete the configuration set event destination
-	err = s.deleteConfigurationSetEventDestination(domain)
+	err = s.deleteConfigurationSetEventDestination(ctx, domain.WorkspaceId, domain.Region, domain.Id.String())
 	if err != nil {
 		return err
 	}
 	// Delete the configuration set
-	err = s.deleteConfigurationSet(domain)
+	err = s.deleteConfigurationSet(ctx, domain.WorkspaceId, domain.Region, domain.Id.String())
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *sesService) deleteConfigurationSetEventDestination(domain *model.Domain) error {
-	svc, ok := s.svcs[domain.Region]
-	if !ok {
-		return fmt.Errorf("SES service not available for region %s", domain.Region)
+func (s *sesService) deleteConfigurationSetEventDestination(ctx context.Context, workspaceId uid.UID, region constant.AwsRegion, name string) error {
+	svc, err := s.workspaceSESClient(ctx, workspaceId, region)
+	if err != nil {
+		return err
 	}
-	_, err := svc.DeleteConfigurationSetEventDestination(context.Background(), &sesv2.DeleteConfigurationSetEventDestinationInput{
-		ConfigurationSetName: aws.String(domain.Id.String()),
+	_, err = svc.DeleteConfigurationSetEventDestination(ctx, &sesv2.DeleteConfigurationSetEventDestinationInput{
+		ConfigurationSetName: aws.String(name),
 		EventDestinationName: aws.String(constant.AppName),
 	})
 	if err != nil {
@@ -238,13 +570,13 @@ func (s *sesService) deleteConfigurationSetEventDestination(domain *model.Domain
 	return nil
 }
 
-func (s *sesService) deleteConfigurationSet(domain *model.Domain) error {
-	svc, ok := s.svcs[domain.Region]
-	if !ok {
-		return fmt.Errorf("SES service not available for region %s", domain.Region)
+func (s *sesService) deleteConfigurationSet(ctx context.Context, workspaceId uid.UID, region constant.AwsRegion, name string) error {
+	svc, err := s.workspaceSESClient(ctx, workspaceId, region)
+	if err != nil {
+		return err
 	}
-	_, err := svc.DeleteConfigurationSet(context.Background(), &sesv2.DeleteConfigurationSetInput{
-		ConfigurationSetName: aws.String(domain.Id.String()),
+	_, err = svc.DeleteConfigurationSet(ctx, &sesv2.DeleteConfigurationSetInput{
+		ConfigurationSetName: aws.String(name),
 	})
 	if err != nil {
 		s.logger.Error().Err(err).Msg("failed to delete configuration set")
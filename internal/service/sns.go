@@ -8,19 +8,21 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"github.com/usesend0/send0/internal/constant"
 	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
 )
 
 type snsNotificationPayload struct {
@@ -46,7 +48,9 @@ type sesNotificationMessage struct {
 	Delivery      *deliveryPayload      `json:"delivery"`
 	Reject        *rejectPayload        `json:"reject"`
 	Open          *openPayload          `json:"open"`
+	Click         *clickPayload         `json:"click"`
 	DeliveryDelay *deliveryDelayPayload `json:"deliveryDelay"`
+	Subscription  *subscriptionPayload  `json:"subscription"`
 }
 
 type mailPayload struct {
@@ -59,32 +63,36 @@ type mailPayload struct {
 		From []string `json:"from"`
 		To   []string `json:"to"`
 	} `json:"commonHeaders"`
+	Tags map[string][]string `json:"tags"` // Includes ses:configuration-set and ses:from-domain
 }
 
 type bouncePayload struct {
 	BounceType        string `json:"bounceType"`
+	BounceSubType     string `json:"bounceSubType"`
 	BouncedRecipients []struct {
-		EmailAddress string `json:"emailAddress"`
-		Status       string `json:"status"`
-		Action       string `json:"action"`
+		EmailAddress   string `json:"emailAddress"`
+		Status         string `json:"status"`
+		Action         string `json:"action"`
+		DiagnosticCode string `json:"diagnosticCode"`
 	} `json:"bouncedRecipients"`
 	Timestamp string `json:"timestamp"`
 }
 
 type complaintPayload struct {
 	ComplaintFeedbackType string `json:"complaintFeedbackType"`
+	ComplaintSubType      string `json:"complaintSubType"`
 	ComplainedRecipients  []struct {
 		EmailAddress string `json:"emailAddress"`
 	} `json:"complainedRecipients"`
+	UserAgent string `json:"userAgent"`
 	Timestamp string `json:"timestamp"`
 }
 
 type deliveryPayload struct {
-	ProcessingTimeMillis int `json:"processingTimeMillis"`
-	Recipients           []struct {
-		EmailAddress string `json:"emailAddress"`
-	} `json:"recipients"`
-	Timestamp string `json:"timestamp"`
+	ProcessingTimeMillis int      `json:"processingTimeMillis"`
+	Recipients           []string `json:"recipients"`
+	SmtpResponse         string   `json:"smtpResponse"`
+	Timestamp            string   `json:"timestamp"`
 }
 
 type rejectPayload struct {
@@ -97,52 +105,83 @@ type openPayload struct {
 	UserAgent string `json:"userAgent"`
 }
 
+type clickPayload struct {
+	Timestamp string              `json:"timestamp"`
+	IpAddress string              `json:"ipAddress"`
+	UserAgent string              `json:"userAgent"`
+	Link      string              `json:"link"`
+	LinkTags  map[string][]string `json:"linkTags"`
+}
+
 type deliveryDelayPayload struct {
 	DelayType         string `json:"delayType"`
 	ExpirationTime    string `json:"expirationTime"`
 	DelayedRecipients []struct {
-		EmailAddress string `json:"emailAddress"`
-		Status       string `json:"status"`
+		EmailAddress   string `json:"emailAddress"`
+		Status         string `json:"status"`
+		DiagnosticCode string `json:"diagnosticCode"`
 	} `json:"delayedRecipients"`
 	Timestamp string `json:"timestamp"`
 }
 
+type subscriptionPayload struct {
+	ContactList string `json:"contactList"`
+	Source      string `json:"source"`
+	Timestamp   string `json:"timestamp"`
+}
+
+const (
+	snsCertificateCacheTTL = 24 * time.Hour
+	maxSNSCertificateSize  = 64 * 1024
+)
+
+var (
+	ErrSNSUnknownTopic   = errors.New("unknown SNS topic")
+	ErrSNSMessageExpired = errors.New("SNS message timestamp is too old")
+	ErrSNSCertificateURL = errors.New("invalid SNS signing certificate URL")
+)
+
+type signingCertificate struct {
+	certificate *x509.Certificate
+	expiresAt   time.Time
+}
+
 type snsService struct {
 	*baseService
 	mu                  sync.RWMutex
 	eventService        EventSevice
-	svcs                map[constant.AwsRegion]*sns.Client
 	snsTopicArns        map[constant.AwsRegion]*model.SNSTopic
-	signingCertificates map[string]*x509.Certificate
+	topics              map[string]*model.SNSTopic // Known topics by ARN, including the topics of workspace AWS accounts
+	queueUrls           map[constant.AwsRegion]string
+	signingCertificates map[string]*signingCertificate
 }
 
 type SNSService interface {
 	Topics() map[constant.AwsRegion]*model.SNSTopic
+	Topic(ctx context.Context, workspaceId uid.UID, region constant.AwsRegion) (*model.SNSTopic, error)
 	SetupTopics(ctx context.Context) error
+	SetupAccountTopics(ctx context.Context, account *model.AWSAccount) error
+	DeleteAccountTopics(ctx context.Context, account *model.AWSAccount) error
 	Subscribe(ctx context.Context, region constant.AwsRegion, topicArn string) error
 	ConfirmSubscribe(payload []byte) error
 	ConfirmUnsubscribe(payload []byte) error
 	ProcessNotification(payload []byte) error
+	StartConsumers(ctx context.Context)
 }
 
 func NewSNSService(baseService *baseService, eventService EventSevice) (SNSService, error) {
-	svcs := make(map[constant.AwsRegion]*sns.Client)
-	for _, region := range constant.SupportedSESRegions {
-		svcs[region] = sns.New(sns.Options{
-			Region: string(region),
-			Credentials: aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(
-				baseService.config.SES.AccessKeyId,
-				baseService.config.SES.SecretAccessKey,
-				"",
-			)),
-		})
+	err := checkSESRegions(baseService.config.SES.Regions)
+	if err != nil {
+		return nil, err
 	}
+
 	return &snsService{
 		baseService:         baseService,
 		eventService:        eventService,
-		svcs:                svcs,
 		snsTopicArns:        make(map[constant.AwsRegion]*model.SNSTopic),
-		signingCertificates: make(map[string]*x509.Certificate),
+		topics:              make(map[string]*model.SNSTopic),
+		queueUrls:           make(map[constant.AwsRegion]string),
+		signingCertificates: make(map[string]*signingCertificate),
 	}, nil
 }
 
@@ -159,9 +198,9 @@ func (s *snsService) SetupTopics(ctx context.Context) error {
 		return err
 	}
 	snsTopicArns := make(map[constant.AwsRegion]*model.SNSTopic)
-	for region, svc := range s.svcs {
+	for _, region := range s.config.SES.Regions {
 		topicIdx := slices.IndexFunc(topics, func(topic *model.SNSTopic) bool {
-			return topic.Region == region
+			return topic.Region == region && topic.WorkspaceId == nil
 		})
 		if topicIdx >= 0 {
 			s.logger.Info().Str("region", string(region)).Msg("Found topic")
@@ -169,7 +208,7 @@ func (s *snsService) SetupTopics(ctx context.Context) error {
 			continue
 		}
 		s.logger.Info().Str("region", string(region)).Msg("Creating new topic")
-		resp, err := svc.CreateTopic(ctx, &sns.CreateTopicInput{
+		resp, err := s.snsClient(nil, region).CreateTopic(ctx, &sns.CreateTopicInput{
 			Name: aws.String("ses" + "-" + constant.AppName),
 			Attributes: map[string]string{
 				"FifoTopic": "false",
@@ -191,9 +230,23 @@ func (s *snsService) SetupTopics(ctx context.Context) error {
 	}
 	s.mu.Lock()
 	s.snsTopicArns = snsTopicArns
+	for _, topic := range topics {
+		s.topics[topic.Arn] = topic
+	}
+	for _, topic := range snsTopicArns {
+		s.topics[topic.Arn] = topic
+	}
 	s.mu.Unlock()
-	// subscribe to topics
+	// subscribe to topics, the queues are subscribed on every start so the
+	// consumers know their queue
 	for region, topic := range snsTopicArns {
+		if s.config.SNS.Delivery == constant.AwsSNSDeliverySQS {
+			err = s.subscribeQueue(ctx, region, topic)
+			if err != nil {
+				return err
+			}
+			continue
+		}
 		if topic.Status == constant.AwsSNSTopicStatusPending {
 			err = s.Subscribe(ctx, region, topic.Arn)
 			if err != nil {
@@ -206,9 +259,139 @@ func (s *snsService) SetupTopics(ctx context.Context) error {
 	return nil
 }
 
+// Topic returns the topic SES publishes the events of the workspace to in the
+// region, the topic of its AWS account when it has one
+func (s *snsService) Topic(ctx context.Context, workspaceId uid.UID, region constant.AwsRegion) (*model.SNSTopic, error) {
+	account, err := s.awsAccount(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		s.mu.RLock()
+		topic, ok := s.snsTopicArns[region]
+		s.mu.RUnlock()
+		if ok {
+			return topic, nil
+		}
+	}
+	isTopic := func(topic *model.SNSTopic) bool {
+		if topic.Region != region {
+			return false
+		}
+		return (account == nil && topic.WorkspaceId == nil) ||
+			(account != nil && topic.WorkspaceId != nil && *topic.WorkspaceId == workspaceId)
+	}
+	s.mu.RLock()
+	for _, topic := range s.topics {
+		if isTopic(topic) {
+			s.mu.RUnlock()
+			return topic, nil
+		}
+	}
+	s.mu.RUnlock()
+	// the topics may not be loaded by this instance
+	topics, err := s.repository.SNSTopic.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, topic := range topics {
+		if isTopic(topic) {
+			s.cacheTopic(topic)
+			return topic, nil
+		}
+	}
+
+	return nil, fmt.Errorf("SNS topic not available for region %s", region)
+}
+
+// SetupAccountTopics creates the topics of every region in the AWS account of
+// a workspace and subscribes them like the topics of the operator account
+func (s *snsService) SetupAccountTopics(ctx context.Context, account *model.AWSAccount) error {
+	topics, err := s.repository.SNSTopic.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	for _, region := range s.config.SES.Regions {
+		topicIdx := slices.IndexFunc(topics, func(topic *model.SNSTopic) bool {
+			return topic.Region == region && topic.WorkspaceId != nil && *topic.WorkspaceId == account.WorkspaceId
+		})
+		var topic *model.SNSTopic
+		if topicIdx >= 0 {
+			topic = topics[topicIdx]
+		} else {
+			resp, err := s.snsClient(account, region).CreateTopic(ctx, &sns.CreateTopicInput{
+				Name: aws.String("ses" + "-" + constant.AppName),
+				Attributes: map[string]string{
+					"FifoTopic": "false",
+				},
+			})
+			if err != nil {
+				return err
+			}
+			topic = &model.SNSTopic{
+				Region:      region,
+				Arn:         *resp.TopicArn,
+				Status:      constant.AwsSNSTopicStatusPending,
+				WorkspaceId: &account.WorkspaceId,
+			}
+			err = s.repository.SNSTopic.Save(ctx, topic)
+			if err != nil {
+				return err
+			}
+			s.cacheTopic(topic)
+		}
+		if topic.Status == constant.AwsSNSTopicStatusActive {
+			continue
+		}
+		if s.config.SNS.Delivery == constant.AwsSNSDeliverySQS {
+			err = s.subscribeAccountQueue(ctx, account, topic)
+		} else {
+			_, err = s.snsClient(account, region).Subscribe(ctx, &sns.SubscribeInput{
+				Protocol: aws.String("https"),
+				TopicArn: aws.String(topic.Arn),
+				Endpoint: aws.String(s.config.SNS.EndPoint),
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteAccountTopics deletes the topics of the AWS account of a workspace, a
+// topic which can't be deleted in the account is only forgotten
+func (s *snsService) DeleteAccountTopics(ctx context.Context, account *model.AWSAccount) error {
+	topics, err := s.repository.SNSTopic.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	for _, topic := range topics {
+		if topic.WorkspaceId == nil || *topic.WorkspaceId != account.WorkspaceId {
+			continue
+		}
+		_, err = s.snsClient(account, topic.Region).DeleteTopic(ctx, &sns.DeleteTopicInput{
+			TopicArn: aws.String(topic.Arn),
+		})
+		if err != nil {
+			s.logger.Error().Err(err).Str("topicArn", topic.Arn).Msg("failed to delete SNS topic")
+		}
+		err = s.repository.SNSTopic.Delete(ctx, topic.Arn)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		delete(s.topics, topic.Arn)
+		s.mu.Unlock()
+	}
+
+	return nil
+}
+
 func (s *snsService) Subscribe(ctx context.Context, region constant.AwsRegion, topicArn string) error {
 	s.logger.Info().Str("region", string(region)).Msg("Subscribing to topic")
-	_, err := s.svcs[region].Subscribe(ctx, &sns.SubscribeInput{
+	_, err := s.snsClient(nil, region).Subscribe(ctx, &sns.SubscribeInput{
 		Protocol: aws.String("https"),
 		TopicArn: aws.String(topicArn),
 		Endpoint: aws.String(s.config.SNS.EndPoint),
@@ -222,16 +405,17 @@ func (s *snsService) Subscribe(ctx context.Context, region constant.AwsRegion, t
 }
 
 func (s *snsService) ConfirmSubscribe(payload []byte) error {
+	return s.confirmSubscribe(payload, true)
+}
+
+func (s *snsService) confirmSubscribe(payload []byte, checkTimestamp bool) error {
 	s.logger.Info().Msg("Confirming subscription")
-	region, snsNotification, err := s.parsePayload(payload)
-	if err != nil {
-		return err
-	}
-	err = s.verifySignature(*snsNotification)
+	topic, snsNotification, err := s.verifyPayload(payload, checkTimestamp)
 	if err != nil {
-		s.logger.Error().Err(err).Msg("Error verifying signature")
+		s.logger.Error().Err(err).Msg("Error verifying payload")
 		return err
 	}
+	region := &topic.Region
 	s.logger.Info().Str("region", string(*region)).Msg("Starting subscription confirmation")
 	resp, err := http.Get(*snsNotification.SubscribeURL)
 	if err != nil {
@@ -242,13 +426,17 @@ func (s *snsService) ConfirmSubscribe(payload []byte) error {
 		return errors.New("non 200 response on subscription URL")
 	}
 	s.logger.Info().Str("region", string(*region)).Msg("Subscription confirmed, updating status")
-	err = s.repository.SNSTopic.UpdateStatus(context.Background(), *region, constant.AwsSNSTopicStatusActive)
+	err = s.repository.SNSTopic.UpdateStatus(context.Background(), snsNotification.TopicArn, constant.AwsSNSTopicStatusActive)
 	if err != nil {
 		s.logger.Error().Err(err).Msg("Error updating topic status")
 		return err
 	}
+	// the topics of workspace AWS accounts aren't in the region map
 	s.mu.Lock()
-	s.snsTopicArns[*region].Status = constant.AwsSNSTopicStatusActive
+	topic.Status = constant.AwsSNSTopicStatusActive
+	if regionTopic, ok := s.snsTopicArns[*region]; ok && regionTopic.Arn == snsNotification.TopicArn {
+		regionTopic.Status = constant.AwsSNSTopicStatusActive
+	}
 	s.mu.Unlock()
 	s.logger.Info().Str("region", string(*region)).Msg("Topic added to map")
 
@@ -256,11 +444,7 @@ func (s *snsService) ConfirmSubscribe(payload []byte) error {
 }
 
 func (s *snsService) ConfirmUnsubscribe(payload []byte) error {
-	region, snsNotification, err := s.parsePayload(payload)
-	if err != nil {
-		return err
-	}
-	err = s.verifySignature(*snsNotification)
+	topic, snsNotification, err := s.verifyPayload(payload, true)
 	if err != nil {
 		return err
 	}
@@ -272,24 +456,29 @@ func (s *snsService) ConfirmUnsubscribe(payload []byte) error {
 	if resp.StatusCode != http.StatusOK {
 		return errors.New("non 200 response on unsubscription URL")
 	}
-	err = s.repository.SNSTopic.UpdateStatus(context.Background(), *region, constant.AwsSNSTopicStatusInactive)
+	err = s.repository.SNSTopic.UpdateStatus(context.Background(), snsNotification.TopicArn, constant.AwsSNSTopicStatusInactive)
 	if err != nil {
 		s.logger.Error().Err(err).Msg("Error updating topic status")
 		return err
 	}
 	s.mu.Lock()
-	delete(s.snsTopicArns, *region)
+	topic.Status = constant.AwsSNSTopicStatusInactive
+	if regionTopic, ok := s.snsTopicArns[topic.Region]; ok && regionTopic.Arn == snsNotification.TopicArn {
+		delete(s.snsTopicArns, topic.Region)
+	}
 	s.mu.Unlock()
 
 	return nil
 }
 
 func (s *snsService) ProcessNotification(payload []byte) error {
-	_, snsNotification, err := s.parsePayload(payload)
-	if err != nil {
-		return err
-	}
-	err = s.verifySignature(*snsNotification)
+	return s.processNotification(payload, true)
+}
+
+// processNotification creates the event of the notification, the timestamp
+// isn't checked for notifications read from a queue as they may wait there
+func (s *snsService) processNotification(payload []byte, checkTimestamp bool) error {
+	topic, snsNotification, err := s.verifyPayload(payload, checkTimestamp)
 	if err != nil {
 		return err
 	}
@@ -304,7 +493,16 @@ func (s *snsService) ProcessNotification(payload []byte) error {
 		s.logger.Error().Err(err)
 		return err
 	}
-	err = s.eventService.CreateSESEvent(context.Background(), message)
+	err = s.eventService.CreateSESEvent(context.Background(), snsNotification.MessageId, topic.WorkspaceId, message)
+	if errors.Is(err, model.ErrEventExists) {
+		s.logger.Info().Str("messageId", snsNotification.MessageId).Msg("Duplicate notification")
+		return nil
+	}
+	// retrying wouldn't change the owner of the email
+	if errors.Is(err, ErrSESEventWorkspace) {
+		s.logger.Warn().Str("topicArn", topic.Arn).Str("messageId", message.Mail.MessageId).Msg("Notification of another workspace")
+		return nil
+	}
 	if err != nil {
 		s.logger.Error().Err(err).Msg("Error creating event")
 		return err
@@ -330,9 +528,78 @@ func (s *snsService) parsePayload(payload []byte) (*constant.AwsRegion, *snsNoti
 	return &region, &snsNotification, nil
 }
 
-func (s *snsService) verifySignature(n snsNotificationPayload) error {
+// verifyPayload parses the payload and checks that it comes from one of our
+// topics, that it is recent and that its signature is valid
+func (s *snsService) verifyPayload(payload []byte, checkTimestamp bool) (*model.SNSTopic, *snsNotificationPayload, error) {
+	region, snsNotification, err := s.parsePayload(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	topic, err := s.verifyTopic(*region, snsNotification.TopicArn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if checkTimestamp {
+		timestamp, err := time.Parse(time.RFC3339, snsNotification.Timestamp)
+		if err != nil {
+			return nil, nil, err
+		}
+		maxAge := time.Duration(s.config.SNS.MaxMessageAgeInSeconds) * time.Second
+		if age := time.Since(timestamp); age > maxAge || age < -maxAge {
+			return nil, nil, ErrSNSMessageExpired
+		}
+	}
+	err = s.verifySignature(*region, *snsNotification)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return topic, snsNotification, nil
+}
+
+// verifyTopic returns the topic of the SNSTopic row of the ARN, other topics
+// return ErrSNSUnknownTopic
+func (s *snsService) verifyTopic(region constant.AwsRegion, topicArn string) (*model.SNSTopic, error) {
+	s.mu.RLock()
+	topic, ok := s.topics[topicArn]
+	s.mu.RUnlock()
+	if !ok {
+		// the topic may have been created by another instance
+		var err error
+		topic, err = s.repository.SNSTopic.FindByArn(context.Background(), topicArn)
+		if err != nil {
+			return nil, err
+		}
+		if topic == nil {
+			return nil, ErrSNSUnknownTopic
+		}
+		s.cacheTopic(topic)
+	}
+	if topic.Region != region {
+		return nil, ErrSNSUnknownTopic
+	}
+
+	return topic, nil
+}
+
+func (s *snsService) cacheTopic(topic *model.SNSTopic) {
+	s.mu.Lock()
+	s.topics[topic.Arn] = topic
+	s.mu.Unlock()
+}
+
+func (s *snsService) verifySignature(region constant.AwsRegion, n snsNotificationPayload) error {
 	s.logger.Info().Msg("Verifying signature")
-	cert, err := s.getSigningCertificate(n.SigingCertURL)
+	var algorithm x509.SignatureAlgorithm
+	switch n.SignatureVersion {
+	case "1":
+		algorithm = x509.SHA1WithRSA
+	case "2":
+		algorithm = x509.SHA256WithRSA
+	default:
+		return fmt.Errorf("unsupported signature version %s", n.SignatureVersion)
+	}
+	cert, err := s.getSigningCertificate(region, n.SigingCertURL)
 	if err != nil {
 		s.logger.Error().Err(err).Msg("Error getting signing certificate")
 		return err
@@ -343,7 +610,7 @@ func (s *snsService) verifySignature(n snsNotificationPayload) error {
 		return err
 	}
 	s.logger.Info().Msg("Signature decoded")
-	return cert.CheckSignature(x509.SHA1WithRSA, s.buildSignature(n), signatureBytes)
+	return cert.CheckSignature(algorithm, s.buildSignature(n), signatureBytes)
 }
 
 func (s *snsService) buildSignature(n snsNotificationPayload) []byte {
@@ -382,34 +649,40 @@ func (s *snsService) buildSignature(n snsNotificationPayload) []byte {
 	return b.Bytes()
 }
 
-func (s *snsService) getSigningCertificate(certificateUrl string) (*x509.Certificate, error) {
+// getSigningCertificate returns the certificate of the SNS endpoint of the
+// region, certificates are cached in memory and in Redis until they expire
+func (s *snsService) getSigningCertificate(region constant.AwsRegion, certificateUrl string) (*x509.Certificate, error) {
 	s.logger.Info().Str("certificateUrl", certificateUrl).Msg("Getting signing certificate")
 	parsedURL, err := url.Parse(certificateUrl)
 	if err != nil {
 		return nil, err
 	}
+	if !s.isSigningCertificateURL(region, parsedURL) {
+		return nil, ErrSNSCertificateURL
+	}
+	key := parsedURL.String()
+	now := time.Now()
 	s.mu.RLock()
-	existingCertificate, ok := s.signingCertificates[parsedURL.String()]
+	existingCertificate, ok := s.signingCertificates[key]
 	s.mu.RUnlock()
-	if ok {
+	if ok && now.Before(existingCertificate.expiresAt) {
 		s.logger.Info().Msg("Certificate found in cache")
-		return existingCertificate, nil
+		return existingCertificate.certificate, nil
 	}
-	s.logger.Info().Msg("Certificate not found in cache, fetching from URL")
-	resp, err := http.Get(certificateUrl)
+	ctx := context.Background()
+	pemBytes, err := s.repository.SNSTopic.FindSigningCertificate(ctx, key)
 	if err != nil {
-		return nil, err
+		s.logger.Error().Err(err).Msg("Error reading cached certificate")
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		s.logger.Error().Int("statusCode", resp.StatusCode).Msg("non 200 response on certificate URL")
-		return nil, err
-	}
-	bytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	cached := pemBytes != nil
+	if !cached {
+		s.logger.Info().Msg("Certificate not found in cache, fetching from URL")
+		pemBytes, err = s.fetchSigningCertificate(key)
+		if err != nil {
+			return nil, err
+		}
 	}
-	block, _ := pem.Decode(bytes)
+	block, _ := pem.Decode(pemBytes)
 	if block == nil {
 		s.logger.Error().Msg("Invalid PEM")
 		return nil, errors.New("invalid PEM")
@@ -419,10 +692,57 @@ func (s *snsService) getSigningCertificate(certificateUrl string) (*x509.Certifi
 		s.logger.Error().Err(err).Msg("Error parsing certificate")
 		return nil, err
 	}
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil, errors.New("signing certificate is not valid")
+	}
+	expiresAt := now.Add(snsCertificateCacheTTL)
+	if cert.NotAfter.Before(expiresAt) {
+		expiresAt = cert.NotAfter
+	}
+	if !cached {
+		err = s.repository.SNSTopic.SaveSigningCertificate(ctx, key, pemBytes, expiresAt.Sub(now))
+		if err != nil {
+			s.logger.Error().Err(err).Msg("Error caching certificate")
+		}
+	}
 	s.mu.Lock()
-	s.signingCertificates[parsedURL.String()] = cert
+	s.signingCertificates[key] = &signingCertificate{
+		certificate: cert,
+		expiresAt:   expiresAt,
+	}
 	s.mu.Unlock()
 	s.logger.Info().Msg("Certificate added to cache")
 
 	return cert, nil
 }
+
+// isSigningCertificateURL tells if the certificate is served by SNS in the
+// region, in development the overridden SNS endpoint serves them too
+func (s *snsService) isSigningCertificateURL(region constant.AwsRegion, certificateUrl *url.URL) bool {
+	if !strings.HasSuffix(certificateUrl.Path, ".pem") {
+		return false
+	}
+	if certificateUrl.Scheme == "https" && certificateUrl.Host == fmt.Sprintf("sns.%s.amazonaws.com", region) {
+		return true
+	}
+	if s.config.Env != constant.EnvDevelopment || s.config.SNS.SNSEndPoint == "" {
+		return false
+	}
+	endpoint, err := url.Parse(s.config.SNS.SNSEndPoint)
+
+	return err == nil && certificateUrl.Scheme == endpoint.Scheme && certificateUrl.Host == endpoint.Host
+}
+
+func (s *snsService) fetchSigningCertificate(certificateUrl string) ([]byte, error) {
+	resp, err := http.Get(certificateUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		s.logger.Error().Int("statusCode", resp.StatusCode).Msg("non 200 response on certificate URL")
+		return nil, errors.New("non 200 response on certificate URL")
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxSNSCertificateSize))
+}
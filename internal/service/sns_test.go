@@ -0,0 +1,281 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+)
+
+type fakeSNSTopicRepository struct {
+	model.SNSTopicRepository
+	topics           []*model.SNSTopic
+	findCalls        int
+	certificates     map[string][]byte
+	certificateCalls int
+}
+
+func (r *fakeSNSTopicRepository) FindSigningCertificate(_ context.Context, url string) ([]byte, error) {
+	r.certificateCalls++
+
+	return r.certificates[url], nil
+}
+
+func (r *fakeSNSTopicRepository) FindByArn(_ context.Context, arn string) (*model.SNSTopic, error) {
+	r.findCalls++
+	for _, topic := range r.topics {
+		if topic.Arn == arn {
+			return topic, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func newTestSNSService(t *testing.T, repository *model.Repository) *snsService {
+	t.Helper()
+	service, err := NewSNSService(newTestBaseService(repository), NewEventService(newTestBaseService(repository)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return service.(*snsService)
+}
+
+func TestVerifyTopicCachesTopicsByArn(t *testing.T) {
+	workspaceId := uid.NewUID(1)
+	topicArn := "arn:aws:sns:us-east-1:123456789012:ses-send0"
+	topicRepository := &fakeSNSTopicRepository{
+		topics: []*model.SNSTopic{{Region: constant.AwsRegionNorthVirginia, Arn: topicArn, WorkspaceId: workspaceId}},
+	}
+	service := newTestSNSService(t, &model.Repository{SNSTopic: topicRepository})
+
+	for i := 0; i < 3; i++ {
+		topic, err := service.verifyTopic(constant.AwsRegionNorthVirginia, topicArn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if topic.WorkspaceId == nil || *topic.WorkspaceId != *workspaceId {
+			t.Fatalf("expected the topic of workspace %s, got %+v", workspaceId, topic)
+		}
+	}
+	if topicRepository.findCalls != 1 {
+		t.Fatalf("expected the topic to be read once, read %d times", topicRepository.findCalls)
+	}
+}
+
+func TestVerifyTopicRejectsUnknownTopics(t *testing.T) {
+	topicArn := "arn:aws:sns:us-east-1:123456789012:ses-send0"
+	service := newTestSNSService(t, &model.Repository{
+		SNSTopic: &fakeSNSTopicRepository{
+			topics: []*model.SNSTopic{{Region: constant.AwsRegionNorthVirginia, Arn: topicArn}},
+		},
+	})
+
+	_, err := service.verifyTopic(constant.AwsRegionNorthVirginia, "arn:aws:sns:us-east-1:210987654321:ses-send0")
+	if !errors.Is(err, ErrSNSUnknownTopic) {
+		t.Fatalf("expected ErrSNSUnknownTopic for another topic, got %v", err)
+	}
+	_, err = service.verifyTopic(constant.AwsRegionIreland, topicArn)
+	if !errors.Is(err, ErrSNSUnknownTopic) {
+		t.Fatalf("expected ErrSNSUnknownTopic for another region, got %v", err)
+	}
+}
+
+func TestIsSigningCertificateURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      constant.Env
+		endpoint string
+		url      string
+		want     bool
+	}{
+		{"sns", constant.EnvDevelopment, "", "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-1.pem", true},
+		{"other region", constant.EnvDevelopment, "", "https://sns.eu-west-1.amazonaws.com/SimpleNotificationService-1.pem", false},
+		{"http", constant.EnvDevelopment, "", "http://sns.us-east-1.amazonaws.com/SimpleNotificationService-1.pem", false},
+		{"not a certificate", constant.EnvDevelopment, "", "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-1", false},
+		{"other host", constant.EnvDevelopment, "", "https://example.com/SimpleNotificationService-1.pem", false},
+		{"endpoint in development", constant.EnvDevelopment, "http://localhost:4566", "http://localhost:4566/_aws/sns/SimpleNotificationService-1.pem", true},
+		{"other port in development", constant.EnvDevelopment, "http://localhost:4566", "http://localhost:8080/SimpleNotificationService-1.pem", false},
+		{"endpoint in production", constant.EnvProduction, "http://localhost:4566", "http://localhost:4566/_aws/sns/SimpleNotificationService-1.pem", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newTestSNSService(t, &model.Repository{})
+			service.config.Env = tt.env
+			service.config.SNS.SNSEndPoint = tt.endpoint
+			certificateUrl, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := service.isSigningCertificateURL(constant.AwsRegionNorthVirginia, certificateUrl); got != tt.want {
+				t.Fatalf("isSigningCertificateURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestSigningCertificate returns a self signed certificate in PEM and its
+// private key, standing in for the SNS signing certificate
+func newTestSigningCertificate(t *testing.T, notAfter time.Time) ([]byte, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), key
+}
+
+func signTestNotification(t *testing.T, service *snsService, key *rsa.PrivateKey, n *snsNotificationPayload) {
+	t.Helper()
+	hash := crypto.SHA1
+	if n.SignatureVersion == "2" {
+		hash = crypto.SHA256
+	}
+	h := hash.New()
+	h.Write(service.buildSignature(*n))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, hash, h.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Signature = base64.StdEncoding.EncodeToString(signature)
+}
+
+func TestVerifySignature(t *testing.T) {
+	certificateUrl := "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-1.pem"
+	certificate, key := newTestSigningCertificate(t, time.Now().Add(time.Hour))
+	expiredCertificate, expiredKey := newTestSigningCertificate(t, time.Now().Add(-time.Minute))
+	_, otherKey := newTestSigningCertificate(t, time.Now().Add(time.Hour))
+	subject := "Amazon SES Email Event Notification"
+	token := "token"
+	subscribeUrl := "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription"
+	notification := func(version string) *snsNotificationPayload {
+		return &snsNotificationPayload{
+			Type:             "Notification",
+			MessageId:        "1",
+			TopicArn:         "arn:aws:sns:us-east-1:123456789012:ses-send0",
+			Message:          `{"eventType":"Send"}`,
+			SignatureVersion: version,
+			Timestamp:        "2024-01-02T03:04:05.000Z",
+			SigingCertURL:    certificateUrl,
+			Subject:          &subject,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		certificate []byte
+		payload     *snsNotificationPayload
+		key         *rsa.PrivateKey
+		modify      func(n *snsNotificationPayload)
+		wantErr     bool
+	}{
+		{name: "version 1", certificate: certificate, payload: notification("1"), key: key},
+		{name: "version 2", certificate: certificate, payload: notification("2"), key: key},
+		{
+			name:        "subscription confirmation",
+			certificate: certificate,
+			payload: &snsNotificationPayload{
+				Type:             "SubscriptionConfirmation",
+				MessageId:        "1",
+				TopicArn:         "arn:aws:sns:us-east-1:123456789012:ses-send0",
+				Message:          "You have chosen to subscribe to the topic",
+				SignatureVersion: "2",
+				Timestamp:        "2024-01-02T03:04:05.000Z",
+				SigingCertURL:    certificateUrl,
+				Token:            &token,
+				SubscribeURL:     &subscribeUrl,
+			},
+			key: key,
+		},
+		{
+			name:        "tampered message",
+			certificate: certificate,
+			payload:     notification("2"),
+			key:         key,
+			modify:      func(n *snsNotificationPayload) { n.Message = `{"eventType":"Bounce"}` },
+			wantErr:     true,
+		},
+		{
+			name:        "version mismatch",
+			certificate: certificate,
+			payload:     notification("1"),
+			key:         key,
+			modify:      func(n *snsNotificationPayload) { n.SignatureVersion = "2" },
+			wantErr:     true,
+		},
+		{name: "other key", certificate: certificate, payload: notification("2"), key: otherKey, wantErr: true},
+		{name: "unsupported version", certificate: certificate, payload: notification("3"), key: key, wantErr: true},
+		{
+			name:        "untrusted certificate url",
+			certificate: certificate,
+			payload:     notification("2"),
+			key:         key,
+			modify: func(n *snsNotificationPayload) {
+				n.SigingCertURL = "https://example.com/SimpleNotificationService-1.pem"
+			},
+			wantErr: true,
+		},
+		{name: "expired certificate", certificate: expiredCertificate, payload: notification("2"), key: expiredKey, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newTestSNSService(t, &model.Repository{
+				SNSTopic: &fakeSNSTopicRepository{certificates: map[string][]byte{certificateUrl: tt.certificate}},
+			})
+			signTestNotification(t, service, tt.key, tt.payload)
+			if tt.modify != nil {
+				tt.modify(tt.payload)
+			}
+			err := service.verifySignature(constant.AwsRegionNorthVirginia, *tt.payload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifySignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetSigningCertificateCachesCertificates(t *testing.T) {
+	certificateUrl := "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-1.pem"
+	certificate, _ := newTestSigningCertificate(t, time.Now().Add(time.Hour))
+	topicRepository := &fakeSNSTopicRepository{certificates: map[string][]byte{certificateUrl: certificate}}
+	service := newTestSNSService(t, &model.Repository{SNSTopic: topicRepository})
+
+	for i := 0; i < 3; i++ {
+		_, err := service.getSigningCertificate(constant.AwsRegionNorthVirginia, certificateUrl)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if topicRepository.certificateCalls != 1 {
+		t.Fatalf("expected the certificate to be read once, read %d times", topicRepository.certificateCalls)
+	}
+	_, err := service.getSigningCertificate(constant.AwsRegionIreland, certificateUrl)
+	if !errors.Is(err, ErrSNSCertificateURL) {
+		t.Fatalf("expected ErrSNSCertificateURL for another region, got %v", err)
+	}
+}
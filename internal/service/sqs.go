@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+)
+
+const (
+	sqsMaxMessages        = 10
+	sqsMaxVisibilityDelay = 12 * time.Hour
+	sqsErrorDelay         = 5 * time.Second
+)
+
+// subscribeQueue creates the queue of the region and subscribes it to the
+// topic, SNS is allowed to send messages to the queue. Both calls are
+// idempotent
+func (s *snsService) subscribeQueue(ctx context.Context, region constant.AwsRegion, topic *model.SNSTopic) error {
+	s.logger.Info().Str("region", string(region)).Msg("Subscribing queue to topic")
+	queueUrl, queueArn, err := s.queue(ctx, region)
+	if err != nil {
+		return err
+	}
+	err = s.allowTopics(ctx, region, queueUrl, queueArn)
+	if err != nil {
+		return err
+	}
+	// the SNS envelope is kept so the signature can be verified
+	_, err = s.snsClient(nil, region).Subscribe(ctx, &sns.SubscribeInput{
+		Protocol: aws.String("sqs"),
+		TopicArn: aws.String(topic.Arn),
+		Endpoint: aws.String(queueArn),
+	})
+	if err != nil {
+		return err
+	}
+	if topic.Status != constant.AwsSNSTopicStatusActive {
+		err = s.repository.SNSTopic.UpdateStatus(ctx, topic.Arn, constant.AwsSNSTopicStatusActive)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		topic.Status = constant.AwsSNSTopicStatusActive
+		s.mu.Unlock()
+	}
+	s.mu.Lock()
+	s.queueUrls[region] = queueUrl
+	s.mu.Unlock()
+
+	return nil
+}
+
+// subscribeAccountQueue subscribes the queue of the region to the topic of a
+// workspace AWS account. The subscription is made by the account so SNS sends
+// a confirmation message to the queue, the consumer confirms it
+func (s *snsService) subscribeAccountQueue(ctx context.Context, account *model.AWSAccount, topic *model.SNSTopic) error {
+	queueUrl, queueArn, err := s.queue(ctx, topic.Region)
+	if err != nil {
+		return err
+	}
+	err = s.allowTopics(ctx, topic.Region, queueUrl, queueArn)
+	if err != nil {
+		return err
+	}
+	_, err = s.snsClient(account, topic.Region).Subscribe(ctx, &sns.SubscribeInput{
+		Protocol: aws.String("sqs"),
+		TopicArn: aws.String(topic.Arn),
+		Endpoint: aws.String(queueArn),
+	})
+
+	return err
+}
+
+// queue creates the queue of the region and returns its URL and ARN
+func (s *snsService) queue(ctx context.Context, region constant.AwsRegion) (string, string, error) {
+	svc := s.sqsClient(region)
+	queue, err := svc.CreateQueue(ctx, &sqs.CreateQueueInput{
+		QueueName: aws.String("ses" + "-" + constant.AppName),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	attributes, err := svc.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       queue.QueueUrl,
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameQueueArn},
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return *queue.QueueUrl, attributes.Attributes[string(types.QueueAttributeNameQueueArn)], nil
+}
+
+// allowTopics lets every topic of the region send messages to the queue,
+// including the topics of workspace AWS accounts
+func (s *snsService) allowTopics(ctx context.Context, region constant.AwsRegion, queueUrl string, queueArn string) error {
+	topics, err := s.repository.SNSTopic.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	topicArns := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		if topic.Region == region {
+			topicArns = append(topicArns, topic.Arn)
+		}
+	}
+	policy, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Effect":    "Allow",
+				"Principal": map[string]string{"Service": "sns.amazonaws.com"},
+				"Action":    "sqs:SendMessage",
+				"Resource":  queueArn,
+				"Condition": map[string]interface{}{
+					"ArnEquals": map[string][]string{"aws:SourceArn": topicArns},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.sqsClient(region).SetQueueAttributes(ctx, &sqs.SetQueueAttributesInput{
+		QueueUrl: aws.String(queueUrl),
+		Attributes: map[string]string{
+			string(types.QueueAttributeNamePolicy): string(policy),
+		},
+	})
+
+	return err
+}
+
+// StartConsumers long polls the queue of every region when the SNS
+// notifications are delivered through SQS
+func (s *snsService) StartConsumers(ctx context.Context) {
+	if s.config.SNS.Delivery != constant.AwsSNSDeliverySQS {
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for region, queueUrl := range s.queueUrls {
+		go s.consume(ctx, region, queueUrl)
+	}
+}
+
+func (s *snsService) consume(ctx context.Context, region constant.AwsRegion, queueUrl string) {
+	logger := s.logger.With().Str("region", string(region)).Logger()
+	svc := s.sqsClient(region)
+	for ctx.Err() == nil {
+		resp, err := svc.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueUrl),
+			MaxNumberOfMessages: sqsMaxMessages,
+			WaitTimeSeconds:     s.config.SNS.SQSWaitTimeInSeconds,
+			VisibilityTimeout:   s.config.SNS.SQSVisibilityTimeoutInSeconds,
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+				types.MessageSystemAttributeNameApproximateReceiveCount,
+			},
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error().Err(err).Msg("Error receiving messages")
+			time.Sleep(sqsErrorDelay)
+			continue
+		}
+		for _, message := range resp.Messages {
+			receiveCount, _ := strconv.Atoi(message.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+			err = s.processQueueMessage(message)
+			switch {
+			case err == nil:
+			case receiveCount >= s.config.SNS.SQSMaxReceiveCount:
+				logger.Error().Err(err).Str("messageId", aws.ToString(message.MessageId)).Msg("Dropping message")
+			default:
+				// the message becomes visible again after a delay growing
+				// with every receive
+				logger.Error().Err(err).Str("messageId", aws.ToString(message.MessageId)).Msg("Error processing message")
+				delay := min(time.Duration(receiveCount)*time.Duration(s.config.SNS.SQSVisibilityTimeoutInSeconds)*time.Second, sqsMaxVisibilityDelay)
+				_, err = svc.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+					QueueUrl:          aws.String(queueUrl),
+					ReceiptHandle:     message.ReceiptHandle,
+					VisibilityTimeout: int32(delay.Seconds()),
+				})
+				if err != nil {
+					logger.Error().Err(err).Msg("Error changing message visibility")
+				}
+				continue
+			}
+			_, err = svc.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(queueUrl),
+				ReceiptHandle: message.ReceiptHandle,
+			})
+			if err != nil {
+				logger.Error().Err(err).Msg("Error deleting message")
+			}
+		}
+	}
+}
+
+// processQueueMessage handles the SNS envelope of the message like the HTTP
+// endpoint handles the request body
+func (s *snsService) processQueueMessage(message types.Message) error {
+	if message.Body == nil {
+		return errors.New("empty message")
+	}
+	payload := []byte(*message.Body)
+	var envelope snsNotificationPayload
+	err := json.Unmarshal(payload, &envelope)
+	if err != nil {
+		return err
+	}
+	switch envelope.Type {
+	case "Notification":
+		return s.processNotification(payload, false)
+	case "SubscriptionConfirmation":
+		return s.confirmSubscribe(payload, false)
+	case "UnsubscribeConfirmation":
+		return nil
+	default:
+		return fmt.Errorf("unsupported message type %s", envelope.Type)
+	}
+}
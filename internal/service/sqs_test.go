@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+)
+
+// TestConsumeQueue runs against an SQS compatible server, e.g. elasticmq or
+// LocalStack, at the URL of SEND0_TEST_SQS_ENDPOINT
+func TestConsumeQueue(t *testing.T) {
+	endpoint := os.Getenv("SEND0_TEST_SQS_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("SEND0_TEST_SQS_ENDPOINT is not set")
+	}
+	service := newTestSNSService(t, &model.Repository{})
+	service.config.SNS.AccessKeyId = "test"
+	service.config.SNS.SecretAccessKey = "test"
+	service.config.SNS.SQSEndPoint = endpoint
+	service.config.SNS.SQSWaitTimeInSeconds = 1
+	service.config.SNS.SQSVisibilityTimeoutInSeconds = 1
+	service.config.SNS.SQSMaxReceiveCount = 1
+	region := constant.AwsRegionNorthVirginia
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queueUrl, _, err := service.queue(ctx, region)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := service.sqsClient(region)
+	_, err = svc.PurgeQueue(ctx, &sqs.PurgeQueueInput{QueueUrl: aws.String(queueUrl)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a message which is handled and one which fails until it is dropped
+	for _, body := range []string{`{"Type": "UnsubscribeConfirmation"}`, `{"Type": "Unknown"}`} {
+		_, err = svc.SendMessage(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(queueUrl), MessageBody: aws.String(body)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	go service.consume(ctx, region, queueUrl)
+
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		attributes, err := svc.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl: aws.String(queueUrl),
+			AttributeNames: []types.QueueAttributeName{
+				types.QueueAttributeNameApproximateNumberOfMessages,
+				types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		visible, _ := strconv.Atoi(attributes.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessages)])
+		notVisible, _ := strconv.Atoi(attributes.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessagesNotVisible)])
+		if visible+notVisible == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the messages to be deleted, %d are left", visible+notVisible)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
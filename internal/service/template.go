@@ -1,10 +1,13 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	htmltemplate "html/template"
 	"strings"
+	texttemplate "text/template"
 
 	"github.com/usesend0/send0/internal/constant"
 	"github.com/usesend0/send0/internal/model"
@@ -13,7 +16,9 @@ import (
 
 type TemplateService interface {
 	Create(ctx context.Context, template *model.Template) error
-	CreateOptInTemplate(ctx context.Context, workspaceId, organizationId uid.UID) error
+	CreateOptInTemplate(ctx context.Context, workspaceId, organizationId uid.UID) (*model.Template, error)
+	GetOptInTemplate(ctx context.Context, workspaceId, organizationId uid.UID) (*model.Template, error)
+	Render(template *model.Template, data map[string]interface{}) (*model.EmailContent, error)
 }
 
 type templateService struct {
@@ -31,10 +36,12 @@ func (s *templateService) Create(ctx context.Context, template *model.Template)
 			return errors.New("Opt-in template must contain the opt-in link variable")
 		}
 	}
+	template.Id = *s.uidGenerator.Next()
+
 	return s.repository.Template.Save(ctx, template)
 }
 
-func (s *templateService) CreateOptInTemplate(ctx context.Context, workspaceId, organizationId uid.UID) error {
+func (s *templateService) CreateOptInTemplate(ctx context.Context, workspaceId, organizationId uid.UID) (*model.Template, error) {
 	content := fmt.Sprintf(`
 		<!DOCTYPE html>
 		<html>
@@ -60,5 +67,76 @@ func (s *templateService) CreateOptInTemplate(ctx context.Context, workspaceId,
 		WorkspaceId:     workspaceId,
 	}
 
-	return s.Create(ctx, template)
+	err := s.Create(ctx, template)
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// GetOptInTemplate returns the opt-in template of the workspace, the default
+// one is created on first use
+func (s *templateService) GetOptInTemplate(ctx context.Context, workspaceId, organizationId uid.UID) (*model.Template, error) {
+	template, err := s.repository.Template.FindOptIn(ctx, workspaceId, organizationId)
+	if err != nil {
+		return nil, err
+	}
+	if template != nil {
+		return template, nil
+	}
+
+	return s.CreateOptInTemplate(ctx, workspaceId, organizationId)
+}
+
+func (s *templateService) Render(template *model.Template, data map[string]interface{}) (*model.EmailContent, error) {
+	subject, err := renderText(template.Subject, data)
+	if err != nil {
+		return nil, err
+	}
+	html, err := renderHtml(template.Content, data)
+	if err != nil {
+		return nil, err
+	}
+	emailContent := &model.EmailContent{
+		Subject: &subject,
+		Html:    &html,
+	}
+	if template.TextContent != nil {
+		text, err := renderText(*template.TextContent, data)
+		if err != nil {
+			return nil, err
+		}
+		emailContent.Text = &text
+	}
+
+	return emailContent, nil
+}
+
+func renderText(content string, data map[string]interface{}) (string, error) {
+	t, err := texttemplate.New("").Parse(content)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	err = t.Execute(&b, data)
+	if err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+func renderHtml(content string, data map[string]interface{}) (string, error) {
+	t, err := htmltemplate.New("").Parse(content)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	err = t.Execute(&b, data)
+	if err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
 }
@@ -6,25 +6,52 @@ import (
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/usesend0/send0/internal/constant"
 	"github.com/usesend0/send0/internal/crypto"
 	"github.com/usesend0/send0/internal/model"
 	"github.com/usesend0/send0/internal/uid"
+	standardwebhooks "github.com/usesend0/send0/pkg/webhook"
 )
 
-const webhookRequestSignatureBitSize = 1024
+const webhookRequestSignatureBitSize = 2048
 const maxWebhookLogRetries = 3
+const maxWebhookResponseBodySize = 4096
+const webhookListenerId = "webhooks"
+
+// webhookSecretGracePeriod is how long a rotated secret keeps signing requests
+const webhookSecretGracePeriod = 24 * time.Hour
+
+const (
+	webhookMaxRetries     = 11
+	webhookRetryBaseDelay = time.Minute
+	webhookRetryMaxDelay  = 8 * time.Hour
+	webhookRetryInterval  = 10 * time.Second
+	webhookRetryBatchSize = 100
+)
+
+var ErrWebhookEventType = errors.New("unsupported webhook event type")
+var ErrWebhookSigningMode = errors.New("unsupported webhook signing mode")
 
 type WebhookService interface {
 	Create(ctx context.Context, webhook *model.Webhook) (*model.Webhook, error)
 	Get(ctx context.Context, id uid.UID) (*model.Webhook, error)
 	List(ctx context.Context, workspaceId uid.UID) ([]*model.Webhook, error)
-	StartListeners()
+	Update(ctx context.Context, webhook *model.Webhook) error
+	Delete(ctx context.Context, webhook *model.Webhook) error
+	RotateSigningKey(ctx context.Context, webhook *model.Webhook) error
+	Test(ctx context.Context, webhook *model.Webhook) (*model.WehbookRequest, error)
+	Redeliver(ctx context.Context, webhook *model.Webhook, log *model.WebhookEvent) error
+	StartListeners(ctx context.Context)
 }
 
 type webhookService struct {
@@ -37,17 +64,25 @@ func NewWebhookService(baseService *baseService, eventService EventSevice) Webho
 	return &webhookService{
 		baseService,
 		eventService,
-		http.DefaultClient,
+		&http.Client{
+			Timeout: time.Duration(baseService.config.Webhook.TimeoutInSeconds) * time.Second,
+		},
 	}
 }
 
 func (s *webhookService) Create(ctx context.Context, webhook *model.Webhook) (*model.Webhook, error) {
-	privateKey, publicKey, err := crypto.GenerateKeyPair(webhookRequestSignatureBitSize)
+	err := validateWebhookEvents(webhook.Events)
 	if err != nil {
 		return nil, err
 	}
-	webhook.SigningKey = model.ToJSONPrivateKey(*privateKey)
-	webhook.SigningKeyPublic, err = crypto.PublicKeyToEncoded(publicKey)
+	webhook.Id = *s.uidGenerator.Next()
+	if webhook.Status == "" {
+		webhook.Status = model.WebhookStatusActive
+	}
+	if webhook.SigningMode == "" {
+		webhook.SigningMode = model.WebhookSigningModeRSA
+	}
+	err = s.generateSigningKey(webhook)
 	if err != nil {
 		return nil, err
 	}
@@ -64,6 +99,112 @@ func (s *webhookService) List(ctx context.Context, workspaceId uid.UID) ([]*mode
 	return s.repository.Webhook.FindByWorkspaceId(ctx, workspaceId)
 }
 
+func (s *webhookService) Update(ctx context.Context, webhook *model.Webhook) error {
+	err := validateWebhookEvents(webhook.Events)
+	if err != nil {
+		return err
+	}
+	if webhook.Status == model.WebhookStatusActive {
+		// a webhook which was disabled after failing starts over
+		webhook.FailureCount = 0
+	}
+
+	return s.repository.Webhook.Update(ctx, webhook)
+}
+
+func (s *webhookService) Delete(ctx context.Context, webhook *model.Webhook) error {
+	return s.repository.Webhook.Delete(ctx, webhook.Id)
+}
+
+// RotateSigningKey replaces the signing key of the webhook, requests are
+// signed with the new key right away. In the HMAC_SHA256 and ED25519 signing
+// modes the requests are also signed with the previous keys until the grace
+// period is over, so receivers can switch keys without rejecting requests
+func (s *webhookService) RotateSigningKey(ctx context.Context, webhook *model.Webhook) error {
+	now := time.Now().UTC()
+	expiresAt := now.Add(webhookSecretGracePeriod)
+	previous := make(model.WebhookSigningSecrets, 0, len(webhook.SigningSecrets))
+	for _, secret := range webhook.SigningSecrets {
+		if secret.ExpiresAt == nil {
+			secret.ExpiresAt = &expiresAt
+		}
+		if secret.ExpiresAt.After(now) {
+			previous = append(previous, secret)
+		}
+	}
+	err := s.generateSigningKey(webhook)
+	if err != nil {
+		return err
+	}
+	if webhook.SigningMode != model.WebhookSigningModeRSA {
+		webhook.SigningSecrets = append(webhook.SigningSecrets, previous...)
+	}
+
+	return s.repository.Webhook.UpdateSigningKey(ctx, webhook)
+}
+
+// Test sends a sample event to the webhook, the sample has the first event
+// type the webhook is subscribed to. The request is not logged or retried
+func (s *webhookService) Test(ctx context.Context, webhook *model.Webhook) (*model.WehbookRequest, error) {
+	eventType := constant.EventTypeEmailDelivered
+	if len(webhook.Events) > 0 {
+		eventType = constant.EventType(webhook.Events[0])
+	}
+	event := &model.Event{
+		Base: model.Base{
+			Id: *s.uidGenerator.Next(),
+		},
+		EventType:   eventType,
+		Receipients: model.JSONBArray{"test@example.com"},
+		MetaData: model.EventMetaData{
+			"test": true,
+		},
+		WorkspaceId: webhook.WorkspaceId,
+	}
+
+	bytes, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	request := s.request(ctx, webhook, event.Id, bytes)
+	if request.Error != "" {
+		return nil, errors.New(request.Error)
+	}
+
+	return request, nil
+}
+
+// generateSigningKey sets a new signing key for the signing mode of the
+// webhook, replacing the current keys
+func (s *webhookService) generateSigningKey(webhook *model.Webhook) error {
+	var secret string
+	var err error
+	switch webhook.SigningMode {
+	case model.WebhookSigningModeRSA:
+		privateKey, _, err := crypto.GenerateKeyPair(webhookRequestSignatureBitSize)
+		if err != nil {
+			return err
+		}
+		webhook.SigningKey = model.ToJSONPrivateKey(*privateKey)
+		webhook.SigningSecrets = model.WebhookSigningSecrets{}
+
+		return webhook.EncodeSigningKey()
+	case model.WebhookSigningModeHMAC:
+		secret, err = standardwebhooks.GenerateSecret()
+	case model.WebhookSigningModeEd25519:
+		secret, _, err = standardwebhooks.GenerateKey()
+	default:
+		return ErrWebhookSigningMode
+	}
+	if err != nil {
+		return err
+	}
+	webhook.SigningKey = model.JSONPrivateKey{}
+	webhook.SigningSecrets = model.WebhookSigningSecrets{{Secret: secret}}
+
+	return webhook.EncodeSigningKey()
+}
+
 func (s *webhookService) CreateWebhookRequestSignature(
 	signingKey *rsa.PrivateKey,
 	id uid.UID,
@@ -85,76 +226,319 @@ func (s *webhookService) CreateWebhookRequestSignature(
 	return &signatureEncoded, nil
 }
 
-func (s *webhookService) StartListeners() {
+// StartListeners delivers the events to the webhooks, the listeners share a
+// consumer group so every event is delivered once. Failed requests are
+// retried in the background until the context is done
+func (s *webhookService) StartListeners(ctx context.Context) {
 	cpus := runtime.NumCPU()
 	for i := 0; i < cpus; i++ {
-		go s.listen()
+		s.eventService.Subscribe(ctx, webhookListenerId, s.handleEvent)
 	}
+	go s.retry(ctx)
 }
 
-func (s *webhookService) listen() {
-	ch := s.eventService.Subscribe(fmt.Sprintf("WL-%s", s.uidGenerator.Next()))
-	for event := range ch {
-		s.handleEvent(event)
+// retry sends the logs which are due for another attempt until the context is
+// done
+func (s *webhookService) retry(ctx context.Context) {
+	ticker := time.NewTicker(webhookRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.retryDue(ctx, now)
+		}
 	}
 }
 
-func (s *webhookService) handleEvent(event *model.Event) {
-	webhook, err := s.repository.Webhook.FindByEventType(context.Background(), event.EventType)
+// retryDue claims a batch of the due logs and attempts them, the claim lasts
+// as long as an attempt may take
+func (s *webhookService) retryDue(ctx context.Context, now time.Time) {
+	logs, err := s.repository.Webhook.ClaimDueLogs(ctx, now, now.Add(s.attemptLease()), webhookRetryBatchSize)
 	if err != nil {
-		s.logger.Error().Err(err).Msg("webhookService.handleEvent")
+		s.logger.Error().Err(err).Msg("failed to find due webhook logs")
 		return
 	}
+	webhooks := make(map[uid.UID]*model.Webhook)
+	for _, log := range logs {
+		if ctx.Err() != nil {
+			// the claim expires and the logs are retried after the restart
+			return
+		}
+		webhook, ok := webhooks[log.WebhookId]
+		if !ok {
+			webhook, err = s.repository.Webhook.FindById(ctx, log.WebhookId)
+			if err != nil {
+				s.logger.Error().Err(err).Msg("failed to find webhook")
+				continue
+			}
+			webhooks[log.WebhookId] = webhook
+		}
+		if webhook == nil || webhook.Status != model.WebhookStatusActive {
+			// the webhook was removed or disabled, the log can be redelivered
+			log.Status = model.WebhookLogStatusFailure
+			s.updateLog(ctx, log)
+			continue
+		}
+		s.attempt(ctx, webhook, log)
+	}
+}
+
+// handleEvent delivers the event to every webhook of the workspace which is
+// subscribed to the event type, the event is handled again when the webhooks
+// can't be found. An event the bus delivers again keeps its log, and the log
+// id the receivers dedupe on
+func (s *webhookService) handleEvent(ctx context.Context, event *model.Event) error {
+	webhooks, err := s.repository.Webhook.FindByEventType(ctx, event.WorkspaceId, event.EventType)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
 	bytes, err := json.Marshal(event)
 	if err != nil {
-		return
+		return err
+	}
+	for _, webhook := range webhooks {
+		// the log is leased to this attempt, it is retried when the server
+		// stops before the attempt is recorded
+		log := &model.WebhookEvent{
+			Base: model.Base{
+				Id: *s.uidGenerator.Next(),
+			},
+			Status:      model.WebhookLogStatusPending,
+			EventType:   model.WebhookEventType(event.EventType),
+			Payload:     string(bytes),
+			NextSendAt:  time.Now().Add(s.attemptLease()),
+			WebhookId:   webhook.Id,
+			WorkspaceId: webhook.WorkspaceId,
+			EventId:     &event.Id,
+		}
+		exists := false
+		err = execRetry(func() error {
+			err := s.repository.Webhook.SaveLog(ctx, log)
+			if errors.Is(err, model.ErrWebhookLogExists) {
+				exists = true
+				return nil
+			}
+			return err
+		}, maxWebhookLogRetries)
+		if exists {
+			// the first delivery sends it, or the retries once its lease is over
+			continue
+		}
+		if err != nil {
+			s.logger.Error().Err(err).Str("webhookId", webhook.Id.String()).Msg("failed to save webhook log")
+			continue
+		}
+		s.attempt(ctx, webhook, log)
 	}
-	privateKey := model.FromJSONPrivateKey(webhook.SigningKey)
-	webhookLog := model.WebhookEvent{
-		Payload: string(bytes),
+
+	return nil
+}
+
+// Redeliver sends the log to the webhook again, a failed request is retried
+// with the same backoff as a new event
+func (s *webhookService) Redeliver(
+	ctx context.Context,
+	webhook *model.Webhook,
+	log *model.WebhookEvent,
+) error {
+	log.Status = model.WebhookLogStatusPending
+	log.Retries = 0
+	log.NextSendAt = time.Now().Add(s.attemptLease())
+	err := s.repository.Webhook.UpdateLog(ctx, log)
+	if err != nil {
+		return err
+	}
+	s.attempt(ctx, webhook, log)
+
+	return nil
+}
+
+// attempt posts the log to the webhook and records the request. A failed
+// request is scheduled for a retry with exponential backoff until the
+// retries run out, the webhook is disabled when it keeps failing
+func (s *webhookService) attempt(ctx context.Context, webhook *model.Webhook, log *model.WebhookEvent) {
+	request := s.request(ctx, webhook, log.Id, []byte(log.Payload))
+	log.Requests = append(log.Requests, *request)
+	success := request.Error == "" &&
+		request.ResponseStatus >= http.StatusOK &&
+		request.ResponseStatus < http.StatusMultipleChoices
+	switch {
+	case success:
+		log.Status = model.WebhookLogStatusSuccess
+	case log.Retries >= webhookMaxRetries:
+		log.Status = model.WebhookLogStatusFailure
+	default:
+		log.Retries++
+		log.NextSendAt = time.Now().Add(webhookRetryDelay(log.Retries))
 	}
-	webhookRequest := model.WehbookRequest{
-		SendAt: time.Now().UTC().Format(time.RFC3339),
+	s.updateLog(ctx, log)
+	if !success {
+		s.createFailureEvent(ctx, webhook, log, request)
 	}
-	signature, err := s.CreateWebhookRequestSignature(&privateKey, webhook.Id, webhookRequest.SendAt, webhookLog.Payload)
+	failureCount, err := s.repository.Webhook.RecordDelivery(ctx, webhook.Id, success)
 	if err != nil {
+		s.logger.Error().Err(err).Str("webhookId", webhook.Id.String()).Msg("failed to record webhook delivery")
 		return
 	}
-	webhookRequest.Signature = *signature
-	webhookLog.Requests = model.JSONBArrayWebhookRequests{webhookRequest}
-	err = execRetry(func() error {
-		return s.repository.Webhook.SaveLog(context.Background(), &webhookLog)
-	}, maxWebhookLogRetries)
-	if err != nil {
-		s.logger.Error().Err(err).Msg("max retries reached")
+	webhook.FailureCount = failureCount
+	if success || failureCount < s.config.Webhook.DisableAfterFailures || webhook.Status != model.WebhookStatusActive {
+		return
 	}
-	resp, status, err := s.postRequest(webhook.URL, bytes, map[string]string{
-		"X-Webhook-Signature": webhookRequest.Signature,
-		"X-Webhook-Id":        webhook.Id.String(),
-		"X-Webhook-Timestamp": webhookRequest.SendAt,
-	})
+	webhook.Status = model.WebhookStatusInactive
+	err = s.repository.Webhook.Update(ctx, webhook)
 	if err != nil {
-		s.logger.Error().Err(err).Msg("error sending webhook request")
+		s.logger.Error().Err(err).Str("webhookId", webhook.Id.String()).Msg("failed to disable webhook")
 		return
 	}
-	webhookLog.Requests[0].ResponseStatus = status
-	webhookLog.Requests[0].ResponseBody = string(resp)
+	s.logger.Warn().Str("webhookId", webhook.Id.String()).Int("failureCount", failureCount).Msg("webhook disabled")
+}
+
+// createFailureEvent records the failed request as an event of the workspace,
+// webhooks can't subscribe to it so a failing webhook is not notified
+func (s *webhookService) createFailureEvent(
+	ctx context.Context,
+	webhook *model.Webhook,
+	log *model.WebhookEvent,
+	request *model.WehbookRequest,
+) {
+	var payload model.Event
+	_ = json.Unmarshal([]byte(log.Payload), &payload)
+	metaData := model.EventMetaData{
+		"webhookId":      webhook.Id.String(),
+		"webhookEventId": log.Id.String(),
+		"eventType":      log.EventType,
+		"url":            webhook.URL,
+		"retries":        log.Retries,
+		"status":         log.Status,
+		"responseStatus": request.ResponseStatus,
+		"error":          request.Error,
+	}
+	if payload.Id.ID() != 0 {
+		metaData["eventId"] = payload.Id.String()
+	}
+	if broadcastId, ok := payload.MetaData["broadcastId"]; ok {
+		metaData["broadcastId"] = broadcastId
+	}
+	event := &model.Event{
+		Base: model.Base{
+			Id: *s.uidGenerator.Next(),
+		},
+		EventType:      constant.EventTypeWebhookFailed,
+		Receipients:    model.JSONBArray{},
+		MetaData:       metaData,
+		OrganizationId: payload.OrganizationId,
+		WorkspaceId:    webhook.WorkspaceId,
+	}
+	s.eventService.Create(ctx, event)
+	s.eventService.Publish(ctx, []*model.Event{event})
+}
 
-	// TODO: update webhook log with response status and body
-	err = execRetry(func() error {
-		return s.repository.Webhook.SaveLog(context.Background(), &webhookLog)
+func (s *webhookService) updateLog(ctx context.Context, log *model.WebhookEvent) {
+	err := execRetry(func() error {
+		return s.repository.Webhook.UpdateLog(ctx, log)
 	}, maxWebhookLogRetries)
 	if err != nil {
-		s.logger.Error().Err(err).Msg("max retries reached")
+		s.logger.Error().Err(err).Str("webhookLogId", log.Id.String()).Msg("max retries reached")
 	}
 }
 
+// request signs and posts the payload to the webhook, the outcome of the
+// request is returned and never an error
+func (s *webhookService) request(
+	ctx context.Context,
+	webhook *model.Webhook,
+	logId uid.UID,
+	payload []byte,
+) *model.WehbookRequest {
+	now := time.Now().UTC()
+	webhookRequest := &model.WehbookRequest{
+		Base: model.Base{
+			Id: *s.uidGenerator.Next(),
+		},
+		SendAt: now.Format(time.RFC3339),
+	}
+	headers, err := s.signatureHeaders(webhook, logId, now, payload)
+	if err != nil {
+		webhookRequest.Error = err.Error()
+		return webhookRequest
+	}
+	webhookRequest.Signature = headers[standardwebhooks.HeaderSignature]
+	if webhook.SigningMode == model.WebhookSigningModeRSA {
+		webhookRequest.Signature = headers[standardwebhooks.HeaderRSASignature]
+	}
+	start := time.Now()
+	resp, status, err := s.postRequest(ctx, webhook.URL, payload, headers)
+	webhookRequest.LatencyInMs = time.Since(start).Milliseconds()
+	webhookRequest.ResponseStatus = status
+	webhookRequest.ResponseBody = string(resp)
+	if err != nil {
+		webhookRequest.Error = err.Error()
+	}
+
+	return webhookRequest
+}
+
+// signatureHeaders signs the payload for the signing mode of the webhook,
+// the Standard Webhooks signature header has a signature for every active
+// secret
+func (s *webhookService) signatureHeaders(
+	webhook *model.Webhook,
+	logId uid.UID,
+	now time.Time,
+	payload []byte,
+) (map[string]string, error) {
+	if webhook.SigningMode == model.WebhookSigningModeRSA {
+		timestamp := now.Format(time.RFC3339)
+		privateKey := model.FromJSONPrivateKey(webhook.SigningKey)
+		signature, err := s.CreateWebhookRequestSignature(&privateKey, webhook.Id, timestamp, string(payload))
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]string{
+			standardwebhooks.HeaderRSASignature: *signature,
+			standardwebhooks.HeaderRSAId:        webhook.Id.String(),
+			standardwebhooks.HeaderRSATimestamp: timestamp,
+			"X-Webhook-Event-Id":                logId.String(),
+		}, nil
+	}
+	secrets := webhook.SigningSecrets.Active(now)
+	if len(secrets) == 0 {
+		return nil, errors.New("webhook has no active signing secret")
+	}
+	signatures := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		signature, err := standardwebhooks.Sign(secret, logId.String(), now, payload)
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, signature)
+	}
+
+	return map[string]string{
+		standardwebhooks.HeaderId:        logId.String(),
+		standardwebhooks.HeaderTimestamp: strconv.FormatInt(now.Unix(), 10),
+		standardwebhooks.HeaderSignature: strings.Join(signatures, " "),
+	}, nil
+}
+
+// attemptLease is how long an attempt may take before the log is sent again
+func (s *webhookService) attemptLease() time.Duration {
+	return time.Duration(s.config.Webhook.TimeoutInSeconds)*time.Second + time.Minute
+}
+
 func (s *webhookService) postRequest(
+	ctx context.Context,
 	url string,
 	payload []byte,
 	headers map[string]string,
 ) ([]byte, int, error) {
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
 	if err != nil {
 		return nil, 0, err
 	}
@@ -167,10 +551,31 @@ func (s *webhookService) postRequest(
 		return nil, 0, err
 	}
 	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseBodySize))
 	if err != nil {
-		return nil, 0, err
+		return nil, resp.StatusCode, err
 	}
 
 	return body, resp.StatusCode, nil
 }
+
+// webhookRetryDelay doubles the delay for every retry, the retries of an
+// event span about a day
+func webhookRetryDelay(retries int) time.Duration {
+	delay := webhookRetryBaseDelay << (retries - 1)
+	if delay <= 0 || delay > webhookRetryMaxDelay {
+		return webhookRetryMaxDelay
+	}
+
+	return delay
+}
+
+func validateWebhookEvents(events model.JSONBArray) error {
+	for _, event := range events {
+		if !slices.Contains(constant.EventTypes, constant.EventType(event)) {
+			return fmt.Errorf("%w %s", ErrWebhookEventType, event)
+		}
+	}
+
+	return nil
+}
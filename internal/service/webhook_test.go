@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/usesend0/send0/internal/config"
+	"github.com/usesend0/send0/internal/constant"
+	"github.com/usesend0/send0/internal/model"
+	"github.com/usesend0/send0/internal/uid"
+	standardwebhooks "github.com/usesend0/send0/pkg/webhook"
+)
+
+type fakeWebhookRepository struct {
+	model.WebhookRepository
+	webhooks     []*model.Webhook
+	logs         map[string]*model.WebhookEvent // By event and webhook id
+	failureCount int
+}
+
+func (r *fakeWebhookRepository) FindByEventType(_ context.Context, _ uid.UID, _ constant.EventType) ([]*model.Webhook, error) {
+	return r.webhooks, nil
+}
+
+func (r *fakeWebhookRepository) SaveLog(_ context.Context, log *model.WebhookEvent) error {
+	key := log.EventId.String() + ":" + log.WebhookId.String()
+	if _, ok := r.logs[key]; ok {
+		return model.ErrWebhookLogExists
+	}
+	r.logs[key] = log
+
+	return nil
+}
+
+func (r *fakeWebhookRepository) UpdateLog(_ context.Context, _ *model.WebhookEvent) error {
+	return nil
+}
+
+func (r *fakeWebhookRepository) RecordDelivery(_ context.Context, _ uid.UID, success bool) (int, error) {
+	r.failureCount++
+	if success {
+		r.failureCount = 0
+	}
+
+	return r.failureCount, nil
+}
+
+func (r *fakeWebhookRepository) Update(_ context.Context, _ *model.Webhook) error {
+	return nil
+}
+
+func (r *fakeWebhookRepository) UpdateSigningKey(_ context.Context, _ *model.Webhook) error {
+	return nil
+}
+
+// webhookReceiver records the requests it receives and answers with the status
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newWebhookReceiver(t *testing.T, status int) *webhookReceiver {
+	receiver := &webhookReceiver{status: status}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receiver.mu.Lock()
+		receiver.requests = append(receiver.requests, r)
+		receiver.bodies = append(receiver.bodies, body)
+		receiver.mu.Unlock()
+		w.WriteHeader(receiver.status)
+	}))
+	t.Cleanup(receiver.Close)
+
+	return receiver
+}
+
+func newTestWebhookService(repository *fakeWebhookRepository) *webhookService {
+	service := &webhookService{
+		baseService:  newTestBaseService(&model.Repository{Webhook: repository}),
+		eventService: &fakeEventService{},
+		httpClient:   &http.Client{},
+	}
+	service.config.Webhook = config.Webhook{TimeoutInSeconds: 10, DisableAfterFailures: 3}
+
+	return service
+}
+
+func TestHandleEventDeliversAnEventOnce(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusOK)
+	webhook := &model.Webhook{
+		Base:        model.Base{Id: *uid.NewUID(1)},
+		Status:      model.WebhookStatusActive,
+		URL:         receiver.URL,
+		SigningMode: model.WebhookSigningModeHMAC,
+	}
+	repository := &fakeWebhookRepository{
+		webhooks: []*model.Webhook{webhook},
+		logs:     make(map[string]*model.WebhookEvent),
+	}
+	service := newTestWebhookService(repository)
+	err := service.generateSigningKey(webhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := &model.Event{
+		Base:      model.Base{Id: *uid.NewUID(2)},
+		EventType: constant.EventTypeEmailDelivered,
+	}
+
+	// the event bus delivers the event again
+	for i := 0; i < 2; i++ {
+		err = service.handleEvent(context.Background(), event)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(repository.logs) != 1 {
+		t.Fatalf("expected 1 log, got %d", len(repository.logs))
+	}
+	if len(receiver.requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(receiver.requests))
+	}
+	log := repository.logs[event.Id.String()+":"+webhook.Id.String()]
+	if got := receiver.requests[0].Header.Get(standardwebhooks.HeaderId); got != log.Id.String() {
+		t.Fatalf("expected the log id %s as the webhook id, got %s", log.Id, got)
+	}
+}
+
+func TestRequestSignsForTheSigningMode(t *testing.T) {
+	for _, mode := range []model.WebhookSigningMode{
+		model.WebhookSigningModeRSA,
+		model.WebhookSigningModeHMAC,
+		model.WebhookSigningModeEd25519,
+	} {
+		t.Run(string(mode), func(t *testing.T) {
+			receiver := newWebhookReceiver(t, http.StatusOK)
+			webhook := &model.Webhook{
+				Base:        model.Base{Id: *uid.NewUID(1)},
+				URL:         receiver.URL,
+				SigningMode: mode,
+			}
+			service := newTestWebhookService(&fakeWebhookRepository{})
+			err := service.generateSigningKey(webhook)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verify := func(key string, i int) error {
+				request := receiver.requests[i]
+				if mode == model.WebhookSigningModeRSA {
+					return standardwebhooks.VerifyRSA(key, receiver.bodies[i], request.Header)
+				}
+				verifier, err := standardwebhooks.NewVerifier(key)
+				if err != nil {
+					return err
+				}
+				return verifier.Verify(receiver.bodies[i], request.Header)
+			}
+			// the key a receiver verifies with
+			key := func() string {
+				if mode == model.WebhookSigningModeHMAC {
+					return webhook.SigningSecret
+				}
+				return webhook.SigningKeyPublic
+			}
+
+			request := service.request(context.Background(), webhook, *uid.NewUID(2), []byte(`{"id":"2"}`))
+			if request.Error != "" {
+				t.Fatal(request.Error)
+			}
+			previousKey := key()
+			err = verify(previousKey, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = service.RotateSigningKey(context.Background(), webhook)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key() == previousKey {
+				t.Fatal("expected a new signing key")
+			}
+			service.request(context.Background(), webhook, *uid.NewUID(3), []byte(`{"id":"3"}`))
+			err = verify(key(), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the previous secret keeps verifying the requests during the
+			// grace period, an RSA key is replaced right away
+			err = verify(previousKey, 1)
+			if mode == model.WebhookSigningModeRSA {
+				if err == nil {
+					t.Fatal("expected the previous RSA key to be replaced")
+				}
+			} else if err != nil {
+				t.Fatalf("expected the previous key to verify during the grace period, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAttemptSchedulesRetriesAndDisablesTheWebhook(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError)
+	webhook := &model.Webhook{
+		Base:        model.Base{Id: *uid.NewUID(1)},
+		Status:      model.WebhookStatusActive,
+		URL:         receiver.URL,
+		SigningMode: model.WebhookSigningModeHMAC,
+	}
+	service := newTestWebhookService(&fakeWebhookRepository{})
+	err := service.generateSigningKey(webhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := &model.WebhookEvent{
+		Base:      model.Base{Id: *uid.NewUID(2)},
+		Status:    model.WebhookLogStatusPending,
+		Payload:   `{"id":"3"}`,
+		WebhookId: webhook.Id,
+	}
+
+	for i := 1; i <= 2; i++ {
+		start := time.Now()
+		service.attempt(context.Background(), webhook, log)
+		if log.Status != model.WebhookLogStatusPending || log.Retries != i {
+			t.Fatalf("expected retry %d to be pending, got %s after %d retries", i, log.Status, log.Retries)
+		}
+		if next := log.NextSendAt.Sub(start); next < webhookRetryDelay(i) || next > webhookRetryDelay(i)+time.Second {
+			t.Fatalf("expected retry %d after %s, got %s", i, webhookRetryDelay(i), next)
+		}
+		if webhook.Status != model.WebhookStatusActive {
+			t.Fatalf("expected the webhook to be active after %d failures", i)
+		}
+	}
+
+	// the webhook is disabled after DisableAfterFailures failed deliveries
+	log.Retries = webhookMaxRetries
+	service.attempt(context.Background(), webhook, log)
+	if log.Status != model.WebhookLogStatusFailure {
+		t.Fatalf("expected the log to fail once the retries run out, got %s", log.Status)
+	}
+	if webhook.Status != model.WebhookStatusInactive || webhook.FailureCount != 3 {
+		t.Fatalf("expected the webhook to be disabled after 3 failures, got %s after %d", webhook.Status, webhook.FailureCount)
+	}
+	if len(log.Requests) != 3 {
+		t.Fatalf("expected 3 requests in the log, got %d", len(log.Requests))
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	for retries, delay := range map[int]time.Duration{
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		9:  256 * time.Minute,
+		10: webhookRetryMaxDelay,
+		64: webhookRetryMaxDelay,
+	} {
+		if got := webhookRetryDelay(retries); got != delay {
+			t.Fatalf("expected retry %d after %s, got %s", retries, delay, got)
+		}
+	}
+}
@@ -59,9 +59,10 @@ func (s *workspaceService) Seed(ctx context.Context) error {
 		Base: model.Base{
 			Id: *organizationId,
 		},
-		Name:      "Main",
-		IsDefault: true,
-		Subdomain: constant.AppName,
+		Name:        "Main",
+		IsDefault:   true,
+		Subdomain:   constant.AppName,
+		WorkspaceId: *workspaceId,
 	}
 	team := &model.Team{
 		Name:           "Admins",
@@ -11,6 +11,8 @@ import (
 
 var startTime = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
 
+const sonyflakeTimeUnit = 10 * time.Millisecond
+
 type UIDGenerator interface {
 	Next() *UID
 }
@@ -46,6 +48,17 @@ func (i *uidGenerator) Next() *UID {
 	return NewUID(int64(uid))
 }
 
+// FirstUIDAt returns the smallest UID generated at the time, records can be
+// queried by creation time by comparing their UID with it
+func FirstUIDAt(t time.Time) *UID {
+	elapsed := t.Sub(startTime) / sonyflakeTimeUnit
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	return NewUID(int64(elapsed) << (sonyflake.BitLenSequence + sonyflake.BitLenMachineID))
+}
+
 func Timestamp(uid int64) time.Time {
 	return timestamp(uint64(uid))
 }
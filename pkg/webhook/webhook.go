@@ -0,0 +1,279 @@
+// Package webhook signs and verifies send0 webhook requests.
+//
+// Webhooks using the HMAC_SHA256 or ED25519 signing mode follow the Standard
+// Webhooks specification (https://www.standardwebhooks.com), the request has
+// the webhook-id, webhook-timestamp and webhook-signature headers. While a
+// secret is being rotated the signature header holds a signature for every
+// active secret, a request is valid when any of them matches.
+//
+// Webhooks using the RSA signing mode have the X-Webhook-Id,
+// X-Webhook-Timestamp and X-Webhook-Signature headers, see VerifyRSA.
+package webhook
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderId        = "webhook-id"
+	HeaderTimestamp = "webhook-timestamp"
+	HeaderSignature = "webhook-signature"
+
+	HeaderRSAId        = "X-Webhook-Id"
+	HeaderRSATimestamp = "X-Webhook-Timestamp"
+	HeaderRSASignature = "X-Webhook-Signature"
+)
+
+const (
+	SecretPrefix     = "whsec_"
+	PrivateKeyPrefix = "whsk_"
+	PublicKeyPrefix  = "whpk_"
+)
+
+const (
+	signatureVersionHMAC    = "v1"
+	signatureVersionEd25519 = "v1a"
+	secretSize              = 32
+)
+
+// DefaultTolerance is how far the timestamp of a request may be from the
+// current time, older requests are rejected to prevent replays
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	ErrMissingHeaders   = errors.New("missing webhook headers")
+	ErrInvalidTimestamp = errors.New("invalid webhook timestamp")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidSecret    = errors.New("invalid webhook secret")
+)
+
+// GenerateSecret returns a new HMAC secret
+func GenerateSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return SecretPrefix + base64.StdEncoding.EncodeToString(secret), nil
+}
+
+// GenerateKey returns a new Ed25519 private key and its public key
+func GenerateKey() (string, string, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	return PrivateKeyPrefix + base64.StdEncoding.EncodeToString(privateKey),
+		PublicKeyPrefix + base64.StdEncoding.EncodeToString(publicKey),
+		nil
+}
+
+// PublicKey returns the public key of an Ed25519 private key
+func PublicKey(privateKey string) (string, error) {
+	key, err := decode(privateKey, PrivateKeyPrefix, ed25519.PrivateKeySize)
+	if err != nil {
+		return "", err
+	}
+	publicKey := ed25519.PrivateKey(key).Public().(ed25519.PublicKey)
+
+	return PublicKeyPrefix + base64.StdEncoding.EncodeToString(publicKey), nil
+}
+
+// Sign returns the signature of the request with the version prefix, the
+// secret is either an HMAC secret or an Ed25519 private key
+func Sign(secret string, id string, timestamp time.Time, payload []byte) (string, error) {
+	content := signedContent(id, timestamp, payload)
+	switch {
+	case strings.HasPrefix(secret, SecretPrefix):
+		key, err := decode(secret, SecretPrefix, 0)
+		if err != nil {
+			return "", err
+		}
+		return signatureVersionHMAC + "," + base64.StdEncoding.EncodeToString(signHMAC(key, content)), nil
+	case strings.HasPrefix(secret, PrivateKeyPrefix):
+		key, err := decode(secret, PrivateKeyPrefix, ed25519.PrivateKeySize)
+		if err != nil {
+			return "", err
+		}
+		signature := ed25519.Sign(ed25519.PrivateKey(key), content)
+		return signatureVersionEd25519 + "," + base64.StdEncoding.EncodeToString(signature), nil
+	default:
+		return "", ErrInvalidSecret
+	}
+}
+
+// Verifier verifies Standard Webhooks requests against one or more HMAC
+// secrets or Ed25519 public keys
+type Verifier struct {
+	secrets    [][]byte
+	publicKeys []ed25519.PublicKey
+	// Tolerance is how far the timestamp of a request may be from now
+	Tolerance time.Duration
+	now       func() time.Time
+}
+
+// NewVerifier returns a verifier for the whsec_ secrets and whpk_ public
+// keys, pass both the old and the new secret while a secret is rotated
+func NewVerifier(secrets ...string) (*Verifier, error) {
+	verifier := &Verifier{
+		Tolerance: DefaultTolerance,
+		now:       time.Now,
+	}
+	for _, secret := range secrets {
+		switch {
+		case strings.HasPrefix(secret, SecretPrefix):
+			key, err := decode(secret, SecretPrefix, 0)
+			if err != nil {
+				return nil, err
+			}
+			verifier.secrets = append(verifier.secrets, key)
+		case strings.HasPrefix(secret, PublicKeyPrefix):
+			key, err := decode(secret, PublicKeyPrefix, ed25519.PublicKeySize)
+			if err != nil {
+				return nil, err
+			}
+			verifier.publicKeys = append(verifier.publicKeys, ed25519.PublicKey(key))
+		default:
+			return nil, ErrInvalidSecret
+		}
+	}
+	if len(verifier.secrets) == 0 && len(verifier.publicKeys) == 0 {
+		return nil, ErrInvalidSecret
+	}
+
+	return verifier, nil
+}
+
+// Verify checks the timestamp and the signatures of the request
+func (v *Verifier) Verify(payload []byte, headers http.Header) error {
+	id := headers.Get(HeaderId)
+	timestampHeader := headers.Get(HeaderTimestamp)
+	signatureHeader := headers.Get(HeaderSignature)
+	if id == "" || timestampHeader == "" || signatureHeader == "" {
+		return ErrMissingHeaders
+	}
+	seconds, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	timestamp := time.Unix(seconds, 0)
+	now := v.now()
+	if now.Sub(timestamp) > v.Tolerance || timestamp.Sub(now) > v.Tolerance {
+		return ErrInvalidTimestamp
+	}
+	content := signedContent(id, timestamp, payload)
+	for _, versionedSignature := range strings.Fields(signatureHeader) {
+		version, encoded, ok := strings.Cut(versionedSignature, ",")
+		if !ok {
+			continue
+		}
+		signature, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		switch version {
+		case signatureVersionHMAC:
+			for _, secret := range v.secrets {
+				if hmac.Equal(signHMAC(secret, content), signature) {
+					return nil
+				}
+			}
+		case signatureVersionEd25519:
+			for _, publicKey := range v.publicKeys {
+				if ed25519.Verify(publicKey, content, signature) {
+					return nil
+				}
+			}
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+// VerifyRSA verifies a request of a webhook using the RSA signing mode, the
+// public key is the base64 encoded PEM key returned by the webhook API. The
+// RFC 3339 timestamp must be within DefaultTolerance of the current time
+func VerifyRSA(publicKey string, payload []byte, headers http.Header) error {
+	return verifyRSA(publicKey, payload, headers, time.Now())
+}
+
+func verifyRSA(publicKey string, payload []byte, headers http.Header, now time.Time) error {
+	id := headers.Get(HeaderRSAId)
+	timestamp := headers.Get(HeaderRSATimestamp)
+	signatureHeader := headers.Get(HeaderRSASignature)
+	if id == "" || timestamp == "" || signatureHeader == "" {
+		return ErrMissingHeaders
+	}
+	signedAt, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	if now.Sub(signedAt) > DefaultTolerance || signedAt.Sub(now) > DefaultTolerance {
+		return ErrInvalidTimestamp
+	}
+	keyBytes, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return ErrInvalidSecret
+	}
+	block, _ := pem.Decode(keyBytes)
+	if block == nil {
+		return ErrInvalidSecret
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return ErrInvalidSecret
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return ErrInvalidSecret
+	}
+	signature, err := base64.StdEncoding.DecodeString(signatureHeader)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	hash := sha256.Sum256([]byte(id + timestamp + string(payload)))
+	err = rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, hash[:], signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func signedContent(id string, timestamp time.Time, payload []byte) []byte {
+	return []byte(fmt.Sprintf("%s.%d.%s", id, timestamp.Unix(), payload))
+}
+
+func signHMAC(secret []byte, content []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(content)
+
+	return mac.Sum(nil)
+}
+
+// decode returns the key of an encoded secret, the size is not checked when
+// it is zero
+func decode(secret string, prefix string, size int) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, prefix))
+	if err != nil || len(key) == 0 || (size > 0 && len(key) != size) {
+		return nil, ErrInvalidSecret
+	}
+
+	return key, nil
+}
@@ -0,0 +1,253 @@
+package webhook
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifier(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	payload := []byte(`{"type":"email.sent"}`)
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldSecret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, publicKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(secret string, timestamp time.Time, payload []byte) string {
+		signature, err := Sign(secret, "msg_1", timestamp, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signature
+	}
+	headers := func(timestamp string, signature string) http.Header {
+		return http.Header{
+			http.CanonicalHeaderKey(HeaderId):        {"msg_1"},
+			http.CanonicalHeaderKey(HeaderTimestamp): {timestamp},
+			http.CanonicalHeaderKey(HeaderSignature): {signature},
+		}
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	tests := []struct {
+		name    string
+		secrets []string
+		headers http.Header
+		err     error
+	}{
+		{
+			name:    "hmac",
+			secrets: []string{secret},
+			headers: headers(timestamp, sign(secret, now, payload)),
+		},
+		{
+			name:    "ed25519",
+			secrets: []string{publicKey},
+			headers: headers(timestamp, sign(privateKey, now, payload)),
+		},
+		{
+			name:    "rotated secret",
+			secrets: []string{oldSecret, secret},
+			headers: headers(timestamp, sign(oldSecret, now, payload)+" "+sign(secret, now, payload)),
+		},
+		{
+			name:    "one of several signatures",
+			secrets: []string{secret},
+			headers: headers(timestamp, "v1,bm9wZQ== "+sign(secret, now, payload)),
+		},
+		{
+			name:    "other secret",
+			secrets: []string{oldSecret},
+			headers: headers(timestamp, sign(secret, now, payload)),
+			err:     ErrInvalidSignature,
+		},
+		{
+			name:    "tampered payload",
+			secrets: []string{secret},
+			headers: headers(timestamp, sign(secret, now, []byte(`{}`))),
+			err:     ErrInvalidSignature,
+		},
+		{
+			name:    "hmac signature with an ed25519 key",
+			secrets: []string{publicKey},
+			headers: headers(timestamp, sign(secret, now, payload)),
+			err:     ErrInvalidSignature,
+		},
+		{
+			name:    "expired timestamp",
+			secrets: []string{secret},
+			headers: headers(
+				strconv.FormatInt(now.Add(-DefaultTolerance-time.Second).Unix(), 10),
+				sign(secret, now.Add(-DefaultTolerance-time.Second), payload),
+			),
+			err: ErrInvalidTimestamp,
+		},
+		{
+			name:    "future timestamp",
+			secrets: []string{secret},
+			headers: headers(
+				strconv.FormatInt(now.Add(DefaultTolerance+time.Second).Unix(), 10),
+				sign(secret, now.Add(DefaultTolerance+time.Second), payload),
+			),
+			err: ErrInvalidTimestamp,
+		},
+		{
+			name:    "invalid timestamp",
+			secrets: []string{secret},
+			headers: headers("yesterday", sign(secret, now, payload)),
+			err:     ErrInvalidTimestamp,
+		},
+		{
+			name:    "missing headers",
+			secrets: []string{secret},
+			headers: http.Header{},
+			err:     ErrMissingHeaders,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verifier, err := NewVerifier(test.secrets...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifier.now = func() time.Time { return now }
+			err = verifier.Verify(payload, test.headers)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestNewVerifierRejectsInvalidSecrets(t *testing.T) {
+	privateKey, _, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secrets := range [][]string{
+		nil,
+		{"secret"},
+		{SecretPrefix + "not base64"},
+		{PublicKeyPrefix + base64.StdEncoding.EncodeToString([]byte("short"))},
+		{privateKey},
+	} {
+		_, err := NewVerifier(secrets...)
+		if !errors.Is(err, ErrInvalidSecret) {
+			t.Fatalf("expected %v for %v, got %v", ErrInvalidSecret, secrets, err)
+		}
+	}
+}
+
+func TestVerifyRSA(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	payload := []byte(`{"type":"email.sent"}`)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodePublicKey := func(key *rsa.PrivateKey) string {
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+		return base64.StdEncoding.EncodeToString(block)
+	}
+	headers := func(key *rsa.PrivateKey, timestamp string, payload []byte) http.Header {
+		hash := sha256.Sum256([]byte("webhook_1" + timestamp + string(payload)))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return http.Header{
+			HeaderRSAId:        {"webhook_1"},
+			HeaderRSATimestamp: {timestamp},
+			HeaderRSASignature: {base64.StdEncoding.EncodeToString(signature)},
+		}
+	}
+	timestamp := now.Format(time.RFC3339)
+
+	tests := []struct {
+		name      string
+		publicKey string
+		headers   http.Header
+		err       error
+	}{
+		{
+			name:      "valid",
+			publicKey: encodePublicKey(key),
+			headers:   headers(key, timestamp, payload),
+		},
+		{
+			name:      "other key",
+			publicKey: encodePublicKey(otherKey),
+			headers:   headers(key, timestamp, payload),
+			err:       ErrInvalidSignature,
+		},
+		{
+			name:      "tampered payload",
+			publicKey: encodePublicKey(key),
+			headers:   headers(key, timestamp, []byte(`{}`)),
+			err:       ErrInvalidSignature,
+		},
+		{
+			name:      "expired timestamp",
+			publicKey: encodePublicKey(key),
+			headers:   headers(key, now.Add(-DefaultTolerance-time.Second).Format(time.RFC3339), payload),
+			err:       ErrInvalidTimestamp,
+		},
+		{
+			name:      "future timestamp",
+			publicKey: encodePublicKey(key),
+			headers:   headers(key, now.Add(DefaultTolerance+time.Second).Format(time.RFC3339), payload),
+			err:       ErrInvalidTimestamp,
+		},
+		{
+			name:      "invalid timestamp",
+			publicKey: encodePublicKey(key),
+			headers:   headers(key, strconv.FormatInt(now.Unix(), 10), payload),
+			err:       ErrInvalidTimestamp,
+		},
+		{
+			name:      "invalid public key",
+			publicKey: base64.StdEncoding.EncodeToString([]byte("key")),
+			headers:   headers(key, timestamp, payload),
+			err:       ErrInvalidSecret,
+		},
+		{
+			name:      "missing headers",
+			publicKey: encodePublicKey(key),
+			headers:   http.Header{},
+			err:       ErrMissingHeaders,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := verifyRSA(test.publicKey, payload, test.headers, now)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}